@@ -49,6 +49,10 @@ func normalizeZone(str string) (zoneAddr, error) {
 			port = transport.GRPCPort
 		case transport.HTTPS:
 			port = transport.HTTPSPort
+		case transport.HTTP:
+			port = transport.HTTPPort
+		case transport.QUIC:
+			port = transport.QUICPort
 		}
 	}
 
@@ -103,3 +107,23 @@ func (zo *zoneOverlap) registerAndCheck(z zoneAddr) (existingZone *zoneAddr, ove
 	zo.unboundOverlap[uz] = z
 	return nil, nil
 }
+
+// check checks if z overlaps with an already registered zoneAddr, without registering z itself.
+// An exact match with a registered zoneAddr is not considered an overlap.
+func (zo *zoneOverlap) check(z zoneAddr) *zoneAddr {
+	uz := zoneAddr{Zone: z.Zone, Address: "", Port: z.Port, Transport: z.Transport}
+	if z.Address != "" {
+		if _, ok := zo.registeredAddr[uz]; ok {
+			// z is bound to an address, but the same zone+port is registered without one
+			return &uz
+		}
+		return nil
+	}
+	for _, r := range zo.registeredAddr {
+		if r.Address != "" && r.Zone == z.Zone && r.Port == z.Port && r.Transport == z.Transport {
+			// z is not bound to an address, but the same zone+port is registered with one
+			return &r
+		}
+	}
+	return nil
+}
@@ -20,12 +20,16 @@ func TestNormalizeZone(t *testing.T) {
 		{"tls://.:8953", "tls://.:8953", false},
 		{"tls://..", "://:", true},
 		{"tls://.:", "://:", true},
+		{"quic://.", "quic://.:853", false},
+		{"quic://.:8853", "quic://.:8853", false},
 		{"grpc://.", "grpc://.:443", false},
 		{"grpc://.:8443", "grpc://.:8443", false},
 		{"grpc://..", "://:", true},
 		{"grpc://.:", "://:", true},
 		{"https://.", "https://.:443", false},
 		{"https://.:8443", "https://.:8443", false},
+		{"http://.", "http://.:80", false},
+		{"http://.:8080", "http://.:8080", false},
 		{"https://..", "://:", true},
 		{"https://.:", "://:", true},
 	} {
@@ -1,10 +1,15 @@
 package dnsserver
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+	"github.com/coredns/coredns/request"
 
 	"github.com/mholt/caddy"
 )
@@ -32,14 +37,49 @@ type Config struct {
 	// DNS-over-TLS or DNS-over-gRPC.
 	Transport string
 
-	// If this function is not nil it will be used to further filter access
-	// to this handler. The primary use is to limit access to a reverse zone
-	// on a non-octet boundary, i.e. /17
-	FilterFunc func(string) bool
+	// FilterFuncs is used to further filter access to this handler. All of them
+	// must return true for the handler to be used. Uses are limiting access to a
+	// reverse zone on a non-octet boundary, i.e. /17, and selecting a view.
+	FilterFuncs []FilterFunc
+
+	// ViewName is the name of the view this config belongs to, if any. Multiple configs
+	// for the same zone and address may exist as long as they are views.
+	ViewName string
 
 	// TLSConfig when listening for encrypted connections (gRPC, DNS-over-TLS).
 	TLSConfig *tls.Config
 
+	// ProxyProtocolTrusted are the networks we accept PROXY protocol headers from, the address of
+	// the client is then taken from the header.
+	ProxyProtocolTrusted []*net.IPNet
+
+	// TCPIdleTimeout is how long an idle TCP or TLS connection is kept open. If zero, the default
+	// of 8 seconds is used.
+	TCPIdleTimeout time.Duration
+
+	// TCPMaxQueries is the number of queries served on a TCP or TLS connection before it is closed,
+	// -1 for no limit. If zero, the default of 128 is used.
+	TCPMaxQueries int
+
+	// TCPMaxPipeline is the number of queries on a TCP or TLS connection that are handled
+	// concurrently. If zero, the default of 64 is used.
+	TCPMaxPipeline int
+
+	// TsigKeys are the TSIG keys declared in this server block, keyed by name. Signed queries are
+	// verified by the server, plugins decide whether a key is required.
+	TsigKeys tsig.Keys
+
+	// DoHPath is the URL path DNS-over-HTTPS queries are served on, if empty doh.Path is used.
+	DoHPath string
+
+	// DoHTrustedProxies are the networks of HTTP proxies whose DoHTrustedHeader is trusted to
+	// carry the address of the client.
+	DoHTrustedProxies []*net.IPNet
+
+	// DoHTrustedHeader is the header, Forwarded or X-Forwarded-For, trusted proxies report the
+	// client in. If empty X-Forwarded-For is used.
+	DoHTrustedHeader string
+
 	// Plugin stack.
 	Plugin []plugin.Plugin
 
@@ -52,6 +92,10 @@ type Config struct {
 	registry map[string]plugin.Handler
 }
 
+// FilterFunc is a function that filters requests for a Config, it returns true when
+// the config should handle the request.
+type FilterFunc func(context.Context, *request.Request) bool
+
 // keyForConfig build a key for identifying the configs during setup time
 func keyForConfig(blocIndex int, blocKeyIndex int) string {
 	return fmt.Sprintf("%d:%d", blocIndex, blocKeyIndex)
@@ -1,7 +1,10 @@
 package dnsserver
 
 import (
+	"crypto/tls"
 	"net"
+	"net/http"
+	"strings"
 
 	"github.com/coredns/coredns/plugin/pkg/nonwriter"
 )
@@ -14,6 +17,8 @@ type DoHWriter struct {
 	raddr net.Addr
 	// laddr is our address. This can be optionally set.
 	laddr net.Addr
+	// tls is the state of the TLS connection the request came in on. This can be optionally set.
+	tls *tls.ConnectionState
 }
 
 // RemoteAddr returns the remote address.
@@ -21,3 +26,86 @@ func (d *DoHWriter) RemoteAddr() net.Addr { return d.raddr }
 
 // LocalAddr returns the local address.
 func (d *DoHWriter) LocalAddr() net.Addr { return d.laddr }
+
+// TsigStatus implements the dns.ResponseWriter interface, TSIG isn't verified for DNS-over-HTTPS.
+func (d *DoHWriter) TsigStatus() error { return errTsigUnsupported }
+
+// ConnectionState returns the state of the TLS connection, it implements dns.ConnectionStater.
+func (d *DoHWriter) ConnectionState() *tls.ConnectionState { return d.tls }
+
+// forwardedFor returns the address of the client as reported in header of r, the Forwarded (RFC
+// 7239) or X-Forwarded-For header. It's only trusted if remote, the address the request came from,
+// is in trusted. The hops are then walked from the nearest proxy back to the client, the first
+// address that isn't a trusted proxy is the client. It returns nil if the client can't be determined.
+// The other header is ignored: the proxies don't necessarily remove it, so a client could forge it.
+func forwardedFor(r *http.Request, header string, remote net.IP, trusted []*net.IPNet) net.IP {
+	if !containsIP(trusted, remote) {
+		return nil
+	}
+
+	hops := forwardedHops(r, header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i] == nil {
+			// Obfuscated or unknown address, we can't go any further.
+			return nil
+		}
+		if !containsIP(trusted, hops[i]) {
+			return hops[i]
+		}
+	}
+	if len(hops) > 0 {
+		return hops[0]
+	}
+	return nil
+}
+
+// forwardedHops returns the addresses from the Forwarded or X-Forwarded-For header, as chosen by
+// header, the client comes first. Addresses that can't be parsed are returned as nil.
+func forwardedHops(r *http.Request, header string) []net.IP {
+	var hops []net.IP
+	if header == "Forwarded" {
+		for _, v := range r.Header["Forwarded"] {
+			for _, elem := range strings.Split(v, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					pair = strings.TrimSpace(pair)
+					if len(pair) < 4 || !strings.EqualFold(pair[:4], "for=") {
+						continue
+					}
+					hops = append(hops, parseHop(strings.Trim(pair[4:], `"`)))
+				}
+			}
+		}
+		return hops
+	}
+
+	for _, v := range r.Header["X-Forwarded-For"] {
+		for _, h := range strings.Split(v, ",") {
+			hops = append(hops, parseHop(strings.TrimSpace(h)))
+		}
+	}
+	return hops
+}
+
+// parseHop parses an address from a Forwarded or X-Forwarded-For header, that may have a port and
+// IPv6 addresses may be enclosed in brackets.
+func parseHop(s string) net.IP {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		return net.ParseIP(h)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
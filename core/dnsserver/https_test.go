@@ -0,0 +1,59 @@
+package dnsserver
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestForwardedFor(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		remote    string
+		header    string // the trusted header
+		forwarded string
+		xff       string
+		expected  string
+	}{
+		// Not from a trusted proxy, headers are ignored.
+		{"192.0.2.1", "X-Forwarded-For", "", "198.51.100.1", ""},
+		{"192.0.2.1", "Forwarded", "for=198.51.100.1", "", ""},
+		// From a trusted proxy.
+		{"10.0.0.1", "X-Forwarded-For", "", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1", "X-Forwarded-For", "", "198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"10.0.0.1", "X-Forwarded-For", "", "203.0.113.1, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"10.0.0.1", "X-Forwarded-For", "", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"10.0.0.1", "X-Forwarded-For", "", "blah", ""},
+		{"10.0.0.1", "X-Forwarded-For", "", "", ""},
+		{"10.0.0.1", "Forwarded", "for=198.51.100.1", "", "198.51.100.1"},
+		{"10.0.0.1", "Forwarded", `for="198.51.100.1:4711";proto=https, for=10.0.0.2`, "", "198.51.100.1"},
+		{"10.0.0.1", "Forwarded", `For="[2001:db8:cafe::17]:4711"`, "", "2001:db8:cafe::17"},
+		{"10.0.0.1", "Forwarded", `for="[2001:db8:cafe::17]"`, "", "2001:db8:cafe::17"},
+		{"10.0.0.1", "Forwarded", "for=unknown, for=10.0.0.2", "", ""},
+		// Only the trusted header is read: a proxy that sets X-Forwarded-For passes a forged Forwarded on.
+		{"10.0.0.1", "X-Forwarded-For", "for=203.0.113.66", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1", "X-Forwarded-For", "for=203.0.113.66", "", ""},
+		{"10.0.0.1", "Forwarded", "for=198.51.100.1", "203.0.113.66", "198.51.100.1"},
+		{"10.0.0.1", "Forwarded", "", "203.0.113.66", ""},
+	}
+
+	for i, tc := range tests {
+		r, _ := http.NewRequest(http.MethodGet, "http://example.org/dns-query", nil)
+		if tc.forwarded != "" {
+			r.Header.Set("Forwarded", tc.forwarded)
+		}
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		ip := forwardedFor(r, tc.header, net.ParseIP(tc.remote), trusted)
+		got := ""
+		if ip != nil {
+			got = ip.String()
+		}
+		if got != tc.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package dnsserver
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/coredns/coredns/plugin/pkg/proxyproto"
+
+	"github.com/miekg/dns"
+)
+
+// serveProxyPacket serves DNS over p, datagrams from trusted sources may start with a PROXY
+// protocol v2 header. dns.Server only serves a *net.UDPConn and takes the remote address from the
+// socket, so we read the datagrams ourselves.
+func (s *Server) serveProxyPacket(p net.PacketConn) error {
+	s.m.Lock()
+	s.proxyPacket = p
+	s.m.Unlock()
+
+	// buf is reused for every datagram, only the DNS payload is copied out of it.
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, addr, err := p.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return err
+		}
+
+		client, data := addr, buf[:n]
+		if proxyproto.Trusted(addr, s.proxyTrusted) {
+			src, payload, err := proxyproto.ReadPacket(data)
+			if err != nil {
+				continue
+			}
+			if src != nil {
+				client = toUDPAddr(src)
+			}
+			data = payload
+		}
+		data = append([]byte(nil), data...)
+
+		w := &proxyPacketWriter{conn: p, peer: addr, client: client, tsig: &tsigState{}}
+		m, formerr := unpackQuery(data)
+		if formerr != nil {
+			w.WriteMsg(formerr)
+			continue
+		}
+		if m == nil {
+			continue
+		}
+		w.tsig = newTsigState(s.tsigSecret, data, m)
+
+		go func() {
+			ctx := context.WithValue(context.Background(), Key{}, s)
+			s.ServeDNS(ctx, w, m)
+		}()
+	}
+}
+
+// toUDPAddr returns a as a *net.UDPAddr, so request.Proto still sees this is UDP.
+func toUDPAddr(a net.Addr) net.Addr {
+	if t, ok := a.(*net.TCPAddr); ok {
+		return &net.UDPAddr{IP: t.IP, Port: t.Port, Zone: t.Zone}
+	}
+	return a
+}
+
+// proxyPacketWriter is a dns.ResponseWriter that sends the reply to the peer we received the
+// query from, i.e. the proxy, but reports the client from the PROXY protocol header as the
+// remote address.
+type proxyPacketWriter struct {
+	conn   net.PacketConn
+	peer   net.Addr
+	client net.Addr
+	tsig   *tsigState
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *proxyPacketWriter) WriteMsg(m *dns.Msg) error {
+	buf, err := w.tsig.pack(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// Write implements the dns.ResponseWriter interface.
+func (w *proxyPacketWriter) Write(b []byte) (int, error) { return w.conn.WriteTo(b, w.peer) }
+
+// Close implements the dns.ResponseWriter interface.
+func (w *proxyPacketWriter) Close() error { return nil }
+
+// LocalAddr implements the dns.ResponseWriter interface.
+func (w *proxyPacketWriter) LocalAddr() net.Addr { return w.conn.LocalAddr() }
+
+// RemoteAddr implements the dns.ResponseWriter interface.
+func (w *proxyPacketWriter) RemoteAddr() net.Addr { return w.client }
+
+// TsigStatus implements the dns.ResponseWriter interface.
+func (w *proxyPacketWriter) TsigStatus() error { return w.tsig.status }
+
+// TsigTimersOnly implements the dns.ResponseWriter interface.
+func (w *proxyPacketWriter) TsigTimersOnly(b bool) { w.tsig.timersOnly = b }
+
+// Hijack implements the dns.ResponseWriter interface.
+func (w *proxyPacketWriter) Hijack() {}
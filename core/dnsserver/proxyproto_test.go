@@ -0,0 +1,102 @@
+package dnsserver
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// proxyV2Header returns a PROXY protocol v2 header for an IPv4 datagram from src to dst.
+func proxyV2Header(src, dst *net.UDPAddr) []byte {
+	h := []byte("\x0D\x0A\x0D\x0A\x00\x0D\x0A\x51\x55\x49\x54\x0A")
+	h = append(h, 0x21, 0x12) // v2 PROXY, AF_INET DGRAM
+	h = binary.BigEndian.AppendUint16(h, 12)
+	h = append(h, src.IP.To4()...)
+	h = append(h, dst.IP.To4()...)
+	h = binary.BigEndian.AppendUint16(h, uint16(src.Port))
+	return binary.BigEndian.AppendUint16(h, uint16(dst.Port))
+}
+
+func TestServeProxyProtocol(t *testing.T) {
+	c := testConfig("dns", ipPlugin{})
+	_, trusted, _ := net.ParseCIDR("127.0.0.0/8")
+	c.ProxyProtocolTrusted = []*net.IPNet{trusted}
+
+	s, err := NewServer("dns://127.0.0.1:0", []*Config{c})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	p, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	go s.Serve(l)
+	go s.ServePacket(p)
+	defer s.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+
+	// TCP with a v1 header.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Could not dial: %s", err)
+	}
+	conn.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 53\r\n"))
+	co := &dns.Conn{Conn: conn}
+	co.SetDeadline(time.Now().Add(2 * time.Second))
+	if err := co.WriteMsg(m); err != nil {
+		t.Fatalf("Could not write query: %s", err)
+	}
+	r, err := co.ReadMsg()
+	co.Close()
+	if err != nil {
+		t.Fatalf("Could not read reply: %s", err)
+	}
+	if ip := r.Answer[0].(*dns.A).A.String(); ip != "192.0.2.1" {
+		t.Errorf("Expected client 192.0.2.1 over TCP, got %s", ip)
+	}
+
+	// UDP with and without a v2 header.
+	tests := []struct {
+		header bool
+		ip     string
+	}{
+		{true, "192.0.2.3"},
+		{false, "127.0.0.1"},
+	}
+	for i, tc := range tests {
+		conn, err := net.Dial("udp", p.LocalAddr().String())
+		if err != nil {
+			t.Fatalf("Test %d: could not dial: %s", i, err)
+		}
+		buf, _ := m.Pack()
+		if tc.header {
+			src := &net.UDPAddr{IP: net.ParseIP(tc.ip), Port: 56324}
+			buf = append(proxyV2Header(src, p.LocalAddr().(*net.UDPAddr)), buf...)
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		conn.Write(buf)
+
+		reply := make([]byte, dns.MaxMsgSize)
+		n, err := conn.Read(reply)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("Test %d: could not read reply: %s", i, err)
+		}
+		r := new(dns.Msg)
+		if err := r.Unpack(reply[:n]); err != nil {
+			t.Fatalf("Test %d: could not unpack reply: %s", i, err)
+		}
+		if ip := r.Answer[0].(*dns.A).A.String(); ip != tc.ip {
+			t.Errorf("Test %d: expected client %s over UDP, got %s", i, tc.ip, ip)
+		}
+	}
+}
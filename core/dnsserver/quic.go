@@ -0,0 +1,58 @@
+package dnsserver
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DoQWriter is a dns.ResponseWriter that writes the reply to a single QUIC stream, as specified in
+// RFC 9250. Every query is sent on its own stream, so the stream is closed after the reply is written.
+type DoQWriter struct {
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	stream     quic.Stream
+	tls        *tls.ConnectionState
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *DoQWriter) WriteMsg(m *dns.Msg) error {
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// Write implements the dns.ResponseWriter interface.
+func (w *DoQWriter) Write(b []byte) (int, error) {
+	buf := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+	return w.stream.Write(buf)
+}
+
+// Close implements the dns.ResponseWriter interface, it closes the send direction of the stream.
+func (w *DoQWriter) Close() error { return w.stream.Close() }
+
+// LocalAddr implements the dns.ResponseWriter interface.
+func (w *DoQWriter) LocalAddr() net.Addr { return w.localAddr }
+
+// RemoteAddr implements the dns.ResponseWriter interface.
+func (w *DoQWriter) RemoteAddr() net.Addr { return w.remoteAddr }
+
+// TsigStatus implements the dns.ResponseWriter interface.
+func (w *DoQWriter) TsigStatus() error { return errTsigUnsupported }
+
+// TsigTimersOnly implements the dns.ResponseWriter interface.
+func (w *DoQWriter) TsigTimersOnly(bool) {}
+
+// Hijack implements the dns.ResponseWriter interface.
+func (w *DoQWriter) Hijack() {}
+
+// ConnectionState returns the state of the TLS connection, it implements dns.ConnectionStater.
+func (w *DoQWriter) ConnectionState() *tls.ConnectionState { return w.tls }
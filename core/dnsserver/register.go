@@ -1,16 +1,17 @@
 package dnsserver
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
-	"strings"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/request"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyfile"
@@ -79,14 +80,13 @@ func (h *dnsContext) InspectServerBlocks(sourceFile string, serverBlocks []caddy
 
 			ones, bits := za.IPNet.Mask.Size()
 			if (bits-ones)%8 != 0 { // only do this for non-octet boundaries
-				cfg.FilterFunc = func(s string) bool {
-					// TODO(miek): strings.ToLower! Slow and allocates new string.
-					addr := dnsutil.ExtractAddressFromReverse(strings.ToLower(s))
+				cfg.FilterFuncs = append(cfg.FilterFuncs, func(_ context.Context, state *request.Request) bool {
+					addr := dnsutil.ExtractAddressFromReverse(state.Name())
 					if addr == "" {
 						return true
 					}
 					return za.IPNet.Contains(net.ParseIP(addr))
-				}
+				})
 			}
 			h.saveConfig(keyConfig, cfg)
 		}
@@ -135,12 +135,19 @@ func (h *dnsContext) MakeServers() ([]caddy.Server, error) {
 			}
 			servers = append(servers, s)
 
-		case transport.HTTPS:
+		case transport.HTTPS, transport.HTTP:
 			s, err := NewServerHTTPS(addr, group)
 			if err != nil {
 				return nil, err
 			}
 			servers = append(servers, s)
+
+		case transport.QUIC:
+			s, err := NewServerQUIC(addr, group)
+			if err != nil {
+				return nil, err
+			}
+			servers = append(servers, s)
 		}
 
 	}
@@ -200,7 +207,14 @@ func (h *dnsContext) validateZonesAndListeningAddresses() error {
 		for _, h := range conf.ListenHosts {
 			// Validate the overlapping of ZoneAddr
 			akey := zoneAddr{Transport: conf.Transport, Zone: conf.Zone, Address: h, Port: conf.Port}
-			existZone, overlapZone := checker.registerAndCheck(akey)
+			var existZone, overlapZone *zoneAddr
+			if conf.ViewName != "" {
+				// Views may share their zone and address with other views, and with a single
+				// config that isn't a view; only check for overlap, don't register.
+				overlapZone = checker.check(akey)
+			} else {
+				existZone, overlapZone = checker.registerAndCheck(akey)
+			}
 			if existZone != nil {
 				return fmt.Errorf("cannot serve %s - it is already defined", akey.String())
 			}
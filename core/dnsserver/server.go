@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/coredns/coredns/plugin/metrics/vars"
 	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/proxyproto"
 	"github.com/coredns/coredns/plugin/pkg/rcode"
 	"github.com/coredns/coredns/plugin/pkg/trace"
 	"github.com/coredns/coredns/plugin/pkg/transport"
@@ -30,15 +32,25 @@ import (
 type Server struct {
 	Addr string // Address we listen on
 
-	server [2]*dns.Server // 0 is a net.Listener, 1 is a net.PacketConn (a *UDPConn) in our case.
-	m      sync.Mutex     // protects the servers
+	udp *dns.Server // serves a net.PacketConn (a *UDPConn) in our case
+	tcp *tcpServer  // serves a net.Listener, with pipelining
+	m   sync.Mutex  // protects the servers
 
-	zones        map[string]*Config // zones keyed by their address
-	dnsWg        sync.WaitGroup     // used to wait on outstanding connections
-	graceTimeout time.Duration      // the maximum duration of a graceful shutdown
-	trace        trace.Trace        // the trace plugin for the server
-	debug        bool               // disable recover()
-	classChaos   bool               // allow non-INET class queries
+	zones        map[string][]*Config // zones keyed by their address
+	dnsWg        sync.WaitGroup       // used to wait on outstanding connections
+	graceTimeout time.Duration        // the maximum duration of a graceful shutdown
+	trace        trace.Trace          // the trace plugin for the server
+	debug        bool                 // disable recover()
+	classChaos   bool                 // allow non-INET class queries
+
+	proxyTrusted []*net.IPNet   // sources we accept PROXY protocol headers from
+	proxyPacket  net.PacketConn // the packet conn when serving UDP with PROXY protocol support
+
+	tcpIdleTimeout time.Duration // idle timeout of TCP connections
+	tcpMaxQueries  int           // queries per TCP connection
+	tcpMaxPipeline int           // concurrently handled queries per TCP connection
+
+	tsigSecret map[string]string // secrets of the TSIG keys of all configs, keyed by key name
 }
 
 // NewServer returns a new CoreDNS server and compiles all plugins in to it. By default CH class
@@ -47,7 +59,7 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 
 	s := &Server{
 		Addr:         addr,
-		zones:        make(map[string]*Config),
+		zones:        make(map[string][]*Config),
 		graceTimeout: 5 * time.Second,
 	}
 
@@ -65,7 +77,29 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 			log.D = true
 		}
 		// set the config per zone
-		s.zones[site.Zone] = site
+		s.zones[site.Zone] = append(s.zones[site.Zone], site)
+		// all configs share the listener, so PROXY protocol trust is shared as well
+		s.proxyTrusted = append(s.proxyTrusted, site.ProxyProtocolTrusted...)
+		// and so are the TCP connection settings
+		if site.TCPIdleTimeout != 0 {
+			s.tcpIdleTimeout = site.TCPIdleTimeout
+		}
+		if site.TCPMaxQueries != 0 {
+			s.tcpMaxQueries = site.TCPMaxQueries
+		}
+		if site.TCPMaxPipeline != 0 {
+			s.tcpMaxPipeline = site.TCPMaxPipeline
+		}
+		// signed queries are verified before we know the zone, so the TSIG keys are shared too
+		for name, key := range site.TsigKeys {
+			if s.tsigSecret == nil {
+				s.tsigSecret = make(map[string]string)
+			}
+			if secret, ok := s.tsigSecret[name]; ok && secret != key.Secret {
+				return nil, fmt.Errorf("TSIG key %q is declared with different secrets for %s", name, addr)
+			}
+			s.tsigSecret[name] = key.Secret
+		}
 
 		// compile custom plugin for everything
 		var stack plugin.Handler
@@ -90,33 +124,47 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 		site.pluginChain = stack
 	}
 
+	// Configs with filters (views) are tried first, in the order they are defined. A config
+	// without filters for the same zone matches everything, so it must come last.
+	for _, z := range s.zones {
+		sort.SliceStable(z, func(i, j int) bool { return len(z[i].FilterFuncs) > 0 && len(z[j].FilterFuncs) == 0 })
+	}
+
 	return s, nil
 }
 
 // Serve starts the server with an existing listener. It blocks until the server stops.
 // This implements caddy.TCPServer interface.
 func (s *Server) Serve(l net.Listener) error {
+	if len(s.proxyTrusted) > 0 {
+		l = proxyproto.NewListener(l, s.proxyTrusted)
+	}
+
 	s.m.Lock()
-	s.server[tcp] = &dns.Server{Listener: l, Net: "tcp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+	s.tcp = newTCPServer(l, s, func(w dns.ResponseWriter, r *dns.Msg) {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		s.ServeDNS(ctx, w, r)
-	})}
+	})
 	s.m.Unlock()
 
-	return s.server[tcp].ActivateAndServe()
+	return s.tcp.serve()
 }
 
 // ServePacket starts the server with an existing packetconn. It blocks until the server stops.
 // This implements caddy.UDPServer interface.
 func (s *Server) ServePacket(p net.PacketConn) error {
+	if len(s.proxyTrusted) > 0 {
+		return s.serveProxyPacket(p)
+	}
+
 	s.m.Lock()
-	s.server[udp] = &dns.Server{PacketConn: p, Net: "udp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+	s.udp = &dns.Server{PacketConn: p, Net: "udp", MsgAcceptFunc: acceptMsg, TsigSecret: s.tsigSecret, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		s.ServeDNS(ctx, w, r)
 	})}
 	s.m.Unlock()
 
-	return s.server[udp].ActivateAndServe()
+	return s.udp.ActivateAndServe()
 }
 
 // Listen implements caddy.TCPServer interface.
@@ -170,11 +218,15 @@ func (s *Server) Stop() (err error) {
 
 	// Close the listener now; this stops the server without delay
 	s.m.Lock()
-	for _, s1 := range s.server {
-		// We might not have started and initialized the full set of servers
-		if s1 != nil {
-			err = s1.Shutdown()
-		}
+	// We might not have started and initialized the full set of servers
+	if s.udp != nil {
+		err = s.udp.Shutdown()
+	}
+	if s.tcp != nil {
+		err = s.tcp.shutdown()
+	}
+	if s.proxyPacket != nil {
+		err = s.proxyPacket.Close()
 	}
 	s.m.Unlock()
 	return
@@ -223,6 +275,17 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 	var dshandler *Config
 
+	// A signed query must carry a valid signature, the replies to it are signed as well.
+	if t := r.IsTsig(); t != nil && len(s.tsigSecret) > 0 {
+		if err := w.TsigStatus(); err != nil {
+			log.Debugf("TSIG of query from %s failed to verify: %s", w.RemoteAddr(), err)
+			m := writeTsigError(w, r)
+			vars.Report(s.Addr, request.Request{W: w, Req: r}, vars.Dropped, rcode.ToString(dns.RcodeNotAuth), m.Len(), time.Now())
+			return
+		}
+		w = &tsigWriter{ResponseWriter: w, key: t.Hdr.Name, algorithm: t.Algorithm}
+	}
+
 	// Wrap the response writer in a ScrubWriter so we automatically make the reply fit in the client's buffer.
 	w = request.NewScrubWriter(r, w)
 
@@ -236,31 +299,30 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 			}
 		}
 
-		if h, ok := s.zones[string(b[:l])]; ok {
-			if r.Question[0].Qtype != dns.TypeDS {
-				if h.FilterFunc == nil {
-					rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
-					if !plugin.ClientWrite(rcode) {
-						errorFunc(s.Addr, w, r, rcode)
-					}
-					return
+		if z, ok := s.zones[string(b[:l])]; ok {
+			for _, h := range z {
+				if h.pluginChain == nil { // zone defined, but has not got any plugins
+					continue
 				}
-				// FilterFunc is set, call it to see if we should use this handler.
-				// This is given to full query name.
-				if h.FilterFunc(q) {
+				// If FilterFuncs are set, call them to see if we should use this handler.
+				if !passAllFilterFuncs(ctx, h.FilterFuncs, &request.Request{Req: r, W: w}) {
+					continue
+				}
+				if r.Question[0].Qtype != dns.TypeDS {
 					rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
 					if !plugin.ClientWrite(rcode) {
 						errorFunc(s.Addr, w, r, rcode)
 					}
 					return
 				}
+				// The type is DS, keep the handler, but keep on searching as maybe we are serving
+				// the parent as well and the DS should be routed to it - this will probably *misroute* DS
+				// queries to a possibly grand parent, but there is no way for us to know at this point
+				// if there is an actually delegation from grandparent -> parent -> zone.
+				// In all fairness: direct DS queries should not be needed.
+				dshandler = h
+				break
 			}
-			// The type is DS, keep the handler, but keep on searching as maybe we are serving
-			// the parent as well and the DS should be routed to it - this will probably *misroute* DS
-			// queries to a possibly grand parent, but there is no way for us to know at this point
-			// if there is an actually delegation from grandparent -> parent -> zone.
-			// In all fairness: direct DS queries should not be needed.
-			dshandler = h
 		}
 		off, end = dns.NextLabel(q, off)
 		if end {
@@ -278,18 +340,36 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	}
 
 	// Wildcard match, if we have found nothing try the root zone as a last resort.
-	if h, ok := s.zones["."]; ok && h.pluginChain != nil {
-		rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
-		if !plugin.ClientWrite(rcode) {
-			errorFunc(s.Addr, w, r, rcode)
+	if z, ok := s.zones["."]; ok {
+		for _, h := range z {
+			if h.pluginChain == nil {
+				continue
+			}
+			if !passAllFilterFuncs(ctx, h.FilterFuncs, &request.Request{Req: r, W: w}) {
+				continue
+			}
+			rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
+			if !plugin.ClientWrite(rcode) {
+				errorFunc(s.Addr, w, r, rcode)
+			}
+			return
 		}
-		return
 	}
 
 	// Still here? Error out with REFUSED.
 	errorAndMetricsFunc(s.Addr, w, r, dns.RcodeRefused)
 }
 
+// passAllFilterFuncs returns true if all filter funcs return true for the request.
+func passAllFilterFuncs(ctx context.Context, filterFuncs []FilterFunc, req *request.Request) bool {
+	for _, ff := range filterFuncs {
+		if !ff(ctx, req) {
+			return false
+		}
+	}
+	return true
+}
+
 // OnStartupComplete lists the sites served by this server
 // and any relevant information, assuming Quiet is false.
 func (s *Server) OnStartupComplete() {
@@ -336,10 +416,18 @@ func errorAndMetricsFunc(server string, w dns.ResponseWriter, r *dns.Msg, rc int
 	w.WriteMsg(answer)
 }
 
-const (
-	tcp = 0
-	udp = 1
-)
+// acceptMsg is dns.DefaultMsgAcceptFunc, except that it also accepts dynamic updates (RFC 2136),
+// which have any number of records in their prerequisite and update sections.
+func acceptMsg(dh dns.Header) dns.MsgAcceptAction {
+	const qr = 1 << 15
+	if dh.Bits&qr == 0 && int(dh.Bits>>11)&0xF == dns.OpcodeUpdate {
+		if dh.Qdcount != 1 {
+			return dns.MsgReject
+		}
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
 
 // Key is the context key for the current server added to the context.
 type Key struct{}
@@ -34,9 +34,11 @@ func NewServergRPC(addr string, group []*Config) (*ServergRPC, error) {
 	// The *tls* plugin must make sure that multiple conflicting
 	// TLS configuration return an error: it can only be specified once.
 	var tlsConfig *tls.Config
-	for _, conf := range s.zones {
-		// Should we error if some configs *don't* have TLS?
-		tlsConfig = conf.TLSConfig
+	for _, z := range s.zones {
+		for _, conf := range z {
+			// Should we error if some configs *don't* have TLS?
+			tlsConfig = conf.TLSConfig
+		}
 	}
 
 	return &ServergRPC{Server: s, tlsConfig: tlsConfig}, nil
@@ -163,7 +165,7 @@ func (r *gRPCresponse) Write(b []byte) (int, error) {
 
 // These methods implement the dns.ResponseWriter interface from Go DNS.
 func (r *gRPCresponse) Close() error              { return nil }
-func (r *gRPCresponse) TsigStatus() error         { return nil }
+func (r *gRPCresponse) TsigStatus() error         { return errTsigUnsupported }
 func (r *gRPCresponse) TsigTimersOnly(b bool)     { return }
 func (r *gRPCresponse) Hijack()                   { return }
 func (r *gRPCresponse) LocalAddr() net.Addr       { return r.localAddr }
@@ -3,6 +3,7 @@ package dnsserver
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -11,34 +12,66 @@ import (
 
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/plugin/pkg/doh"
+	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
-// ServerHTTPS represents an instance of a DNS-over-HTTPS server.
+// ServerHTTPS represents an instance of a DNS-over-HTTPS server. When created for an http:// address
+// it serves DNS-over-HTTPS over cleartext HTTP/1.1 and HTTP/2 (h2c), for use behind a proxy that
+// terminates TLS.
 type ServerHTTPS struct {
 	*Server
 	httpsServer *http.Server
 	listenAddr  net.Addr
 	tlsConfig   *tls.Config
+	transport   string
+	path        string
+	trusted     []*net.IPNet
+	header      string // the header trusted proxies report the client in
 }
 
-// NewServerHTTPS returns a new CoreDNS GRPC server and compiles all plugins in to it.
+// NewServerHTTPS returns a new CoreDNS DNS-over-HTTPS server and compiles all plugins in to it.
 func NewServerHTTPS(addr string, group []*Config) (*ServerHTTPS, error) {
 	s, err := NewServer(addr, group)
 	if err != nil {
 		return nil, err
 	}
+	trans, _ := parse.Transport(addr)
+
 	// The *tls* plugin must make sure that multiple conflicting
 	// TLS configuration return an error: it can only be specified once.
 	var tlsConfig *tls.Config
-	for _, conf := range s.zones {
-		// Should we error if some configs *don't* have TLS?
-		tlsConfig = conf.TLSConfig
+	path := doh.Path
+	var trusted []*net.IPNet
+	header := "X-Forwarded-For"
+	for _, z := range s.zones {
+		for _, conf := range z {
+			// Should we error if some configs *don't* have TLS?
+			tlsConfig = conf.TLSConfig
+			if conf.DoHPath != "" {
+				path = conf.DoHPath
+			}
+			trusted = append(trusted, conf.DoHTrustedProxies...)
+			if conf.DoHTrustedHeader != "" {
+				header = conf.DoHTrustedHeader
+			}
+		}
+	}
+	if trans == transport.HTTP {
+		// Cleartext, TLS is terminated in front of us.
+		tlsConfig = nil
 	}
 
-	sh := &ServerHTTPS{Server: s, tlsConfig: tlsConfig, httpsServer: new(http.Server)}
+	sh := &ServerHTTPS{Server: s, tlsConfig: tlsConfig, transport: trans, path: path, trusted: trusted, header: header, httpsServer: new(http.Server)}
 	sh.httpsServer.Handler = sh
+	if trans == transport.HTTP {
+		sh.httpsServer.Handler = h2c.NewHandler(sh, &http2.Server{})
+	}
 
 	return sh, nil
 }
@@ -61,7 +94,7 @@ func (s *ServerHTTPS) ServePacket(p net.PacketConn) error { return nil }
 // Listen implements caddy.TCPServer interface.
 func (s *ServerHTTPS) Listen() (net.Listener, error) {
 
-	l, err := net.Listen("tcp", s.Addr[len(transport.HTTPS+"://"):])
+	l, err := net.Listen("tcp", s.Addr[len(s.transport+"://"):])
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +111,7 @@ func (s *ServerHTTPS) OnStartupComplete() {
 		return
 	}
 
-	out := startUpZones(transport.HTTPS+"://", s.Addr, s.zones)
+	out := startUpZones(s.transport+"://", s.Addr, s.zones)
 	if out != "" {
 		fmt.Print(out)
 	}
@@ -99,13 +132,27 @@ func (s *ServerHTTPS) Stop() error {
 // chain, converts it back and write it to the client.
 func (s *ServerHTTPS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	if r.URL.Path != doh.Path {
+	if r.URL.Path != s.path {
 		http.Error(w, "", http.StatusNotFound)
 		return
 	}
 
-	msg, err := doh.RequestToMsg(r)
+	isJSON := doh.IsJSONRequest(r)
+
+	var (
+		msg *dns.Msg
+		err error
+	)
+	if isJSON {
+		msg, err = doh.JSONRequestToMsg(r)
+	} else {
+		msg, err = doh.RequestToMsg(r)
+	}
 	if err != nil {
+		if isJSON {
+			writeJSON(w, http.StatusBadRequest, &doh.Response{Status: dns.RcodeFormatError, Comment: err.Error()}, 0)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -113,7 +160,12 @@ func (s *ServerHTTPS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Create a DoHWriter with the correct addresses in it.
 	h, p, _ := net.SplitHostPort(r.RemoteAddr)
 	port, _ := strconv.Atoi(p)
-	dw := &DoHWriter{laddr: s.listenAddr, raddr: &net.TCPAddr{IP: net.ParseIP(h), Port: port}}
+	ip := net.ParseIP(h)
+	if client := forwardedFor(r, s.header, ip, s.trusted); client != nil {
+		// The port of the client is not known.
+		ip, port = client, 0
+	}
+	dw := &DoHWriter{laddr: s.listenAddr, raddr: &net.TCPAddr{IP: ip, Port: port}, tls: r.TLS}
 
 	// We just call the normal chain handler - all error handling is done there.
 	// We should expect a packet to be returned that we can send to the client.
@@ -127,11 +179,16 @@ func (s *ServerHTTPS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	buf, _ := dw.Msg.Pack()
-
 	mt, _ := response.Typify(dw.Msg, time.Now().UTC())
 	age := dnsutil.MinimalTTL(dw.Msg, mt)
 
+	if isJSON {
+		writeJSON(w, http.StatusOK, doh.MsgToJSON(dw.Msg), age)
+		return
+	}
+
+	buf, _ := dw.Msg.Pack()
+
 	w.Header().Set("Content-Type", doh.MimeType)
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%f", age.Seconds()))
 	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
@@ -140,6 +197,22 @@ func (s *ServerHTTPS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(buf)
 }
 
+// writeJSON writes the JSON API response r with status code.
+func writeJSON(w http.ResponseWriter, code int, r *doh.Response, age time.Duration) {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", doh.JSONMimeType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%f", age.Seconds()))
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.WriteHeader(code)
+
+	w.Write(buf)
+}
+
 // Shutdown stops the server (non gracefully).
 func (s *ServerHTTPS) Shutdown() error {
 	if s.httpsServer != nil {
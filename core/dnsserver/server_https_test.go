@@ -0,0 +1,191 @@
+package dnsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/doh"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/http2"
+)
+
+func testServerHTTPS(t *testing.T) *ServerHTTPS {
+	t.Helper()
+	s, err := NewServerHTTPS("127.0.0.1:443", []*Config{testConfig("https", rcodePlugin(dns.RcodeNameError))})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServerHTTPS, got %s", err)
+	}
+	return s
+}
+
+func TestServeHTTPWire(t *testing.T) {
+	s := testServerHTTPS(t)
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	req, _ := doh.NewRequest(http.MethodGet, "127.0.0.1:443", m)
+	req.RemoteAddr = "10.240.0.1:40212"
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != doh.MimeType {
+		t.Errorf("Expected content type %s, got %s", doh.MimeType, ct)
+	}
+	ret := new(dns.Msg)
+	if err := ret.Unpack(w.Body.Bytes()); err != nil {
+		t.Fatalf("Could not unpack reply: %s", err)
+	}
+	if ret.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeNameError, ret.Rcode)
+	}
+}
+
+func TestServeHTTPJSON(t *testing.T) {
+	s := testServerHTTPS(t)
+
+	tests := []struct {
+		url    string
+		code   int
+		status int
+	}{
+		{"https://127.0.0.1/dns-query?name=example.com&type=AAAA&cd=1", http.StatusOK, dns.RcodeNameError},
+		{"https://127.0.0.1/dns-query?name=example.com&type=BLAH", http.StatusBadRequest, dns.RcodeFormatError},
+	}
+
+	for i, tc := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tc.url, nil)
+		req.Header.Set("Accept", doh.JSONMimeType)
+		req.RemoteAddr = "10.240.0.1:40212"
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("Test %d: expected status %d, got %d", i, tc.code, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != doh.JSONMimeType {
+			t.Errorf("Test %d: expected content type %s, got %s", i, doh.JSONMimeType, ct)
+		}
+		r := new(doh.Response)
+		if err := json.Unmarshal(w.Body.Bytes(), r); err != nil {
+			t.Fatalf("Test %d: could not decode reply: %s", i, err)
+		}
+		if r.Status != tc.status {
+			t.Errorf("Test %d: expected status %d, got %d", i, tc.status, r.Status)
+		}
+		if tc.code != http.StatusOK {
+			if r.Comment == "" {
+				t.Errorf("Test %d: expected comment with the error", i)
+			}
+			continue
+		}
+		if len(r.Question) != 1 || r.Question[0].Name != "example.com." || r.Question[0].Type != dns.TypeAAAA {
+			t.Errorf("Test %d: unexpected question %+v", i, r.Question)
+		}
+		if !r.CD {
+			t.Errorf("Test %d: expected CD to be set", i)
+		}
+	}
+}
+
+// ipPlugin replies with an A record holding the address of the client.
+type ipPlugin struct{}
+
+func (ipPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: state.QName(), Rrtype: dns.TypeA, Class: dns.ClassINET}, A: net.ParseIP(state.IP())}}
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+func (ipPlugin) Name() string { return "ipplugin" }
+
+func TestServeHTTPCleartext(t *testing.T) {
+	c := testConfig("http", ipPlugin{})
+	c.DoHPath = "/resolve"
+	_, trusted, _ := net.ParseCIDR("127.0.0.0/8")
+	c.DoHTrustedProxies = []*net.IPNet{trusted}
+
+	s, err := NewServerHTTPS("http://127.0.0.1:0", []*Config{c})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServerHTTPS, got %s", err)
+	}
+	l, err := s.Listen()
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	go s.Serve(l)
+	defer s.Stop()
+
+	// HTTP/2 without TLS (h2c), with prior knowledge.
+	h2c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS:   func(network, addr string, _ *tls.Config) (net.Conn, error) { return net.Dial(network, addr) },
+	}}
+
+	tests := []struct {
+		client    *http.Client
+		path      string
+		xff       string
+		forwarded string
+		code      int
+		proto     int
+		ip        string
+	}{
+		{http.DefaultClient, "/resolve", "", "", http.StatusOK, 1, "127.0.0.1"},
+		{http.DefaultClient, "/resolve", "192.0.2.1", "", http.StatusOK, 1, "192.0.2.1"},
+		{h2c, "/resolve", "192.0.2.1", "", http.StatusOK, 2, "192.0.2.1"},
+		// A Forwarded header forged by the client is passed on by the proxy, and ignored.
+		{http.DefaultClient, "/resolve", "192.0.2.1", "for=203.0.113.66", http.StatusOK, 1, "192.0.2.1"},
+		{http.DefaultClient, doh.Path, "", "", http.StatusNotFound, 1, ""},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		req, _ := doh.NewRequest(http.MethodPost, l.Addr().String(), m)
+		req.URL.Scheme = "http"
+		req.URL.Path = tc.path
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.forwarded != "" {
+			req.Header.Set("Forwarded", tc.forwarded)
+		}
+
+		resp, err := tc.client.Do(req)
+		if err != nil {
+			t.Fatalf("Test %d: request failed: %s", i, err)
+		}
+		if resp.StatusCode != tc.code {
+			t.Errorf("Test %d: expected status %d, got %d", i, tc.code, resp.StatusCode)
+		}
+		if resp.ProtoMajor != tc.proto {
+			t.Errorf("Test %d: expected HTTP/%d, got %s", i, tc.proto, resp.Proto)
+		}
+		if tc.code != http.StatusOK {
+			resp.Body.Close()
+			continue
+		}
+		ret, err := doh.ResponseToMsg(resp)
+		if err != nil {
+			t.Fatalf("Test %d: could not read reply: %s", i, err)
+		}
+		if ip := ret.Answer[0].(*dns.A).A.String(); ip != tc.ip {
+			t.Errorf("Test %d: expected client %s, got %s", i, tc.ip, ip)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package dnsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// ServerQUIC represents an instance of a DNS-over-QUIC server, see RFC 9250.
+type ServerQUIC struct {
+	*Server
+	quicListener *quic.Listener
+	packetConn   net.PacketConn
+	tlsConfig    *tls.Config
+}
+
+// NewServerQUIC returns a new CoreDNS QUIC server and compiles all plugins in to it.
+func NewServerQUIC(addr string, group []*Config) (*ServerQUIC, error) {
+	s, err := NewServer(addr, group)
+	if err != nil {
+		return nil, err
+	}
+	// The *tls* plugin must make sure that multiple conflicting
+	// TLS configuration return an error: it can only be specified once.
+	var tlsConfig *tls.Config
+	for _, z := range s.zones {
+		for _, conf := range z {
+			// Should we error if some configs *don't* have TLS?
+			tlsConfig = conf.TLSConfig
+		}
+	}
+	if tlsConfig == nil {
+		return nil, fmt.Errorf("DNS-over-QUIC requires a TLS configuration for %s, use the tls plugin", addr)
+	}
+
+	// DoQ is identified by the "doq" ALPN token, see RFC 9250, Section 4.1.1.
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{doqALPN}
+
+	return &ServerQUIC{Server: s, tlsConfig: tlsConfig}, nil
+}
+
+// Serve implements caddy.TCPServer interface.
+func (s *ServerQUIC) Serve(l net.Listener) error { return nil }
+
+// ServePacket implements caddy.UDPServer interface.
+func (s *ServerQUIC) ServePacket(p net.PacketConn) error {
+	l, err := quic.Listen(p, s.tlsConfig, &quic.Config{MaxIdleTimeout: quicIdleTimeout})
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.quicListener = l
+	s.packetConn = p
+	s.m.Unlock()
+
+	for {
+		conn, err := l.Accept(context.Background())
+		if err != nil {
+			if errors.Is(err, quic.ErrServerClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveQUICConnection(conn)
+	}
+}
+
+// serveQUICConnection handles the streams of a single QUIC connection, every stream carries one query.
+func (s *ServerQUIC) serveQUICConnection(conn quic.Connection) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			conn.CloseWithError(doqNoError, "")
+			return
+		}
+		go s.serveQUICStream(conn, stream)
+	}
+}
+
+func (s *ServerQUIC) serveQUICStream(conn quic.Connection, stream quic.Stream) {
+	stream.SetReadDeadline(time.Now().Add(quicReadTimeout))
+
+	// Every message is prefixed with a 2 byte length field, RFC 9250, Section 4.2.
+	var l [2]byte
+	if _, err := io.ReadFull(stream, l[:]); err != nil {
+		stream.CancelRead(doqProtocolError)
+		stream.CancelWrite(doqProtocolError)
+		return
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		stream.CancelRead(doqProtocolError)
+		stream.CancelWrite(doqProtocolError)
+		return
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(buf); err != nil {
+		conn.CloseWithError(doqProtocolError, "malformed message")
+		return
+	}
+
+	state := conn.ConnectionState().TLS
+	w := &DoQWriter{
+		localAddr:  conn.LocalAddr(),
+		remoteAddr: streamAddr(conn.RemoteAddr()),
+		stream:     stream,
+		tls:        &state,
+	}
+
+	s.ServeDNS(context.Background(), w, msg)
+	w.Close()
+}
+
+// streamAddr returns a as a *net.TCPAddr, QUIC streams are reliable and have no size restrictions,
+// so plugins should treat DoQ queries like TCP queries; request.Proto keys off the address type.
+func streamAddr(a net.Addr) net.Addr {
+	if u, ok := a.(*net.UDPAddr); ok {
+		return &net.TCPAddr{IP: u.IP, Port: u.Port, Zone: u.Zone}
+	}
+	return a
+}
+
+// Listen implements caddy.TCPServer interface.
+func (s *ServerQUIC) Listen() (net.Listener, error) { return nil, nil }
+
+// ListenPacket implements caddy.UDPServer interface.
+func (s *ServerQUIC) ListenPacket() (net.PacketConn, error) {
+	p, err := net.ListenPacket("udp", s.Addr[len(transport.QUIC+"://"):])
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// OnStartupComplete lists the sites served by this server
+// and any relevant information, assuming Quiet is false.
+func (s *ServerQUIC) OnStartupComplete() {
+	if Quiet {
+		return
+	}
+
+	out := startUpZones(transport.QUIC+"://", s.Addr, s.zones)
+	if out != "" {
+		fmt.Print(out)
+	}
+	return
+}
+
+// Stop stops the server. It blocks until the server is totally stopped.
+func (s *ServerQUIC) Stop() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.quicListener != nil {
+		s.quicListener.Close()
+	}
+	// Closing the listener doesn't close the packet conn we handed to it, close it ourselves so
+	// nothing reads from it anymore after a reload.
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	return nil
+}
+
+const (
+	doqALPN = "doq"
+
+	// Error codes used when closing DoQ connections or streams, see RFC 9250, Section 4.3.
+	doqNoError       = 0x0
+	doqProtocolError = 0x2
+
+	quicIdleTimeout = 30 * time.Second
+	quicReadTimeout = 10 * time.Second
+)
@@ -0,0 +1,85 @@
+package dnsserver
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+func TestNewServerQUIC(t *testing.T) {
+	if _, err := NewServerQUIC("quic://127.0.0.1:0", []*Config{testConfig("quic", testPlugin{})}); err == nil {
+		t.Errorf("Expected error for NewServerQUIC without TLS config")
+	}
+}
+
+func TestServerQUIC(t *testing.T) {
+	serverTLS, clientTLS, err := test.TLSConfig()
+	if err != nil {
+		t.Fatalf("Could not create TLS config: %s", err)
+	}
+
+	c := testConfig("quic", rcodePlugin(dns.RcodeNameError))
+	c.TLSConfig = serverTLS
+	s, err := NewServerQUIC("quic://127.0.0.1:0", []*Config{c})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServerQUIC, got %s", err)
+	}
+	p, err := s.ListenPacket()
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	go s.ServePacket(p)
+	defer s.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clientTLS.NextProtos = []string{"doq"}
+	conn, err := quic.DialAddr(ctx, p.LocalAddr().String(), clientTLS, nil)
+	if err != nil {
+		t.Fatalf("Could not dial: %s", err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	// Send two queries on the same connection, each on its own stream.
+	for i := 0; i < 2; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		m.Id = 0
+
+		stream, err := conn.OpenStreamSync(ctx)
+		if err != nil {
+			t.Fatalf("Could not open stream: %s", err)
+		}
+		buf, _ := m.Pack()
+		l := make([]byte, 2)
+		binary.BigEndian.PutUint16(l, uint16(len(buf)))
+		stream.Write(append(l, buf...))
+		stream.Close()
+
+		reply, err := io.ReadAll(stream)
+		if err != nil {
+			t.Fatalf("Could not read reply: %s", err)
+		}
+		if len(reply) < 2 || int(binary.BigEndian.Uint16(reply)) != len(reply)-2 {
+			t.Fatalf("Expected length prefixed reply, got %d bytes", len(reply))
+		}
+		ret := new(dns.Msg)
+		if err := ret.Unpack(reply[2:]); err != nil {
+			t.Fatalf("Could not unpack reply: %s", err)
+		}
+		if ret.Rcode != dns.RcodeNameError {
+			t.Errorf("Expected rcode %d, got %d", dns.RcodeNameError, ret.Rcode)
+		}
+		if ret.Id != 0 {
+			t.Errorf("Expected message ID 0, got %d", ret.Id)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package dnsserver
 
 import (
 	"context"
+	"net"
 	"testing"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
 )
@@ -48,6 +51,63 @@ func TestNewServer(t *testing.T) {
 	}
 }
 
+// rcodePlugin replies with its rcode, so we can see which config handled a query.
+type rcodePlugin int
+
+func (rp rcodePlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetRcode(r, int(rp))
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+func (rp rcodePlugin) Name() string { return "rcodeplugin" }
+
+func TestServeDNSViews(t *testing.T) {
+	external := testConfig("dns", rcodePlugin(dns.RcodeNameError))
+
+	internal := testConfig("dns", rcodePlugin(dns.RcodeSuccess))
+	internal.ViewName = "internal"
+	internal.FilterFuncs = []FilterFunc{func(_ context.Context, state *request.Request) bool {
+		return state.IP() == "10.240.0.1"
+	}}
+
+	none := testConfig("dns", rcodePlugin(dns.RcodeRefused))
+	none.ViewName = "none"
+	none.FilterFuncs = []FilterFunc{func(_ context.Context, _ *request.Request) bool { return false }}
+
+	// The config without filters is listed first, but views must be tried before it.
+	s, err := NewServer("127.0.0.1:53", []*Config{external, none, internal})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err)
+	}
+
+	tests := []struct {
+		remote string
+		rcode  int
+	}{
+		{"10.240.0.1", dns.RcodeSuccess},
+		{"192.0.2.1", dns.RcodeNameError},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.com.", dns.TypeA)
+		rec := dnstest.NewRecorder(&remoteWriter{ResponseWriter: &test.ResponseWriter{}, ip: tc.remote})
+		s.ServeDNS(context.TODO(), rec, m)
+		if rec.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, rec.Rcode)
+		}
+	}
+}
+
+type remoteWriter struct {
+	dns.ResponseWriter
+	ip string
+}
+
+func (r *remoteWriter) RemoteAddr() net.Addr { return &net.UDPAddr{IP: net.ParseIP(r.ip), Port: 53} }
+
 func BenchmarkCoreServeDNS(b *testing.B) {
 	s, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", testPlugin{})})
 	if err != nil {
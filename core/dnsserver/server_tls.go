@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/coredns/coredns/plugin/pkg/proxyproto"
 	"github.com/coredns/coredns/plugin/pkg/transport"
 
 	"github.com/miekg/dns"
@@ -26,9 +27,11 @@ func NewServerTLS(addr string, group []*Config) (*ServerTLS, error) {
 	// The *tls* plugin must make sure that multiple conflicting
 	// TLS configuration return an error: it can only be specified once.
 	var tlsConfig *tls.Config
-	for _, conf := range s.zones {
-		// Should we error if some configs *don't* have TLS?
-		tlsConfig = conf.TLSConfig
+	for _, z := range s.zones {
+		for _, conf := range z {
+			// Should we error if some configs *don't* have TLS?
+			tlsConfig = conf.TLSConfig
+		}
 	}
 
 	return &ServerTLS{Server: s, tlsConfig: tlsConfig}, nil
@@ -38,18 +41,22 @@ func NewServerTLS(addr string, group []*Config) (*ServerTLS, error) {
 func (s *ServerTLS) Serve(l net.Listener) error {
 	s.m.Lock()
 
+	// The PROXY protocol header comes before the TLS handshake.
+	if len(s.proxyTrusted) > 0 {
+		l = proxyproto.NewListener(l, s.proxyTrusted)
+	}
 	if s.tlsConfig != nil {
 		l = tls.NewListener(l, s.tlsConfig)
 	}
 
 	// Only fill out the TCP server for this one.
-	s.server[tcp] = &dns.Server{Listener: l, Net: "tcp-tls", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+	s.tcp = newTCPServer(l, s.Server, func(w dns.ResponseWriter, r *dns.Msg) {
 		ctx := context.Background()
 		s.ServeDNS(ctx, w, r)
-	})}
+	})
 	s.m.Unlock()
 
-	return s.server[tcp].ActivateAndServe()
+	return s.tcp.serve()
 }
 
 // ServePacket implements caddy.UDPServer interface.
@@ -0,0 +1,387 @@
+package dnsserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tcpServer serves DNS over the TCP (or TLS) connections accepted from a listener. Unlike
+// dns.Server, it handles queries pipelined on a connection concurrently and writes the replies as
+// soon as they are ready, possibly out of order (RFC 7766, Section 6.2.1.1).
+type tcpServer struct {
+	l       net.Listener
+	handler func(w dns.ResponseWriter, r *dns.Msg)
+
+	idleTimeout time.Duration // how long a connection may be idle before it's closed
+	maxQueries  int           // queries per connection, -1 for no limit
+	maxPipeline int           // queries per connection that are handled concurrently
+	tsigSecret  map[string]string
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func newTCPServer(l net.Listener, s *Server, handler func(w dns.ResponseWriter, r *dns.Msg)) *tcpServer {
+	t := &tcpServer{
+		l:           l,
+		handler:     handler,
+		idleTimeout: s.tcpIdleTimeout,
+		maxQueries:  s.tcpMaxQueries,
+		maxPipeline: s.tcpMaxPipeline,
+		tsigSecret:  s.tsigSecret,
+		conns:       make(map[net.Conn]struct{}),
+	}
+	if t.idleTimeout == 0 {
+		t.idleTimeout = tcpIdleTimeout
+	}
+	if t.maxQueries == 0 {
+		t.maxQueries = tcpMaxQueries
+	}
+	if t.maxPipeline == 0 {
+		t.maxPipeline = tcpMaxPipeline
+	}
+	return t
+}
+
+// serve accepts connections until the listener is closed.
+func (t *tcpServer) serve() error {
+	for {
+		c, err := t.l.Accept()
+		if err != nil {
+			if t.isStopped() {
+				return nil
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return err
+		}
+
+		t.mu.Lock()
+		if t.stopped {
+			t.mu.Unlock()
+			c.Close()
+			return nil
+		}
+		t.conns[c] = struct{}{}
+		t.wg.Add(1)
+		t.mu.Unlock()
+
+		go t.serveConn(c)
+	}
+}
+
+// serveConn reads the queries from c and hands each of them to the handler in its own goroutine.
+// The connection is closed when the client closes it, when it has been idle for too long, or when
+// the query limit is reached, after all outstanding queries are answered.
+func (t *tcpServer) serveConn(c net.Conn) {
+	conn := &tcpConn{Conn: c, idleTimeout: t.idleTimeout}
+	r := bufio.NewReader(c)
+
+	var (
+		inflight sync.WaitGroup
+		pending  int32
+		sem      = make(chan struct{}, t.maxPipeline)
+	)
+
+	timeout := tcpReadTimeout // the first query must arrive quickly, after that the idle timeout applies
+	for q := 0; t.maxQueries == -1 || q < t.maxQueries; {
+		if !t.setReadDeadline(c, timeout) {
+			break
+		}
+		// Peek doesn't consume anything, so after a timeout the stream is still intact. We're not
+		// idle while replies are outstanding, in that case keep waiting for the next query.
+		if _, err := r.Peek(2); err != nil {
+			if isTimeout(err) && atomic.LoadInt32(&pending) > 0 {
+				continue
+			}
+			break
+		}
+		buf, err := readTCPMsg(r)
+		if err != nil {
+			break
+		}
+		q++
+		timeout = t.idleTimeout
+
+		m, formerr := unpackQuery(buf)
+		if formerr != nil {
+			conn.writeMsg(formerr)
+			continue
+		}
+		if m == nil {
+			continue
+		}
+
+		sem <- struct{}{}
+		inflight.Add(1)
+		atomic.AddInt32(&pending, 1)
+		go func() {
+			defer func() {
+				atomic.AddInt32(&pending, -1)
+				inflight.Done()
+				<-sem
+			}()
+			t.handler(&tcpWriter{conn: conn, req: m, tsig: newTsigState(t.tsigSecret, buf, m)}, m)
+		}()
+	}
+
+	inflight.Wait()
+	if !conn.isHijacked() {
+		c.Close()
+	}
+
+	t.mu.Lock()
+	delete(t.conns, c)
+	t.mu.Unlock()
+	t.wg.Done()
+}
+
+// setReadDeadline sets the read deadline of c, unless we're shutting down; shutdown sets a deadline
+// in the past to unblock the readers, which must not be overwritten.
+func (t *tcpServer) setReadDeadline(c net.Conn, timeout time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return false
+	}
+	c.SetReadDeadline(time.Now().Add(timeout))
+	return true
+}
+
+func (t *tcpServer) isStopped() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stopped
+}
+
+// shutdown closes the listener and stops reading from the open connections. It waits until the
+// outstanding queries are answered.
+func (t *tcpServer) shutdown() error {
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return nil
+	}
+	t.stopped = true
+	err := t.l.Close()
+	for c := range t.conns {
+		c.SetReadDeadline(aLongTimeAgo)
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+	return err
+}
+
+// tcpConn serializes the writes of concurrently handled queries to a connection.
+type tcpConn struct {
+	net.Conn
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	hijacked bool
+}
+
+// write writes the message in b, prefixed with its length.
+func (c *tcpConn) write(b []byte) (int, error) {
+	if len(b) > dns.MaxMsgSize {
+		return 0, errors.New("message too large")
+	}
+	buf := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+	n, err := c.Conn.Write(buf)
+	if n >= 2 {
+		n -= 2
+	}
+	return n, err
+}
+
+func (c *tcpConn) writeMsg(m *dns.Msg) error {
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = c.write(buf)
+	return err
+}
+
+func (c *tcpConn) hijack() {
+	c.mu.Lock()
+	c.hijacked = true
+	c.mu.Unlock()
+}
+
+func (c *tcpConn) isHijacked() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hijacked
+}
+
+// tcpWriter is the dns.ResponseWriter for a single query on a TCP or TLS connection.
+type tcpWriter struct {
+	conn *tcpConn
+	req  *dns.Msg
+	tsig *tsigState
+}
+
+// WriteMsg implements the dns.ResponseWriter interface. If the query carried the edns-tcp-keepalive
+// option, the reply carries it too, with our idle timeout (RFC 7828).
+func (w *tcpWriter) WriteMsg(m *dns.Msg) error {
+	setKeepalive(m, w.req, w.conn.idleTimeout)
+	buf, err := w.tsig.pack(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// Write implements the dns.ResponseWriter interface.
+func (w *tcpWriter) Write(b []byte) (int, error) { return w.conn.write(b) }
+
+// Close implements the dns.ResponseWriter interface.
+func (w *tcpWriter) Close() error { return w.conn.Close() }
+
+// LocalAddr implements the dns.ResponseWriter interface.
+func (w *tcpWriter) LocalAddr() net.Addr { return w.conn.LocalAddr() }
+
+// RemoteAddr implements the dns.ResponseWriter interface.
+func (w *tcpWriter) RemoteAddr() net.Addr { return w.conn.RemoteAddr() }
+
+// TsigStatus implements the dns.ResponseWriter interface.
+func (w *tcpWriter) TsigStatus() error { return w.tsig.status }
+
+// TsigTimersOnly implements the dns.ResponseWriter interface.
+func (w *tcpWriter) TsigTimersOnly(b bool) { w.tsig.timersOnly = b }
+
+// Hijack implements the dns.ResponseWriter interface. The connection is then not closed by the
+// server, the handler (or the client) must close it.
+func (w *tcpWriter) Hijack() { w.conn.hijack() }
+
+// ConnectionState returns the state of the TLS connection, it implements dns.ConnectionStater.
+// It returns nil for plain TCP connections.
+func (w *tcpWriter) ConnectionState() *tls.ConnectionState {
+	if c, ok := w.conn.Conn.(*tls.Conn); ok {
+		state := c.ConnectionState()
+		return &state
+	}
+	return nil
+}
+
+// setKeepalive sets the edns-tcp-keepalive option in the reply m when the query r has it, and
+// removes it otherwise. The timeout is in units of 100 milliseconds.
+func setKeepalive(m, r *dns.Msg, idle time.Duration) {
+	mo := m.IsEdns0()
+	if mo != nil {
+		for i := 0; i < len(mo.Option); i++ {
+			if mo.Option[i].Option() == dns.EDNS0TCPKEEPALIVE {
+				mo.Option = append(mo.Option[:i], mo.Option[i+1:]...)
+				i--
+			}
+		}
+	}
+	if mo == nil || !hasKeepalive(r) {
+		return
+	}
+
+	timeout := idle / (100 * time.Millisecond)
+	if timeout > 0xFFFF {
+		timeout = 0xFFFF
+	}
+	// dns.EDNS0_TCP_KEEPALIVE packs its code and length twice, so build the option by hand.
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, uint16(timeout))
+	mo.Option = append(mo.Option, &dns.EDNS0_LOCAL{Code: dns.EDNS0TCPKEEPALIVE, Data: data})
+}
+
+func hasKeepalive(r *dns.Msg) bool {
+	o := r.IsEdns0()
+	if o == nil {
+		return false
+	}
+	for _, e := range o.Option {
+		if e.Option() == dns.EDNS0TCPKEEPALIVE {
+			return true
+		}
+	}
+	return false
+}
+
+// readTCPMsg reads a length prefixed message from r.
+func readTCPMsg(r *bufio.Reader) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// unpackQuery unpacks the query in buf, applying the same checks as dns.Server does with
+// acceptMsg. If the query is rejected, a FORMERR reply is returned instead. Both are nil if the
+// message must be ignored.
+func unpackQuery(buf []byte) (q, formerr *dns.Msg) {
+	if len(buf) < 12 {
+		return nil, nil
+	}
+	dh := dns.Header{
+		Id:      binary.BigEndian.Uint16(buf[0:]),
+		Bits:    binary.BigEndian.Uint16(buf[2:]),
+		Qdcount: binary.BigEndian.Uint16(buf[4:]),
+		Ancount: binary.BigEndian.Uint16(buf[6:]),
+		Nscount: binary.BigEndian.Uint16(buf[8:]),
+		Arcount: binary.BigEndian.Uint16(buf[10:]),
+	}
+
+	switch acceptMsg(dh) {
+	case dns.MsgIgnore:
+		return nil, nil
+	case dns.MsgAccept:
+		q = new(dns.Msg)
+		if q.Unpack(buf) == nil {
+			return q, nil
+		}
+	}
+
+	formerr = new(dns.Msg)
+	formerr.Id = dh.Id
+	formerr.Opcode = int(dh.Bits>>11) & 0xF
+	formerr.SetRcodeFormatError(formerr)
+	return nil, formerr
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// aLongTimeAgo is a non-zero time, far in the past, used to unblock reads.
+var aLongTimeAgo = time.Unix(1, 0)
+
+const (
+	tcpReadTimeout  = 2 * time.Second // timeout for the first query on a connection
+	tcpWriteTimeout = 2 * time.Second
+	tcpIdleTimeout  = 8 * time.Second // RFC 7766, Section 6.2.3
+	tcpMaxQueries   = 128
+	tcpMaxPipeline  = 64
+)
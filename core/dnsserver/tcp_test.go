@@ -0,0 +1,218 @@
+package dnsserver
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+)
+
+// slowPlugin answers queries for names starting with "slow" after a delay.
+type slowPlugin struct{}
+
+func (slowPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if strings.HasPrefix(r.Question[0].Name, "slow") {
+		time.Sleep(200 * time.Millisecond)
+	}
+	m := new(dns.Msg)
+	m.SetReply(r)
+	if o := r.IsEdns0(); o != nil {
+		m.SetEdns0(o.UDPSize(), false)
+	}
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+func (slowPlugin) Name() string { return "slowplugin" }
+
+func startTCPServer(t *testing.T, p plugin.Handler, setup func(*Config)) (*Server, string) {
+	c := testConfig("dns", p)
+	if setup != nil {
+		setup(c)
+	}
+	s, err := NewServer("dns://127.0.0.1:0", []*Config{c})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+func TestServeTCPPipelining(t *testing.T) {
+	s, addr := startTCPServer(t, slowPlugin{}, nil)
+	defer s.Stop()
+
+	co, err := dns.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Could not dial: %s", err)
+	}
+	defer co.Close()
+	co.SetDeadline(time.Now().Add(2 * time.Second))
+
+	for i, name := range []string{"slow.example.com.", "fast.example.com."} {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		m.Id = uint16(i + 1)
+		if err := co.WriteMsg(m); err != nil {
+			t.Fatalf("Could not write query: %s", err)
+		}
+	}
+
+	// The reply for the fast query must not wait for the slow one.
+	for _, name := range []string{"fast.example.com.", "slow.example.com."} {
+		r, err := co.ReadMsg()
+		if err != nil {
+			t.Fatalf("Could not read reply: %s", err)
+		}
+		if r.Question[0].Name != name {
+			t.Errorf("Expected reply for %s, got %s", name, r.Question[0].Name)
+		}
+	}
+}
+
+func TestServeTCPKeepalive(t *testing.T) {
+	s, addr := startTCPServer(t, slowPlugin{}, func(c *Config) { c.TCPIdleTimeout = 30 * time.Second })
+	defer s.Stop()
+
+	co, err := dns.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Could not dial: %s", err)
+	}
+	defer co.Close()
+	co.SetDeadline(time.Now().Add(2 * time.Second))
+
+	tests := []struct {
+		keepalive bool
+		timeout   uint16
+	}{
+		{true, 300},
+		{false, 0},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		m.SetEdns0(4096, false)
+		if tc.keepalive {
+			o := m.IsEdns0()
+			o.Option = append(o.Option, &dns.EDNS0_LOCAL{Code: dns.EDNS0TCPKEEPALIVE})
+		}
+		if err := co.WriteMsg(m); err != nil {
+			t.Fatalf("Test %d: could not write query: %s", i, err)
+		}
+		r, err := co.ReadMsg()
+		if err != nil {
+			t.Fatalf("Test %d: could not read reply: %s", i, err)
+		}
+
+		// The dns package doesn't unpack this option, it ends up as an EDNS0_LOCAL.
+		var keepalive *dns.EDNS0_LOCAL
+		if o := r.IsEdns0(); o != nil {
+			for _, e := range o.Option {
+				if l, ok := e.(*dns.EDNS0_LOCAL); ok && l.Code == dns.EDNS0TCPKEEPALIVE {
+					keepalive = l
+				}
+			}
+		}
+		if !tc.keepalive {
+			if keepalive != nil {
+				t.Errorf("Test %d: expected no edns-tcp-keepalive option, got %s", i, keepalive)
+			}
+			continue
+		}
+		if keepalive == nil {
+			t.Fatalf("Test %d: expected edns-tcp-keepalive option in reply", i)
+		}
+		if len(keepalive.Data) != 2 || binary.BigEndian.Uint16(keepalive.Data) != tc.timeout {
+			t.Errorf("Test %d: expected timeout %d, got %x", i, tc.timeout, keepalive.Data)
+		}
+	}
+}
+
+func TestServeTCPLimits(t *testing.T) {
+	tests := []struct {
+		setup   func(*Config)
+		queries int
+		wait    time.Duration
+	}{
+		{func(c *Config) { c.TCPMaxQueries = 2 }, 2, 0},
+		{func(c *Config) { c.TCPIdleTimeout = 100 * time.Millisecond }, 1, 300 * time.Millisecond},
+	}
+
+	for i, tc := range tests {
+		s, addr := startTCPServer(t, slowPlugin{}, tc.setup)
+
+		co, err := dns.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Test %d: could not dial: %s", i, err)
+		}
+		co.SetDeadline(time.Now().Add(2 * time.Second))
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		for j := 0; j < tc.queries; j++ {
+			if err := co.WriteMsg(m); err != nil {
+				t.Fatalf("Test %d: could not write query: %s", i, err)
+			}
+			if _, err := co.ReadMsg(); err != nil {
+				t.Fatalf("Test %d: could not read reply %d: %s", i, j, err)
+			}
+		}
+		time.Sleep(tc.wait)
+
+		// The server must have closed the connection.
+		co.WriteMsg(m)
+		if _, err := co.ReadMsg(); err == nil {
+			t.Errorf("Test %d: expected connection to be closed", i)
+		}
+		co.Close()
+		s.Stop()
+	}
+}
+
+func TestUnpackQuery(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	buf, _ := m.Pack()
+	if q, formerr := unpackQuery(buf); q == nil || formerr != nil {
+		t.Errorf("Expected query to be accepted")
+	}
+
+	m.Response = true
+	buf, _ = m.Pack()
+	if q, formerr := unpackQuery(buf); q != nil || formerr != nil {
+		t.Errorf("Expected response to be ignored")
+	}
+
+	m.Response = false
+	m.Question = append(m.Question, m.Question[0])
+	buf, _ = m.Pack()
+	q, formerr := unpackQuery(buf)
+	if q != nil || formerr == nil {
+		t.Fatalf("Expected query with two questions to be rejected")
+	}
+	if formerr.Rcode != dns.RcodeFormatError || formerr.Id != m.Id {
+		t.Errorf("Expected FORMERR reply with ID %d, got %s with ID %d", m.Id, dns.RcodeToString[formerr.Rcode], formerr.Id)
+	}
+}
+
+func TestUnpackUpdate(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	a1, _ := dns.NewRR("a.example.com. 3600 IN A 127.0.0.1")
+	a2, _ := dns.NewRR("b.example.com. 3600 IN A 127.0.0.2")
+	m.Insert([]dns.RR{a1, a2})
+	buf, _ := m.Pack()
+	if q, formerr := unpackQuery(buf); q == nil || formerr != nil {
+		t.Errorf("Expected update to be accepted")
+	}
+}
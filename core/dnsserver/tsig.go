@@ -0,0 +1,123 @@
+package dnsserver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
+	"github.com/miekg/dns"
+)
+
+// tsigState holds the outcome of verifying the TSIG of a query, and signs the replies to it. This
+// is what dns.Server does for the connections it serves itself.
+type tsigState struct {
+	secrets    map[string]string
+	status     error
+	requestMAC string
+	timersOnly bool
+}
+
+// newTsigState verifies the TSIG, if any, of the query m which was received as buf.
+func newTsigState(secrets map[string]string, buf []byte, m *dns.Msg) *tsigState {
+	t := &tsigState{secrets: secrets}
+	ts := m.IsTsig()
+	if ts == nil {
+		return t
+	}
+	t.requestMAC = ts.MAC
+	secret, ok := secrets[ts.Hdr.Name]
+	if !ok {
+		t.status = dns.ErrSecret
+		return t
+	}
+	t.status = dns.TsigVerify(buf, secret, "", false)
+	return t
+}
+
+// pack packs m, signing it when it has a TSIG record for one of our keys. Each message signed
+// is chained to the previous one, and only the first one covers all TSIG variables, as needed for
+// zone transfers (RFC 8945, Section 5.3.1).
+func (t *tsigState) pack(m *dns.Msg) ([]byte, error) {
+	ts := m.IsTsig()
+	if ts == nil {
+		return m.Pack()
+	}
+	secret, ok := t.secrets[ts.Hdr.Name]
+	if !ok {
+		return m.Pack()
+	}
+	buf, mac, err := dns.TsigGenerate(m, secret, t.requestMAC, t.timersOnly)
+	if err != nil {
+		return nil, err
+	}
+	t.requestMAC = mac
+	t.timersOnly = true
+	return buf, nil
+}
+
+// tsigWriter adds a TSIG record to the replies to a signed query, so that the transport signs them
+// with the key of the query (RFC 8945, Section 5.3).
+type tsigWriter struct {
+	dns.ResponseWriter
+	key       string
+	algorithm string
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *tsigWriter) WriteMsg(m *dns.Msg) error {
+	if m.IsTsig() == nil {
+		m.SetTsig(w.key, w.algorithm, tsig.Fudge, time.Now().Unix())
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// tsigError returns the reply to r, whose TSIG failed to verify with err: NOTAUTH, with a TSIG record
+// that carries the error and no MAC (RFC 8945, Section 5.2). For BADTIME the time of the server is
+// added as other data, so the client can tell how far off its clock is.
+func tsigError(r *dns.Msg, err error, now time.Time) *dns.Msg {
+	t := r.IsTsig()
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeNotAuth)
+	if opt := r.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+	e := &dns.TSIG{
+		Hdr:        dns.RR_Header{Name: t.Hdr.Name, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+		Algorithm:  t.Algorithm,
+		TimeSigned: t.TimeSigned,
+		Fudge:      t.Fudge,
+		OrigId:     t.OrigId,
+		Error:      dns.RcodeBadKey,
+	}
+	switch err {
+	case dns.ErrSig:
+		e.Error = dns.RcodeBadSig
+	case dns.ErrTime:
+		e.Error = dns.RcodeBadTime
+		e.OtherLen = 6
+		e.OtherData = fmt.Sprintf("%012x", now.Unix())
+	}
+	m.Extra = append(m.Extra, e)
+	return m
+}
+
+// writeTsigError writes the reply to r, whose TSIG failed to verify. It must not be signed, so
+// it's packed here instead of by the transport, unless that doesn't sign anyway.
+func writeTsigError(w dns.ResponseWriter, r *dns.Msg) *dns.Msg {
+	err := w.TsigStatus()
+	m := tsigError(r, err, time.Now())
+	if err == errTsigUnsupported {
+		w.WriteMsg(m)
+		return m
+	}
+	if buf, err := m.Pack(); err == nil {
+		w.Write(buf)
+	}
+	return m
+}
+
+// errTsigUnsupported is the TSIG status of queries received over transports that don't verify
+// TSIG signatures.
+var errTsigUnsupported = errors.New("TSIG is not supported on this transport")
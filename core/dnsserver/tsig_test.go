@@ -0,0 +1,156 @@
+package dnsserver
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
+	"github.com/miekg/dns"
+)
+
+const testKey = "key.example.com."
+
+func tsigConfig(c *Config) {
+	c.TsigKeys = tsig.Keys{testKey: {Name: testKey, Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}}
+}
+
+func TestServeTsig(t *testing.T) {
+	s, tcp := startTCPServer(t, slowPlugin{}, tsigConfig)
+	defer s.Stop()
+
+	p, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	go s.ServePacket(p)
+	udp := p.LocalAddr().String()
+
+	tests := []struct {
+		key     string
+		secret  string
+		skew    time.Duration // of the client's clock
+		rcode   int
+		tsigErr uint16 // the error in the TSIG of a NOTAUTH reply
+	}{
+		{testKey, "c2VjcmV0", 0, dns.RcodeSuccess, dns.RcodeSuccess},
+		{testKey, "d3Jvbmc=", 0, dns.RcodeNotAuth, dns.RcodeBadSig},
+		{"unknown.example.com.", "c2VjcmV0", 0, dns.RcodeNotAuth, dns.RcodeBadKey},
+		{testKey, "c2VjcmV0", time.Hour, dns.RcodeNotAuth, dns.RcodeBadTime},
+	}
+
+	for _, proto := range []string{"udp", "tcp"} {
+		addr := udp
+		if proto == "tcp" {
+			addr = tcp
+		}
+		for i, tc := range tests {
+			m := new(dns.Msg)
+			m.SetQuestion("fast.example.com.", dns.TypeA)
+			signed := time.Now().Add(-tc.skew).Unix()
+			m.SetTsig(tc.key, dns.HmacSHA256, 300, signed)
+			c := &dns.Client{Net: proto, TsigSecret: map[string]string{tc.key: tc.secret}}
+
+			// The client verifies the signature of the reply, an error reply is not signed.
+			r, _, err := c.Exchange(m, addr)
+			if tc.rcode == dns.RcodeSuccess && err != nil {
+				t.Fatalf("Test %d (%s): expected no error, got %s", i, proto, err)
+			}
+			if r == nil {
+				t.Fatalf("Test %d (%s): expected a reply, got %s", i, proto, err)
+			}
+			if r.Rcode != tc.rcode {
+				t.Errorf("Test %d (%s): expected rcode %s, got %s", i, proto, dns.RcodeToString[tc.rcode], dns.RcodeToString[r.Rcode])
+			}
+			ts := r.IsTsig()
+			if ts == nil {
+				t.Errorf("Test %d (%s): expected a TSIG record in the reply", i, proto)
+				continue
+			}
+			if ts.Error != tc.tsigErr {
+				t.Errorf("Test %d (%s): expected TSIG error %s, got %s", i, proto, dns.RcodeToString[int(tc.tsigErr)], dns.RcodeToString[int(ts.Error)])
+			}
+			if tc.rcode == dns.RcodeSuccess {
+				continue
+			}
+			if ts.MACSize != 0 || ts.MAC != "" {
+				t.Errorf("Test %d (%s): expected no MAC in an error reply, got %q", i, proto, ts.MAC)
+			}
+			if ts.TimeSigned != uint64(signed) {
+				t.Errorf("Test %d (%s): expected the time signed of the query, got %d", i, proto, ts.TimeSigned)
+			}
+			if tc.tsigErr != dns.RcodeBadTime {
+				continue
+			}
+			now, err := strconv.ParseUint(ts.OtherData, 16, 64)
+			if err != nil || ts.OtherLen != 6 {
+				t.Fatalf("Test %d (%s): expected the server time as other data, got %q", i, proto, ts.OtherData)
+			}
+			if d := int64(now) - time.Now().Unix(); d < -5 || d > 5 {
+				t.Errorf("Test %d (%s): expected the current server time, got %d", i, proto, now)
+			}
+		}
+	}
+}
+
+func TestTsigError(t *testing.T) {
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+	r.SetEdns0(4096, true)
+	r.SetTsig(testKey, dns.HmacSHA256, 300, 1500000000)
+	now := time.Unix(1500003600, 0)
+
+	tests := []struct {
+		err      error
+		expected uint16
+	}{
+		{dns.ErrSig, dns.RcodeBadSig},
+		{dns.ErrTime, dns.RcodeBadTime},
+		{dns.ErrSecret, dns.RcodeBadKey},
+		{dns.ErrKeyAlg, dns.RcodeBadKey},
+		{errTsigUnsupported, dns.RcodeBadKey},
+	}
+	for i, tc := range tests {
+		m := tsigError(r, tc.err, now)
+		if m.Rcode != dns.RcodeNotAuth {
+			t.Errorf("Test %d: expected NOTAUTH, got %s", i, dns.RcodeToString[m.Rcode])
+		}
+		if m.IsEdns0() == nil {
+			t.Errorf("Test %d: expected an OPT record", i)
+		}
+		ts := m.IsTsig()
+		if ts == nil {
+			t.Fatalf("Test %d: expected a TSIG record last", i)
+		}
+		if ts.Error != tc.expected {
+			t.Errorf("Test %d: expected TSIG error %s, got %s", i, dns.RcodeToString[int(tc.expected)], dns.RcodeToString[int(ts.Error)])
+		}
+		if ts.Hdr.Name != testKey || ts.MAC != "" {
+			t.Errorf("Test %d: expected an unsigned TSIG record for %s, got %s", i, testKey, ts)
+		}
+		wantOther := ""
+		if tc.expected == dns.RcodeBadTime {
+			wantOther = "000059683d10"
+		}
+		if ts.OtherData != wantOther {
+			t.Errorf("Test %d: expected other data %q, got %q", i, wantOther, ts.OtherData)
+		}
+		if _, err := m.Pack(); err != nil {
+			t.Errorf("Test %d: expected the reply to pack, got %s", i, err)
+		}
+	}
+}
+
+func TestNewServerTsigConflict(t *testing.T) {
+	c1 := testConfig("dns", slowPlugin{})
+	tsigConfig(c1)
+	c2 := testConfig("dns", slowPlugin{})
+	c2.Zone = "example.org."
+	c2.TsigKeys = tsig.Keys{testKey: {Name: testKey, Algorithm: dns.HmacSHA256, Secret: "b3RoZXI="}}
+
+	if _, err := NewServer("dns://127.0.0.1:0", []*Config{c1, c2}); err == nil {
+		t.Errorf("Expected error for a key declared with different secrets, got none")
+	}
+}
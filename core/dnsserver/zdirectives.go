@@ -13,6 +13,11 @@ var Directives = []string{
 	"metadata",
 	"cancel",
 	"tls",
+	"view",
+	"doh",
+	"proxyproto",
+	"tcp",
+	"tsig",
 	"reload",
 	"nsid",
 	"root",
@@ -26,6 +31,9 @@ var Directives = []string{
 	"errors",
 	"log",
 	"dnstap",
+	"cookie",
+	"acl",
+	"rrl",
 	"chaos",
 	"loadbalance",
 	"cache",
@@ -38,12 +46,15 @@ var Directives = []string{
 	"federation",
 	"k8s_external",
 	"kubernetes",
+	"sign",
 	"file",
 	"auto",
 	"secondary",
+	"catalog",
 	"etcd",
 	"loop",
 	"forward",
+	"recursive",
 	"grpc",
 	"erratic",
 	"whoami",
@@ -0,0 +1,157 @@
+// Package acl implements a plugin that allows, blocks or drops queries based on the
+// source address of the client, the query type and the zone.
+package acl
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// ACL enforces access control policies on DNS queries.
+type ACL struct {
+	Next plugin.Handler
+
+	Rules []rule
+}
+
+// rule defines a list of zones and the policies that apply to queries for names in those zones.
+type rule struct {
+	zones    []string
+	policies []policy
+}
+
+// action defines what to do with a query that matches a policy.
+type action int
+
+const (
+	// actionNone does nothing on the queries.
+	actionNone action = iota
+	// actionAllow allows the queries and hands them to the next plugin.
+	actionAllow
+	// actionBlock blocks the queries and replies with REFUSED.
+	actionBlock
+	// actionDrop drops the queries without sending a reply.
+	actionDrop
+)
+
+// String returns the name of the action as used in the Corefile.
+func (a action) String() string {
+	switch a {
+	case actionAllow:
+		return "allow"
+	case actionBlock:
+		return "block"
+	case actionDrop:
+		return "drop"
+	}
+	return "none"
+}
+
+// policy defines the action taken when a query matches both qtypes and nets. An
+// empty qtypes or nets matches everything.
+type policy struct {
+	action action
+	qtypes map[uint16]struct{}
+	nets   []*net.IPNet
+}
+
+// matches returns true if the policy applies to the query in state.
+func (p policy) matches(state request.Request) bool {
+	if len(p.qtypes) > 0 {
+		if _, ok := p.qtypes[state.QType()]; !ok {
+			return false
+		}
+	}
+	if len(p.nets) == 0 {
+		return true
+	}
+	ip := net.ParseIP(state.IP())
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (a ACL) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	act, zone, _ := a.match(state)
+	server := metrics.WithServer(ctx)
+
+	switch act {
+	case actionDrop:
+		RequestDropCount.WithLabelValues(server, zone).Inc()
+		return dns.RcodeSuccess, nil
+
+	case actionBlock:
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		state.SizeAndDo(m)
+		w.WriteMsg(m)
+		RequestBlockCount.WithLabelValues(server, zone).Inc()
+		return dns.RcodeSuccess, nil
+
+	case actionAllow:
+		RequestAllowCount.WithLabelValues(server, zone).Inc()
+	}
+
+	return plugin.NextOrFailure(a.Name(), a.Next, ctx, w, r)
+}
+
+// match returns the action of the first policy that matches the query in state, together with the
+// zone of the rule and an identifier of the policy in the form <zone>#<index>. If no policy
+// matches actionNone and empty strings are returned.
+func (a ACL) match(state request.Request) (action, string, string) {
+	for _, rule := range a.Rules {
+		zone := plugin.Zones(rule.zones).Matches(state.Name())
+		if zone == "" {
+			continue
+		}
+		for i, p := range rule.policies {
+			if p.matches(state) {
+				return p.action, zone, zone + "#" + strconv.Itoa(i+1)
+			}
+		}
+	}
+	return actionNone, "", ""
+}
+
+// Metadata implements the metadata.Provider interface. It adds the labels "acl/action" and
+// "acl/rule" that hold the action taken and the policy that matched. The policies are only
+// evaluated when one of the labels is actually used.
+func (a ACL) Metadata(ctx context.Context, state request.Request) context.Context {
+	var (
+		once sync.Once
+		act  action
+		id   string
+	)
+	eval := func() { act, _, id = a.match(state) }
+
+	metadata.SetValueFunc(ctx, "acl/action", func() string {
+		once.Do(eval)
+		return act.String()
+	})
+	metadata.SetValueFunc(ctx, "acl/rule", func() string {
+		once.Do(eval)
+		return id
+	})
+	return ctx
+}
+
+// Name implements the plugin.Handler interface.
+func (a ACL) Name() string { return "acl" }
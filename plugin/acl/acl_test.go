@@ -0,0 +1,120 @@
+package acl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+// next is the handler after acl, it always replies with NOERROR.
+var next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+})
+
+func TestACLServeDNS(t *testing.T) {
+	tests := []struct {
+		config    string
+		qname     string
+		qtype     uint16
+		wantRcode int
+		wantMsg   bool // false if the query should be dropped
+	}{
+		// test.ResponseWriter has 10.240.0.1 as the remote address.
+		{`acl example.org {
+			block type A net 10.240.0.0/16
+		}`, "www.example.org.", dns.TypeA, dns.RcodeRefused, true},
+		{`acl example.org {
+			block type A net 10.240.0.0/16
+		}`, "www.example.org.", dns.TypeAAAA, dns.RcodeSuccess, true},
+		{`acl example.org {
+			block type A net 192.168.0.0/16
+		}`, "www.example.org.", dns.TypeA, dns.RcodeSuccess, true},
+		{`acl example.org {
+			block type A net 10.240.0.0/16
+		}`, "www.example.net.", dns.TypeA, dns.RcodeSuccess, true},
+		{`acl example.org {
+			allow net 10.240.0.1
+			block
+		}`, "www.example.org.", dns.TypeA, dns.RcodeSuccess, true},
+		{`acl example.org {
+			allow net 10.240.0.2
+			block
+		}`, "www.example.org.", dns.TypeA, dns.RcodeRefused, true},
+		{`acl {
+			drop type ANY
+		}`, "www.example.org.", dns.TypeANY, dns.RcodeSuccess, false},
+		{`acl example.net {
+			block
+		}
+		acl example.org {
+			drop
+		}`, "www.example.org.", dns.TypeMX, dns.RcodeSuccess, false},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.config)
+		c.ServerBlockKeys = []string{"."}
+		a, err := parse(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to parse config: %s", i, err)
+		}
+		a.Next = next
+
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		if _, err := a.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+		}
+		if !tc.wantMsg {
+			if rec.Msg != nil {
+				t.Errorf("Test %d: expected query to be dropped, got reply", i)
+			}
+			continue
+		}
+		if rec.Msg == nil {
+			t.Errorf("Test %d: expected reply, got none", i)
+			continue
+		}
+		if rec.Msg.Rcode != tc.wantRcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.wantRcode, rec.Msg.Rcode)
+		}
+	}
+}
+
+func TestACLMetadata(t *testing.T) {
+	c := caddy.NewTestController("dns", `acl example.org {
+		allow net 192.168.0.0/16
+		block type A
+	}`)
+	a, err := parse(c)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %s", err)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	state := request.Request{W: &test.ResponseWriter{}, Req: m}
+
+	ctx := metadata.ContextWithMetadata(context.TODO())
+	ctx = a.Metadata(ctx, state)
+
+	if v := metadata.ValueFunc(ctx, "acl/action")(); v != "block" {
+		t.Errorf("Expected acl/action to be %q, got %q", "block", v)
+	}
+	if v := metadata.ValueFunc(ctx, "acl/rule")(); v != "example.org.#2" {
+		t.Errorf("Expected acl/rule to be %q, got %q", "example.org.#2", v)
+	}
+}
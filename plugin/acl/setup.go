@@ -0,0 +1,108 @@
+package acl
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+func init() {
+	caddy.RegisterPlugin("acl", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	a, err := parse(c)
+	if err != nil {
+		return plugin.Error("acl", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		a.Next = next
+		return a
+	})
+
+	c.OnStartup(func() error {
+		metrics.MustRegister(c, RequestBlockCount, RequestDropCount, RequestAllowCount)
+		return nil
+	})
+	return nil
+}
+
+func parse(c *caddy.Controller) (ACL, error) {
+	a := ACL{}
+	for c.Next() {
+		r := rule{}
+		r.zones = c.RemainingArgs()
+		if len(r.zones) == 0 {
+			r.zones = make([]string, len(c.ServerBlockKeys))
+			copy(r.zones, c.ServerBlockKeys)
+		}
+		for i := range r.zones {
+			r.zones[i] = plugin.Host(r.zones[i]).Normalize()
+		}
+
+		for c.NextBlock() {
+			p := policy{}
+
+			switch strings.ToLower(c.Val()) {
+			case "allow":
+				p.action = actionAllow
+			case "block":
+				p.action = actionBlock
+			case "drop":
+				p.action = actionDrop
+			default:
+				return a, c.Errf("unexpected token %q; expect 'allow', 'block' or 'drop'", c.Val())
+			}
+
+			p.qtypes = make(map[uint16]struct{})
+
+			var current string
+			for _, token := range c.RemainingArgs() {
+				switch strings.ToLower(token) {
+				case "type", "net":
+					current = strings.ToLower(token)
+					continue
+				}
+
+				switch current {
+				case "type":
+					if token == "*" {
+						continue
+					}
+					qtype, ok := dns.StringToType[strings.ToUpper(token)]
+					if !ok {
+						return a, c.Errf("unexpected token %q; expect a valid query type", token)
+					}
+					p.qtypes[qtype] = struct{}{}
+
+				case "net":
+					if token == "*" {
+						continue
+					}
+					n, err := pkgparse.Net(token)
+					if err != nil {
+						return a, c.Errf("illegal CIDR notation %q", token)
+					}
+					p.nets = append(p.nets, n)
+
+				default:
+					return a, c.Errf("unexpected token %q; expect 'type' or 'net'", token)
+				}
+			}
+
+			r.policies = append(r.policies, p)
+		}
+		a.Rules = append(a.Rules, r)
+	}
+	return a, nil
+}
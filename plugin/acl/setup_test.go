@@ -0,0 +1,66 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		// Success cases.
+		{`acl {
+			block type A net 192.168.0.0/16
+		}`, false},
+		{`acl example.org {
+			block type A net 192.168.0.0/16
+		}`, false},
+		{`acl {
+			allow net 10.0.0.1
+			drop type ANY
+			block
+		}`, false},
+		{`acl {
+			block type A AAAA net 192.168.0.0/16 2001:db8::/32
+		}`, false},
+		{`acl {
+			block type * net *
+		}`, false},
+		{`acl example.org {
+			block type A net 192.168.0.0/16
+		}
+		acl example.net {
+			allow net 10.0.0.0/8
+		}`, false},
+		// Failure cases.
+		{`acl {
+			deny type A
+		}`, true},
+		{`acl {
+			block type ABC
+		}`, true},
+		{`acl {
+			block net 192.168.0.0/33
+		}`, true},
+		{`acl {
+			block net example.org
+		}`, true},
+		{`acl {
+			block A
+		}`, true},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		err := setup(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+		}
+	}
+}
@@ -3,12 +3,14 @@ package auto
 
 import (
 	"context"
+	"net"
 	"regexp"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/file"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/request"
 
@@ -32,6 +34,11 @@ type (
 
 		// In the future this should be something like ZoneMeta that contains all this stuff.
 		transferTo     []string
+		transferKeys   map[string]tsig.Key
+		updateFrom     []*net.IPNet
+		updateKeys     map[string]tsig.Key
+		persist        bool
+		journalSize    int
 		ReloadInterval time.Duration
 		upstream       *upstream.Upstream // Upstream for looking up names during the resolution process.
 	}
@@ -59,6 +66,11 @@ func (a Auto) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		return dns.RcodeServerFailure, nil
 	}
 
+	if r.Opcode == dns.OpcodeUpdate {
+		update := file.Update{Zone: z}
+		return update.ServeDNS(ctx, w, r)
+	}
+
 	if state.QType() == dns.TypeAXFR || state.QType() == dns.TypeIXFR {
 		xfr := file.Xfr{Zone: z}
 		return xfr.ServeDNS(ctx, w, r)
@@ -4,13 +4,16 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
 	"github.com/coredns/coredns/plugin/metrics"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 
 	"github.com/mholt/caddy"
@@ -82,6 +85,9 @@ func autoParse(c *caddy.Controller) (Auto, error) {
 			template:       "${1}",
 			re:             regexp.MustCompile(`db\.(.*)`),
 			ReloadInterval: nilInterval,
+			transferKeys:   map[string]tsig.Key{},
+			updateKeys:     map[string]tsig.Key{},
+			journalSize:    file.DefaultJournalSize,
 		},
 		Zones: &Zones{},
 	}
@@ -152,14 +158,63 @@ func autoParse(c *caddy.Controller) (Auto, error) {
 				a.loader.upstream = upstream.New()
 
 			case "transfer":
-				t, _, e := parse.Transfer(c, false)
+				t, _, name, e := parse.Transfer(c, false)
 				if e != nil {
 					return a, e
 				}
+				if name != "" {
+					key, err := config.TsigKeys.Get(name)
+					if err != nil {
+						return a, c.Err(err.Error())
+					}
+					for _, to := range t {
+						a.loader.transferKeys[to] = key
+					}
+				}
 				if t != nil {
 					a.loader.transferTo = append(a.loader.transferTo, t...)
 				}
 
+			case "update":
+				args, name, err := parse.Key(c.RemainingArgs())
+				if err != nil {
+					return a, c.Err(err.Error())
+				}
+				if len(args) == 0 {
+					return a, c.ArgErr()
+				}
+				nets, err := parse.Nets(args)
+				if err != nil {
+					return a, c.Err(err.Error())
+				}
+				if name != "" {
+					key, err := config.TsigKeys.Get(name)
+					if err != nil {
+						return a, c.Err(err.Error())
+					}
+					for _, n := range nets {
+						a.loader.updateKeys[n.String()] = key
+					}
+				}
+				a.loader.updateFrom = append(a.loader.updateFrom, nets...)
+
+			case "persist":
+				if len(c.RemainingArgs()) != 0 {
+					return a, c.ArgErr()
+				}
+				a.loader.persist = true
+
+			case "journal":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return a, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 0 {
+					return a, c.Errf("invalid journal size '%s'", args[0])
+				}
+				a.loader.journalSize = n
+
 			default:
 				return Auto{}, c.Errf("unknown property '%s'", c.Val())
 			}
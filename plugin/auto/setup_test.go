@@ -4,7 +4,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
 	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
 )
 
 func TestAutoParse(t *testing.T) {
@@ -129,3 +134,67 @@ func TestAutoParse(t *testing.T) {
 		}
 	}
 }
+
+func TestAutoParseUpdate(t *testing.T) {
+	c := caddy.NewTestController("dns", `auto example.org {
+		directory /tmp
+		update 10.0.0.0/8
+		persist
+	}`)
+	a, err := autoParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(a.loader.updateFrom) != 1 || a.loader.updateFrom[0].String() != "10.0.0.0/8" {
+		t.Errorf("Expected update from 10.0.0.0/8, got %v", a.loader.updateFrom)
+	}
+	if !a.loader.persist {
+		t.Errorf("Expected persist to be set")
+	}
+	if a.loader.journalSize != file.DefaultJournalSize {
+		t.Errorf("Expected journal size %d, got %d", file.DefaultJournalSize, a.loader.journalSize)
+	}
+
+	a, err = autoParse(caddy.NewTestController("dns", "auto {\ndirectory /tmp\njournal 5\n}"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if a.loader.journalSize != 5 {
+		t.Errorf("Expected journal size 5, got %d", a.loader.journalSize)
+	}
+
+	for _, input := range []string{
+		"auto {\ndirectory /tmp\nupdate\n}",
+		"auto {\ndirectory /tmp\nupdate 10.0.0.0/33\n}",
+		"auto {\ndirectory /tmp\npersist yes\n}",
+		"auto {\ndirectory /tmp\njournal -1\n}",
+	} {
+		if _, err := autoParse(caddy.NewTestController("dns", input)); err == nil {
+			t.Errorf("Expected error for input %q", input)
+		}
+	}
+}
+
+func TestAutoParseTsig(t *testing.T) {
+	c := caddy.NewTestController("dns", `auto example.org {
+		directory /tmp
+		transfer to * key xfr.example.org.
+		update 10.0.0.0/8 key xfr.example.org.
+	}`)
+	dnsserver.GetConfig(c).TsigKeys = tsig.Keys{"xfr.example.org.": {Name: "xfr.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}}
+	a, err := autoParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if a.loader.transferKeys["*"].Name != "xfr.example.org." {
+		t.Errorf("Expected key for transfers, got %v", a.loader.transferKeys)
+	}
+	if a.loader.updateKeys["10.0.0.0/8"].Name != "xfr.example.org." {
+		t.Errorf("Expected key for updates, got %v", a.loader.updateKeys)
+	}
+
+	c = caddy.NewTestController("dns", "auto {\ndirectory /tmp\ntransfer to * key unknown.example.org.\n}")
+	if _, err := autoParse(c); err == nil {
+		t.Errorf("Expected error for undeclared key")
+	}
+}
@@ -54,6 +54,11 @@ func (a Auto) Walk() error {
 		zo.ReloadInterval = a.loader.ReloadInterval
 		zo.Upstream = a.loader.upstream
 		zo.TransferTo = a.loader.transferTo
+		zo.TransferKeys = a.loader.transferKeys
+		zo.UpdateFrom = a.loader.updateFrom
+		zo.UpdateKeys = a.loader.updateKeys
+		zo.Persist = a.loader.persist
+		zo.JournalSize = a.loader.journalSize
 
 		a.Zones.Add(zo, origin)
 
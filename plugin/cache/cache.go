@@ -23,14 +23,28 @@ type Cache struct {
 
 	ncache  *cache.Cache
 	ncap    int
+	nbytes  bool // ncap is in bytes
 	nttl    time.Duration
 	minnttl time.Duration
 
 	pcache  *cache.Cache
 	pcap    int
+	pbytes  bool // pcap is in bytes
 	pttl    time.Duration
 	minpttl time.Duration
 
+	// Aggressive use of NSEC records, if not nil.
+	nsec *nsecCache
+
+	// Serve stale.
+	staleUpTo    time.Duration // how long expired items are served, zero disables it
+	verifyStale  bool          // ask the next plugin before serving an expired item
+	staleTimeout time.Duration // how long to wait for the next plugin, when verifying
+
+	// Persist the cache in a file, if not empty.
+	persistFile     string
+	persistInterval time.Duration // save the cache periodically, if not zero
+
 	// Prefetch.
 	prefetch   int
 	duration   time.Duration
@@ -56,7 +70,11 @@ func New() *Cache {
 		prefetch:   0,
 		duration:   1 * time.Minute,
 		percentage: 10,
-		now:        time.Now,
+
+		verifyStale:  true,
+		staleTimeout: defaultStaleTimeout,
+
+		now: time.Now,
 	}
 }
 
@@ -158,33 +176,33 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 
 	// key returns empty string for anything we don't want to cache.
 	hasKey, key := key(w.state.Name(), res, mt, do)
+	// When serving stale, a failure must not replace the expired item.
+	if mt == response.ServerError && w.staleUpTo > 0 {
+		hasKey = false
+	}
 
-	msgTTL := dnsutil.MinimalTTL(res, mt)
-	var duration time.Duration
-	if mt == response.NameError || mt == response.NoData {
-		duration = computeTTL(msgTTL, w.minnttl, w.nttl)
-	} else if mt == response.ServerError {
-		// use default ttl which is 5s
-		duration = minTTL
-	} else {
-		duration = computeTTL(msgTTL, w.minpttl, w.pttl)
+	if w.nsec != nil && res.AuthenticatedData && w.state.Match(res) {
+		switch mt {
+		case response.NoError, response.NameError, response.NoData:
+			w.nsec.add(res, w.now(), w.nttl)
+		}
 	}
 
+	duration := w.ttlFor(res, mt)
+
 	if hasKey && duration > 0 {
 		if w.state.Match(res) {
 			w.set(res, key, mt, duration)
 			cacheSize.WithLabelValues(w.server, Success).Set(float64(w.pcache.Len()))
 			cacheSize.WithLabelValues(w.server, Denial).Set(float64(w.ncache.Len()))
+			cacheBytes.WithLabelValues(w.server, Success).Set(float64(w.pcache.Size()))
+			cacheBytes.WithLabelValues(w.server, Denial).Set(float64(w.ncache.Size()))
 		} else {
 			// Don't log it, but increment counter
 			cacheDrops.WithLabelValues(w.server).Inc()
 		}
 	}
 
-	if w.prefetch {
-		return nil
-	}
-
 	// Apply capped TTL to this reply to avoid jarring TTL experience 1799 -> 8 (e.g.)
 	ttl := uint32(duration.Seconds())
 	for i := range res.Answer {
@@ -198,20 +216,37 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 			res.Extra[i].Header().Ttl = ttl
 		}
 	}
+
+	if w.prefetch {
+		return nil
+	}
 	return w.ResponseWriter.WriteMsg(res)
 }
 
-func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration time.Duration) {
+// ttlFor returns the duration m, of type mt, is cached for.
+func (c *Cache) ttlFor(m *dns.Msg, mt response.Type) time.Duration {
+	msgTTL := dnsutil.MinimalTTL(m, mt)
+	switch mt {
+	case response.NameError, response.NoData:
+		return computeTTL(msgTTL, c.minnttl, c.nttl)
+	case response.ServerError:
+		// use default ttl which is 5s
+		return minTTL
+	}
+	return computeTTL(msgTTL, c.minpttl, c.pttl)
+}
+
+func (c *Cache) set(m *dns.Msg, key uint64, mt response.Type, duration time.Duration) {
 	// duration is expected > 0
 	// and key is valid
 	switch mt {
 	case response.NoError, response.Delegation:
-		i := newItem(m, w.now(), duration)
-		w.pcache.Add(key, i)
+		i := newItem(m, c.now(), duration)
+		c.pcache.Add(key, i)
 
 	case response.NameError, response.NoData, response.ServerError:
-		i := newItem(m, w.now(), duration)
-		w.ncache.Add(key, i)
+		i := newItem(m, c.now(), duration)
+		c.ncache.Add(key, i)
 
 	case response.OtherError:
 		// don't cache these
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -249,6 +250,53 @@ func TestCacheZeroTTL(t *testing.T) {
 	}
 }
 
+func TestCacheGetSet(t *testing.T) {
+	c := New()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	m := new(dns.Msg)
+	m.SetQuestion("Example.ORG.", dns.TypeNS)
+	m.Response = true
+	m.Answer = []dns.RR{test.NS("example.org. 3600 IN NS ns.example.net.")}
+	m.Extra = []dns.RR{test.A("ns.example.net. 3600 IN A 127.0.0.53"), test.OPT(4096, false)}
+	c.Set(m)
+
+	got, ok := c.Get("example.org.", dns.TypeNS)
+	if !ok {
+		t.Fatal("Expected the message to be cached")
+	}
+	if len(got.Answer) != 1 || len(got.Extra) != 1 {
+		t.Errorf("Expected 1 answer and 1 additional record, got %d and %d", len(got.Answer), len(got.Extra))
+	}
+	if _, ok := c.Get("example.org.", dns.TypeA); ok {
+		t.Errorf("Expected no cached A records")
+	}
+
+	now = now.Add(maxTTL + time.Second)
+	if _, ok := c.Get("example.org.", dns.TypeNS); ok {
+		t.Errorf("Expected the cached message to be expired")
+	}
+}
+
+func TestCacheBytes(t *testing.T) {
+	c := New()
+	c.pcache = newCache(256<<10, true)
+	c.Next = BackendHandler()
+
+	for i := 0; i < 2000; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion(fmt.Sprintf("host%d.example.org.", i), dns.TypeA)
+		c.ServeDNS(context.TODO(), &test.ResponseWriter{}, req)
+	}
+	if size := c.pcache.Size(); size == 0 || size > 256<<10 {
+		t.Errorf("Expected the cache to use at most %d bytes, got %d", 256<<10, size)
+	}
+	if l := c.pcache.Len(); l == 0 || l >= 2000 {
+		t.Errorf("Expected some elements to be evicted, got %d", l)
+	}
+}
+
 func BenchmarkCacheResponse(b *testing.B) {
 	c := New()
 	c.prefetch = 1
@@ -3,10 +3,12 @@ package cache
 import (
 	"context"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -55,6 +57,20 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		return dns.RcodeSuccess, nil
 	}
 
+	if c.nsec != nil {
+		if m := c.synthesize(state, now); m != nil {
+			cacheSynthesized.WithLabelValues(server).Inc()
+			w.WriteMsg(m)
+			return dns.RcodeSuccess, nil
+		}
+	}
+
+	if c.staleUpTo > 0 {
+		if i := c.getStale(now, state); i != nil {
+			return c.serveStale(ctx, state, server, i, now)
+		}
+	}
+
 	crr := &ResponseWriter{ResponseWriter: w, Cache: c, state: state, server: server}
 	return plugin.NextOrFailure(c.Name(), c.Next, ctx, crr, r)
 }
@@ -89,6 +105,40 @@ func (c *Cache) exists(state request.Request) *item {
 	return nil
 }
 
+// Get returns the cached response for name and qtype, as it would be sent to a client without the DO
+// bit. It is used by other plugins that share the cache.
+func (c *Cache) Get(name string, qtype uint16) (*dns.Msg, bool) {
+	now := c.now().UTC()
+	k := hash(strings.ToLower(name), qtype, false)
+
+	i, ok := c.ncache.Get(k)
+	if !ok {
+		i, ok = c.pcache.Get(k)
+	}
+	if !ok || i.(*item).ttl(now) <= 0 {
+		return nil, false
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	return i.(*item).toMsg(m, now), true
+}
+
+// Set caches m, a response, as the reply to its question without the DO bit. The TTLs are capped as
+// configured. It is used by other plugins that share the cache.
+func (c *Cache) Set(m *dns.Msg) {
+	if len(m.Question) == 0 {
+		return
+	}
+	mt, _ := response.Typify(m, c.now().UTC())
+	hasKey, k := key(strings.ToLower(m.Question[0].Name), m, mt, false)
+	if !hasKey {
+		return
+	}
+	if duration := c.ttlFor(m, mt); duration > 0 {
+		c.set(m, k, mt, duration)
+	}
+}
+
 var (
 	cacheSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: plugin.Namespace,
@@ -97,6 +147,13 @@ var (
 		Help:      "The number of elements in the cache.",
 	}, []string{"server", "type"})
 
+	cacheBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "size_bytes",
+		Help:      "The approximate memory used by the elements in the cache.",
+	}, []string{"server", "type"})
+
 	cacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
 		Subsystem: "cache",
@@ -118,6 +175,20 @@ var (
 		Help:      "The number of time the cache has prefetched a cached item.",
 	}, []string{"server"})
 
+	cacheSynthesized = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "nsec_synthesized_total",
+		Help:      "The count of responses synthesized from cached NSEC and NSEC3 records.",
+	}, []string{"server"})
+
+	cacheServedStale = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "served_stale_total",
+		Help:      "The count of replies from expired items.",
+	}, []string{"server"})
+
 	cacheDrops = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
 		Subsystem: "cache",
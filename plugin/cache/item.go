@@ -19,6 +19,8 @@ type item struct {
 	origTTL uint32
 	stored  time.Time
 
+	refreshing int32 // set while an expired item is refreshed, see serveStale
+
 	*freq.Freq
 }
 
@@ -82,6 +84,22 @@ func (i *item) toMsg(m *dns.Msg, now time.Time) *dns.Msg {
 	return m1
 }
 
+// Size implements the cache.Sizer interface, it returns the approximate number of bytes i uses.
+func (i *item) Size() int {
+	size := itemSize
+	for _, section := range [][]dns.RR{i.Answer, i.Ns, i.Extra} {
+		for _, rr := range section {
+			size += rrSize + dns.Len(rr)
+		}
+	}
+	return size
+}
+
+const (
+	itemSize = 256 // the item, with its frequency and slices, and its key in the cache
+	rrSize   = 64  // the header and the interface of a record, on top of its wire size
+)
+
 func (i *item) ttl(now time.Time) int {
 	ttl := int(i.origTTL) - int(now.UTC().Sub(i.stored).Seconds())
 	return ttl
@@ -0,0 +1,602 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// nsecCache holds the NSEC and NSEC3 records of validated responses, by zone, to synthesize denials
+// of existence and wildcard answers for the names they cover (RFC 8198).
+type nsecCache struct {
+	sync.RWMutex
+	zones map[string]*nsecZone
+	size  int // the number of records held
+	cap   int
+}
+
+// nsecZone holds the cached records of a zone.
+type nsecZone struct {
+	soa       *rrset
+	nsec      []*rrset          // NSEC records, in canonical order
+	nsec3     []*rrset          // NSEC3 records, in hash order
+	wildcards map[string]*rrset // wildcard RRsets, by "name/type"
+}
+
+// rrset is an RRset with its signatures. For the NSEC(3) chains it's a single record.
+type rrset struct {
+	rrs    []dns.RR
+	sigs   []dns.RR
+	expire time.Time
+}
+
+func newNSECCache(size int) *nsecCache {
+	return &nsecCache{zones: map[string]*nsecZone{}, cap: size}
+}
+
+// add adds the signed NSEC and NSEC3 records, SOA records and RRsets expanded from wildcards in m,
+// which must be validated, to the cache. Nothing is kept for longer than max.
+func (c *nsecCache) add(m *dns.Msg, now time.Time, max time.Duration) {
+	sigs := map[string][]dns.RR{}
+	for _, section := range [][]dns.RR{m.Answer, m.Ns} {
+		for _, rr := range section {
+			if sig, ok := rr.(*dns.RRSIG); ok {
+				k := rrsetKey(sig.Hdr.Name, sig.TypeCovered)
+				sigs[k] = append(sigs[k], sig)
+			}
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, rr := range m.Ns {
+		h := rr.Header()
+		s := sigs[rrsetKey(h.Name, h.Rrtype)]
+		if len(s) == 0 {
+			continue
+		}
+		zone := strings.ToLower(s[0].(*dns.RRSIG).SignerName)
+		if !dns.IsSubDomain(zone, h.Name) {
+			continue
+		}
+		set := &rrset{rrs: []dns.RR{rr}, sigs: s, expire: now.Add(ttl(h.Ttl, max))}
+		switch x := rr.(type) {
+		case *dns.SOA:
+			if strings.EqualFold(h.Name, zone) {
+				set.expire = now.Add(ttl(x.Minttl, ttl(h.Ttl, max)))
+				c.zone(zone).soa = set
+			}
+		case *dns.NSEC:
+			c.insert(zone, set, false, now)
+		case *dns.NSEC3:
+			c.insert(zone, set, true, now)
+		}
+	}
+
+	for _, set := range rrSets(m.Answer) {
+		h := set[0].Header()
+		s := sigs[rrsetKey(h.Name, h.Rrtype)]
+		if len(s) == 0 {
+			continue
+		}
+		sig := s[0].(*dns.RRSIG)
+		labels := dns.Split(h.Name)
+		if int(sig.Labels) >= len(labels) {
+			continue
+		}
+		zone := strings.ToLower(sig.SignerName)
+		wildcard := "*." + strings.ToLower(h.Name[labels[len(labels)-int(sig.Labels)]:])
+		if int(sig.Labels) == 0 {
+			wildcard = "*."
+		}
+		if !dns.IsSubDomain(zone, wildcard) {
+			continue
+		}
+		w := &rrset{expire: now.Add(ttl(h.Ttl, max))}
+		for _, rr := range set {
+			rr = dns.Copy(rr)
+			rr.Header().Name = wildcard
+			w.rrs = append(w.rrs, rr)
+		}
+		for _, sig := range s {
+			sig = dns.Copy(sig)
+			sig.Header().Name = wildcard
+			w.sigs = append(w.sigs, sig)
+		}
+		k := rrsetKey(wildcard, h.Rrtype)
+		if z, ok := c.zones[zone]; ok {
+			if _, ok := z.wildcards[k]; ok {
+				z.wildcards[k] = w
+				continue
+			}
+		}
+		if !c.room(now, zone) {
+			continue
+		}
+		c.zone(zone).wildcards[k] = w
+		c.size++
+	}
+}
+
+// zone returns the cached records of zone, creating them if needed. The lock must be held.
+func (c *nsecCache) zone(zone string) *nsecZone {
+	z, ok := c.zones[zone]
+	if !ok {
+		z = &nsecZone{wildcards: map[string]*rrset{}}
+		c.zones[zone] = z
+	}
+	return z
+}
+
+// insert inserts the NSEC or NSEC3 record in set into the chain of zone, replacing the one with the
+// same owner. NSEC3 records with other parameters than the cached chain replace that chain. The lock
+// must be held.
+func (c *nsecCache) insert(zone string, set *rrset, nsec3 bool, now time.Time) {
+	owner := set.rrs[0].Header().Name
+	if z, ok := c.zones[zone]; ok {
+		if nsec3 && len(z.nsec3) > 0 && !sameParams(z.nsec3[0].rrs[0].(*dns.NSEC3), set.rrs[0].(*dns.NSEC3)) {
+			c.size -= len(z.nsec3)
+			z.nsec3 = nil
+		}
+		chain := z.chain(nsec3)
+		i := sort.Search(len(*chain), func(i int) bool { return compare((*chain)[i], owner, nsec3) >= 0 })
+		if i < len(*chain) && compare((*chain)[i], owner, nsec3) == 0 {
+			(*chain)[i] = set
+			return
+		}
+	}
+
+	// Making room can remove records of this zone too, so look them up again after.
+	if !c.room(now, zone) {
+		return
+	}
+	chain := c.zone(zone).chain(nsec3)
+	i := sort.Search(len(*chain), func(i int) bool { return compare((*chain)[i], owner, nsec3) >= 0 })
+	*chain = append(*chain, nil)
+	copy((*chain)[i+1:], (*chain)[i:])
+	(*chain)[i] = set
+	c.size++
+}
+
+// chain returns the NSEC or NSEC3 chain of z.
+func (z *nsecZone) chain(nsec3 bool) *[]*rrset {
+	if nsec3 {
+		return &z.nsec3
+	}
+	return &z.nsec
+}
+
+// room makes room for another record in zone, if the cache is full. Expired records are removed
+// first, then those of a random other zone, and lastly those of zone itself. Zone itself is never
+// removed. It returns false if there is no room. The lock must be held.
+func (c *nsecCache) room(now time.Time, zone string) bool {
+	if c.size < c.cap {
+		return true
+	}
+	for name, z := range c.zones {
+		c.size -= z.prune(now)
+		if z.empty() && name != zone {
+			delete(c.zones, name)
+		}
+	}
+	if c.size < c.cap {
+		return true
+	}
+	for name, z := range c.zones {
+		if name == zone {
+			continue
+		}
+		c.size -= z.records()
+		delete(c.zones, name)
+		break
+	}
+	if c.size < c.cap {
+		return true
+	}
+	if z, ok := c.zones[zone]; ok {
+		c.size -= z.records()
+		z.nsec, z.nsec3, z.wildcards = nil, nil, map[string]*rrset{}
+	}
+	return c.size < c.cap
+}
+
+// records returns the number of records held for z, these count towards the capacity.
+func (z *nsecZone) records() int { return len(z.nsec) + len(z.nsec3) + len(z.wildcards) }
+
+// prune removes the expired records of z and returns how many there were.
+func (z *nsecZone) prune(now time.Time) int {
+	n := 0
+	keep := func(chain []*rrset) []*rrset {
+		k := chain[:0]
+		for _, set := range chain {
+			if set.expire.After(now) {
+				k = append(k, set)
+				continue
+			}
+			n++
+		}
+		return k
+	}
+	z.nsec = keep(z.nsec)
+	z.nsec3 = keep(z.nsec3)
+	for k, w := range z.wildcards {
+		if !w.expire.After(now) {
+			delete(z.wildcards, k)
+			n++
+		}
+	}
+	if z.soa != nil && !z.soa.expire.After(now) {
+		z.soa = nil
+	}
+	return n
+}
+
+func (z *nsecZone) empty() bool {
+	return z.soa == nil && len(z.nsec) == 0 && len(z.nsec3) == 0 && len(z.wildcards) == 0
+}
+
+// synthesize returns the answer for qname and type qtype, that follows from the cached records, or nil.
+// The TTLs are set to the time left.
+func (c *nsecCache) synthesize(qname string, qtype uint16, now time.Time) *dns.Msg {
+	c.RLock()
+	defer c.RUnlock()
+
+	name, z := "", (*nsecZone)(nil)
+	for zone, zz := range c.zones {
+		if dns.IsSubDomain(zone, qname) && len(zone) > len(name) {
+			name, z = zone, zz
+		}
+	}
+	if z == nil {
+		return nil
+	}
+
+	var s *synthesis
+	switch {
+	case len(z.nsec) > 0:
+		s = z.nsecSynthesize(name, qname, qtype, now)
+	case len(z.nsec3) > 0:
+		s = z.nsec3Synthesize(name, qname, qtype, now)
+	}
+	if s == nil {
+		return nil
+	}
+	return s.msg(z, qname, now)
+}
+
+// synthesize returns the reply to state synthesized from the cached NSEC records, or nil. The records
+// are validated, the AD bit is set for clients that understand it.
+func (c *Cache) synthesize(state request.Request, now time.Time) *dns.Msg {
+	ret := c.nsec.synthesize(state.QName(), state.QType(), now)
+	if ret == nil {
+		return nil
+	}
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Rcode = ret.Rcode
+	m.Answer, m.Ns = ret.Answer, ret.Ns
+
+	do := state.Do()
+	m.AuthenticatedData = do || state.Req.AuthenticatedData
+	if !do {
+		m.Answer, m.Ns = stripDNSSEC(m.Answer), stripDNSSEC(m.Ns)
+	}
+	return m
+}
+
+// stripDNSSEC removes the RRSIG, NSEC and NSEC3 records from rrs.
+func stripDNSSEC(rrs []dns.RR) []dns.RR {
+	keep := rrs[:0]
+	for _, rr := range rrs {
+		switch rr.Header().Rrtype {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			continue
+		}
+		keep = append(keep, rr)
+	}
+	return keep
+}
+
+// synthesis is what follows from the cached records: a name error, no data, or an answer from a
+// wildcard, and the proof.
+type synthesis struct {
+	rcode    int
+	wildcard *rrset // the wildcard RRset for an answer
+	proof    []*rrset
+}
+
+func (s *synthesis) msg(z *nsecZone, qname string, now time.Time) *dns.Msg {
+	m := new(dns.Msg)
+	m.Rcode = s.rcode
+	sets := s.proof
+	if s.wildcard != nil {
+		sets = append([]*rrset{s.wildcard}, sets...)
+	} else {
+		if z.soa == nil || !z.soa.expire.After(now) {
+			return nil
+		}
+		sets = append([]*rrset{z.soa}, sets...)
+	}
+
+	expire := sets[0].expire
+	for _, set := range sets {
+		if set.expire.Before(expire) {
+			expire = set.expire
+		}
+	}
+	ttl := uint32(expire.Sub(now).Seconds())
+	if ttl == 0 {
+		return nil
+	}
+
+	seen := map[dns.RR]bool{}
+	for i, set := range sets {
+		if seen[set.rrs[0]] {
+			continue
+		}
+		seen[set.rrs[0]] = true
+		for _, rr := range append(append([]dns.RR{}, set.rrs...), set.sigs...) {
+			rr = dns.Copy(rr)
+			rr.Header().Ttl = ttl
+			if i == 0 && s.wildcard != nil {
+				rr.Header().Name = qname
+				m.Answer = append(m.Answer, rr)
+				continue
+			}
+			m.Ns = append(m.Ns, rr)
+		}
+	}
+	return m
+}
+
+func (z *nsecZone) nsecSynthesize(zone, qname string, qtype uint16, now time.Time) *synthesis {
+	if n := z.nsecMatch(qname, now); n != nil {
+		if !nodata(n.rrs[0].(*dns.NSEC).TypeBitMap, qtype, qname == zone) {
+			return nil
+		}
+		return &synthesis{rcode: dns.RcodeSuccess, proof: []*rrset{n}}
+	}
+
+	cover := z.nsecCover(qname, now)
+	if cover == nil {
+		return nil
+	}
+	owner, next := cover.rrs[0].Header().Name, cover.rrs[0].(*dns.NSEC).NextDomain
+	if dns.IsSubDomain(owner, qname) && cut(cover.rrs[0].(*dns.NSEC).TypeBitMap) {
+		return nil
+	}
+	// An empty non-terminal: qname exists, but has no records.
+	if dns.IsSubDomain(qname, next) && !strings.EqualFold(qname, next) {
+		return &synthesis{rcode: dns.RcodeSuccess, proof: []*rrset{cover}}
+	}
+	// The closest encloser is the longest ancestor of qname that is also one of the owner or next name.
+	ce := zone
+	for _, other := range []string{owner, next} {
+		common := dns.CompareDomainName(qname, other)
+		idx := dns.Split(qname)
+		if common > dns.CountLabel(ce) && common < len(idx) {
+			ce = strings.ToLower(qname[idx[len(idx)-common]:])
+		}
+	}
+	wildcard := "*." + ce
+	if ce == "." {
+		wildcard = "*."
+	}
+
+	if w := z.nsecMatch(wildcard, now); w != nil {
+		return z.fromWildcard(wildcard, qtype, w.rrs[0].(*dns.NSEC).TypeBitMap, []*rrset{cover}, []*rrset{cover, w}, now)
+	}
+	wcover := z.nsecCover(wildcard, now)
+	if wcover == nil {
+		return nil
+	}
+	return &synthesis{rcode: dns.RcodeNameError, proof: []*rrset{cover, wcover}}
+}
+
+func (z *nsecZone) nsec3Synthesize(zone, qname string, qtype uint16, now time.Time) *synthesis {
+	if n := z.nsec3Match(qname, now); n != nil {
+		if !nodata(n.rrs[0].(*dns.NSEC3).TypeBitMap, qtype, qname == zone) {
+			return nil
+		}
+		return &synthesis{rcode: dns.RcodeSuccess, proof: []*rrset{n}}
+	}
+
+	// The closest encloser proof: the closest encloser matches, the next closer name is covered.
+	idx := dns.Split(qname)
+	var ce, ncCover *rrset
+	wildcard := ""
+	for i := 1; i < len(idx) && dns.IsSubDomain(zone, qname[idx[i]:]); i++ {
+		if ce = z.nsec3Match(qname[idx[i]:], now); ce != nil {
+			ncCover = z.nsec3Cover(qname[idx[i-1]:], now)
+			wildcard = "*." + strings.ToLower(qname[idx[i]:])
+			break
+		}
+	}
+	if ce == nil || ncCover == nil {
+		return nil
+	}
+	// With opt-out there could be an unsigned delegation for the name.
+	if ncCover.rrs[0].(*dns.NSEC3).Flags&1 == 1 || cut(ce.rrs[0].(*dns.NSEC3).TypeBitMap) {
+		return nil
+	}
+
+	if w := z.nsec3Match(wildcard, now); w != nil {
+		return z.fromWildcard(wildcard, qtype, w.rrs[0].(*dns.NSEC3).TypeBitMap, []*rrset{ncCover}, []*rrset{ce, ncCover, w}, now)
+	}
+	wcover := z.nsec3Cover(wildcard, now)
+	if wcover == nil {
+		return nil
+	}
+	return &synthesis{rcode: dns.RcodeNameError, proof: []*rrset{ce, ncCover, wcover}}
+}
+
+// fromWildcard returns the answer from the wildcard, that exists with the types in bitmap, with the
+// proof that qname doesn't exist. Or no data, with the proof including the wildcard's record.
+func (z *nsecZone) fromWildcard(wildcard string, qtype uint16, bitmap []uint16, answerProof, nodataProof []*rrset, now time.Time) *synthesis {
+	if hasBit(bitmap, qtype) {
+		w, ok := z.wildcards[rrsetKey(wildcard, qtype)]
+		if !ok || !w.expire.After(now) {
+			return nil
+		}
+		return &synthesis{rcode: dns.RcodeSuccess, wildcard: w, proof: answerProof}
+	}
+	if hasBit(bitmap, dns.TypeCNAME) {
+		return nil
+	}
+	return &synthesis{rcode: dns.RcodeSuccess, proof: nodataProof}
+}
+
+func (z *nsecZone) nsecMatch(name string, now time.Time) *rrset {
+	i := sort.Search(len(z.nsec), func(i int) bool { return compare(z.nsec[i], name, false) >= 0 })
+	if i < len(z.nsec) && compare(z.nsec[i], name, false) == 0 && z.nsec[i].expire.After(now) {
+		return z.nsec[i]
+	}
+	return nil
+}
+
+// nsecCover returns the NSEC record that covers name, the one with the owner name just before it,
+// if its next name is after name, or is the apex.
+func (z *nsecZone) nsecCover(name string, now time.Time) *rrset {
+	i := sort.Search(len(z.nsec), func(i int) bool { return compare(z.nsec[i], name, false) >= 0 })
+	if i == 0 {
+		return nil
+	}
+	n := z.nsec[i-1]
+	next := n.rrs[0].(*dns.NSEC).NextDomain
+	if !n.expire.After(now) {
+		return nil
+	}
+	if dnsutil.CanonicalCompare(name, next) < 0 || dnsutil.CanonicalCompare(next, n.rrs[0].Header().Name) <= 0 {
+		return n
+	}
+	return nil
+}
+
+func (z *nsecZone) nsec3Match(name string, now time.Time) *rrset {
+	if len(z.nsec3) == 0 {
+		return nil
+	}
+	h := hashName(z.nsec3[0].rrs[0].(*dns.NSEC3), name)
+	i := sort.Search(len(z.nsec3), func(i int) bool { return compare(z.nsec3[i], h, true) >= 0 })
+	if i < len(z.nsec3) && compare(z.nsec3[i], h, true) == 0 && z.nsec3[i].expire.After(now) {
+		return z.nsec3[i]
+	}
+	return nil
+}
+
+// nsec3Cover returns the NSEC3 record that covers the hash of name.
+func (z *nsecZone) nsec3Cover(name string, now time.Time) *rrset {
+	if len(z.nsec3) == 0 {
+		return nil
+	}
+	h := hashName(z.nsec3[0].rrs[0].(*dns.NSEC3), name)
+	i := sort.Search(len(z.nsec3), func(i int) bool { return compare(z.nsec3[i], h, true) >= 0 })
+	if i < len(z.nsec3) && compare(z.nsec3[i], h, true) == 0 {
+		return nil // it matches
+	}
+	if i == 0 {
+		// Only the last record in the chain, with the first hash as next, can cover it.
+		i = len(z.nsec3)
+	}
+	n := z.nsec3[i-1]
+	owner, next := hashOf(n), strings.ToUpper(n.rrs[0].(*dns.NSEC3).NextDomain)
+	if !n.expire.After(now) {
+		return nil
+	}
+	if (owner < h && h < next) || (next <= owner && (h > owner || h < next)) {
+		return n
+	}
+	return nil
+}
+
+// compare compares the owner of the record in set with name, for NSEC3 records name is a hash.
+func compare(set *rrset, name string, nsec3 bool) int {
+	if nsec3 {
+		return strings.Compare(hashOf(set), name)
+	}
+	return dnsutil.CanonicalCompare(set.rrs[0].Header().Name, name)
+}
+
+// hashOf returns the hash in the owner name of the NSEC3 record in set.
+func hashOf(set *rrset) string {
+	owner := set.rrs[0].Header().Name
+	i, _ := dns.NextLabel(owner, 0)
+	return strings.ToUpper(strings.TrimSuffix(owner[:i], "."))
+}
+
+func hashName(n *dns.NSEC3, name string) string {
+	return dns.HashName(name, n.Hash, n.Iterations, n.Salt)
+}
+
+func sameParams(a, b *dns.NSEC3) bool {
+	return a.Hash == b.Hash && a.Iterations == b.Iterations && strings.EqualFold(a.Salt, b.Salt)
+}
+
+// nodata returns true if bitmap, of an NSEC(3) record matching the name, proves there is no RRset of
+// qtype. The parent side of a delegation only proves there is no DS, the apex of a zone can't.
+func nodata(bitmap []uint16, qtype uint16, apex bool) bool {
+	if hasBit(bitmap, qtype) || hasBit(bitmap, dns.TypeCNAME) {
+		return false
+	}
+	if cut(bitmap) {
+		return qtype == dns.TypeDS
+	}
+	return !(qtype == dns.TypeDS && apex)
+}
+
+// cut returns true if bitmap is of a delegation, or a DNAME: the names below it are in another zone
+// or don't exist.
+func cut(bitmap []uint16) bool {
+	return (hasBit(bitmap, dns.TypeNS) && !hasBit(bitmap, dns.TypeSOA)) || hasBit(bitmap, dns.TypeDNAME)
+}
+
+func hasBit(bitmap []uint16, t uint16) bool {
+	for _, x := range bitmap {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+func rrsetKey(name string, t uint16) string {
+	return strings.ToLower(name) + "/" + dns.TypeToString[t]
+}
+
+// rrSets returns the RRsets in rrs, without the signatures.
+func rrSets(rrs []dns.RR) [][]dns.RR {
+	sets := map[string][]dns.RR{}
+	order := []string{}
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeRRSIG || h.Rrtype == dns.TypeOPT {
+			continue
+		}
+		k := rrsetKey(h.Name, h.Rrtype)
+		if _, ok := sets[k]; !ok {
+			order = append(order, k)
+		}
+		sets[k] = append(sets[k], rr)
+	}
+	rrsets := make([][]dns.RR, len(order))
+	for i, k := range order {
+		rrsets[i] = sets[k]
+	}
+	return rrsets
+}
+
+// ttl returns the TTL t in seconds as a duration, no longer than max.
+func ttl(t uint32, max time.Duration) time.Duration {
+	d := time.Duration(t) * time.Second
+	if d > max {
+		return max
+	}
+	return d
+}
@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// The NSEC chain of example.org., sub.example.org. is a delegation and there is a wildcard below
+// w.example.org., an empty non-terminal.
+var nsecChain = map[string]dns.RR{
+	"example.org.":     nsec("example.org.", "a.example.org.", dns.TypeSOA, dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY),
+	"a.example.org.":   nsec("a.example.org.", "sub.example.org.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC),
+	"sub.example.org.": nsec("sub.example.org.", "*.w.example.org.", dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC),
+	"*.w.example.org.": nsec("*.w.example.org.", "www.example.org.", dns.TypeTXT, dns.TypeRRSIG, dns.TypeNSEC),
+	"www.example.org.": nsec("www.example.org.", "example.org.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC),
+}
+
+func TestNSECSynthesize(t *testing.T) {
+	c := newNSECCache(defaultCap)
+	now := time.Now()
+
+	// What a validating upstream told us: b.example.org., t.example.org. and zz.example.org. don't
+	// exist, and x.w.example.org. has a TXT record from the wildcard.
+	c.add(negative("b.example.org.", dns.RcodeNameError, nsecChain["a.example.org."], nsecChain["example.org."]), now, time.Hour)
+	c.add(negative("t.example.org.", dns.RcodeNameError, nsecChain["sub.example.org."], nsecChain["example.org."]), now, time.Hour)
+	c.add(negative("zz.example.org.", dns.RcodeNameError, nsecChain["www.example.org."], nsecChain["example.org."]), now, time.Hour)
+	wildcard := new(dns.Msg)
+	wildcard.SetQuestion("x.w.example.org.", dns.TypeTXT)
+	txt := test.TXT(`x.w.example.org. 3600 IN TXT "wildcard"`)
+	wildcard.Answer = []dns.RR{txt, sig(txt, 3)}
+	wildcard.Ns = []dns.RR{nsecChain["*.w.example.org."], sig(nsecChain["*.w.example.org."], 4)}
+	c.add(wildcard, now, time.Hour)
+
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		found  bool
+		rcode  int
+		answer int
+	}{
+		{"c.example.org.", dns.TypeA, true, dns.RcodeNameError, 0},
+		{"zzz.example.org.", dns.TypeA, true, dns.RcodeNameError, 0},
+		{"x.c.example.org.", dns.TypeA, true, dns.RcodeNameError, 0},
+		{"a.example.org.", dns.TypeMX, true, dns.RcodeSuccess, 0},
+		{"a.example.org.", dns.TypeA, false, 0, 0},
+		{"w.example.org.", dns.TypeA, true, dns.RcodeSuccess, 0}, // empty non-terminal
+		{"y.w.example.org.", dns.TypeTXT, true, dns.RcodeSuccess, 2},
+		{"y.w.example.org.", dns.TypeA, true, dns.RcodeSuccess, 0},
+		{"x.sub.example.org.", dns.TypeA, false, 0, 0}, // below a delegation
+		{"sub.example.org.", dns.TypeA, false, 0, 0},
+		{"sub.example.org.", dns.TypeDS, true, dns.RcodeSuccess, 0},
+		{"example.org.", dns.TypeDS, false, 0, 0},
+		{"example.net.", dns.TypeA, false, 0, 0},
+	}
+	for i, tc := range tests {
+		m := c.synthesize(tc.qname, tc.qtype, now)
+		if (m != nil) != tc.found {
+			t.Errorf("Test %d: expected synthesized %t for %s %s, got %v", i, tc.found, tc.qname, dns.TypeToString[tc.qtype], m)
+			continue
+		}
+		if m == nil {
+			continue
+		}
+		if m.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, m.Rcode)
+		}
+		if len(m.Answer) != tc.answer {
+			t.Errorf("Test %d: expected %d answer records, got %d", i, tc.answer, len(m.Answer))
+		}
+		for _, rr := range m.Answer {
+			if rr.Header().Name != tc.qname {
+				t.Errorf("Test %d: expected the answer for %s, got %s", i, tc.qname, rr)
+			}
+		}
+		if tc.answer == 0 && (len(m.Ns) == 0 || m.Ns[0].Header().Rrtype != dns.TypeSOA) {
+			t.Errorf("Test %d: expected the SOA record first in the authority section", i)
+		}
+	}
+
+	// Nothing is synthesized once the records expire.
+	if m := c.synthesize("c.example.org.", dns.TypeA, now.Add(time.Hour)); m != nil {
+		t.Errorf("Expected nothing synthesized from expired records, got %v", m)
+	}
+}
+
+func TestNSEC3Synthesize(t *testing.T) {
+	for _, optOut := range []bool{false, true} {
+		c := newNSECCache(defaultCap)
+		now := time.Now()
+		c.add(negative("b.example.org.", dns.RcodeNameError, nsec3Chain(optOut, "example.org.", "a.example.org.", "www.example.org.")...), now, time.Hour)
+
+		// With opt-out there could be an insecure delegation for c.example.org.
+		if m := c.synthesize("c.example.org.", dns.TypeA, now); (m != nil) == optOut {
+			t.Errorf("Expected synthesized %t for opt-out %t, got %v", !optOut, optOut, m)
+		} else if m != nil && m.Rcode != dns.RcodeNameError {
+			t.Errorf("Expected NXDOMAIN, got %d", m.Rcode)
+		}
+		if m := c.synthesize("a.example.org.", dns.TypeMX, now); m == nil || m.Rcode != dns.RcodeSuccess {
+			t.Errorf("Expected no data for a.example.org. MX, got %v", m)
+		}
+		if m := c.synthesize("a.example.org.", dns.TypeA, now); m != nil {
+			t.Errorf("Expected nothing synthesized for a.example.org. A, got %v", m)
+		}
+	}
+}
+
+func TestNSECCapacity(t *testing.T) {
+	c := newNSECCache(2)
+	now := time.Now()
+	c.add(negative("b.example.org.", dns.RcodeNameError, nsecChain["a.example.org."], nsecChain["example.org."]), now, time.Hour)
+	c.add(negative("zz.example.org.", dns.RcodeNameError, nsecChain["www.example.org."]), now, time.Hour)
+	if c.size > 2 || c.size != c.held() {
+		t.Errorf("Expected at most 2 records, got %d, holding %d", c.size, c.held())
+	}
+
+	// Many zones, each with an NSEC record at the apex that covers b.<zone> and *.<zone>.
+	c = newNSECCache(5)
+	for i := 0; i < 20; i++ {
+		zone := fmt.Sprintf("example%d.org.", i)
+		m := new(dns.Msg)
+		m.SetQuestion("b."+zone, dns.TypeA)
+		m.Response, m.AuthenticatedData, m.Rcode = true, true, dns.RcodeNameError
+		soa := test.SOA(zone + " 3600 IN SOA ns." + zone + " hostmaster." + zone + " 1 7200 3600 1209600 3600")
+		n := nsec(zone, "c."+zone, dns.TypeSOA, dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC)
+		m.Ns = []dns.RR{soa, signer(sig(soa, 2), zone), n, signer(sig(n, 2), zone)}
+		c.add(m, now, time.Hour)
+
+		if c.size > 5 || c.size != c.held() {
+			t.Fatalf("Zone %d: expected at most 5 records, got %d, holding %d", i, c.size, c.held())
+		}
+		if _, ok := c.zones[zone]; !ok || c.size == 0 {
+			t.Fatalf("Zone %d: expected the records of %s to be held", i, zone)
+		}
+		if m := c.synthesize("b."+zone, dns.TypeA, now); m == nil {
+			t.Errorf("Zone %d: expected b.%s to be synthesized", i, zone)
+		}
+	}
+}
+
+// held returns the number of records held in c.
+func (c *nsecCache) held() int {
+	n := 0
+	for _, z := range c.zones {
+		n += z.records()
+	}
+	return n
+}
+
+func TestCacheAggressiveNSEC(t *testing.T) {
+	c := New()
+	c.nsec = newNSECCache(defaultCap)
+	backend := 0
+	c.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		backend++
+		m := negative(r.Question[0].Name, dns.RcodeNameError, nsecChain["a.example.org."], nsecChain["example.org."])
+		m.SetRcode(r, dns.RcodeNameError)
+		m.AuthenticatedData = true
+		m.SetEdns0(4096, true)
+		w.WriteMsg(m)
+		return dns.RcodeNameError, nil
+	})
+
+	for i, qname := range []string{"b.example.org.", "c.example.org.", "d.example.org."} {
+		req := new(dns.Msg)
+		req.SetQuestion(qname, dns.TypeA)
+		req.SetEdns0(4096, i != 2)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, req)
+
+		// Without the DO bit the client doesn't care about validation.
+		if rec.Msg.Rcode != dns.RcodeNameError || rec.Msg.AuthenticatedData != (i != 2) {
+			t.Errorf("Test %d: expected a validated NXDOMAIN, got %v", i, rec.Msg)
+		}
+		sigs := 0
+		for _, rr := range rec.Msg.Ns {
+			if rr.Header().Rrtype == dns.TypeRRSIG {
+				sigs++
+			}
+		}
+		if i != 2 && sigs == 0 || i == 2 && sigs != 0 {
+			t.Errorf("Test %d: expected signatures only with the DO bit, got %d", i, sigs)
+		}
+	}
+	if backend != 1 {
+		t.Errorf("Expected the backend to be asked once, got %d", backend)
+	}
+}
+
+// negative returns a signed, validated, negative response for qname from example.org. with the
+// NSEC(3) records in nsecs.
+func negative(qname string, rcode int, nsecs ...dns.RR) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	m.Response, m.AuthenticatedData, m.Rcode = true, true, rcode
+	soa := test.SOA("example.org. 3600 IN SOA ns.example.org. hostmaster.example.org. 1 7200 3600 1209600 3600")
+	m.Ns = []dns.RR{soa, sig(soa, 2)}
+	for _, n := range nsecs {
+		m.Ns = append(m.Ns, n, sig(n, uint8(dns.CountLabel(n.Header().Name))))
+	}
+	return m
+}
+
+func nsec(name, next string, types ...uint16) dns.RR {
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return &dns.NSEC{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600}, NextDomain: next, TypeBitMap: types}
+}
+
+// nsec3Chain returns the NSEC3 chain of example.org. with names, these have A records.
+func nsec3Chain(optOut bool, names ...string) []dns.RR {
+	hashes := []string{}
+	for _, name := range names {
+		hashes = append(hashes, dns.HashName(name, dns.SHA1, 1, "AB"))
+	}
+	sort.Strings(hashes)
+	flags := uint8(0)
+	if optOut {
+		flags = 1
+	}
+	chain := []dns.RR{}
+	for i, h := range hashes {
+		chain = append(chain, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(h) + ".example.org.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 3600},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			Iterations: 1,
+			SaltLength: 1,
+			Salt:       "AB",
+			HashLength: 20,
+			NextDomain: hashes[(i+1)%len(hashes)],
+			TypeBitMap: []uint16{dns.TypeA, dns.TypeRRSIG},
+		})
+	}
+	return chain
+}
+
+// signer returns sig with its signer set to zone.
+func signer(sig dns.RR, zone string) dns.RR {
+	sig.(*dns.RRSIG).SignerName = zone
+	return sig
+}
+
+// sig returns a (fake) signature for rr, signed by example.org.
+func sig(rr dns.RR, labels uint8) dns.RR {
+	h := rr.Header()
+	return &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: h.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: h.Ttl},
+		TypeCovered: h.Rrtype,
+		Algorithm:   dns.ECDSAP256SHA256,
+		Labels:      labels,
+		OrigTtl:     h.Ttl,
+		Expiration:  uint32(time.Now().Add(time.Hour).Unix()),
+		Inception:   uint32(time.Now().Add(-time.Hour).Unix()),
+		KeyTag:      12345,
+		SignerName:  "example.org.",
+		Signature:   "c2lnbmF0dXJl",
+	}
+}
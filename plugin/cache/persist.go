@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+// entry is a cached item in a snapshot.
+type entry struct {
+	Key    uint64
+	Denial bool
+	Stored time.Time
+	TTL    uint32
+	Msg    []byte // the item as a packed message
+}
+
+// save writes the items in the cache, that can still be served, to file.
+func (c *Cache) save(file string) error {
+	now := c.now().UTC()
+	entries := []entry{}
+	for _, x := range []struct {
+		c      *cache.Cache
+		denial bool
+	}{{c.pcache, false}, {c.ncache, true}} {
+		x.c.Walk(func(key uint64, el interface{}) bool {
+			i := el.(*item)
+			if c.expired(i, now) {
+				return true
+			}
+			buf, err := i.pack()
+			if err != nil {
+				return true
+			}
+			entries = append(entries, entry{Key: key, Denial: x.denial, Stored: i.stored, TTL: i.origTTL, Msg: buf})
+			return true
+		})
+	}
+
+	// Write to a temporary file first, so a crash doesn't leave half a snapshot.
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := gob.NewEncoder(f).Encode(entries); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// load adds the items in the snapshot in file to the cache, skipping those that can't be served
+// anymore. It returns the number of items added.
+func (c *Cache) load(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	entries := []entry{}
+	if err := gob.NewDecoder(f).Decode(&entries); err != nil {
+		return 0, err
+	}
+	now := c.now().UTC()
+	n := 0
+	for _, e := range entries {
+		i, err := unpack(e.Msg)
+		if err != nil {
+			continue
+		}
+		i.stored, i.origTTL = e.Stored, e.TTL
+		if c.expired(i, now) {
+			continue
+		}
+		if e.Denial {
+			c.ncache.Add(e.Key, i)
+		} else {
+			c.pcache.Add(e.Key, i)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// expired returns true if i can't be served anymore, not even as a stale item.
+func (c *Cache) expired(i *item, now time.Time) bool {
+	return time.Duration(-i.ttl(now))*time.Second >= c.staleUpTo
+}
+
+// persist saves the cache to file every interval, until stop is closed.
+func (c *Cache) persist(file string, interval time.Duration, stop chan struct{}) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := c.save(file); err != nil {
+				log.Errorf("Failed to save the cache to %q: %s", file, err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// pack returns i as a packed message.
+func (i *item) pack() ([]byte, error) {
+	m := new(dns.Msg)
+	m.Response = true
+	m.Rcode = i.Rcode
+	m.Authoritative = i.Authoritative
+	m.AuthenticatedData = i.AuthenticatedData
+	m.RecursionAvailable = i.RecursionAvailable
+	m.Answer, m.Ns, m.Extra = i.Answer, i.Ns, i.Extra
+	return m.Pack()
+}
+
+// unpack returns the item in buf, a packed message. The caller sets the TTL.
+func unpack(buf []byte) (*item, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return newItem(m, time.Time{}, 0), nil
+}
+
+// handover holds the caches of the instance that is being reloaded, by server block and
+// configuration, so the new instance can take them over when its configuration is unchanged.
+var handover = struct {
+	sync.Mutex
+	m map[string]*Cache
+}{m: map[string]*Cache{}}
+
+// handOver offers the caches of c to the next instance.
+func (c *Cache) handOver(key string) {
+	handover.Lock()
+	handover.m[key] = c
+	handover.Unlock()
+}
+
+// takeOver uses the caches of the previous instance with the same key, if there is one. It returns
+// true if it did.
+func (c *Cache) takeOver(key string) bool {
+	handover.Lock()
+	defer handover.Unlock()
+	old, ok := handover.m[key]
+	if !ok {
+		return false
+	}
+	delete(handover.m, key)
+	c.pcache, c.ncache, c.nsec = old.pcache, old.ncache, old.nsec
+	return true
+}
+
+// withdraw removes the caches of c from the handover, if they were not taken.
+func (c *Cache) withdraw(key string) {
+	handover.Lock()
+	if handover.m[key] == c {
+		delete(handover.m, key)
+	}
+	handover.Unlock()
+}
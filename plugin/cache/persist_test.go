@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestPersist(t *testing.T) {
+	now := time.Now()
+	c := New()
+	c.now = func() time.Time { return now }
+	c.Next = BackendHandler() // answers with a TTL of 303
+
+	for _, q := range []struct {
+		name  string
+		qtype uint16
+	}{{"a.example.org.", dns.TypeA}, {"b.example.org.", dns.TypeA}} {
+		req := new(dns.Msg)
+		req.SetQuestion(q.name, q.qtype)
+		c.ServeDNS(context.TODO(), &test.ResponseWriter{}, req)
+	}
+	nx := new(dns.Msg)
+	nx.SetQuestion("nx.example.org.", dns.TypeA)
+	nx.Response, nx.Rcode = true, dns.RcodeNameError
+	nx.Ns = []dns.RR{test.SOA("example.org. 60 IN SOA ns.example.org. hostmaster.example.org. 1 7200 3600 1209600 60")}
+	c.Set(nx)
+
+	file := filepath.Join(t.TempDir(), "cache")
+	if err := c.save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// A minute and a half later the denial has expired.
+	now = now.Add(90 * time.Second)
+	c1 := New()
+	c1.now = c.now
+	n, err := c1.load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Expected %d items to be loaded, got %d", 2, n)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("a.example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	c1.Next = test.NextHandler(dns.RcodeServerFailure, nil)
+	c1.ServeDNS(context.TODO(), rec, req)
+	if len(rec.Msg.Answer) != 1 || rec.Msg.Answer[0].Header().Ttl != 303-90 {
+		t.Errorf("Expected the cached answer with a TTL of %d, got %v", 303-90, rec.Msg)
+	}
+	if _, ok := c1.Get("nx.example.org.", dns.TypeA); ok {
+		t.Errorf("Expected the expired denial not to be loaded")
+	}
+
+	// With serve_stale expired items are kept.
+	c2 := New()
+	c2.now = c.now
+	c2.staleUpTo = time.Hour
+	if n, _ := c2.load(file); n != 3 {
+		t.Errorf("Expected %d items to be loaded, got %d", 3, n)
+	}
+}
+
+func TestHandover(t *testing.T) {
+	old := New()
+	old.handOver("key")
+
+	c := New()
+	if !c.takeOver("key") || c.pcache != old.pcache || c.ncache != old.ncache {
+		t.Errorf("Expected the caches to be taken over")
+	}
+	// Old withdraws after the new instance started, that doesn't matter.
+	old.withdraw("key")
+
+	c1 := New()
+	if c1.takeOver("key") {
+		t.Errorf("Expected the caches to be taken over only once")
+	}
+
+	old.handOver("key")
+	old.withdraw("key")
+	if c1.takeOver("key") {
+		t.Errorf("Expected withdrawn caches not to be taken over")
+	}
+}
@@ -2,7 +2,10 @@ package cache
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/core/dnsserver"
@@ -33,10 +36,52 @@ func setup(c *caddy.Controller) error {
 		return ca
 	})
 
+	// On reload the caches are handed over to the new instance, if the configuration is unchanged.
+	key := handoverKey(c, ca)
+	reloaded := ca.takeOver(key)
+	c.OnRestart(func() error {
+		ca.handOver(key)
+		return nil
+	})
+	c.OnRestartFailed(func() error {
+		ca.withdraw(key)
+		return nil
+	})
+
+	if ca.persistFile != "" {
+		stop := make(chan struct{})
+		c.OnStartup(func() error {
+			if !reloaded {
+				n, err := ca.load(ca.persistFile)
+				switch {
+				case err == nil:
+					log.Infof("Loaded %d items from %q", n, ca.persistFile)
+				case !os.IsNotExist(err):
+					log.Warningf("Failed to load the cache from %q: %s", ca.persistFile, err)
+				}
+			}
+			if ca.persistInterval > 0 {
+				go ca.persist(ca.persistFile, ca.persistInterval, stop)
+			}
+			return nil
+		})
+		c.OnShutdown(func() error {
+			close(stop)
+			if err := ca.save(ca.persistFile); err != nil {
+				log.Errorf("Failed to save the cache to %q: %s", ca.persistFile, err)
+			}
+			return nil
+		})
+	}
+	c.OnShutdown(func() error {
+		ca.withdraw(key)
+		return nil
+	})
+
 	c.OnStartup(func() error {
 		metrics.MustRegister(c,
-			cacheSize, cacheHits, cacheMisses,
-			cachePrefetches, cacheDrops)
+			cacheSize, cacheBytes, cacheHits, cacheMisses,
+			cachePrefetches, cacheDrops, cacheSynthesized, cacheServedStale)
 		return nil
 	})
 
@@ -45,6 +90,7 @@ func setup(c *caddy.Controller) error {
 
 func cacheParse(c *caddy.Controller) (*Cache, error) {
 	ca := New()
+	config := dnsserver.GetConfig(c)
 
 	j := 0
 	for c.Next() {
@@ -84,11 +130,11 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 				if len(args) == 0 {
 					return nil, c.ArgErr()
 				}
-				pcap, err := strconv.Atoi(args[0])
+				pcap, bytes, err := capacity(args[0])
 				if err != nil {
 					return nil, err
 				}
-				ca.pcap = pcap
+				ca.pcap, ca.pbytes = pcap, bytes
 				if len(args) > 1 {
 					pttl, err := strconv.Atoi(args[1])
 					if err != nil {
@@ -116,11 +162,11 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 				if len(args) == 0 {
 					return nil, c.ArgErr()
 				}
-				ncap, err := strconv.Atoi(args[0])
+				ncap, bytes, err := capacity(args[0])
 				if err != nil {
 					return nil, err
 				}
-				ca.ncap = ncap
+				ca.ncap, ca.nbytes = ncap, bytes
 				if len(args) > 1 {
 					nttl, err := strconv.Atoi(args[1])
 					if err != nil {
@@ -180,6 +226,67 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 					}
 					ca.percentage = num
 				}
+			case "aggressive_nsec":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				ncap := defaultCap
+				if len(args) > 0 {
+					var err error
+					if ncap, err = strconv.Atoi(args[0]); err != nil {
+						return nil, err
+					}
+					if ncap <= 0 {
+						return nil, fmt.Errorf("aggressive_nsec capacity should be positive: %d", ncap)
+					}
+				}
+				ca.nsec = newNSECCache(ncap)
+			case "serve_stale":
+				args := c.RemainingArgs()
+				if len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ca.staleUpTo = defaultStaleUpTo
+				if len(args) > 0 {
+					d, err := time.ParseDuration(args[0])
+					if err != nil {
+						return nil, err
+					}
+					if d <= 0 {
+						return nil, fmt.Errorf("serve_stale duration should be positive: %s", d)
+					}
+					ca.staleUpTo = d
+				}
+				if len(args) > 1 {
+					switch args[1] {
+					case "verify":
+						ca.verifyStale = true
+					case "immediate":
+						ca.verifyStale = false
+					default:
+						return nil, fmt.Errorf("invalid value for serve_stale refresh mode: %s", args[1])
+					}
+				}
+			case "persist":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ca.persistFile = args[0]
+				if !filepath.IsAbs(ca.persistFile) && config.Root != "" {
+					ca.persistFile = filepath.Join(config.Root, ca.persistFile)
+				}
+				if len(args) > 1 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if d <= 0 {
+						return nil, fmt.Errorf("persist interval should be positive: %s", d)
+					}
+					ca.persistInterval = d
+				}
 
 			default:
 				return nil, c.ArgErr()
@@ -191,9 +298,60 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 		}
 		ca.Zones = origins
 
-		ca.pcache = cache.New(ca.pcap)
-		ca.ncache = cache.New(ca.ncap)
+		ca.pcache = newCache(ca.pcap, ca.pbytes)
+		ca.ncache = newCache(ca.ncap, ca.nbytes)
 	}
 
 	return ca, nil
 }
+
+// capacity parses a capacity: a number of items, or a number of bytes when it has a suffix of B, KB,
+// MB or GB.
+func capacity(s string) (int, bool, error) {
+	mult := 0
+	for _, u := range []struct {
+		suffix string
+		mult   int
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSuffix(s, u.suffix), u.mult
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false, err
+	}
+	if mult == 0 {
+		return n, false, nil
+	}
+	if n*mult < minBytes {
+		return 0, false, fmt.Errorf("cache capacity in bytes should be at least %d: %d", minBytes, n*mult)
+	}
+	return n * mult, true, nil
+}
+
+// minBytes is the smallest capacity in bytes, it leaves 1KB for each shard of the cache.
+const minBytes = 256 << 10
+
+// handoverKey returns the key for the caches of ca in the handover, it is made of the server block and
+// the configuration.
+func handoverKey(c *caddy.Controller, ca *Cache) string {
+	nsec := 0
+	if ca.nsec != nil {
+		nsec = ca.nsec.cap
+	}
+	return fmt.Sprintf("%v %v %d %t %d %t %s %s %s %s %d %s %d %d %s %t %s %s",
+		c.ServerBlockKeys, ca.Zones,
+		ca.pcap, ca.pbytes, ca.ncap, ca.nbytes, ca.pttl, ca.minpttl, ca.nttl, ca.minnttl,
+		ca.prefetch, ca.duration, ca.percentage,
+		nsec, ca.staleUpTo, ca.verifyStale,
+		ca.persistFile, ca.persistInterval)
+}
+
+func newCache(size int, bytes bool) *cache.Cache {
+	if bytes {
+		return cache.NewBytes(size)
+	}
+	return cache.New(size)
+}
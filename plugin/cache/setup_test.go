@@ -113,3 +113,206 @@ func TestSetup(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupAggressiveNSEC(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		cap       int
+	}{
+		{`cache`, false, 0},
+		{`cache {
+				aggressive_nsec
+			}`, false, defaultCap},
+		{`cache {
+				aggressive_nsec 100
+			}`, false, 100},
+		// fails
+		{`cache {
+				aggressive_nsec 0
+			}`, true, 0},
+		{`cache {
+				aggressive_nsec many
+			}`, true, 0},
+		{`cache {
+				aggressive_nsec 10 20
+			}`, true, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		ca, err := cacheParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %v: Expected error but found nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		cap := 0
+		if ca.nsec != nil {
+			cap = ca.nsec.cap
+		}
+		if cap != test.cap {
+			t.Errorf("Test %v: Expected aggressive_nsec capacity %d, got %d", i, test.cap, cap)
+		}
+	}
+}
+
+func TestSetupServeStale(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		staleUpTo time.Duration
+		verify    bool
+	}{
+		{`cache`, false, 0, true},
+		{`cache {
+				serve_stale
+			}`, false, time.Hour, true},
+		{`cache {
+				serve_stale 20m
+			}`, false, 20 * time.Minute, true},
+		{`cache {
+				serve_stale 1h immediate
+			}`, false, time.Hour, false},
+		{`cache {
+				serve_stale 1h verify
+			}`, false, time.Hour, true},
+		// fails
+		{`cache {
+				serve_stale 0s
+			}`, true, 0, false},
+		{`cache {
+				serve_stale 20
+			}`, true, 0, false},
+		{`cache {
+				serve_stale 1h later
+			}`, true, 0, false},
+		{`cache {
+				serve_stale 1h verify 10
+			}`, true, 0, false},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		ca, err := cacheParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %v: Expected error but found nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if ca.staleUpTo != test.staleUpTo {
+			t.Errorf("Test %v: Expected serve_stale duration %s, got %s", i, test.staleUpTo, ca.staleUpTo)
+		}
+		if ca.verifyStale != test.verify {
+			t.Errorf("Test %v: Expected verify %t, got %t", i, test.verify, ca.verifyStale)
+		}
+	}
+}
+
+func TestSetupCapacityBytes(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		pcap      int
+		pbytes    bool
+		ncap      int
+		nbytes    bool
+	}{
+		{`cache {
+				success 5000
+			}`, false, 5000, false, defaultCap, false},
+		{`cache {
+				success 64MB
+				denial 512KB
+			}`, false, 64 << 20, true, 512 << 10, true},
+		{`cache {
+				success 1GB
+				denial 300000B
+			}`, false, 1 << 30, true, 300000, true},
+		// fails
+		{`cache {
+				success 0MB
+			}`, true, 0, false, 0, false},
+		{`cache {
+				denial 100KB
+			}`, true, 0, false, 0, false},
+		{`cache {
+				denial 10TB
+			}`, true, 0, false, 0, false},
+		{`cache {
+				denial MB
+			}`, true, 0, false, 0, false},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		ca, err := cacheParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %v: Expected error but found nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if ca.pcap != test.pcap || ca.pbytes != test.pbytes {
+			t.Errorf("Test %v: Expected success capacity %d (bytes %t), got %d (bytes %t)", i, test.pcap, test.pbytes, ca.pcap, ca.pbytes)
+		}
+		if ca.ncap != test.ncap || ca.nbytes != test.nbytes {
+			t.Errorf("Test %v: Expected denial capacity %d (bytes %t), got %d (bytes %t)", i, test.ncap, test.nbytes, ca.ncap, ca.nbytes)
+		}
+	}
+}
+
+func TestSetupPersist(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		file      string
+		interval  time.Duration
+	}{
+		{`cache`, false, "", 0},
+		{`cache {
+				persist /var/lib/coredns/cache
+			}`, false, "/var/lib/coredns/cache", 0},
+		{`cache {
+				persist /var/lib/coredns/cache 5m
+			}`, false, "/var/lib/coredns/cache", 5 * time.Minute},
+		// fails
+		{`cache {
+				persist
+			}`, true, "", 0},
+		{`cache {
+				persist /var/lib/coredns/cache 0s
+			}`, true, "", 0},
+		{`cache {
+				persist /var/lib/coredns/cache 5m 10m
+			}`, true, "", 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		ca, err := cacheParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %v: Expected error but found nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if ca.persistFile != test.file || ca.persistInterval != test.interval {
+			t.Errorf("Test %v: Expected persist %q every %s, got %q every %s", i, test.file, test.interval, ca.persistFile, ca.persistInterval)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// getStale returns the expired item for state, if it expired less than staleUpTo ago.
+func (c *Cache) getStale(now time.Time, state request.Request) *item {
+	k := hash(state.Name(), state.QType(), state.Do())
+	for _, ca := range []*cache.Cache{c.ncache, c.pcache} {
+		i, ok := ca.Get(k)
+		if !ok {
+			continue
+		}
+		it := i.(*item)
+		if it.Rcode == dns.RcodeServerFailure {
+			continue
+		}
+		if ttl := it.ttl(now); ttl <= 0 && time.Duration(-ttl)*time.Second < c.staleUpTo {
+			return it
+		}
+	}
+	return nil
+}
+
+// serveStale answers the query in state with the expired item i (RFC 8767). In verify mode the next
+// plugin is asked first, i is used when it fails or doesn't reply within staleTimeout. Otherwise i is
+// used right away and the item is refreshed in the background, by one query at a time.
+func (c *Cache) serveStale(ctx context.Context, state request.Request, server string, i *item, now time.Time) (int, error) {
+	if !c.verifyStale {
+		if atomic.CompareAndSwapInt32(&i.refreshing, 0, 1) {
+			cw := newPrefetchResponseWriter(server, state, c)
+			go func() {
+				plugin.NextOrFailure(c.Name(), c.Next, ctx, cw, state.Req)
+				// A successful refresh replaces i, after a failure the next query tries again.
+				atomic.StoreInt32(&i.refreshing, 0)
+			}()
+		}
+		return c.writeStale(state, server, i)
+	}
+
+	// The reply is cached when it arrives, even if we've given up on it.
+	cw := &staleResponseWriter{ResponseWriter: newPrefetchResponseWriter(server, state, c)}
+	done := make(chan struct{})
+	var (
+		rcode int
+		err   error
+	)
+	go func() {
+		rcode, err = plugin.NextOrFailure(c.Name(), c.Next, ctx, cw, state.Req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if cw.msg != nil && cw.msg.Rcode != dns.RcodeServerFailure {
+			state.W.WriteMsg(cw.msg)
+			return rcode, err
+		}
+	case <-time.After(c.staleTimeout):
+	}
+	return c.writeStale(state, server, i)
+}
+
+// writeStale writes the reply from the expired item i, with TTLs of staleTTL.
+func (c *Cache) writeStale(state request.Request, server string, i *item) (int, error) {
+	cacheServedStale.WithLabelValues(server).Inc()
+	// The TTLs in the reply are what's left of the item's TTL at this time.
+	at := i.stored.Add(time.Duration(int(i.origTTL)-staleTTL) * time.Second)
+	state.W.WriteMsg(i.toMsg(state.Req, at))
+	return dns.RcodeSuccess, nil
+}
+
+// staleResponseWriter caches the reply, and keeps it so it can be written to the client later.
+type staleResponseWriter struct {
+	*ResponseWriter
+	msg *dns.Msg
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *staleResponseWriter) WriteMsg(res *dns.Msg) error {
+	err := w.ResponseWriter.WriteMsg(res)
+	w.msg = res
+	return err
+}
+
+const (
+	defaultStaleUpTo    = 1 * time.Hour
+	defaultStaleTimeout = 1800 * time.Millisecond // the client response timer of RFC 8767
+	staleTTL            = 30                      // the TTL in seconds of stale replies
+)
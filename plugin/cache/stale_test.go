@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		verify bool
+		down   func() (int, error) // what the backend does after the first query, nil is up
+		answer string              // expected after the item expired
+		rcode  int                 // expected after the item is too stale
+	}{
+		{"immediate", false, nil, "example.org. 30 IN A 127.0.0.1", dns.RcodeSuccess},
+		{"verify up", true, nil, "example.org. 10 IN A 127.0.0.2", dns.RcodeSuccess},
+		{"verify failure", true, func() (int, error) { return dns.RcodeServerFailure, errors.New("no healthy upstreams") }, "example.org. 30 IN A 127.0.0.1", dns.RcodeServerFailure},
+		{"verify timeout", true, func() (int, error) { time.Sleep(200 * time.Millisecond); return dns.RcodeServerFailure, nil }, "example.org. 30 IN A 127.0.0.1", dns.RcodeServerFailure},
+	}
+
+	t0 := time.Now()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New()
+			c.staleUpTo = time.Hour
+			c.verifyStale = tc.verify
+			c.staleTimeout = 50 * time.Millisecond
+			fetchc := make(chan struct{}, 10)
+			c.Next = staleHandler(tc.down, fetchc)
+
+			req := new(dns.Msg)
+			req.SetQuestion("example.org.", dns.TypeA)
+
+			for _, v := range []struct {
+				after  time.Duration
+				answer string
+			}{
+				{0, "example.org. 10 IN A 127.0.0.1"},
+				{20 * time.Second, tc.answer},
+			} {
+				c.now = func() time.Time { return t0.Add(v.after) }
+				rec := dnstest.NewRecorder(&test.ResponseWriter{})
+				c.ServeDNS(context.TODO(), rec, req)
+				select {
+				case <-fetchc:
+				case <-time.After(time.Second):
+					t.Fatalf("After %s: want request to be sent to the backend", v.after)
+				}
+				if rec.Msg == nil || len(rec.Msg.Answer) != 1 {
+					t.Fatalf("After %s: want 1 answer RR, got %v", v.after, rec.Msg)
+				}
+				if want, got := test.A(v.answer).String(), rec.Msg.Answer[0].String(); want != got {
+					t.Errorf("After %s: want answer %s, got %s", v.after, want, got)
+				}
+			}
+
+			c.now = func() time.Time { return t0.Add(2 * time.Hour) }
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			rcode, _ := c.ServeDNS(context.TODO(), rec, req)
+			if rec.Msg != nil {
+				rcode = rec.Msg.Rcode
+			}
+			if rcode != tc.rcode {
+				t.Errorf("After the stale window: want rcode %d, got %d", tc.rcode, rcode)
+			}
+		})
+	}
+}
+
+func TestServeStaleRefreshOnce(t *testing.T) {
+	c := New()
+	c.staleUpTo = time.Hour
+	c.verifyStale = false
+
+	var queries int32
+	release := make(chan struct{})
+	c.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		if atomic.AddInt32(&queries, 1) > 1 {
+			<-release
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, test.A("example.org. 10 IN A 127.0.0.1"))
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+
+	t0 := time.Now()
+	c.now = func() time.Time { return t0 }
+	c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+
+	// While the backend is slow, all queries get the expired item, and only one refreshes it.
+	c.now = func() time.Time { return t0.Add(20 * time.Second) }
+	for i := 0; i < 10; i++ {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, req)
+		if rec.Msg == nil || len(rec.Msg.Answer) != 1 || rec.Msg.Answer[0].Header().Ttl != staleTTL {
+			t.Fatalf("Query %d: want stale answer, got %v", i, rec.Msg)
+		}
+	}
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	if q := atomic.LoadInt32(&queries); q != 2 {
+		t.Errorf("Want 2 queries to the backend, got %d", q)
+	}
+}
+
+// staleHandler returns an A record for example.org. with TTL 10, the address is incremented on every
+// request. After the first request it calls down, if not nil.
+func staleHandler(down func() (int, error), fetchc chan struct{}) plugin.Handler {
+	i := 0
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		defer func() { fetchc <- struct{}{} }()
+		i++
+		if i > 1 && down != nil {
+			return down()
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, test.A(fmt.Sprintf("example.org. 10 IN A 127.0.0.%d", i)))
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
@@ -0,0 +1,99 @@
+// Package catalog implements catalog zones (RFC 9432). A consumer provisions the secondary zones listed
+// in a catalog zone transferred from a primary, a producer generates a catalog zone of the zones served
+// by the file and auto plugins.
+package catalog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
+	"github.com/miekg/dns"
+)
+
+// Catalog serves a catalog zone and, for a consumer, its member zones.
+type Catalog struct {
+	Next plugin.Handler
+
+	origin   string
+	from     []string            // primaries of the catalog and member zones, empty for a producer
+	to       []string            // addresses allowed to transfer the catalog and member zones
+	keys     map[string]tsig.Key // TSIG keys for the from and to addresses
+	interval time.Duration       // how often a producer checks the zones served
+
+	sources func() []plugin.Handler // the handlers of the server block, for a producer
+
+	mu       sync.RWMutex
+	zone     *file.Zone        // the catalog zone
+	members  map[string]member // member zones of a consumer, by name
+	produced []string          // zones listed by a producer
+	zones    file.Zones        // the zones served, replaced on every change
+
+	stop chan struct{}
+}
+
+// member is a member zone of a consumer.
+type member struct {
+	id   string // the unique ID of the member in the catalog
+	zone *file.Zone
+}
+
+// New returns a new Catalog for the catalog zone origin.
+func New(origin string) *Catalog {
+	return &Catalog{
+		origin:   origin,
+		keys:     map[string]tsig.Key{},
+		interval: defaultInterval,
+		members:  map[string]member{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (c *Catalog) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	c.mu.RLock()
+	f := file.File{Next: c.Next, Zones: c.zones}
+	c.mu.RUnlock()
+	return f.ServeDNS(ctx, w, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (c *Catalog) Name() string { return "catalog" }
+
+// OnShutdown stops keeping the catalog, and its member zones, up to date.
+func (c *Catalog) OnShutdown() error {
+	close(c.stop)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.zone != nil {
+		c.zone.OnShutdown()
+	}
+	for _, m := range c.members {
+		m.zone.OnShutdown()
+	}
+	return nil
+}
+
+// rebuild rebuilds the zones served from the catalog zone and the member zones. The caller must hold mu.
+func (c *Catalog) rebuild() {
+	z := make(map[string]*file.Zone, len(c.members)+1)
+	names := make([]string, 0, len(c.members)+1)
+	if c.zone != nil {
+		z[c.origin] = c.zone
+		names = append(names, c.origin)
+	}
+	for name, m := range c.members {
+		z[name] = m.zone
+		names = append(names, name)
+	}
+	c.zones = file.Zones{Z: z, Names: names}
+}
+
+const (
+	defaultInterval = time.Minute
+	syncInterval    = time.Second
+)
@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestMembers(t *testing.T) {
+	rrs := []dns.RR{
+		test.SOA("catalog.example. 0 IN SOA invalid. invalid. 1 3600 600 2147483646 0"),
+		test.NS("catalog.example. 0 IN NS invalid."),
+		test.TXT(`version.catalog.example. 0 IN TXT "2"`),
+		test.PTR("a1.zones.catalog.example. 0 IN PTR example.org."),
+		test.PTR("B2.ZONES.catalog.example. 0 IN PTR Example.NET."),
+		test.PTR("c3.zones.catalog.example. 0 IN PTR example.org."),     // listed twice
+		test.PTR("d4.zones.catalog.example. 0 IN PTR catalog.example."), // the catalog itself
+		test.PTR("ext.a1.zones.catalog.example. 0 IN PTR example.com."), // a property, not a member
+		test.PTR("e5.other.catalog.example. 0 IN PTR example.info."),    // not in zones
+	}
+
+	ids, err := members("catalog.example.", rrs)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	want := map[string]string{"example.org.": "a1", "example.net.": "b2"}
+	if len(ids) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, ids)
+	}
+	for name, id := range want {
+		if ids[name] != id {
+			t.Errorf("Expected ID %q for %s, got %q", id, name, ids[name])
+		}
+	}
+
+	// Without a version, or another version, the catalog is not processed.
+	if _, err := members("catalog.example.", rrs[:2]); err == nil {
+		t.Errorf("Expected error for a catalog without version")
+	}
+	rrs[2] = test.TXT(`version.catalog.example. 0 IN TXT "1"`)
+	if _, err := members("catalog.example.", rrs); err == nil {
+		t.Errorf("Expected error for a version 1 catalog")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	f := file.File{Zones: file.Zones{Names: []string{"example.org.", "example.net.", "catalog.example."}}}
+	c := New("catalog.example.")
+	c.sources = func() []plugin.Handler { return []plugin.Handler{f} }
+
+	c.generate()
+	z := c.zone
+	if z == nil {
+		t.Fatal("Expected a catalog zone")
+	}
+	ids, err := members(c.origin, z.All())
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(ids) != 2 || ids["example.org."] != id("example.org.") || ids["example.net."] != id("example.net.") {
+		t.Errorf("Expected example.org. and example.net., got %v", ids)
+	}
+
+	// Nothing changed, the zone stays the same.
+	c.generate()
+	if c.zone != z {
+		t.Errorf("Expected the catalog zone not to be regenerated")
+	}
+
+	f.Zones.Names = []string{"example.org."}
+	c.generate()
+	if c.zone == z {
+		t.Fatal("Expected the catalog zone to be regenerated")
+	}
+	if serial, prev := c.zone.SOASerialIfDefined(), z.SOASerialIfDefined(); serial <= prev {
+		t.Errorf("Expected serial to increase from %d, got %d", prev, serial)
+	}
+
+	// The catalog zone is served.
+	m := new(dns.Msg)
+	m.SetQuestion("version.catalog.example.", dns.TypeTXT)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := c.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(rec.Msg.Answer) != 1 {
+		t.Errorf("Expected 1 answer, got %d", len(rec.Msg.Answer))
+	}
+}
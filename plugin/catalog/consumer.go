@@ -0,0 +1,110 @@
+package catalog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+
+	"github.com/miekg/dns"
+)
+
+// newZone returns a secondary zone for origin, transferred from the primaries of the catalog.
+func (c *Catalog) newZone(origin string) *file.Zone {
+	z := file.NewZone(origin, "stdin")
+	z.TransferFrom = c.from
+	z.TransferTo = c.to
+	z.TransferKeys = c.keys
+	z.Upstream = upstream.New()
+	return z
+}
+
+// consume keeps the catalog zone up to date, and updates the member zones whenever it changes, until
+// c is shut down.
+func (c *Catalog) consume() {
+	go c.zone.Update()
+
+	serial := int64(-1)
+	tick := time.NewTicker(syncInterval)
+	defer tick.Stop()
+	for {
+		if s := c.zone.SOASerialIfDefined(); s != serial {
+			serial = s
+			c.sync()
+		}
+		select {
+		case <-tick.C:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// sync adds and removes member zones to match the catalog. A member whose unique ID changed is
+// removed and added again, so it's transferred from scratch (RFC 9432, Section 5.4).
+func (c *Catalog) sync() {
+	ids, err := members(c.origin, c.zone.All())
+	if err != nil {
+		log.Errorf("Not processing catalog %s: %s", c.origin, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, m := range c.members {
+		if id, ok := ids[name]; ok && id == m.id {
+			continue
+		}
+		m.zone.OnShutdown()
+		delete(c.members, name)
+		log.Infof("Removed zone %s of catalog %s", name, c.origin)
+	}
+	for name, id := range ids {
+		if _, ok := c.members[name]; ok {
+			continue
+		}
+		z := c.newZone(name)
+		c.members[name] = member{id: id, zone: z}
+		go func() {
+			z.TransferIn()
+			z.Update()
+		}()
+		log.Infof("Added zone %s of catalog %s", name, c.origin)
+	}
+	c.rebuild()
+}
+
+// members returns the member zones listed in the records of the catalog zone origin, with their unique
+// IDs (RFC 9432, Section 4.1). Only version 2 catalogs are supported.
+func members(origin string, rrs []dns.RR) (map[string]string, error) {
+	zones := "zones." + origin
+	version := ""
+	ids := map[string]string{}
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+		switch x := rr.(type) {
+		case *dns.TXT:
+			if name == "version."+origin {
+				version = strings.Join(x.Txt, "")
+			}
+		case *dns.PTR:
+			if !dns.IsSubDomain(zones, name) || dns.CountLabel(name) != dns.CountLabel(zones)+1 {
+				continue
+			}
+			member := strings.ToLower(dns.Fqdn(x.Ptr))
+			if member == origin {
+				continue
+			}
+			// A zone listed more than once keeps the first ID.
+			if _, ok := ids[member]; !ok {
+				ids[member] = dns.SplitDomainName(name)[0]
+			}
+		}
+	}
+	if version != "2" {
+		return nil, fmt.Errorf("unsupported catalog version %q", version)
+	}
+	return ids, nil
+}
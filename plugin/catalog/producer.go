@@ -0,0 +1,136 @@
+package catalog
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/coredns/coredns/plugin/auto"
+	"github.com/coredns/coredns/plugin/file"
+
+	"github.com/miekg/dns"
+)
+
+// produce regenerates the catalog zone every interval, until c is shut down.
+func (c *Catalog) produce() {
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			c.generate()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// generate regenerates the catalog zone when the zones served by the file and auto plugins changed.
+// The secondaries of the catalog are notified of the new version.
+func (c *Catalog) generate() {
+	names := c.served()
+
+	c.mu.RLock()
+	old := c.zone
+	same := old != nil && equal(names, c.produced)
+	c.mu.RUnlock()
+	if same {
+		return
+	}
+
+	serial := uint32(time.Now().Unix())
+	if old != nil {
+		if prev := uint32(old.SOASerialIfDefined()); serial-prev == 0 || serial-prev > file.MaxSerialIncrement {
+			serial = prev + 1
+		}
+	}
+	z, err := c.catalog(names, serial)
+	if err != nil {
+		log.Errorf("Failed to generate catalog %s: %s", c.origin, err)
+		return
+	}
+
+	c.mu.Lock()
+	c.zone = z
+	c.produced = names
+	c.rebuild()
+	c.mu.Unlock()
+
+	log.Infof("Catalog %s lists %d zones, serial %d", c.origin, len(names), serial)
+	if old != nil {
+		z.Notify()
+	}
+}
+
+// served returns the sorted names of the zones served by the file and auto plugins, except the
+// catalog zone itself.
+func (c *Catalog) served() []string {
+	seen := map[string]bool{c.origin: true}
+	names := []string{}
+	add := func(zones []string) {
+		for _, name := range zones {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	for _, h := range c.sources() {
+		switch x := h.(type) {
+		case file.File:
+			add(x.Zones.Names)
+		case auto.Auto:
+			add(x.Zones.Names())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// catalog returns the catalog zone listing the zones names, with SOA serial serial. The records of
+// the apex are the ones RFC 9432 suggests.
+func (c *Catalog) catalog(names []string, serial uint32) (*file.Zone, error) {
+	z := file.NewZone(c.origin, "stdin")
+	z.TransferTo = c.to
+	z.TransferKeys = c.keys
+
+	rrs := []string{
+		fmt.Sprintf("%s 0 IN SOA invalid. invalid. %d 3600 600 2147483646 0", c.origin, serial),
+		fmt.Sprintf("%s 0 IN NS invalid.", c.origin),
+		fmt.Sprintf("version.%s 0 IN TXT \"2\"", c.origin),
+	}
+	for _, name := range names {
+		rrs = append(rrs, fmt.Sprintf("%s.zones.%s 0 IN PTR %s", id(name), c.origin, name))
+	}
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			return nil, err
+		}
+		if err := z.Insert(rr); err != nil {
+			return nil, err
+		}
+	}
+	return z, nil
+}
+
+// id returns the unique ID of the member zone name. It's derived from the name, so it stays the same
+// across restarts.
+func id(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:8])
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
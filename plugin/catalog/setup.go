@@ -0,0 +1,115 @@
+package catalog
+
+import (
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/mholt/caddy"
+)
+
+var log = clog.NewWithPlugin("catalog")
+
+func init() {
+	caddy.RegisterPlugin("catalog", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	cat, err := catalogParse(c)
+	if err != nil {
+		return plugin.Error("catalog", err)
+	}
+
+	config := dnsserver.GetConfig(c)
+	c.OnStartup(func() error {
+		if len(cat.from) > 0 {
+			cat.zone.TransferIn()
+			go cat.consume()
+			return nil
+		}
+		// Do this in OnStartup, so all plugins have been initialized.
+		cat.sources = config.Handlers
+		cat.generate()
+		go cat.produce()
+		return nil
+	})
+	c.OnShutdown(cat.OnShutdown)
+
+	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		cat.Next = next
+		return cat
+	})
+
+	return nil
+}
+
+func catalogParse(c *caddy.Controller) (*Catalog, error) {
+	var cat *Catalog
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		cat = New(plugin.Host(args[0]).Normalize())
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "transfer":
+				t, f, name, err := parse.Transfer(c, true)
+				if err != nil {
+					return nil, err
+				}
+				if name != "" {
+					key, err := config.TsigKeys.Get(name)
+					if err != nil {
+						return nil, c.Err(err.Error())
+					}
+					for _, addrs := range [][]string{t, f} {
+						for _, addr := range addrs {
+							cat.keys[addr] = key
+						}
+					}
+				}
+				cat.to = append(cat.to, t...)
+				cat.from = append(cat.from, f...)
+
+			case "reload":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, c.Errf("invalid reload duration '%s'", args[0])
+				}
+				if d <= 0 {
+					return nil, c.Errf("reload duration must be positive: '%s'", args[0])
+				}
+				cat.interval = d
+
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	if len(cat.from) > 0 {
+		cat.zone = cat.newZone(cat.origin)
+		cat.rebuild()
+	}
+	return cat, nil
+}
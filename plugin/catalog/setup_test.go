@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+func TestCatalogParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		from      int
+		to        int
+		interval  time.Duration
+	}{
+		// positive
+		{`catalog catalog.example`, false, 0, 0, defaultInterval},
+		{`catalog catalog.example {
+			transfer from 10.0.0.1 10.0.0.2
+		}`, false, 2, 0, defaultInterval},
+		{`catalog catalog.example {
+			transfer to *
+			reload 10s
+		}`, false, 0, 1, 10 * time.Second},
+		{`catalog catalog.example {
+			transfer from 10.0.0.1 key xfr.example.org.
+			transfer to 10.0.0.3
+		}`, false, 1, 1, defaultInterval},
+		// negative
+		{`catalog`, true, 0, 0, 0},
+		{`catalog catalog.example catalog.example.net`, true, 0, 0, 0},
+		{`catalog catalog.example {
+			transfer from *
+		}`, true, 0, 0, 0},
+		{`catalog catalog.example {
+			transfer from 10.0.0.1 key unknown.example.org.
+		}`, true, 0, 0, 0},
+		{`catalog catalog.example {
+			reload never
+		}`, true, 0, 0, 0},
+		{`catalog catalog.example {
+			reload 0s
+		}`, true, 0, 0, 0},
+		{`catalog catalog.example {
+			member example.org
+		}`, true, 0, 0, 0},
+		{`catalog catalog.example
+		catalog catalog.example.net`, true, 0, 0, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		key := tsig.Key{Name: "xfr.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+		dnsserver.GetConfig(c).TsigKeys = tsig.Keys{key.Name: key}
+		cat, err := catalogParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if cat.origin != "catalog.example." {
+			t.Errorf("Test %d: expected origin catalog.example., got %s", i, cat.origin)
+		}
+		if len(cat.from) != test.from || len(cat.to) != test.to {
+			t.Errorf("Test %d: expected %d from and %d to, got %d and %d", i, test.from, test.to, len(cat.from), len(cat.to))
+		}
+		if cat.interval != test.interval {
+			t.Errorf("Test %d: expected reload %s, got %s", i, test.interval, cat.interval)
+		}
+		if (cat.zone != nil) != (test.from > 0) {
+			t.Errorf("Test %d: expected a secondary catalog zone to be %t", i, test.from > 0)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package cookie implements the server side of DNS Cookies (RFC 7873).
+package cookie
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// Cookie is a plugin that adds server cookies to responses and verifies the server cookies
+// sent by clients.
+type Cookie struct {
+	Next plugin.Handler
+
+	secret *cookie.Secret
+	// require a valid server cookie from clients that send a cookie over UDP.
+	require bool
+
+	now func() time.Time
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (c *Cookie) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return plugin.NextOrFailure(c.Name(), c.Next, ctx, w, r)
+	}
+	var co *dns.EDNS0_COOKIE
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_COOKIE); ok {
+			co = e
+			break
+		}
+	}
+	if co == nil {
+		return plugin.NextOrFailure(c.Name(), c.Next, ctx, w, r)
+	}
+
+	client, server, err := cookie.Parse(co.Cookie)
+	if err != nil {
+		return dns.RcodeFormatError, nil
+	}
+
+	state := request.Request{W: w, Req: r}
+	ip := net.ParseIP(state.IP())
+	now := c.now()
+
+	valid := server != nil && c.secret.Valid(client, server, ip, now)
+	ctx = cookie.NewContext(ctx, valid)
+
+	cw := &ResponseWriter{ResponseWriter: w, cookie: hex.EncodeToString(client) + hex.EncodeToString(c.secret.Generate(client, ip, now))}
+
+	if !valid && c.require && state.Proto() == "udp" {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeBadCookie)
+		state.SizeAndDo(m)
+		cw.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+
+	return plugin.NextOrFailure(c.Name(), c.Next, ctx, cw, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (c *Cookie) Name() string { return "cookie" }
+
+// ResponseWriter is a response writer that adds the COOKIE option to the response.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	cookie string
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
+	// Copy the OPT record, as it may be shared with the request, and replace any cookie option
+	// with our own.
+	o := new(dns.OPT)
+	o.Hdr.Name = "."
+	o.Hdr.Rrtype = dns.TypeOPT
+
+	found := false
+	for i, rr := range res.Extra {
+		if opt, ok := rr.(*dns.OPT); ok {
+			o.Hdr = opt.Hdr
+			for _, e := range opt.Option {
+				if e.Option() != dns.EDNS0COOKIE {
+					o.Option = append(o.Option, e)
+				}
+			}
+			res.Extra[i] = o
+			found = true
+			break
+		}
+	}
+	if !found {
+		o.SetUDPSize(dns.MinMsgSize)
+		res.Extra = append(res.Extra, o)
+	}
+	o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: w.cookie})
+
+	return w.ResponseWriter.WriteMsg(res)
+}
@@ -0,0 +1,149 @@
+package cookie
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+const clientCookie = "2464c4abcf10c957"
+
+func newTestCookie(t *testing.T, require bool) (*Cookie, *bool) {
+	s, err := cookie.NewSecret(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := new(bool)
+	co := &Cookie{secret: s, require: require, now: time.Now}
+	co.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*valid = cookie.Valid(ctx)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		state := request.Request{W: w, Req: r}
+		state.SizeAndDo(m)
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+	return co, valid
+}
+
+func cookieQuery(c string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	if c != "" {
+		o := m.IsEdns0()
+		o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: c})
+	}
+	return m
+}
+
+func responseCookie(t *testing.T, m *dns.Msg) (client, server []byte) {
+	if m == nil {
+		t.Fatal("Expected response, got none")
+	}
+	opt := m.IsEdns0()
+	if opt == nil {
+		t.Fatal("Expected OPT record in response")
+	}
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_COOKIE); ok {
+			client, server, err := cookie.Parse(e.Cookie)
+			if err != nil {
+				t.Fatalf("Expected valid cookie in response, got %s", err)
+			}
+			return client, server
+		}
+	}
+	t.Fatal("Expected COOKIE option in response")
+	return nil, nil
+}
+
+func TestCookie(t *testing.T) {
+	co, valid := newTestCookie(t, false)
+
+	// Client cookie only, we should get a server cookie back.
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	co.ServeDNS(context.TODO(), rec, cookieQuery(clientCookie))
+	client, server := responseCookie(t, rec.Msg)
+	if hex.EncodeToString(client) != clientCookie {
+		t.Errorf("Expected client cookie %s, got %x", clientCookie, client)
+	}
+	if len(server) != cookie.ServerLen {
+		t.Errorf("Expected server cookie of length %d, got %d", cookie.ServerLen, len(server))
+	}
+	if *valid {
+		t.Error("Expected cookie not to be valid without server cookie")
+	}
+
+	// Send the server cookie back.
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	co.ServeDNS(context.TODO(), rec, cookieQuery(clientCookie+hex.EncodeToString(server)))
+	responseCookie(t, rec.Msg)
+	if !*valid {
+		t.Error("Expected cookie to be valid")
+	}
+	if !co.secret.Valid(client, server, net.ParseIP("10.240.0.1"), time.Now()) {
+		t.Error("Expected server cookie to be valid for client")
+	}
+
+	// Bogus server cookie is treated as client cookie only.
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	co.ServeDNS(context.TODO(), rec, cookieQuery(clientCookie+"01000000000000000000000000000000"))
+	responseCookie(t, rec.Msg)
+	if *valid {
+		t.Error("Expected bogus cookie not to be valid")
+	}
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeSuccess, rec.Msg.Rcode)
+	}
+
+	// Malformed cookie.
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	if rcode, _ := co.ServeDNS(context.TODO(), rec, cookieQuery("2464")); rcode != dns.RcodeFormatError {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeFormatError, rcode)
+	}
+
+	// No cookie, no cookie in the reply.
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	co.ServeDNS(context.TODO(), rec, cookieQuery(""))
+	for _, o := range rec.Msg.IsEdns0().Option {
+		if _, ok := o.(*dns.EDNS0_COOKIE); ok {
+			t.Error("Expected no COOKIE option in response")
+		}
+	}
+}
+
+func TestCookieRequire(t *testing.T) {
+	co, _ := newTestCookie(t, true)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	co.ServeDNS(context.TODO(), rec, cookieQuery(clientCookie))
+	if rec.Msg.Rcode != dns.RcodeBadCookie {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeBadCookie, rec.Msg.Rcode)
+	}
+	_, server := responseCookie(t, rec.Msg)
+
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	co.ServeDNS(context.TODO(), rec, cookieQuery(clientCookie+hex.EncodeToString(server)))
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeSuccess, rec.Msg.Rcode)
+	}
+
+	// TCP does not need a valid cookie.
+	rec = dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+	co.ServeDNS(context.TODO(), rec, cookieQuery(clientCookie))
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeSuccess, rec.Msg.Rcode)
+	}
+}
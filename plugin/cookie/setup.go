@@ -0,0 +1,103 @@
+package cookie
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("cookie", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	co, err := cookieParse(c)
+	if err != nil {
+		return plugin.Error("cookie", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		co.Next = next
+		return co
+	})
+
+	return nil
+}
+
+func cookieParse(c *caddy.Controller) (*Cookie, error) {
+	co := &Cookie{now: time.Now}
+
+	var (
+		secrets [][cookie.SecretLen]byte
+		rotate  time.Duration
+	)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+		if len(c.RemainingArgs()) != 0 {
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "secret":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					b, err := hex.DecodeString(a)
+					if err != nil || len(b) != cookie.SecretLen {
+						return nil, c.Errf("secret must be %d hex encoded bytes, got %q", cookie.SecretLen, a)
+					}
+					var s [cookie.SecretLen]byte
+					copy(s[:], b)
+					secrets = append(secrets, s)
+				}
+			case "rotate":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, c.Errf("invalid duration for rotate '%s'", args[0])
+				}
+				if d < time.Minute {
+					return nil, c.Errf("rotate must be at least a minute, got %s", d)
+				}
+				rotate = d
+			case "require":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				co.require = true
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	if rotate > 0 && len(secrets) == 0 {
+		return nil, c.Errf("rotate needs a secret")
+	}
+
+	secret, err := cookie.NewSecret(secrets, rotate)
+	if err != nil {
+		return nil, err
+	}
+	co.secret = secret
+	return co, nil
+}
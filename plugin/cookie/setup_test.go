@@ -0,0 +1,63 @@
+package cookie
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetupCookie(t *testing.T) {
+	tests := []struct {
+		input           string
+		shouldErr       bool
+		expectedRequire bool
+	}{
+		{`cookie`, false, false},
+		{`cookie {
+			secret e5e973e5a6b2a43f48e7dc849e37bfcf
+		}`, false, false},
+		{`cookie {
+			secret e5e973e5a6b2a43f48e7dc849e37bfcf 0102030405060708090a0b0c0d0e0f10
+			rotate 1h
+			require
+		}`, false, true},
+		// fails
+		{`cookie example.org`, true, false},
+		{`cookie {
+			secret e5e973e5
+		}`, true, false},
+		{`cookie {
+			secret
+		}`, true, false},
+		{`cookie {
+			rotate 1h
+		}`, true, false},
+		{`cookie {
+			secret e5e973e5a6b2a43f48e7dc849e37bfcf
+			rotate 1s
+		}`, true, false},
+		{`cookie {
+			blah
+		}`, true, false},
+		{`cookie
+		cookie`, true, false},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		co, err := cookieParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			continue
+		}
+		if co.require != test.expectedRequire {
+			t.Errorf("Test %d: expected require %t, got %t", i, test.expectedRequire, co.require)
+		}
+	}
+}
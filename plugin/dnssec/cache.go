@@ -6,8 +6,8 @@ import (
 	"github.com/miekg/dns"
 )
 
-// hash serializes the RRset and return a signature cache key.
-func hash(rrs []dns.RR) uint64 {
+// hash serializes the RRset, and the key tags of the keys signing it, and return a signature cache key.
+func hash(rrs []dns.RR, tags ...uint16) uint64 {
 	h := fnv.New64()
 	buf := make([]byte, 256)
 	for _, r := range rrs {
@@ -16,6 +16,9 @@ func hash(rrs []dns.RR) uint64 {
 			h.Write(buf[:off])
 		}
 	}
+	for _, t := range tags {
+		h.Write([]byte{byte(t >> 8), byte(t)})
+	}
 
 	i := h.Sum64()
 	return i
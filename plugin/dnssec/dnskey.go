@@ -6,6 +6,8 @@ import (
 	"crypto/rsa"
 	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/request"
@@ -58,33 +60,82 @@ func ParseKeyFile(pubFile, privFile string) (*DNSKEY, error) {
 	return &DNSKEY{K: dk, D: dk.ToDS(dns.SHA256), s: nil, tag: 0}, errors.New("no private key found")
 }
 
+// ParseKeyFiles reads the DNSSEC keys named in names with ParseKeyFile. A name can be the basename of
+// the key files, e.g. Kmiek.nl.+013+26205, or the name of either file. Relative names are relative to
+// root, if not empty.
+func ParseKeyFiles(root string, names []string) ([]*DNSKEY, error) {
+	keys := []*DNSKEY{}
+	for _, k := range names {
+		base := k
+		// Kmiek.nl.+013+26205.key, handle .private or without extension: Kmiek.nl.+013+26205
+		if strings.HasSuffix(k, ".key") {
+			base = k[:len(k)-4]
+		}
+		if strings.HasSuffix(k, ".private") {
+			base = k[:len(k)-8]
+		}
+		if !filepath.IsAbs(base) && root != "" {
+			base = filepath.Join(root, base)
+		}
+		k, err := ParseKeyFile(base+".key", base+".private")
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
 // getDNSKEY returns the correct DNSKEY to the client. Signatures are added when do is true.
 func (d Dnssec) getDNSKEY(state request.Request, zone string, do bool, server string) *dns.Msg {
-	keys := make([]dns.RR, len(d.keys))
-	for i, k := range d.keys {
+	published, _, _ := d.keySet()
+	keys := make([]dns.RR, len(published))
+	for i, k := range published {
 		keys[i] = dns.Copy(k.K)
 		keys[i].Header().Name = zone
 	}
+	return d.keyReply(state, zone, keys, do, server)
+}
+
+// getCDS returns the CDS or CDNSKEY records, depending on the qtype, for the KSKs the parent should
+// have a DS record for (RFC 7344). Signatures are added when do is true.
+func (d Dnssec) getCDS(state request.Request, zone string, do bool, server string) *dns.Msg {
+	ksks := d.manager.ds(time.Now().UTC())
+	rrs := make([]dns.RR, len(ksks))
+	for i, k := range ksks {
+		key := dns.Copy(k.K).(*dns.DNSKEY)
+		key.Hdr.Name = zone
+		if state.QType() == dns.TypeCDS {
+			rrs[i] = key.ToDS(dns.SHA256).ToCDS()
+		} else {
+			rrs[i] = key.ToCDNSKEY()
+		}
+	}
+	return d.keyReply(state, zone, rrs, do, server)
+}
+
+// keyReply returns a reply with rrs as the answer, and their signatures when do is true.
+func (d Dnssec) keyReply(state request.Request, zone string, rrs []dns.RR, do bool, server string) *dns.Msg {
 	m := new(dns.Msg)
 	m.SetReply(state.Req)
-	m.Answer = keys
-	if !do {
+	m.Answer = rrs
+	if !do || len(rrs) == 0 {
 		return m
 	}
 
 	incep, expir := incepExpir(time.Now().UTC())
-	if sigs, err := d.sign(keys, zone, 3600, incep, expir, server); err == nil {
+	if sigs, err := d.sign(rrs, zone, 3600, incep, expir, server); err == nil {
 		m.Answer = append(m.Answer, sigs...)
 	}
 	return m
 }
 
-// Return true iff this is a zone key with the SEP bit unset. This implies a ZSK (rfc4034 2.1.1).
-func (k DNSKEY) isZSK() bool {
+// IsZSK returns true iff this is a zone key with the SEP bit unset. This implies a ZSK (rfc4034 2.1.1).
+func (k DNSKEY) IsZSK() bool {
 	return k.K.Flags&(1<<8) == (1<<8) && k.K.Flags&1 == 0
 }
 
-// Return true iff this is a zone key with the SEP bit set. This implies a KSK (rfc4034 2.1.1).
-func (k DNSKEY) isKSK() bool {
+// IsKSK returns true iff this is a zone key with the SEP bit set. This implies a KSK (rfc4034 2.1.1).
+func (k DNSKEY) IsKSK() bool {
 	return k.K.Flags&(1<<8) == (1<<8) && k.K.Flags&1 == 1
 }
@@ -1,8 +1,10 @@
 // Package dnssec implements a plugin that signs responses on-the-fly using
-// NSEC black lies.
+// NSEC black lies or NSEC3 white lies.
 package dnssec
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -23,6 +25,10 @@ type Dnssec struct {
 	splitkeys bool
 	inflight  *singleflight.Group
 	cache     *cache.Cache
+	probes    *cache.Cache    // which names exist, for the closest encloser of NSEC3 white lies
+	manager   *keyManager     // generates and rolls the keys, nil if they are read from files
+	nsec3     *dns.NSEC3PARAM // use NSEC3 white lies with these parameters, instead of NSEC black lies
+	optOut    bool            // set the opt-out flag in the NSEC3 records
 }
 
 // New returns a new Dnssec.
@@ -32,16 +38,23 @@ func New(zones []string, keys []*DNSKEY, splitkeys bool, next plugin.Handler, c
 		keys:      keys,
 		splitkeys: splitkeys,
 		cache:     c,
+		probes:    cache.New(defaultCap),
 		inflight:  new(singleflight.Group),
 	}
 }
 
 // Sign signs the message in state. it takes care of negative or nodata responses. It
-// uses NSEC black lies for authenticated denial of existence. For delegations it
+// uses NSEC black lies, or NSEC3 white lies, for authenticated denial of existence. For delegations it
 // will insert DS records and sign those.
 // Signatures will be cached for a short while. By default we sign for 8 days,
 // starting 3 hours ago.
 func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.Msg {
+	return d.signMsg(context.Background(), state, now, server)
+}
+
+// signMsg signs the message in state, see Sign. The next plugin is asked, with ctx, which names exist
+// when that needs to be proven, and tells in the metadata of ctx which answers come from a wildcard.
+func (d Dnssec) signMsg(ctx context.Context, state request.Request, now time.Time, server string) *dns.Msg {
 	req := state.Req
 
 	incep, expir := incepExpir(now)
@@ -51,6 +64,12 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 		return req
 	}
 
+	// With white lies, answers synthesized from a wildcard prove the qname doesn't exist as such.
+	wild := ""
+	if d.nsec3 != nil && (mt == response.NoError || mt == response.NoData) {
+		wild = wildcard(ctx, state)
+	}
+
 	if mt == response.NameError || mt == response.NoData {
 		if req.Ns[0].Header().Rrtype != dns.TypeSOA || len(req.Ns) > 1 {
 			return req
@@ -61,6 +80,13 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 		if sigs, err := d.sign(req.Ns, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
 		}
+		// White lies prove the name error, the rcode stays.
+		if d.nsec3 != nil {
+			if rrs, err := d.whiteLies(ctx, state, mt, wild, ttl, incep, expir, server); err == nil {
+				req.Ns = append(req.Ns, rrs...)
+			}
+			return req
+		}
 		if sigs, err := d.nsec(state, mt, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
 		}
@@ -72,6 +98,12 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 
 	for _, r := range rrSets(req.Answer) {
 		ttl := r[0].Header().Ttl
+		if wild != "" && strings.EqualFold(r[0].Header().Name, state.Name()) {
+			if sigs, err := d.signWildcard(r, wild, state.Zone, ttl, incep, expir, server); err == nil {
+				req.Answer = append(req.Answer, sigs...)
+			}
+			continue
+		}
 		if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Answer = append(req.Answer, sigs...)
 		}
@@ -82,6 +114,11 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 			req.Ns = append(req.Ns, sigs...)
 		}
 	}
+	if wild != "" && len(req.Answer) > 0 {
+		if rrs, err := d.whiteLies(ctx, state, mt, wild, req.Answer[0].Header().Ttl, incep, expir, server); err == nil {
+			req.Ns = append(req.Ns, rrs...)
+		}
+	}
 	for _, r := range rrSets(req.Extra) {
 		ttl := r[0].Header().Ttl
 		if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
@@ -91,8 +128,26 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 	return req
 }
 
+// keySet returns the keys in the DNSKEY RRset, the keys signing, and whether the keys are split in KSKs
+// and ZSKs.
+func (d Dnssec) keySet() (published, signing []*DNSKEY, split bool) {
+	if d.manager == nil {
+		return d.keys, d.keys, d.splitkeys
+	}
+	published, signing = d.manager.keySet(time.Now().UTC())
+	return published, signing, true
+}
+
 func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
-	k := hash(rrs)
+	_, keys, split := d.keySet()
+	// Rolled keys change, the signatures of the old keys must not be used once they're retired.
+	var tags []uint16
+	if d.manager != nil {
+		for i := range keys {
+			tags = append(tags, keys[i].tag)
+		}
+	}
+	k := hash(rrs, tags...)
 	sgs, ok := d.get(k, server)
 	if ok {
 		return sgs, nil
@@ -100,16 +155,16 @@ func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32,
 
 	sigs, err := d.inflight.Do(k, func() (interface{}, error) {
 		var sigs []dns.RR
-		for _, k := range d.keys {
-			if d.splitkeys {
-				if len(rrs) > 0 && rrs[0].Header().Rrtype == dns.TypeDNSKEY {
-					// We are signing a DNSKEY RRSet. With split keys, we need to use a KSK here.
-					if !k.isKSK() {
+		for _, k := range keys {
+			if split {
+				if len(rrs) > 0 && signedByKSK(rrs[0].Header().Rrtype) {
+					// We are signing a DNSKEY, CDS or CDNSKEY RRSet. With split keys, we need to use a KSK here.
+					if !k.IsKSK() {
 						continue
 					}
 				} else {
 					// For non-DNSKEY RRSets, we want to use a ZSK.
-					if !k.isZSK() {
+					if !k.IsZSK() {
 						continue
 					}
 				}
@@ -126,6 +181,11 @@ func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32,
 	return sigs.([]dns.RR), err
 }
 
+// signedByKSK returns true if RRsets of type t are signed by the KSKs, when the keys are split.
+func signedByKSK(t uint16) bool {
+	return t == dns.TypeDNSKEY || t == dns.TypeCDS || t == dns.TypeCDNSKEY
+}
+
 func (d Dnssec) set(key uint64, sigs []dns.RR) { d.cache.Add(key, sigs) }
 
 func (d Dnssec) get(key uint64, server string) ([]dns.RR, bool) {
@@ -39,8 +39,31 @@ func (d Dnssec) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		}
 	}
 
+	// With rolled keys, the CDS and CDNSKEY records tell the parent which KSKs to use.
+	if (qtype == dns.TypeCDS || qtype == dns.TypeCDNSKEY) && d.manager != nil {
+		for _, z := range d.zones {
+			if qname == z {
+				resp := d.getCDS(state, z, do, server)
+				resp.Authoritative = true
+				w.WriteMsg(resp)
+				return dns.RcodeSuccess, nil
+			}
+		}
+	}
+
+	if qtype == dns.TypeNSEC3PARAM && d.nsec3 != nil {
+		for _, z := range d.zones {
+			if qname == z {
+				resp := d.getNSEC3PARAM(state, z, do, server)
+				resp.Authoritative = true
+				w.WriteMsg(resp)
+				return dns.RcodeSuccess, nil
+			}
+		}
+	}
+
 	if do {
-		drr := &ResponseWriter{w, d, server}
+		drr := &ResponseWriter{w, d, server, ctx}
 		return plugin.NextOrFailure(d.Name(), d.Next, ctx, drr, r)
 	}
 
@@ -75,6 +98,27 @@ var (
 		Name:      "cache_misses_total",
 		Help:      "The count of cache misses.",
 	}, []string{"server"})
+
+	keyCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "dnssec",
+		Name:      "keys",
+		Help:      "The number of rolled keys, by type and state.",
+	}, []string{"type", "state"})
+
+	keyEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "dnssec",
+		Name:      "key_events_total",
+		Help:      "The count of key rollover events, by type and event.",
+	}, []string{"type", "event"})
+
+	kskWaiting = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "dnssec",
+		Name:      "ksk_rollover_waiting",
+		Help:      "Set to 1 while a KSK rollover waits for the new DS record at the parent.",
+	})
 )
 
 // Name implements the Handler interface.
@@ -1,6 +1,7 @@
 package dnssec
 
 import (
+	"context"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -13,7 +14,8 @@ import (
 type ResponseWriter struct {
 	dns.ResponseWriter
 	d      Dnssec
-	server string // server label for metrics.
+	server string          // server label for metrics.
+	ctx    context.Context // of the query, for the queries to the next plugin while signing
 }
 
 // WriteMsg implements the dns.ResponseWriter interface.
@@ -28,7 +30,7 @@ func (d *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	}
 	state.Zone = zone
 
-	res = d.d.Sign(state, time.Now().UTC(), d.server)
+	res = d.d.signMsg(d.ctx, state, time.Now().UTC(), d.server)
 	cacheSize.WithLabelValues(d.server, "signature").Set(float64(d.d.cache.Len()))
 	// No need for EDNS0 trickery, as that is handled by the server.
 
@@ -0,0 +1,561 @@
+package dnssec
+
+import (
+	"bufio"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/miekg/dns"
+)
+
+// keyManager generates the keys for on-the-fly signing and rolls them. ZSKs are rolled with the
+// pre-publish method: a new ZSK is published a propagation delay before it replaces the current one,
+// which stays published for another propagation delay. KSKs are rolled with the double-signature method:
+// a new KSK signs the DNSKEY RRset together with the current one, which is only retired once the new DS
+// record has been seen at the parent, that picks it up from the CDS and CDNSKEY records (RFC 6781,
+// Section 4.1.2, and RFC 7344). The keys, and their timeline, are kept in a directory so they survive
+// restarts.
+type keyManager struct {
+	dir         string
+	name        string // the owner name of the keys
+	zskLifetime time.Duration
+	kskLifetime time.Duration
+	propagation time.Duration // how long before changes to the DNSKEY or DS RRset are seen everywhere
+	resolvers   []string      // asked for the DS RRset at the parent, the ones in /etc/resolv.conf if empty
+
+	parentDS func(name string) ([]*dns.DS, error) // looks up the DS RRset of name at the parent
+
+	mu      sync.RWMutex
+	keys    []*managedKey
+	last    time.Time // when the keys were last rolled
+	waiting bool      // for the DS of a new KSK to show up at the parent
+
+	stop chan struct{}
+}
+
+// managedKey is a key with its timeline. A zero time is not scheduled (yet).
+type managedKey struct {
+	*DNSKEY
+	base string // the path of the key files, without extension
+
+	published time.Time // added to the DNSKEY RRset
+	active    time.Time // signing
+	retired   time.Time // no longer signing
+	removed   time.Time // removed from the DNSKEY RRset
+	dsAdded   time.Time // added to the CDS and CDNSKEY RRsets, for KSKs
+	dsRemoved time.Time // removed from the CDS and CDNSKEY RRsets
+}
+
+func newKeyManager(dir, name string) *keyManager {
+	m := &keyManager{
+		dir:         dir,
+		name:        name,
+		zskLifetime: defaultZSKLifetime,
+		kskLifetime: defaultKSKLifetime,
+		propagation: defaultPropagation,
+		stop:        make(chan struct{}),
+	}
+	m.parentDS = m.lookupDS
+	return m
+}
+
+// between returns true if from <= t < until, a zero from never is and a zero until never ends.
+func between(t, from, until time.Time) bool {
+	return !from.IsZero() && !t.Before(from) && (until.IsZero() || t.Before(until))
+}
+
+func (k *managedKey) isPublished(t time.Time) bool { return between(t, k.published, k.removed) }
+func (k *managedKey) isActive(t time.Time) bool    { return between(t, k.active, k.retired) }
+func (k *managedKey) inDS(t time.Time) bool        { return between(t, k.dsAdded, k.dsRemoved) }
+
+func (k *managedKey) kind() string {
+	if k.IsKSK() {
+		return "ksk"
+	}
+	return "zsk"
+}
+
+// keySet returns the keys in the DNSKEY RRset and the keys signing at time t.
+func (m *keyManager) keySet(t time.Time) (published, signing []*DNSKEY) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.keys {
+		if k.isPublished(t) {
+			published = append(published, k.DNSKEY)
+		}
+		if k.isActive(t) {
+			signing = append(signing, k.DNSKEY)
+		}
+	}
+	return published, signing
+}
+
+// ds returns the KSKs in the CDS and CDNSKEY RRsets at time t.
+func (m *keyManager) ds(t time.Time) []*DNSKEY {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := []*DNSKEY{}
+	for _, k := range m.keys {
+		if k.inDS(t) {
+			keys = append(keys, k.DNSKEY)
+		}
+	}
+	return keys
+}
+
+// run rolls the keys every minute, until m is stopped.
+func (m *keyManager) run() {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := m.roll(time.Now().UTC()); err != nil {
+				log.Errorf("Failed to roll keys in %q: %s", m.dir, err)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// roll generates the keys needed at time now and schedules the rollovers. The events that happened
+// since the last time are logged.
+func (m *keyManager) roll(now time.Time) error {
+	// The parent is asked without holding the lock, the keys are needed for signing meanwhile.
+	seen := m.dsSeen(now)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.retireKSK(now, seen); err != nil {
+		return err
+	}
+
+	for _, ksk := range []bool{false, true} {
+		var err error
+		if ksk {
+			err = m.rollKSK(now)
+		} else {
+			err = m.rollZSK(now)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	m.events(now)
+	m.last = now
+
+	// Forget the keys that are gone, their files are kept.
+	keys := m.keys[:0]
+	for _, k := range m.keys {
+		if k.removed.IsZero() || now.Before(k.removed) {
+			keys = append(keys, k)
+		}
+	}
+	m.keys = keys
+	m.report(now)
+	return nil
+}
+
+// current returns the newest active key of the kind at time now, and its successor, if scheduled.
+func (m *keyManager) current(ksk bool, now time.Time) (cur, next *managedKey) {
+	for _, k := range m.keys {
+		if k.IsKSK() != ksk || k.active.IsZero() {
+			continue
+		}
+		if k.isActive(now) && (cur == nil || k.active.After(cur.active)) {
+			cur = k
+		}
+	}
+	for _, k := range m.keys {
+		if k.IsKSK() != ksk || k.active.IsZero() {
+			continue
+		}
+		if (cur == nil && k.active.After(now)) || (cur != nil && k.active.After(cur.active)) {
+			next = k
+		}
+	}
+	return cur, next
+}
+
+func (m *keyManager) rollZSK(now time.Time) error {
+	cur, next := m.current(false, now)
+	if next != nil {
+		return nil
+	}
+	if cur == nil {
+		_, err := m.generate(false, now, func(k *managedKey) { k.published, k.active = now, now })
+		return err
+	}
+
+	end := cur.active.Add(m.zskLifetime)
+	if now.Before(end.Add(-m.propagation)) {
+		return nil
+	}
+	active := end
+	if active.Before(now.Add(m.propagation)) {
+		active = now.Add(m.propagation)
+	}
+	if _, err := m.generate(false, now, func(k *managedKey) { k.published, k.active = now, active }); err != nil {
+		return err
+	}
+	cur.retired, cur.removed = active, active.Add(m.propagation)
+	return m.save(cur)
+}
+
+func (m *keyManager) rollKSK(now time.Time) error {
+	cur, next := m.current(true, now)
+	if next != nil {
+		return nil
+	}
+	if cur == nil {
+		_, err := m.generate(true, now, func(k *managedKey) { k.published, k.active, k.dsAdded = now, now, now })
+		return err
+	}
+
+	if now.Before(cur.active.Add(m.kskLifetime)) {
+		return nil
+	}
+	// The previous rollover must be done before the next one starts.
+	for _, k := range m.keys {
+		if k != cur && k.IsKSK() && (k.retired.IsZero() || now.Before(k.removed)) {
+			return nil
+		}
+	}
+	// The new KSK signs right away, but the parent must only get it once the new DNSKEY RRset has
+	// been seen everywhere. The current KSK signs until the new DS is seen at the parent, see retireKSK.
+	ds := now.Add(m.propagation)
+	if _, err := m.generate(true, now, func(k *managedKey) { k.published, k.active, k.dsAdded = now, now, ds }); err != nil {
+		return err
+	}
+	cur.dsRemoved = ds
+	return m.save(cur)
+}
+
+// rolledKSK returns the KSK that is being replaced, and the KSK replacing it, if the DS of the latter
+// should be at the parent by time now.
+func (m *keyManager) rolledKSK(now time.Time) (old, next *managedKey) {
+	for _, k := range m.keys {
+		if !k.IsKSK() || k.active.IsZero() || !k.retired.IsZero() {
+			continue
+		}
+		if old == nil || k.active.Before(old.active) {
+			old = k
+		}
+	}
+	for _, k := range m.keys {
+		if !k.IsKSK() || old == nil || !k.active.After(old.active) {
+			continue
+		}
+		if !k.dsAdded.IsZero() && !now.Before(k.dsAdded) {
+			return old, k
+		}
+	}
+	return nil, nil
+}
+
+// dsSeen returns true if the DS of the KSK replacing the current one is at the parent.
+func (m *keyManager) dsSeen(now time.Time) bool {
+	m.mu.RLock()
+	_, next := m.rolledKSK(now)
+	m.mu.RUnlock()
+	if next == nil {
+		return false
+	}
+
+	ds, err := m.parentDS(m.name)
+	if err != nil {
+		log.Warningf("Failed to look up the DS records of %s: %s", m.name, err)
+		return false
+	}
+	for _, d := range ds {
+		if d.KeyTag != next.tag || d.Algorithm != next.K.Algorithm {
+			continue
+		}
+		if want := next.K.ToDS(d.DigestType); want != nil && strings.EqualFold(want.Digest, d.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// retireKSK schedules the removal of the KSK being replaced once the DS of the new KSK is seen at the
+// parent: it keeps signing for one more propagation delay, until the old DS has expired from caches.
+// Until then the rollover waits, however long that takes.
+func (m *keyManager) retireKSK(now time.Time, seen bool) error {
+	old, next := m.rolledKSK(now)
+	if next == nil {
+		m.waiting = false
+		kskWaiting.Set(0)
+		return nil
+	}
+	if !seen {
+		if !m.waiting {
+			log.Warningf("KSK %d keeps signing until the DS record of KSK %d is seen at the parent of %s", old.tag, next.tag, m.name)
+		}
+		m.waiting = true
+		kskWaiting.Set(1)
+		return nil
+	}
+
+	log.Infof("DS record of KSK %d seen at the parent of %s", next.tag, m.name)
+	m.waiting = false
+	kskWaiting.Set(0)
+	old.retired, old.removed = now.Add(m.propagation), now.Add(m.propagation)
+	return m.save(old)
+}
+
+// lookupDS asks the resolvers for the DS RRset of name.
+func (m *keyManager) lookupDS(name string) ([]*dns.DS, error) {
+	resolvers := m.resolvers
+	if len(resolvers) == 0 {
+		r, err := parse.HostPortOrFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, err
+		}
+		resolvers = r
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeDS)
+	req.SetEdns0(4096, false)
+	c := &dns.Client{Timeout: 2 * time.Second}
+	var err error
+	for _, r := range resolvers {
+		var ret *dns.Msg
+		ret, _, err = c.Exchange(req, r)
+		if err != nil {
+			continue
+		}
+		if ret.Rcode != dns.RcodeSuccess {
+			err = fmt.Errorf("%s returned %s", r, dns.RcodeToString[ret.Rcode])
+			continue
+		}
+		ds := []*dns.DS{}
+		for _, rr := range ret.Answer {
+			if d, ok := rr.(*dns.DS); ok && strings.EqualFold(d.Hdr.Name, name) {
+				ds = append(ds, d)
+			}
+		}
+		return ds, nil
+	}
+	return nil, err
+}
+
+// generate generates a new key, schedules it with schedule and writes it to the directory.
+func (m *keyManager) generate(ksk bool, now time.Time, schedule func(*managedKey)) (*managedKey, error) {
+	flags := uint16(256)
+	if ksk {
+		flags = 257
+	}
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: m.name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: origTTL},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("no signer for algorithm %d", key.Algorithm)
+	}
+
+	k := &managedKey{
+		DNSKEY: &DNSKEY{K: key, D: key.ToDS(dns.SHA256), s: signer, tag: key.KeyTag()},
+		base:   filepath.Join(m.dir, fmt.Sprintf("K%s+%03d+%05d", m.name, key.Algorithm, key.KeyTag())),
+	}
+	schedule(k)
+
+	if err := writeFile(k.base+".key", []byte(key.String()+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	if err := writeFile(k.base+".private", []byte(key.PrivateKeyString(priv)), 0600); err != nil {
+		return nil, err
+	}
+	if err := m.save(k); err != nil {
+		return nil, err
+	}
+	m.keys = append(m.keys, k)
+
+	log.Infof("Generated %s %d, published %s, active %s", strings.ToUpper(k.kind()), k.tag, k.published.Format(time.RFC3339), k.active.Format(time.RFC3339))
+	keyEvents.WithLabelValues(k.kind(), "generated").Inc()
+	return k, nil
+}
+
+// events logs, and counts, the events scheduled since the last roll.
+func (m *keyManager) events(now time.Time) {
+	if m.last.IsZero() {
+		return
+	}
+	for _, k := range m.keys {
+		for _, e := range []struct {
+			t     time.Time
+			event string
+			msg   string
+		}{
+			{k.published, "published", "published in the DNSKEY RRset"},
+			{k.active, "active", "is signing"},
+			{k.retired, "retired", "stopped signing"},
+			{k.removed, "removed", "removed from the DNSKEY RRset"},
+			{k.dsAdded, "ds_published", "published in the CDS and CDNSKEY RRsets, the DS record at the parent should be updated"},
+			{k.dsRemoved, "ds_removed", "removed from the CDS and CDNSKEY RRsets"},
+		} {
+			if e.t.IsZero() || !e.t.After(m.last) || e.t.After(now) {
+				continue
+			}
+			log.Infof("%s %d %s", strings.ToUpper(k.kind()), k.tag, e.msg)
+			keyEvents.WithLabelValues(k.kind(), e.event).Inc()
+		}
+	}
+}
+
+// report sets the keys metric.
+func (m *keyManager) report(now time.Time) {
+	count := map[[2]string]float64{}
+	for _, kind := range []string{"ksk", "zsk"} {
+		for _, state := range []string{"published", "active", "retired"} {
+			count[[2]string{kind, state}] = 0
+		}
+	}
+	for _, k := range m.keys {
+		switch {
+		case k.isActive(now):
+			count[[2]string{k.kind(), "active"}]++
+		case k.isPublished(now) && now.Before(k.active):
+			count[[2]string{k.kind(), "published"}]++
+		case k.isPublished(now):
+			count[[2]string{k.kind(), "retired"}]++
+		}
+	}
+	for l, n := range count {
+		keyCount.WithLabelValues(l[0], l[1]).Set(n)
+	}
+}
+
+// load reads the keys, and their timelines, from the directory. Keys that were removed are skipped.
+func (m *keyManager) load(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return err
+	}
+	states, err := filepath.Glob(filepath.Join(m.dir, "K*.state"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		base := strings.TrimSuffix(state, ".state")
+		k := &managedKey{base: base}
+		if err := k.readState(state); err != nil {
+			return err
+		}
+		if !k.removed.IsZero() && !now.Before(k.removed) {
+			continue
+		}
+		dk, err := ParseKeyFile(base+".key", base+".private")
+		if err != nil {
+			return err
+		}
+		k.DNSKEY = dk
+		m.keys = append(m.keys, k)
+	}
+	m.last = now
+	return nil
+}
+
+// The timeline of a key is kept in a .state file next to the key files, with one "Event: time" per line.
+var stateFields = []string{"Published", "Active", "Retired", "Removed", "DSPublished", "DSRemoved"}
+
+func (k *managedKey) fields() []*time.Time {
+	return []*time.Time{&k.published, &k.active, &k.retired, &k.removed, &k.dsAdded, &k.dsRemoved}
+}
+
+// save writes the timeline of k to its state file.
+func (m *keyManager) save(k *managedKey) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "; timeline of %s %d\n", strings.ToUpper(k.kind()), k.tag)
+	for i, t := range k.fields() {
+		if !t.IsZero() {
+			fmt.Fprintf(&b, "%s: %s\n", stateFields[i], t.UTC().Format(stateTime))
+		}
+	}
+	return writeFile(k.base+".state", []byte(b.String()), 0644)
+}
+
+func (k *managedKey) readState(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fields := k.fields()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return fmt.Errorf("invalid line in %q: %q", name, line)
+		}
+		field, value := line[:i], strings.TrimSpace(line[i+1:])
+		for j := range stateFields {
+			if stateFields[j] != field {
+				continue
+			}
+			t, err := time.Parse(stateTime, value)
+			if err != nil {
+				return fmt.Errorf("invalid time in %q: %q", name, line)
+			}
+			*fields[j] = t
+		}
+	}
+	return scanner.Err()
+}
+
+// writeFile writes data to the file name, by renaming a temporary file, so it's never seen half written.
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails after a successful rename
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+const (
+	stateTime = "20060102150405"
+
+	defaultZSKLifetime = 30 * 24 * time.Hour
+	defaultKSKLifetime = 365 * 24 * time.Hour
+	defaultPropagation = 24 * time.Hour
+)
@@ -0,0 +1,274 @@
+package dnssec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func newTestManager(t *testing.T) (*keyManager, func()) {
+	dir, err := ioutil.TempDir("", "coredns-dnssec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newKeyManager(dir, "example.org.")
+	m.zskLifetime = 10 * time.Hour
+	m.kskLifetime = 100 * time.Hour
+	m.propagation = time.Hour
+	m.parentDS = func(string) ([]*dns.DS, error) { return nil, nil }
+	return m, func() { os.RemoveAll(dir) }
+}
+
+func tags(keys []*DNSKEY) map[uint16]bool {
+	t := map[uint16]bool{}
+	for _, k := range keys {
+		t[k.tag] = true
+	}
+	return t
+}
+
+func kinds(keys []*DNSKEY, ksk bool) []*DNSKEY {
+	ks := []*DNSKEY{}
+	for _, k := range keys {
+		if k.IsKSK() == ksk {
+			ks = append(ks, k)
+		}
+	}
+	return ks
+}
+
+func TestRollZSK(t *testing.T) {
+	m, rm := newTestManager(t)
+	defer rm()
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := m.roll(start); err != nil {
+		t.Fatal(err)
+	}
+	published, signing := m.keySet(start)
+	if len(published) != 2 || len(signing) != 2 {
+		t.Fatalf("Expected a KSK and a ZSK, got %d published and %d signing keys", len(published), len(signing))
+	}
+	zsk := kinds(signing, false)[0]
+
+	// Before the lifetime minus the propagation delay nothing happens.
+	now := start.Add(8 * time.Hour)
+	m.roll(now)
+	if published, _ := m.keySet(now); len(published) != 2 {
+		t.Fatalf("Expected no new key, got %d published keys", len(published))
+	}
+
+	// The new ZSK is published one propagation delay before it signs.
+	now = start.Add(9 * time.Hour)
+	m.roll(now)
+	published, signing = m.keySet(now)
+	zsks := kinds(published, false)
+	if len(zsks) != 2 {
+		t.Fatalf("Expected 2 published ZSKs, got %d", len(zsks))
+	}
+	if s := kinds(signing, false); len(s) != 1 || s[0].tag != zsk.tag {
+		t.Fatalf("Expected only ZSK %d to sign", zsk.tag)
+	}
+
+	// At the end of the lifetime the new ZSK takes over, the old one stays published.
+	now = start.Add(10 * time.Hour)
+	m.roll(now)
+	published, signing = m.keySet(now)
+	if len(kinds(published, false)) != 2 {
+		t.Fatalf("Expected 2 published ZSKs, got %d", len(kinds(published, false)))
+	}
+	s := kinds(signing, false)
+	if len(s) != 1 || s[0].tag == zsk.tag {
+		t.Fatalf("Expected only the new ZSK to sign")
+	}
+
+	// One propagation delay later the old one is gone.
+	now = start.Add(11 * time.Hour)
+	m.roll(now)
+	published, _ = m.keySet(now)
+	if zsks := kinds(published, false); len(zsks) != 1 || zsks[0].tag != s[0].tag {
+		t.Fatalf("Expected only the new ZSK to be published")
+	}
+}
+
+func TestRollKSK(t *testing.T) {
+	m, rm := newTestManager(t)
+	defer rm()
+	m.zskLifetime = 1000 * time.Hour // keep the ZSK out of the way
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.roll(start)
+	_, signing := m.keySet(start)
+	ksk := kinds(signing, true)[0]
+	if ds := m.ds(start); len(ds) != 1 || ds[0].tag != ksk.tag {
+		t.Fatalf("Expected the KSK in the CDS RRset")
+	}
+
+	// Double signature: both KSKs sign, the CDS RRset is still the old one.
+	now := start.Add(100 * time.Hour)
+	m.roll(now)
+	_, signing = m.keySet(now)
+	ksks := kinds(signing, true)
+	if len(ksks) != 2 {
+		t.Fatalf("Expected 2 signing KSKs, got %d", len(ksks))
+	}
+	if ds := m.ds(now); len(ds) != 1 || ds[0].tag != ksk.tag {
+		t.Fatalf("Expected the old KSK in the CDS RRset")
+	}
+	next := ksks[0]
+	if next.tag == ksk.tag {
+		next = ksks[1]
+	}
+
+	// After the propagation delay the CDS RRset switches to the new KSK.
+	now = now.Add(time.Hour)
+	m.roll(now)
+	if ds := m.ds(now); len(ds) != 1 || ds[0].tag != next.tag {
+		t.Fatalf("Expected the new KSK in the CDS RRset")
+	}
+	if _, signing := m.keySet(now); len(kinds(signing, true)) != 2 {
+		t.Fatalf("Expected the old KSK to still sign")
+	}
+
+	// Until the new DS is seen at the parent, the old KSK keeps signing, however long that takes.
+	now = now.Add(100 * time.Hour)
+	m.roll(now)
+	if _, signing := m.keySet(now); len(kinds(signing, true)) != 2 {
+		t.Fatalf("Expected the old KSK to sign while the new DS isn't seen")
+	}
+	if !m.waiting {
+		t.Fatalf("Expected the rollover to wait for the new DS")
+	}
+
+	// Once it is, the old KSK signs for another propagation delay and is then removed.
+	m.parentDS = func(string) ([]*dns.DS, error) { return []*dns.DS{ksk.D, next.D}, nil }
+	m.roll(now)
+	if _, signing := m.keySet(now); len(kinds(signing, true)) != 2 {
+		t.Fatalf("Expected the old KSK to sign until the old DS expired from caches")
+	}
+	now = now.Add(time.Hour)
+	m.roll(now)
+	published, signing := m.keySet(now)
+	if tags(published)[ksk.tag] || tags(signing)[ksk.tag] {
+		t.Fatalf("Expected the old KSK to be removed")
+	}
+	if !tags(signing)[next.tag] {
+		t.Fatalf("Expected the new KSK to sign")
+	}
+}
+
+func TestLookupDS(t *testing.T) {
+	m, rm := newTestManager(t)
+	defer rm()
+	m.roll(time.Now().UTC())
+	_, signing := m.keySet(time.Now().UTC())
+	ksk := kinds(signing, true)[0]
+
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		if r.Question[0].Qtype == dns.TypeDS {
+			ret.Answer = append(ret.Answer, ksk.D)
+		}
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	m.resolvers = []string{s.Addr}
+	ds, err := m.lookupDS(m.name)
+	if err != nil {
+		t.Fatalf("Expected the DS RRset, got error: %s", err)
+	}
+	if len(ds) != 1 || ds[0].KeyTag != ksk.tag || ds[0].Digest != ksk.D.Digest {
+		t.Fatalf("Expected the DS of KSK %d, got %v", ksk.tag, ds)
+	}
+}
+
+func TestRollLoad(t *testing.T) {
+	m, rm := newTestManager(t)
+	defer rm()
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.roll(start)
+	now := start.Add(9 * time.Hour)
+	m.roll(now) // a new ZSK is published
+	published, signing := m.keySet(now)
+
+	// A restart must pick up the keys, and their timeline, from the directory.
+	m1 := newKeyManager(m.dir, m.name)
+	m1.zskLifetime, m1.kskLifetime, m1.propagation = m.zskLifetime, m.kskLifetime, m.propagation
+	if err := m1.load(now); err != nil {
+		t.Fatal(err)
+	}
+	m1.roll(now)
+	published1, signing1 := m1.keySet(now)
+	if len(published1) != len(published) || len(signing1) != len(signing) {
+		t.Fatalf("Expected %d published and %d signing keys, got %d and %d", len(published), len(signing), len(published1), len(signing1))
+	}
+	for tag := range tags(published) {
+		if !tags(published1)[tag] {
+			t.Errorf("Expected key %d to be published", tag)
+		}
+	}
+
+	later := start.Add(10 * time.Hour)
+	m.roll(later)
+	m1.roll(later)
+	_, signing = m.keySet(later)
+	_, signing1 = m1.keySet(later)
+	if kinds(signing, false)[0].tag != kinds(signing1, false)[0].tag {
+		t.Errorf("Expected the same ZSK to sign after a restart")
+	}
+}
+
+func TestCDS(t *testing.T) {
+	m, rm := newTestManager(t)
+	defer rm()
+	if err := m.roll(time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	d := New([]string{"example.org."}, nil, false, test.ErrorHandler(), cache.New(defaultCap))
+	d.manager = m
+
+	for _, qtype := range []uint16{dns.TypeCDS, dns.TypeCDNSKEY, dns.TypeDNSKEY} {
+		r := new(dns.Msg)
+		r.SetQuestion("example.org.", qtype)
+		r.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := d.ServeDNS(context.TODO(), rec, r); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		want := 1 // the KSK
+		if qtype == dns.TypeDNSKEY {
+			want = 2
+		}
+		sigs, rrs := 0, 0
+		for _, rr := range rec.Msg.Answer {
+			switch x := rr.(type) {
+			case *dns.RRSIG:
+				sigs++
+				if x.KeyTag != kinds(m.ds(time.Now().UTC()), true)[0].tag {
+					t.Errorf("Expected %s to be signed by the KSK", dns.TypeToString[qtype])
+				}
+			default:
+				rrs++
+				if rr.Header().Rrtype != qtype {
+					t.Errorf("Expected %s, got %s", dns.TypeToString[qtype], dns.TypeToString[rr.Header().Rrtype])
+				}
+			}
+		}
+		if rrs != want || sigs != 1 {
+			t.Errorf("Expected %d %s records and 1 signature, got %d and %d", want, dns.TypeToString[qtype], rrs, sigs)
+		}
+	}
+}
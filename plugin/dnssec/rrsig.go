@@ -19,6 +19,18 @@ func (k *DNSKEY) newRRSIG(signerName string, ttl, incep, expir uint32) *dns.RRSI
 	return sig
 }
 
+// Sign returns the signature made with k over the RRset rrs, valid from incep until expir. Unlike the
+// signatures made on-the-fly, the original TTL is the TTL of rrs.
+func (k *DNSKEY) Sign(rrs []dns.RR, signerName string, incep, expir uint32) (*dns.RRSIG, error) {
+	ttl := rrs[0].Header().Ttl
+	sig := k.newRRSIG(signerName, ttl, incep, expir)
+	sig.OrigTtl = ttl
+	if err := sig.Sign(k.s, rrs); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
 type rrset struct {
 	qname string
 	qtype uint16
@@ -1,18 +1,22 @@
 package dnssec
 
 import (
+	"encoding/hex"
 	"fmt"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
 	"github.com/coredns/coredns/plugin/pkg/cache"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/parse"
 
 	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
 )
 
 var log = clog.NewWithPlugin("dnssec")
@@ -25,35 +29,64 @@ func init() {
 }
 
 func setup(c *caddy.Controller) error {
-	zones, keys, capacity, splitkeys, err := dnssecParse(c)
+	zones, keys, capacity, splitkeys, opts, err := dnssecParse(c)
 	if err != nil {
 		return plugin.Error("dnssec", err)
 	}
 
 	ca := cache.New(capacity)
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-		return New(zones, keys, splitkeys, next, ca)
+		d := New(zones, keys, splitkeys, next, ca)
+		d.manager = opts.manager
+		d.nsec3, d.optOut = opts.nsec3, opts.optOut
+		return d
 	})
 
 	c.OnStartup(func() error {
-		metrics.MustRegister(c, cacheSize, cacheHits, cacheMisses)
+		metrics.MustRegister(c, cacheSize, cacheHits, cacheMisses, keyCount, keyEvents, kskWaiting)
 		return nil
 	})
 
+	if manager := opts.manager; manager != nil {
+		c.OnStartup(func() error {
+			now := time.Now().UTC()
+			if err := manager.load(now); err != nil {
+				return plugin.Error("dnssec", err)
+			}
+			if err := manager.roll(now); err != nil {
+				return plugin.Error("dnssec", err)
+			}
+			go manager.run()
+			return nil
+		})
+		c.OnShutdown(func() error {
+			close(manager.stop)
+			return nil
+		})
+	}
+
 	return nil
 }
 
-func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
+func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, options, error) {
 	zones := []string{}
 
 	keys := []*DNSKEY{}
 
 	capacity := defaultCap
 
+	var (
+		manager   *keyManager
+		lifetimes = map[string]time.Duration{}
+		resolvers []string
+		nsec3     *dns.NSEC3PARAM
+		optOut    bool
+	)
+
 	i := 0
 	for c.Next() {
 		if i > 0 {
-			return nil, nil, 0, false, plugin.ErrOnce
+			return nil, nil, 0, false, options{}, plugin.ErrOnce
 		}
 		i++
 
@@ -69,23 +102,57 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 
 			switch x := c.Val(); x {
 			case "key":
-				k, e := keyParse(c)
+				k, m, e := keyParse(c)
 				if e != nil {
-					return nil, nil, 0, false, e
+					return nil, nil, 0, false, options{}, e
 				}
 				keys = append(keys, k...)
+				if m != nil {
+					manager = m
+				}
+				if manager != nil && len(keys) > 0 {
+					return nil, nil, 0, false, options{}, c.Err("key auto can not be combined with key file")
+				}
+			case "zsk_lifetime", "ksk_lifetime", "propagation":
+				if !c.NextArg() {
+					return nil, nil, 0, false, options{}, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return nil, nil, 0, false, options{}, c.Errf("invalid duration for %s: %s", x, err)
+				}
+				if d <= 0 {
+					return nil, nil, 0, false, options{}, c.Errf("%s must be positive, got %s", x, d)
+				}
+				lifetimes[x] = d
+			case "ds_resolver":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, nil, 0, false, options{}, c.ArgErr()
+				}
+				r, err := parse.HostPortOrFile(args...)
+				if err != nil {
+					return nil, nil, 0, false, options{}, err
+				}
+				resolvers = r
+			case "nsec3":
+				param, o, err := nsec3Parse(c)
+				if err != nil {
+					return nil, nil, 0, false, options{}, err
+				}
+				nsec3, optOut = param, o
 			case "cache_capacity":
 				if !c.NextArg() {
-					return nil, nil, 0, false, c.ArgErr()
+					return nil, nil, 0, false, options{}, c.ArgErr()
 				}
 				value := c.Val()
 				cacheCap, err := strconv.Atoi(value)
 				if err != nil {
-					return nil, nil, 0, false, err
+					return nil, nil, 0, false, options{}, err
 				}
 				capacity = cacheCap
 			default:
-				return nil, nil, 0, false, c.Errf("unknown property '%s'", x)
+				return nil, nil, 0, false, options{}, c.Errf("unknown property '%s'", x)
 			}
 
 		}
@@ -94,12 +161,36 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 		zones[i] = plugin.Host(zones[i]).Normalize()
 	}
 
+	if manager == nil && (len(lifetimes) > 0 || len(resolvers) > 0) {
+		return nil, nil, 0, false, options{}, fmt.Errorf("zsk_lifetime, ksk_lifetime, propagation and ds_resolver need key auto")
+	}
+	if manager != nil {
+		if len(zones) != 1 {
+			return nil, nil, 0, false, options{}, fmt.Errorf("key auto can only sign one zone, got %d", len(zones))
+		}
+		manager.name = zones[0]
+		if d, ok := lifetimes["zsk_lifetime"]; ok {
+			manager.zskLifetime = d
+		}
+		if d, ok := lifetimes["ksk_lifetime"]; ok {
+			manager.kskLifetime = d
+		}
+		if d, ok := lifetimes["propagation"]; ok {
+			manager.propagation = d
+		}
+		manager.resolvers = resolvers
+		// A rollover must be done before the next one starts.
+		if manager.zskLifetime <= 2*manager.propagation || manager.kskLifetime <= 2*manager.propagation {
+			return nil, nil, 0, false, options{}, fmt.Errorf("zsk_lifetime and ksk_lifetime must be longer than twice the propagation delay %s", manager.propagation)
+		}
+	}
+
 	// Check if we have both KSKs and ZSKs.
 	zsk, ksk := 0, 0
 	for _, k := range keys {
-		if k.isKSK() {
+		if k.IsKSK() {
 			ksk++
-		} else if k.isZSK() {
+		} else if k.IsZSK() {
 			zsk++
 		}
 	}
@@ -116,45 +207,84 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 			}
 		}
 		if !ok {
-			return zones, keys, capacity, splitkeys, fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", string(kname), k.tag)
+			return zones, keys, capacity, splitkeys, options{}, fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", string(kname), k.tag)
 		}
 	}
 
-	return zones, keys, capacity, splitkeys, nil
+	return zones, keys, capacity, splitkeys, options{manager: manager, nsec3: nsec3, optOut: optOut}, nil
 }
 
-func keyParse(c *caddy.Controller) ([]*DNSKEY, error) {
+// options are the settings of dnssec that New doesn't take.
+type options struct {
+	manager *keyManager
+	nsec3   *dns.NSEC3PARAM
+	optOut  bool
+}
+
+// nsec3Parse parses the arguments of nsec3: [ITERATIONS [SALT]] [opt-out]. There are no iterations and no
+// salt by default, as RFC 9276 recommends.
+func nsec3Parse(c *caddy.Controller) (*dns.NSEC3PARAM, bool, error) {
+	param := &dns.NSEC3PARAM{Hash: dns.SHA1}
+	args := c.RemainingArgs()
+	optOut := false
+	if len(args) > 0 && args[len(args)-1] == "opt-out" {
+		optOut = true
+		args = args[:len(args)-1]
+	}
+	if len(args) > 2 {
+		return nil, false, c.ArgErr()
+	}
+	if len(args) > 0 {
+		n, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil || n > maxIterations {
+			return nil, false, c.Errf("invalid NSEC3 iterations '%s'", args[0])
+		}
+		param.Iterations = uint16(n)
+	}
+	if len(args) > 1 && args[1] != "-" {
+		salt, err := hex.DecodeString(args[1])
+		if err != nil || len(salt) > 255 {
+			return nil, false, c.Errf("invalid NSEC3 salt '%s'", args[1])
+		}
+		param.Salt = strings.ToUpper(hex.EncodeToString(salt))
+		param.SaltLength = uint8(len(salt))
+	}
+	return param, optOut, nil
+}
+
+// maxIterations is the highest number of NSEC3 iterations allowed. Validators commonly treat zones using
+// more as insecure (RFC 9276, Section 3.2).
+const maxIterations = 150
+
+func keyParse(c *caddy.Controller) ([]*DNSKEY, *keyManager, error) {
 	keys := []*DNSKEY{}
 	config := dnsserver.GetConfig(c)
 
 	if !c.NextArg() {
-		return nil, c.ArgErr()
+		return nil, nil, c.ArgErr()
 	}
 	value := c.Val()
-	if value == "file" {
+	switch value {
+	case "file":
 		ks := c.RemainingArgs()
 		if len(ks) == 0 {
-			return nil, c.ArgErr()
+			return nil, nil, c.ArgErr()
 		}
-
-		for _, k := range ks {
-			base := k
-			// Kmiek.nl.+013+26205.key, handle .private or without extension: Kmiek.nl.+013+26205
-			if strings.HasSuffix(k, ".key") {
-				base = k[:len(k)-4]
-			}
-			if strings.HasSuffix(k, ".private") {
-				base = k[:len(k)-8]
-			}
-			if !filepath.IsAbs(base) && config.Root != "" {
-				base = filepath.Join(config.Root, base)
-			}
-			k, err := ParseKeyFile(base+".key", base+".private")
-			if err != nil {
-				return nil, err
-			}
-			keys = append(keys, k)
+		keys, err := ParseKeyFiles(config.Root, ks)
+		return keys, nil, err
+	case "auto":
+		if !c.NextArg() {
+			return nil, nil, c.ArgErr()
+		}
+		dir := c.Val()
+		if !filepath.IsAbs(dir) && config.Root != "" {
+			dir = filepath.Join(config.Root, dir)
+		}
+		if c.NextArg() {
+			return nil, nil, c.ArgErr()
 		}
+		// The name is set once the zones are known.
+		return nil, newKeyManager(dir, ""), nil
 	}
-	return keys, nil
+	return keys, nil, nil
 }
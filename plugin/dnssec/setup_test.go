@@ -78,11 +78,59 @@ func TestSetupDnssec(t *testing.T) {
 				key file ksk_Kcluster.local
 			}`, false, []string{"cluster.local."}, nil, true, defaultCap, "",
 		},
+		{
+			`dnssec example.org {
+				key auto keys
+				zsk_lifetime 720h
+				propagation 1h
+				ds_resolver 127.0.0.1 [::1]:1053
+			}`, false, []string{"example.org."}, nil, false, defaultCap, "",
+		},
+		{
+			`dnssec example.org {
+				key auto keys
+				ksk_lifetime 2h
+				propagation 1h
+			}`, true, []string{"example.org."}, nil, false, defaultCap, "twice the propagation",
+		},
+		{
+			`dnssec example.org cluster.local {
+				key auto keys
+			}`, true, nil, nil, false, defaultCap, "one zone",
+		},
+		{
+			`dnssec cluster.local {
+				key file Kcluster.local
+				key auto keys
+			}`, true, nil, nil, false, defaultCap, "can not be combined",
+		},
+		{
+			`dnssec example.org {
+				zsk_lifetime 720h
+			}`, true, nil, nil, false, defaultCap, "need key auto",
+		},
+		{
+			`dnssec example.org {
+				ds_resolver 127.0.0.1
+			}`, true, nil, nil, false, defaultCap, "need key auto",
+		},
+		{
+			`dnssec example.org {
+				key auto keys
+				ds_resolver
+			}`, true, nil, nil, false, defaultCap, "argument count",
+		},
+		{
+			`dnssec example.org {
+				key auto keys
+				propagation soon
+			}`, true, nil, nil, false, defaultCap, "invalid duration",
+		},
 	}
 
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.input)
-		zones, keys, capacity, splitkeys, err := dnssecParse(c)
+		zones, keys, capacity, splitkeys, _, err := dnssecParse(c)
 
 		if test.shouldErr && err == nil {
 			t.Errorf("Test %d: Expected error but found %s for input %s", i, err, test.input)
@@ -118,6 +166,51 @@ func TestSetupDnssec(t *testing.T) {
 	}
 }
 
+func TestSetupNSEC3(t *testing.T) {
+	tests := []struct {
+		input      string
+		shouldErr  bool
+		nsec3      bool
+		iterations uint16
+		salt       string
+		optOut     bool
+	}{
+		{`dnssec example.org`, false, false, 0, "", false},
+		{"dnssec example.org {\n nsec3\n}", false, true, 0, "", false},
+		{"dnssec example.org {\n nsec3 opt-out\n}", false, true, 0, "", true},
+		{"dnssec example.org {\n nsec3 5 aabb\n}", false, true, 5, "AABB", false},
+		{"dnssec example.org {\n nsec3 5 - opt-out\n}", false, true, 5, "", true},
+		// fails
+		{"dnssec example.org {\n nsec3 151\n}", true, false, 0, "", false},
+		{"dnssec example.org {\n nsec3 1 xyz\n}", true, false, 0, "", false},
+		{"dnssec example.org {\n nsec3 1 aa bb\n}", true, false, 0, "", false},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		_, _, _, _, opts, err := dnssecParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if (opts.nsec3 != nil) != test.nsec3 {
+			t.Fatalf("Test %d: expected NSEC3 %t, got %t", i, test.nsec3, opts.nsec3 != nil)
+		}
+		if opts.nsec3 == nil {
+			continue
+		}
+		if opts.nsec3.Iterations != test.iterations || opts.nsec3.Salt != test.salt || opts.optOut != test.optOut {
+			t.Errorf("Test %d: expected %d iterations, salt %q and opt-out %t, got %d, %q and %t", i,
+				test.iterations, test.salt, test.optOut, opts.nsec3.Iterations, opts.nsec3.Salt, opts.optOut)
+		}
+	}
+}
+
 const keypub = `; This is a zone-signing key, keyid 45330, for cluster.local.
 ; Created: 20170901060531 (Fri Sep  1 08:05:31 2017)
 ; Publish: 20170901060531 (Fri Sep  1 08:05:31 2017)
@@ -0,0 +1,268 @@
+package dnssec
+
+import (
+	"context"
+	"encoding/base32"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// whiteLies returns the NSEC3 records, and their signatures, that deny the qname or the qtype. These are
+// white lies (RFC 7129, Appendix B): every NSEC3 record covers just the hash it has to, so the names in
+// the zone can't be enumerated.
+//
+// For NODATA the NSEC3 record matches the qname and has every type, except the qtype, in its bitmap. For
+// NXDOMAIN it is the closest encloser proof (RFC 5155, Section 7.2.2): an NSEC3 record matching the
+// closest encloser, one covering the next closer name and one covering the wildcard at the closest
+// encloser. The closest encloser is found by asking the next plugin, see closestEncloser. Its types
+// aren't known, so its bitmap has every type so that nothing is denied for it.
+//
+// When the answer is synthesized from wildcard, the closest encloser is the parent of the wildcard.
+// A NODATA answer then gets the NSEC3 records matching the closest encloser and the wildcard, the
+// latter without the qtype, and the one covering the next closer name (RFC 5155, Section 7.2.5). A
+// positive answer only needs the one covering the next closer name (RFC 5155, Section 7.2.6).
+func (d Dnssec) whiteLies(ctx context.Context, state request.Request, mt response.Type, wildcard string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
+	qname := state.Name()
+	var nsec3s []*dns.NSEC3
+	switch {
+	case wildcard != "":
+		ce := wildcard[2:]
+		nsec3s = []*dns.NSEC3{d.nsec3Cover(nextCloser(qname, ce), state.Zone, ttl)}
+		if mt == response.NoData {
+			nsec3s = []*dns.NSEC3{
+				d.nsec3Match(ce, state.Zone, nsec3Bitmap(ce == state.Zone, 0), ttl),
+				nsec3s[0],
+				d.nsec3Match(wildcard, state.Zone, nsec3Bitmap(false, state.QType()), ttl),
+			}
+		}
+	case mt == response.NameError && qname != state.Zone:
+		ce := d.closestEncloser(ctx, state)
+		nsec3s = []*dns.NSEC3{
+			d.nsec3Match(ce, state.Zone, nsec3Bitmap(ce == state.Zone, 0), ttl),
+			d.nsec3Cover(nextCloser(qname, ce), state.Zone, ttl),
+			d.nsec3Cover("*."+ce, state.Zone, ttl),
+		}
+	default:
+		nsec3s = []*dns.NSEC3{d.nsec3Match(qname, state.Zone, nsec3Bitmap(qname == state.Zone, state.QType()), ttl)}
+	}
+
+	rrs := []dns.RR{}
+	for _, n := range nsec3s {
+		sigs, err := d.sign([]dns.RR{n}, state.Zone, ttl, incep, expir, server)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, n)
+		rrs = append(rrs, sigs...)
+	}
+	return rrs, nil
+}
+
+// closestEncloser returns the closest encloser of the qname in state, that doesn't exist: its longest
+// ancestor that does. The ancestors of a name that exists exist too, so the next plugin is asked for
+// them in a binary search: that is at most maxProbes queries, for a name of 127 labels. If there is no
+// next plugin, or it fails, the parent is used.
+func (d Dnssec) closestEncloser(ctx context.Context, state request.Request) string {
+	parent := parentName(state.Name())
+	if d.Next == nil {
+		return parent
+	}
+	// The ancestors below the zone, longest first.
+	names := []string{}
+	for name := parent; name != state.Zone && name != "."; name = parentName(name) {
+		names = append(names, name)
+	}
+	lo, hi := 0, len(names)
+	for probes := 0; lo < hi && probes < maxProbes; probes++ {
+		mid := (lo + hi) / 2
+		exists, ok := d.exists(ctx, state, names[mid])
+		if !ok {
+			return parent
+		}
+		if exists {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	if lo >= len(names) {
+		return state.Zone
+	}
+	return names[lo]
+}
+
+// exists asks the next plugin whether name exists, ok is false when it can't tell. The answers are
+// cached for their TTL, as the probes don't pass the *cache* plugin.
+func (d Dnssec) exists(ctx context.Context, state request.Request, name string) (exists, ok bool) {
+	h := fnv.New64()
+	h.Write([]byte(strings.ToLower(name)))
+	key := h.Sum64()
+
+	now := time.Now().UTC()
+	if p, ok := d.probes.Get(key); ok && now.Before(p.(probe).expire) {
+		return p.(probe).exists, true
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(name, dns.TypeA)
+	nw := nonwriter.New(state.W)
+	plugin.NextOrFailure(d.Name(), d.Next, ctx, nw, m)
+	if nw.Msg == nil || (nw.Msg.Rcode != dns.RcodeSuccess && nw.Msg.Rcode != dns.RcodeNameError) {
+		return false, false
+	}
+	exists = nw.Msg.Rcode == dns.RcodeSuccess
+	mt, _ := response.Typify(nw.Msg, now)
+	d.probes.Add(key, probe{exists: exists, expire: now.Add(dnsutil.MinimalTTL(nw.Msg, mt))})
+	return exists, true
+}
+
+// probe is the cached answer to the question whether a name exists.
+type probe struct {
+	exists bool
+	expire time.Time
+}
+
+// maxProbes is the maximum number of queries to find a closest encloser, enough for 127 labels.
+const maxProbes = 7
+
+// wildcard returns the wildcard the answer to state is synthesized from, as reported by the next
+// plugin in the "file/wildcard" metadata. It returns "" if there is none.
+func wildcard(ctx context.Context, state request.Request) string {
+	f := metadata.ValueFunc(ctx, "file/wildcard")
+	if f == nil {
+		return ""
+	}
+	w := f()
+	if !strings.HasPrefix(w, "*.") || !dns.IsSubDomain(state.Zone, w) || !dns.IsSubDomain(w[2:], state.Name()) || w[2:] == state.Name() {
+		return ""
+	}
+	return w
+}
+
+// signWildcard signs rrs, synthesized from wildcard, as the wildcard: the signature gets the label
+// count of the wildcard, so the validator can tell it's an expansion (RFC 4035, Section 5.3.4).
+func (d Dnssec) signWildcard(rrs []dns.RR, wildcard, zone string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
+	wild := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		wild[i] = dns.Copy(rr)
+		wild[i].Header().Name = wildcard
+	}
+	sigs, err := d.sign(wild, zone, ttl, incep, expir, server)
+	if err != nil {
+		return nil, err
+	}
+	// The signatures are cached, and shared by all names the wildcard expands to.
+	owned := make([]dns.RR, len(sigs))
+	for i, s := range sigs {
+		owned[i] = dns.Copy(s)
+		owned[i].Header().Name = rrs[0].Header().Name
+	}
+	return owned, nil
+}
+
+// nextCloser returns the next closer name of qname: its ancestor with one label more than the closest
+// encloser ce.
+func nextCloser(qname, ce string) string {
+	name := qname
+	for parentName(name) != ce && name != "." {
+		name = parentName(name)
+	}
+	return name
+}
+
+// nsec3Match returns an NSEC3 record whose owner is the hash of name, with types in its bitmap.
+func (d Dnssec) nsec3Match(name, zone string, types []uint16, ttl uint32) *dns.NSEC3 {
+	h := dns.HashName(name, d.nsec3.Hash, d.nsec3.Iterations, d.nsec3.Salt)
+	return d.newNSEC3(h, hashAdd(h, 1), zone, types, ttl)
+}
+
+// nsec3Cover returns an NSEC3 record that covers the hash of name, and only that hash.
+func (d Dnssec) nsec3Cover(name, zone string, ttl uint32) *dns.NSEC3 {
+	h := dns.HashName(name, d.nsec3.Hash, d.nsec3.Iterations, d.nsec3.Salt)
+	return d.newNSEC3(hashAdd(h, -1), hashAdd(h, 1), zone, nil, ttl)
+}
+
+func (d Dnssec) newNSEC3(owner, next, zone string, types []uint16, ttl uint32) *dns.NSEC3 {
+	n := &dns.NSEC3{
+		Hash:       d.nsec3.Hash,
+		Iterations: d.nsec3.Iterations,
+		SaltLength: d.nsec3.SaltLength,
+		Salt:       d.nsec3.Salt,
+		HashLength: uint8(base32.HexEncoding.DecodedLen(len(next))),
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+	n.Hdr = dns.RR_Header{Name: strings.ToLower(owner) + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: ttl}
+	if d.optOut {
+		n.Flags = 1
+	}
+	return n
+}
+
+// getNSEC3PARAM returns the NSEC3PARAM record of the zone. Signatures are added when do is true.
+func (d Dnssec) getNSEC3PARAM(state request.Request, zone string, do bool, server string) *dns.Msg {
+	param := dns.Copy(d.nsec3).(*dns.NSEC3PARAM)
+	param.Hdr = dns.RR_Header{Name: zone, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: 0}
+	return d.keyReply(state, zone, []dns.RR{param}, do, server)
+}
+
+// nsec3Bitmap returns the NSEC3 bitmap for a name, or for the apex, without the type drop.
+func nsec3Bitmap(apex bool, drop uint16) []uint16 {
+	bitmap := zoneBitmap[:]
+	if apex {
+		bitmap = apexBitmap[:]
+	}
+	types := make([]uint16, 0, len(bitmap)+1)
+	for _, t := range bitmap {
+		if t != dns.TypeNSEC && t != drop {
+			types = append(types, t)
+		}
+	}
+	if apex && drop != dns.TypeNSEC3PARAM {
+		types = append(types, dns.TypeNSEC3PARAM)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// hashAdd returns the base32hex encoded hash h plus delta, modulo the size of the hash.
+func hashAdd(h string, delta int) string {
+	b, err := base32.HexEncoding.DecodeString(strings.ToUpper(h))
+	if err != nil {
+		return h
+	}
+	carry := delta
+	for i := len(b) - 1; i >= 0 && carry != 0; i-- {
+		v := int(b[i]) + carry
+		b[i] = byte(v)
+		switch {
+		case v > 255:
+			carry = 1
+		case v < 0:
+			carry = -1
+		default:
+			carry = 0
+		}
+	}
+	return base32.HexEncoding.EncodeToString(b)
+}
+
+// parentName returns the name with its first label removed.
+func parentName(name string) string {
+	i, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[i:]
+}
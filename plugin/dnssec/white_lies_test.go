@@ -0,0 +1,309 @@
+package dnssec
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func newWhiteLies(t *testing.T, optOut bool) (Dnssec, func(), func()) {
+	d, rm1, rm2 := newDnssec(t, []string{"miek.nl."})
+	d.nsec3 = &dns.NSEC3PARAM{Hash: dns.SHA1, Iterations: 1, SaltLength: 2, Salt: "AABB"}
+	d.optOut = optOut
+	return d, rm1, rm2
+}
+
+func nsec3s(rrs []dns.RR) []*dns.NSEC3 {
+	n := []*dns.NSEC3{}
+	for _, rr := range rrs {
+		if x, ok := rr.(*dns.NSEC3); ok {
+			n = append(n, x)
+		}
+	}
+	return n
+}
+
+func TestWhiteLiesNameError(t *testing.T) {
+	d, rm1, rm2 := newWhiteLies(t, false)
+	defer rm1()
+	defer rm2()
+
+	m := testNxdomainMsg()
+	m.Question[0].Name = "a.ww.miek.nl."
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+
+	if m.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeNameError, m.Rcode)
+	}
+	if !section(m.Ns, 4) {
+		t.Errorf("Authority section should have 4 sigs")
+	}
+	n := nsec3s(m.Ns)
+	if len(n) != 3 {
+		t.Fatalf("Expected 3 NSEC3 records, got %d", len(n))
+	}
+	// Closest encloser, next closer name and the wildcard at the closest encloser.
+	if !n[0].Match("ww.miek.nl.") {
+		t.Errorf("Expected NSEC3 matching the closest encloser")
+	}
+	if !n[1].Cover("a.ww.miek.nl.") || n[1].Match("a.ww.miek.nl.") {
+		t.Errorf("Expected NSEC3 covering the next closer name")
+	}
+	if !n[2].Cover("*.ww.miek.nl.") {
+		t.Errorf("Expected NSEC3 covering the wildcard")
+	}
+	// White lies cover nothing but the name they deny.
+	for _, name := range []string{"miek.nl.", "www.miek.nl.", "b.ww.miek.nl."} {
+		if n[1].Cover(name) || n[2].Cover(name) {
+			t.Errorf("Expected %s not to be covered", name)
+		}
+	}
+	for _, x := range n {
+		if x.Flags != 0 {
+			t.Errorf("Expected no opt-out flag, got flags %d", x.Flags)
+		}
+	}
+}
+
+func TestWhiteLiesClosestEncloser(t *testing.T) {
+	zone, err := file.Parse(strings.NewReader(dbMiekNL), "miek.nl.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	d, rm1, rm2 := newWhiteLies(t, false)
+	defer rm1()
+	defer rm2()
+	d.Next = file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{"miek.nl.": zone}, Names: []string{"miek.nl."}}}
+
+	tests := []struct {
+		qname      string
+		ce         string
+		nextCloser string
+	}{
+		{"x.a.miek.nl.", "a.miek.nl.", "x.a.miek.nl."},
+		{"x.y.miek.nl.", "miek.nl.", "y.miek.nl."},
+		{"x.y.z.miek.nl.", "miek.nl.", "z.miek.nl."},
+	}
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		d.ServeDNS(context.TODO(), rec, m)
+
+		if rec.Msg.Rcode != dns.RcodeNameError {
+			t.Fatalf("Expected rcode %d for %s, got %d", dns.RcodeNameError, tc.qname, rec.Msg.Rcode)
+		}
+		n := nsec3s(rec.Msg.Ns)
+		if len(n) != 3 {
+			t.Fatalf("Expected 3 NSEC3 records for %s, got %d", tc.qname, len(n))
+		}
+		if !n[0].Match(tc.ce) {
+			t.Errorf("Expected NSEC3 matching the closest encloser %s", tc.ce)
+		}
+		if !n[1].Cover(tc.nextCloser) || n[1].Match(tc.nextCloser) {
+			t.Errorf("Expected NSEC3 covering the next closer name %s", tc.nextCloser)
+		}
+		if !n[2].Cover("*." + tc.ce) {
+			t.Errorf("Expected NSEC3 covering the wildcard at %s", tc.ce)
+		}
+	}
+}
+
+func TestWhiteLiesProbes(t *testing.T) {
+	d, rm1, rm2 := newWhiteLies(t, false)
+	defer rm1()
+	defer rm2()
+
+	// Only miek.nl. and a.miek.nl. exist.
+	probes := 0
+	d.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		probes++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Ns = []dns.RR{test.SOA("miek.nl.	1800	IN	SOA	linode.atoom.net. miek.miek.nl. 1282630057 14400 3600 604800 14400")}
+		if name := r.Question[0].Name; name != "miek.nl." && name != "a.miek.nl." {
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+		return m.Rcode, nil
+	})
+
+	qname := strings.Repeat("x.", 100) + "a.miek.nl."
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	state := request.Request{Req: m, Zone: "miek.nl.", W: &test.ResponseWriter{}}
+	if ce := d.closestEncloser(context.TODO(), state); ce != "a.miek.nl." {
+		t.Errorf("Expected closest encloser a.miek.nl., got %s", ce)
+	}
+	if probes > maxProbes {
+		t.Errorf("Expected at most %d probes, got %d", maxProbes, probes)
+	}
+
+	// The answers are cached.
+	probes = 0
+	d.closestEncloser(context.TODO(), state)
+	if probes != 0 {
+		t.Errorf("Expected the probes to be cached, got %d queries", probes)
+	}
+}
+
+func TestWhiteLiesWildcard(t *testing.T) {
+	zone, err := file.Parse(strings.NewReader(dbWildcard), "miek.nl.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	d, rm1, rm2 := newWhiteLies(t, false)
+	defer rm1()
+	defer rm2()
+	f := file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{"miek.nl.": zone}, Names: []string{"miek.nl."}}}
+	d.Next = f
+
+	tests := []struct {
+		qtype uint16
+		nsec3 int
+	}{
+		{dns.TypeTXT, 1}, // the next closer name
+		{dns.TypeMX, 3},  // the closest encloser, the next closer name and the wildcard
+	}
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion("x.y.w.miek.nl.", tc.qtype)
+		m.SetEdns0(4096, true)
+		// As the metadata plugin does.
+		ctx := metadata.ContextWithMetadata(context.TODO())
+		ctx = f.Metadata(ctx, request.Request{Req: m, W: &test.ResponseWriter{}})
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		d.ServeDNS(ctx, rec, m)
+
+		n := nsec3s(rec.Msg.Ns)
+		if len(n) != tc.nsec3 {
+			t.Fatalf("Expected %d NSEC3 records for %s, got %d", tc.nsec3, dns.TypeToString[tc.qtype], len(n))
+		}
+		if tc.qtype == dns.TypeTXT {
+			if !n[0].Cover("y.w.miek.nl.") || n[0].Match("y.w.miek.nl.") {
+				t.Errorf("Expected NSEC3 covering the next closer name")
+			}
+			// The signature is the wildcard's, with its label count.
+			var txt []dns.RR
+			var sig *dns.RRSIG
+			for _, rr := range rec.Msg.Answer {
+				switch x := rr.(type) {
+				case *dns.TXT:
+					txt = append(txt, x)
+				case *dns.RRSIG:
+					sig = x
+				}
+			}
+			if sig == nil || sig.Labels != 3 || sig.Hdr.Name != "x.y.w.miek.nl." {
+				t.Fatalf("Expected a signature of the wildcard with 3 labels, got %v", sig)
+			}
+			if err := sig.Verify(d.keys[0].K, txt); err != nil {
+				t.Errorf("Expected the signature to validate, got %s", err)
+			}
+			continue
+		}
+		if !n[0].Match("w.miek.nl.") {
+			t.Errorf("Expected NSEC3 matching the closest encloser")
+		}
+		if !n[1].Cover("y.w.miek.nl.") {
+			t.Errorf("Expected NSEC3 covering the next closer name")
+		}
+		if !n[2].Match("*.w.miek.nl.") {
+			t.Errorf("Expected NSEC3 matching the wildcard")
+		}
+		for _, typ := range n[2].TypeBitMap {
+			if typ == dns.TypeMX {
+				t.Errorf("Expected MX not to be in the bitmap of the wildcard")
+			}
+		}
+	}
+}
+
+const dbWildcard = `
+$TTL    30M
+$ORIGIN miek.nl.
+@       IN      SOA     linode.atoom.net. miek.miek.nl. ( 1282630057 4H 1H 7D 4H )
+        IN      NS      linode.atoom.net.
+w       IN      A       127.0.0.1
+*.w     IN      TXT     "wildcard"
+`
+
+func TestWhiteLiesNoData(t *testing.T) {
+	d, rm1, rm2 := newWhiteLies(t, true)
+	defer rm1()
+	defer rm2()
+
+	m := testNoDataMsg()
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+
+	if m.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeSuccess, m.Rcode)
+	}
+	n := nsec3s(m.Ns)
+	if len(n) != 1 {
+		t.Fatalf("Expected 1 NSEC3 record, got %d", len(n))
+	}
+	if !n[0].Match("www.miek.nl.") {
+		t.Errorf("Expected NSEC3 matching the qname")
+	}
+	if n[0].Flags != 1 {
+		t.Errorf("Expected the opt-out flag, got flags %d", n[0].Flags)
+	}
+	for _, typ := range n[0].TypeBitMap {
+		if typ == dns.TypeTXT || typ == dns.TypeNSEC {
+			t.Errorf("Expected %s not to be in the bitmap", dns.TypeToString[typ])
+		}
+	}
+
+	// The NSEC3 record must pack and its signature must validate.
+	var sig *dns.RRSIG
+	for _, rr := range m.Ns {
+		if x, ok := rr.(*dns.RRSIG); ok && x.TypeCovered == dns.TypeNSEC3 {
+			sig = x
+		}
+	}
+	if sig == nil {
+		t.Fatal("Expected a signature over the NSEC3 record")
+	}
+	if err := sig.Verify(d.keys[0].K, []dns.RR{n[0]}); err != nil {
+		t.Errorf("Expected the signature to validate, got %s", err)
+	}
+}
+
+func TestHashAdd(t *testing.T) {
+	tests := []struct {
+		in    string
+		delta int
+		out   string
+	}{
+		{"00000000000000000000000000000000", 1, "00000000000000000000000000000001"},
+		{"00000000000000000000000000000000", -1, "VVVVVVVVVVVVVVVVVVVVVVVVVVVVVVVV"},
+		{"VVVVVVVVVVVVVVVVVVVVVVVVVVVVVVVV", 1, "00000000000000000000000000000000"},
+		{"0000000000000000000000000000000V", 1, "00000000000000000000000000000010"},
+	}
+	for i, tc := range tests {
+		if got := hashAdd(tc.in, tc.delta); got != tc.out {
+			t.Errorf("Test %d: expected %s, got %s", i, tc.out, got)
+		}
+	}
+}
+
+func testNoDataMsg() *dns.Msg {
+	return &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeSuccess},
+		Question: []dns.Question{{Name: "www.miek.nl.", Qclass: dns.ClassINET, Qtype: dns.TypeTXT}},
+		Ns:       []dns.RR{test.SOA("miek.nl.	1800	IN	SOA	linode.atoom.net. miek.miek.nl. 1461471181 14400 3600 604800 14400")},
+	}
+}
@@ -0,0 +1,87 @@
+// Package doh configures the DNS-over-HTTPS server of a server block.
+package doh
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("doh", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	if err := parse(c); err != nil {
+		return plugin.Error("doh", err)
+	}
+	return nil
+}
+
+func parse(c *caddy.Controller) error {
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return plugin.ErrOnce
+		}
+		i++
+		if len(c.RemainingArgs()) != 0 {
+			return c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "path":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				path := c.Val()
+				if !strings.HasPrefix(path, "/") {
+					return c.Errf("path must start with a '/': %q", path)
+				}
+				config.DoHPath = path
+				if c.NextArg() {
+					return c.ArgErr()
+				}
+
+			case "trusted_proxies":
+				args := c.RemainingArgs()
+				// trusted_proxies CIDR... [header forwarded|x-forwarded-for]
+				if n := len(args); n >= 2 && args[n-2] == "header" {
+					switch strings.ToLower(args[n-1]) {
+					case "forwarded":
+						config.DoHTrustedHeader = "Forwarded"
+					case "x-forwarded-for":
+						config.DoHTrustedHeader = "X-Forwarded-For"
+					default:
+						return c.Errf("unknown header %q, must be forwarded or x-forwarded-for", args[n-1])
+					}
+					args = args[:n-2]
+				}
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, a := range args {
+					n, err := pkgparse.Net(a)
+					if err != nil {
+						return c.Errf("illegal CIDR notation %q", a)
+					}
+					config.DoHTrustedProxies = append(config.DoHTrustedProxies, n)
+				}
+
+			default:
+				return c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return nil
+}
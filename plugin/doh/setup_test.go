@@ -0,0 +1,94 @@
+package doh
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		path      string
+		trusted   []string
+		header    string
+	}{
+		// positive
+		{`doh`, false, "", nil, ""},
+		{`doh {
+			path /resolve
+		}`, false, "/resolve", nil, ""},
+		{`doh {
+			trusted_proxies 10.0.0.0/8 192.168.1.1
+			trusted_proxies 2001:db8::/32
+		}`, false, "", []string{"10.0.0.0/8", "192.168.1.1/32", "2001:db8::/32"}, ""},
+		{`doh {
+			trusted_proxies 10.0.0.0/8 header forwarded
+		}`, false, "", []string{"10.0.0.0/8"}, "Forwarded"},
+		{`doh {
+			trusted_proxies 10.0.0.0/8 header X-Forwarded-For
+		}`, false, "", []string{"10.0.0.0/8"}, "X-Forwarded-For"},
+		// negative
+		{`doh /resolve`, true, "", nil, ""},
+		{`doh {
+			path
+		}`, true, "", nil, ""},
+		{`doh {
+			path resolve
+		}`, true, "", nil, ""},
+		{`doh {
+			path /a /b
+		}`, true, "", nil, ""},
+		{`doh {
+			trusted_proxies
+		}`, true, "", nil, ""},
+		{`doh {
+			trusted_proxies 10.0.0.0/33
+		}`, true, "", nil, ""},
+		{`doh {
+			blah
+		}`, true, "", nil, ""},
+		{`doh {
+			trusted_proxies header forwarded
+		}`, true, "", nil, ""},
+		{`doh {
+			trusted_proxies 10.0.0.0/8 header x-real-ip
+		}`, true, "", nil, ""},
+		{"doh\ndoh", true, "", nil, ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found one for input %s: %v", i, test.input, err)
+			continue
+		}
+
+		cfg := dnsserver.GetConfig(c)
+		if cfg.DoHPath != test.path {
+			t.Errorf("Test %d: Expected path %q, got %q", i, test.path, cfg.DoHPath)
+		}
+		if cfg.DoHTrustedHeader != test.header {
+			t.Errorf("Test %d: Expected header %q, got %q", i, test.header, cfg.DoHTrustedHeader)
+		}
+		if len(cfg.DoHTrustedProxies) != len(test.trusted) {
+			t.Errorf("Test %d: Expected %d trusted proxies, got %d", i, len(test.trusted), len(cfg.DoHTrustedProxies))
+			continue
+		}
+		for j, n := range cfg.DoHTrustedProxies {
+			if n.String() != test.trusted[j] {
+				t.Errorf("Test %d: Expected trusted proxy %s, got %s", i, test.trusted[j], n)
+			}
+		}
+	}
+}
@@ -69,6 +69,11 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		return dns.RcodeSuccess, nil
 	}
 
+	if r.Opcode == dns.OpcodeUpdate {
+		update := Update{z}
+		return update.ServeDNS(ctx, w, r)
+	}
+
 	if z.Expired != nil && *z.Expired {
 		log.Errorf("Zone %s is expired", zone)
 		return dns.RcodeServerFailure, nil
@@ -141,10 +146,14 @@ func Parse(f io.Reader, origin, fileName string, serial int64) (*Zone, error) {
 		if err := z.Insert(rr); err != nil {
 			return nil, err
 		}
+		z.journal.records++
 	}
 	if !seenSOA {
 		return nil, fmt.Errorf("file %q has no SOA record", fileName)
 	}
+	if z.Apex.SOA != nil {
+		z.fileSerial = int64(z.Apex.SOA.Serial)
+	}
 
 	return z, nil
 }
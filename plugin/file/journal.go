@@ -0,0 +1,159 @@
+package file
+
+import (
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultJournalSize is the number of changes of a zone that are kept for incremental zone transfers.
+const DefaultJournalSize = 100
+
+// delta is the change of a zone from one serial to the next, as sent in an incremental zone
+// transfer (RFC 1995). The SOA records themselves are not part of deleted and added.
+type delta struct {
+	from, to *dns.SOA
+	deleted  []dns.RR
+	added    []dns.RR
+}
+
+func (d delta) len() int { return len(d.deleted) + len(d.added) + 2 }
+
+// journal holds the most recent deltas of a zone, oldest first. Each delta starts at the serial
+// the previous one ends with. The journal is protected by the zone's reloadMu.
+type journal struct {
+	deltas  []delta
+	size    int // number of records in deltas
+	records int // (approximate) number of records in the zone
+}
+
+// add adds d to the journal and drops the oldest deltas when there are more than max, or when the
+// journal holds more records than the zone itself; sending the full zone is cheaper then. If d
+// doesn't start where the journal ends, the journal is cleared first.
+func (j *journal) add(d delta, max int) {
+	if n := len(j.deltas); n > 0 && j.deltas[n-1].to.Serial != d.from.Serial {
+		j.clear()
+	}
+	j.deltas = append(j.deltas, d)
+	j.size += d.len()
+
+	for len(j.deltas) > 0 && (len(j.deltas) > max || j.size > j.records) {
+		j.size -= j.deltas[0].len()
+		j.deltas[0] = delta{}
+		j.deltas = j.deltas[1:]
+	}
+}
+
+func (j *journal) clear() {
+	j.deltas = nil
+	j.size = 0
+}
+
+// since returns the deltas from serial to the current serial of the zone, or false if the journal
+// doesn't go back that far.
+func (j *journal) since(serial uint32) ([]delta, bool) {
+	for i, d := range j.deltas {
+		if d.from.Serial == serial {
+			return j.deltas[i:], true
+		}
+	}
+	return nil, false
+}
+
+// changes collects the records deleted from and added to a zone. Deleting a record that was added
+// before, or adding one that was deleted, cancels out.
+type changes struct {
+	deleted []dns.RR
+	added   []dns.RR
+}
+
+func (c *changes) add(rr dns.RR) {
+	if i := indexRR(c.deleted, rr); i >= 0 {
+		c.deleted = append(c.deleted[:i], c.deleted[i+1:]...)
+		return
+	}
+	c.added = append(c.added, rr)
+}
+
+func (c *changes) del(rr dns.RR) {
+	if i := indexRR(c.added, rr); i >= 0 {
+		c.added = append(c.added[:i], c.added[i+1:]...)
+		return
+	}
+	c.deleted = append(c.deleted, rr)
+}
+
+// indexRR returns the index of rr in rrs, or -1. Unlike dns.IsDuplicate, the TTLs must be equal too.
+func indexRR(rrs []dns.RR, rr dns.RR) int {
+	for i, x := range rrs {
+		if x.Header().Ttl == rr.Header().Ttl && dns.IsDuplicate(x, rr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// diff returns the changes from zone z1 to zone z2, and the number of records in the latter. The SOA
+// records are not compared.
+func diff(z1, z2 *Zone) (*changes, int) {
+	c := &changes{}
+	diffRRs(c, z1.Apex.SIGSOA, z2.Apex.SIGSOA)
+	diffRRs(c, z1.Apex.NS, z2.Apex.NS)
+	diffRRs(c, z1.Apex.SIGNS, z2.Apex.SIGNS)
+	records := 1 + len(z2.Apex.SIGSOA) + len(z2.Apex.NS) + len(z2.Apex.SIGNS)
+
+	records += diffTrees(c, z1.Tree, z2.Tree)
+	records += diffTrees(c, z1.nsec3, z2.nsec3)
+	return c, records
+}
+
+// diffTrees adds the changes from tree t1 to tree t2 to c, and returns the number of records in t2.
+func diffTrees(c *changes, t1, t2 *tree.Tree) int {
+	records := 0
+	// Both trees are sorted in canonical order, so walk them side by side.
+	e1, e2 := t1.All(), t2.All()
+	i, j := 0, 0
+	for i < len(e1) || j < len(e2) {
+		switch {
+		case j == len(e2):
+			diffRRs(c, e1[i].All(), nil)
+			i++
+		case i == len(e1):
+			diffRRs(c, nil, e2[j].All())
+			records += len(e2[j].All())
+			j++
+		default:
+			cmp := tree.Less(e1[i], e2[j].Name())
+			switch {
+			case cmp < 0:
+				diffRRs(c, nil, e2[j].All())
+				records += len(e2[j].All())
+				j++
+			case cmp > 0:
+				diffRRs(c, e1[i].All(), nil)
+				i++
+			default:
+				diffRRs(c, e1[i].All(), e2[j].All())
+				records += len(e2[j].All())
+				i++
+				j++
+			}
+		}
+	}
+	return records
+}
+
+// diffRRs adds the records of old that aren't in new to the deleted records of c, and those of new
+// that aren't in old to the added records.
+func diffRRs(c *changes, old, new []dns.RR) {
+	for _, rr := range old {
+		if indexRR(new, rr) < 0 {
+			c.deleted = append(c.deleted, rr)
+		}
+	}
+	for _, rr := range new {
+		if indexRR(old, rr) < 0 {
+			c.added = append(c.added, rr)
+		}
+	}
+}
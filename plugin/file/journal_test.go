@@ -0,0 +1,206 @@
+package file
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const dbUpdate2 = `$TTL 3600
+example.org.      IN SOA ns.example.org. admin.example.org. 2019010101 3600 600 86400 300
+example.org.      IN NS  ns.example.org.
+example.org.      IN NS  ns3.example.org.
+ns.example.org.   IN A   192.0.2.53
+www.example.org.  IN A   192.0.2.1
+www.example.org.  IN A   192.0.2.3
+alias.example.org. IN CNAME www.example.org.
+host.example.org. IN A   192.0.2.10
+`
+
+func TestDiff(t *testing.T) {
+	z1, err := Parse(strings.NewReader(dbUpdate), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	z2, err := Parse(strings.NewReader(dbUpdate2), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+
+	c, records := diff(z1, z2)
+	if records != 8 {
+		t.Errorf("Expected 8 records in the new zone, got %d", records)
+	}
+
+	deleted := rrs("example.org. 3600 IN NS ns2.example.org.", "www.example.org. 3600 IN A 192.0.2.2", `txt.example.org. 3600 IN TXT "hello"`)
+	added := rrs("example.org. 3600 IN NS ns3.example.org.", "www.example.org. 3600 IN A 192.0.2.3", "host.example.org. 3600 IN A 192.0.2.10")
+	testChanges(t, "deleted", c.deleted, deleted)
+	testChanges(t, "added", c.added, added)
+}
+
+func testChanges(t *testing.T, what string, got, want []dns.RR) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("Expected %d %s records, got %d: %v", len(want), what, len(got), got)
+		return
+	}
+	for _, rr := range want {
+		if indexRR(got, rr) < 0 {
+			t.Errorf("Expected %s record %s, got %v", what, rr, got)
+		}
+	}
+}
+
+func testDelta(from, to uint32, n int) delta {
+	d := delta{
+		from: &dns.SOA{Hdr: dns.RR_Header{Rrtype: dns.TypeSOA}, Serial: from},
+		to:   &dns.SOA{Hdr: dns.RR_Header{Rrtype: dns.TypeSOA}, Serial: to},
+	}
+	for i := 0; i < n; i++ {
+		d.added = append(d.added, &dns.A{Hdr: dns.RR_Header{Rrtype: dns.TypeA}})
+	}
+	return d
+}
+
+func TestJournalAdd(t *testing.T) {
+	j := journal{records: 100}
+	for i := uint32(1); i <= 5; i++ {
+		j.add(testDelta(i, i+1, 1), 3)
+	}
+	if len(j.deltas) != 3 || j.size != 9 {
+		t.Fatalf("Expected 3 deltas of 9 records, got %d of %d", len(j.deltas), j.size)
+	}
+	if _, ok := j.since(2); ok {
+		t.Errorf("Expected serial 2 to be dropped from the journal")
+	}
+	if d, ok := j.since(4); !ok || len(d) != 2 {
+		t.Errorf("Expected 2 deltas since serial 4, got %d", len(d))
+	}
+
+	// A delta that doesn't follow the last one clears the journal.
+	j.add(testDelta(10, 11, 1), 3)
+	if len(j.deltas) != 1 || j.size != 3 {
+		t.Fatalf("Expected 1 delta of 3 records, got %d of %d", len(j.deltas), j.size)
+	}
+
+	// Deltas holding more records than the zone are dropped.
+	j.add(testDelta(11, 12, 98), 3)
+	if len(j.deltas) != 1 || j.deltas[0].from.Serial != 11 {
+		t.Errorf("Expected only the delta from serial 11, got %d deltas", len(j.deltas))
+	}
+	j.add(testDelta(12, 13, 200), 3)
+	if len(j.deltas) != 0 || j.size != 0 {
+		t.Errorf("Expected an empty journal, got %d deltas of %d records", len(j.deltas), j.size)
+	}
+}
+
+func TestZoneReplaceJournal(t *testing.T) {
+	z, err := Parse(strings.NewReader(dbUpdate), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	z2, err := Parse(strings.NewReader(dbUpdate2), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+
+	z.replace(z2)
+	if z.Apex.SOA.Serial != 2019010101 {
+		t.Errorf("Expected serial 2019010101, got %d", z.Apex.SOA.Serial)
+	}
+	d, ok := z.journal.since(2019010100)
+	if !ok || len(d) != 1 {
+		t.Fatalf("Expected 1 delta since serial 2019010100, got %d", len(d))
+	}
+	if len(d[0].deleted) != 3 || len(d[0].added) != 3 {
+		t.Errorf("Expected 3 deleted and 3 added records, got %d and %d", len(d[0].deleted), len(d[0].added))
+	}
+
+	// Without a journal nothing is kept.
+	z, _ = Parse(strings.NewReader(dbUpdate), "example.org.", "stdin", 0)
+	z.JournalSize = 0
+	z.replace(z2)
+	if len(z.journal.deltas) != 0 {
+		t.Errorf("Expected an empty journal, got %d deltas", len(z.journal.deltas))
+	}
+}
+
+func ixfrRequest(serial uint32) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetIxfr("example.org.", serial, "ns.example.org.", "admin.example.org.")
+	return m
+}
+
+func TestXfrIxfr(t *testing.T) {
+	z := newUpdateZone(t)
+	z.TransferTo = []string{"*"}
+
+	for _, rr := range []string{"host.example.org. 300 IN A 192.0.2.10", "host.example.org. 300 IN A 192.0.2.11"} {
+		m := new(dns.Msg)
+		m.SetUpdate("example.org.")
+		m.Insert(rrs(rr))
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		Update{z}.ServeDNS(context.TODO(), rec, m)
+		if rec.Msg.Rcode != dns.RcodeSuccess {
+			t.Fatalf("Expected update to succeed, got %s", dns.RcodeToString[rec.Msg.Rcode])
+		}
+	}
+	if z.Apex.SOA.Serial != 2019010102 {
+		t.Fatalf("Expected serial 2019010102, got %d", z.Apex.SOA.Serial)
+	}
+
+	tests := []struct {
+		serial uint32
+		// expected serials of the SOA records in the answer, nil for a full zone transfer
+		serials []uint32
+	}{
+		{2019010100, []uint32{2019010102, 2019010100, 2019010101, 2019010101, 2019010102, 2019010102}},
+		{2019010101, []uint32{2019010102, 2019010101, 2019010102, 2019010102}},
+		{2019010102, []uint32{2019010102}},
+		{2019010103, []uint32{2019010102}},
+		{2018010100, nil},
+	}
+
+	x := Xfr{z}
+	for i, tc := range tests {
+		records := x.ixfr(ixfrRequest(tc.serial))
+		if tc.serials == nil {
+			if records != nil {
+				t.Errorf("Test %d: expected a full zone transfer, got %d records", i, len(records))
+			}
+			continue
+		}
+		var serials []uint32
+		for _, rr := range records {
+			if soa, ok := rr.(*dns.SOA); ok {
+				serials = append(serials, soa.Serial)
+			}
+		}
+		if len(serials) != len(tc.serials) {
+			t.Errorf("Test %d: expected SOA serials %v, got %v", i, tc.serials, serials)
+			continue
+		}
+		for k := range serials {
+			if serials[k] != tc.serials[k] {
+				t.Errorf("Test %d: expected SOA serials %v, got %v", i, tc.serials, serials)
+				break
+			}
+		}
+		// Each delta adds one record.
+		if n := len(records) - len(serials); n != (len(tc.serials)-1)/2 {
+			t.Errorf("Test %d: expected %d added records, got %d", i, (len(tc.serials)-1)/2, n)
+		}
+	}
+
+	// Over UDP the answer fits in a single message.
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	x.ServeDNS(context.TODO(), rec, ixfrRequest(2019010100))
+	if len(rec.Msg.Answer) != 8 {
+		t.Errorf("Expected 8 records in the UDP answer, got %d", len(rec.Msg.Answer))
+	}
+}
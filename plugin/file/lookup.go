@@ -32,11 +32,11 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 	qtype := state.QType()
 	do := state.Do()
 
-	if 0 < z.ReloadInterval {
+	if z.mustLock() {
 		z.reloadMu.RLock()
 	}
 	defer func() {
-		if 0 < z.ReloadInterval {
+		if z.mustLock() {
 			z.reloadMu.RUnlock()
 		}
 	}()
@@ -168,6 +168,10 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 		if len(rrs) == 0 {
 			ret := z.soa(do)
 			if do {
+				if n := z.nsec3Param(); n != nil {
+					ret = append(ret, z.nsec3NoData(n, qname, do)...)
+					return nil, ret, nil, NoData
+				}
 				nsec := z.typeFromElem(elem, dns.TypeNSEC, do)
 				ret = append(ret, nsec...)
 			}
@@ -204,6 +208,10 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 		if len(rrs) == 0 {
 			ret := z.soa(do)
 			if do {
+				if n := z.nsec3Param(); n != nil {
+					ret = append(ret, z.nsec3Wildcard(n, qname, wildElem.Name()[2:], true, do)...)
+					return nil, ret, nil, Success
+				}
 				nsec := z.typeFromElem(wildElem, dns.TypeNSEC, do)
 				ret = append(ret, nsec...)
 			}
@@ -212,7 +220,9 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 
 		if do {
 			// An NSEC is needed to say no longer name exists under this wildcard.
-			if deny, found := z.Tree.Prev(qname); found {
+			if n := z.nsec3Param(); n != nil {
+				auth = append(auth, z.nsec3Wildcard(n, qname, wildElem.Name()[2:], false, do)...)
+			} else if deny, found := z.Tree.Prev(qname); found {
 				nsec := z.typeFromElem(deny, dns.TypeNSEC, do)
 				auth = append(auth, nsec...)
 			}
@@ -237,6 +247,15 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 
 	ret := z.soa(do)
 	if do {
+		if n := z.nsec3Param(); n != nil {
+			if rcode == NameError {
+				ret = append(ret, z.nsec3NameError(n, qname, do)...)
+			} else {
+				ret = append(ret, z.nsec3NoData(n, qname, do)...)
+			}
+			goto Out
+		}
+
 		deny, found := z.Tree.Prev(qname)
 		if !found {
 			goto Out
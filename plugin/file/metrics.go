@@ -0,0 +1,78 @@
+package file
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Variables declared for monitoring secondary zones.
+var (
+	TransferCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "secondary",
+		Name:      "transfers_total",
+		Help:      "Counter of incoming zone transfers per zone, type (axfr or ixfr) and result (success or failure).",
+	}, []string{"zone", "type", "result"})
+	TransferDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "secondary",
+		Name:      "transfer_duration_seconds",
+		Buckets:   plugin.TimeBuckets,
+		Help:      "Histogram of the time incoming zone transfers took.",
+	}, []string{"zone", "type"})
+	TransferSerial = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "secondary",
+		Name:      "serial",
+		Help:      "Gauge of the SOA serial of each secondary zone.",
+	}, []string{"zone"})
+	// Staleness reports the seconds since each secondary zone was last known to be up to date.
+	Staleness = &staleness{zones: map[string]*Zone{}}
+)
+
+var stalenessDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(plugin.Namespace, "secondary", "staleness_seconds"),
+	"Seconds since each secondary zone was last known to be up to date with a primary.",
+	[]string{"zone"}, nil,
+)
+
+// staleness is a prometheus.Collector for the staleness of the secondary zones being kept up to date.
+type staleness struct {
+	sync.Mutex
+	zones map[string]*Zone
+}
+
+func (s *staleness) add(z *Zone) {
+	s.Lock()
+	s.zones[z.origin] = z
+	s.Unlock()
+}
+
+// remove removes z, unless it has been replaced by a newer instance of the zone.
+func (s *staleness) remove(z *Zone) {
+	s.Lock()
+	if s.zones[z.origin] == z {
+		delete(s.zones, z.origin)
+	}
+	s.Unlock()
+}
+
+// Describe implements the prometheus.Collector interface.
+func (s *staleness) Describe(ch chan<- *prometheus.Desc) { ch <- stalenessDesc }
+
+// Collect implements the prometheus.Collector interface.
+func (s *staleness) Collect(ch chan<- prometheus.Metric) {
+	s.Lock()
+	defer s.Unlock()
+	for origin, z := range s.zones {
+		t := z.primaries.lastRefreshed()
+		if t.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(stalenessDesc, prometheus.GaugeValue, time.Since(t).Seconds(), origin)
+	}
+}
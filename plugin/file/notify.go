@@ -5,6 +5,7 @@ import (
 	"net"
 
 	"github.com/coredns/coredns/plugin/pkg/rcode"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -13,6 +14,7 @@ import (
 // isNotify checks if state is a notify message and if so, will *also* check if it
 // is from one of the configured masters. If not it will not be a valid notify
 // message. If the zone z is not a secondary zone the message will also be ignored.
+// If a TSIG key is configured for the master, the notify must be signed with it.
 func (z *Zone) isNotify(state request.Request) bool {
 	if state.Req.Opcode != dns.OpcodeNotify {
 		return false
@@ -27,30 +29,38 @@ func (z *Zone) isNotify(state request.Request) bool {
 		if err != nil {
 			continue
 		}
-		if from == remote {
-			return true
+		if from != remote {
+			continue
+		}
+		if key, ok := z.TransferKeys[f]; ok && !tsig.Verified(state.W, state.Req, key) {
+			continue
 		}
+		return true
 	}
 	return false
 }
 
 // Notify will send notifies to all configured TransferTo IP addresses.
 func (z *Zone) Notify() {
-	go notify(z.origin, z.TransferTo)
+	go notify(z.origin, z.TransferTo, z.TransferKeys)
 }
 
 // notify sends notifies to the configured remote servers. It will try up to three times
 // before giving up on a specific remote. We will sequentially loop through "to"
-// until they all have replied (or have 3 failed attempts).
-func notify(zone string, to []string) error {
-	m := new(dns.Msg)
-	m.SetNotify(zone)
-	c := new(dns.Client)
-
+// until they all have replied (or have 3 failed attempts). Notifies to remotes that have
+// a TSIG key are signed with it.
+func notify(zone string, to []string, keys map[string]tsig.Key) error {
 	for _, t := range to {
 		if t == "*" {
 			continue
 		}
+		m := new(dns.Msg)
+		m.SetNotify(zone)
+		c := new(dns.Client)
+		if key, ok := keys[t]; ok {
+			tsig.Sign(m, key)
+			c.TsigSecret = map[string]string{key.Name: key.Secret}
+		}
 		if err := notifyAddr(c, m, t); err != nil {
 			log.Error(err.Error())
 		} else {
@@ -0,0 +1,119 @@
+package file
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Param returns an NSEC3 record of the zone, holding the parameters of its NSEC3 chain, or nil
+// if the zone isn't signed with NSEC3.
+func (z *Zone) nsec3Param() *dns.NSEC3 {
+	e := z.nsec3.Min()
+	if e == nil {
+		return nil
+	}
+	rrs := e.Types(dns.TypeNSEC3)
+	if len(rrs) == 0 {
+		return nil
+	}
+	return rrs[0].(*dns.NSEC3)
+}
+
+// nsec3Match returns the element holding the NSEC3 record for name, if there is one.
+func (z *Zone) nsec3Match(n *dns.NSEC3, name string) (*tree.Elem, bool) {
+	return z.nsec3.Search(z.hashName(n, name))
+}
+
+// nsec3Cover returns the element holding the NSEC3 record covering name, i.e. the one whose owner
+// name precedes the hash of name. The chain wraps around, so this is the last one if none does.
+func (z *Zone) nsec3Cover(n *dns.NSEC3, name string) *tree.Elem {
+	if e, found := z.nsec3.Prev(z.hashName(n, name)); found {
+		return e
+	}
+	return z.nsec3.Max()
+}
+
+func (z *Zone) hashName(n *dns.NSEC3, name string) string {
+	return strings.ToLower(dns.HashName(name, n.Hash, n.Iterations, n.Salt)) + "." + z.origin
+}
+
+// nsec3NoData returns the NSEC3 records proving qname exists, but not with the type asked for.
+func (z *Zone) nsec3NoData(n *dns.NSEC3, qname string, do bool) []dns.RR {
+	e, found := z.nsec3Match(n, qname)
+	if !found {
+		return nil
+	}
+	return z.typeFromElem(e, dns.TypeNSEC3, do)
+}
+
+// nsec3NameError returns the NSEC3 records proving qname doesn't exist: the closest encloser proof
+// and the record covering the wildcard at the closest encloser (RFC 5155, Section 7.2.2).
+func (z *Zone) nsec3NameError(n *dns.NSEC3, qname string, do bool) []dns.RR {
+	ce := z.origin
+	for name := qname; name != z.origin; {
+		i, end := dns.NextLabel(name, 0)
+		if end {
+			break
+		}
+		name = name[i:]
+		if _, found := z.nsec3Match(n, name); found {
+			ce = name
+			break
+		}
+	}
+	elems := z.closestEncloserProof(n, qname, ce)
+	elems = append(elems, z.nsec3Cover(n, "*."+ce))
+	return z.nsec3Records(elems, do)
+}
+
+// nsec3Wildcard returns the NSEC3 records proving qname doesn't exist and the wildcard at the closest
+// encloser ce was used. For a NODATA response the wildcard's own NSEC3 record is added, to prove the
+// type doesn't exist there either (RFC 5155, Sections 7.2.5 and 7.2.6).
+func (z *Zone) nsec3Wildcard(n *dns.NSEC3, qname, ce string, nodata, do bool) []dns.RR {
+	if !nodata {
+		return z.nsec3Records([]*tree.Elem{z.nsec3Cover(n, nextCloser(qname, ce))}, do)
+	}
+	elems := z.closestEncloserProof(n, qname, ce)
+	if e, found := z.nsec3Match(n, "*."+ce); found {
+		elems = append(elems, e)
+	}
+	return z.nsec3Records(elems, do)
+}
+
+// closestEncloserProof returns the elements holding the NSEC3 record matching the closest encloser
+// ce of qname, and the one covering the next closer name (RFC 5155, Section 7.2.1).
+func (z *Zone) closestEncloserProof(n *dns.NSEC3, qname, ce string) []*tree.Elem {
+	elems := []*tree.Elem{}
+	if e, found := z.nsec3Match(n, ce); found {
+		elems = append(elems, e)
+	}
+	return append(elems, z.nsec3Cover(n, nextCloser(qname, ce)))
+}
+
+// nsec3Records returns the NSEC3 records, and signatures if do is true, of elems. An element listed
+// more than once is only added once.
+func (z *Zone) nsec3Records(elems []*tree.Elem, do bool) []dns.RR {
+	rrs := []dns.RR{}
+	seen := map[*tree.Elem]bool{}
+	for _, e := range elems {
+		if e == nil || seen[e] {
+			continue
+		}
+		seen[e] = true
+		rrs = append(rrs, z.typeFromElem(e, dns.TypeNSEC3, do)...)
+	}
+	return rrs
+}
+
+// nextCloser returns the name one label longer than the closest encloser ce, on the way to qname.
+func nextCloser(qname, ce string) string {
+	labels := dns.Split(qname)
+	i := len(labels) - dns.CountLabel(ce) - 1
+	if i < 0 {
+		return qname
+	}
+	return qname[labels[i]:]
+}
@@ -1,22 +1,157 @@
 package file
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func TestParseNSEC3PARAM(t *testing.T) {
-	_, err := Parse(strings.NewReader(nsec3paramTest), "miek.nl", "stdin", 0)
-	if err == nil {
-		t.Fatalf("Expected error when reading zone, got nothing")
+	z, err := Parse(strings.NewReader(nsec3paramTest), "miek.nl", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %s", err)
+	}
+	if rrs := z.All(); len(rrs) != 3 {
+		t.Errorf("Expected 3 records, got %d", len(rrs))
 	}
 }
 
 func TestParseNSEC3(t *testing.T) {
-	_, err := Parse(strings.NewReader(nsec3Test), "miek.nl", "stdin", 0)
-	if err == nil {
-		t.Fatalf("Expected error when reading zone, got nothing")
+	z, err := Parse(strings.NewReader(nsec3Test), "example.org", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %s", err)
+	}
+	if z.nsec3.Len() != 1 {
+		t.Errorf("Expected the NSEC3 records to be kept apart, got %d names", z.nsec3.Len())
+	}
+	// The hashed owner name is not a name in the zone.
+	if _, found := z.Tree.Search("aub8v9ce95ie18spjubsr058h41n7pa5.example.org."); found {
+		t.Errorf("Expected NSEC3 owner name not to be found in the zone")
+	}
+	if rrs := z.All(); len(rrs) != 3 {
+		t.Errorf("Expected 3 records, got %d", len(rrs))
+	}
+}
+
+func TestLookupNSEC3(t *testing.T) {
+	zone, err := Parse(strings.NewReader(nsec3Zone()), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %s", err)
+	}
+	fm := File{Next: test.ErrorHandler(), Zones: Zones{Z: map[string]*Zone{"example.org.": zone}, Names: []string{"example.org."}}}
+	if zone.nsec3Param() == nil {
+		t.Fatal("Expected an NSEC3 chain")
+	}
+
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		rcode  int
+		answer int
+		match  []string // names an NSEC3 record must match
+		cover  []string // names an NSEC3 record must cover
+	}{
+		// NODATA
+		{"a.example.org.", dns.TypeMX, dns.RcodeSuccess, 0, []string{"a.example.org."}, nil},
+		// NODATA for an empty non-terminal
+		{"c.example.org.", dns.TypeA, dns.RcodeSuccess, 0, []string{"c.example.org."}, nil},
+		// NXDOMAIN, the closest encloser is an empty non-terminal
+		{"x.c.example.org.", dns.TypeA, dns.RcodeNameError, 0, []string{"c.example.org."}, []string{"x.c.example.org.", "*.c.example.org."}},
+		// NXDOMAIN, the closest encloser is the apex
+		{"x.y.example.org.", dns.TypeA, dns.RcodeNameError, 0, []string{"example.org."}, []string{"y.example.org.", "*.example.org."}},
+		// Wildcard answer
+		{"x.w.example.org.", dns.TypeTXT, dns.RcodeSuccess, 1, nil, []string{"x.w.example.org."}},
+		// Wildcard NODATA
+		{"x.w.example.org.", dns.TypeA, dns.RcodeSuccess, 0, []string{"w.example.org.", "*.w.example.org."}, []string{"x.w.example.org."}},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := fm.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		resp := rec.Msg
+		if resp.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, resp.Rcode)
+		}
+		if len(resp.Answer) != tc.answer {
+			t.Errorf("Test %d: expected %d answers, got %d", i, tc.answer, len(resp.Answer))
+		}
+
+		nsec3s := []*dns.NSEC3{}
+		for _, rr := range resp.Ns {
+			if x, ok := rr.(*dns.NSEC3); ok {
+				nsec3s = append(nsec3s, x)
+			}
+		}
+		if len(nsec3s) == 0 || len(nsec3s) > len(tc.match)+len(tc.cover) {
+			t.Errorf("Test %d: expected at most %d NSEC3 records, got %d", i, len(tc.match)+len(tc.cover), len(nsec3s))
+		}
+		for _, name := range tc.match {
+			if !anyNSEC3(nsec3s, func(x *dns.NSEC3) bool { return x.Match(name) }) {
+				t.Errorf("Test %d: expected an NSEC3 record matching %s", i, name)
+			}
+		}
+		for _, name := range tc.cover {
+			if !anyNSEC3(nsec3s, func(x *dns.NSEC3) bool { return x.Cover(name) }) {
+				t.Errorf("Test %d: expected an NSEC3 record covering %s", i, name)
+			}
+		}
+	}
+}
+
+func anyNSEC3(nsec3s []*dns.NSEC3, f func(*dns.NSEC3) bool) bool {
+	for _, x := range nsec3s {
+		if f(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// nsec3Zone returns an (unsigned) zone with an NSEC3 chain.
+func nsec3Zone() string {
+	const salt = "AABB"
+	zone := `example.org.	3600	IN	SOA	ns.example.org. hostmaster.example.org. 1 7200 3600 1209600 3600
+example.org.	3600	IN	NS	ns.example.org.
+example.org.	0	IN	NSEC3PARAM	1 0 2 ` + salt + `
+ns.example.org.	3600	IN	A	127.0.0.1
+a.example.org.	3600	IN	A	127.0.0.1
+b.c.example.org.	3600	IN	A	127.0.0.1
+*.w.example.org.	3600	IN	TXT	"wildcard"
+`
+	types := map[string]string{
+		"example.org.":     "NS SOA NSEC3PARAM",
+		"ns.example.org.":  "A",
+		"a.example.org.":   "A",
+		"c.example.org.":   "",
+		"b.c.example.org.": "A",
+		"w.example.org.":   "",
+		"*.w.example.org.": "TXT",
+	}
+	hashes := []string{}
+	bitmap := map[string]string{}
+	for name, t := range types {
+		h := dns.HashName(name, dns.SHA1, 2, salt)
+		hashes = append(hashes, h)
+		bitmap[h] = t
+	}
+	sort.Strings(hashes)
+	for i, h := range hashes {
+		next := hashes[(i+1)%len(hashes)]
+		zone += fmt.Sprintf("%s.example.org. 3600 IN NSEC3 1 0 2 %s %s %s\n", h, salt, next, bitmap[h])
 	}
+	return zone
 }
 
 const nsec3paramTest = `miek.nl.	1800	IN	SOA	linode.atoom.net. miek.miek.nl. 1460175181 14400 3600 604800 14400
@@ -0,0 +1,57 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/miekg/dns"
+)
+
+// WriteFile writes the zone to its file, after the change described by what. The zone is written to a
+// temporary file that is then renamed, so the file is never seen half written. Comments and
+// $INCLUDEs in the original file are lost.
+func (z *Zone) WriteFile(what string) error {
+	z.writeMu.Lock()
+	defer z.writeMu.Unlock()
+
+	records := z.All()
+	soa, ok := records[0].(*dns.SOA)
+	if !ok {
+		return fmt.Errorf("zone %q has no SOA record", z.origin)
+	}
+
+	name := z.File()
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails after a successful rename
+
+	if fi, err := os.Stat(name); err == nil {
+		tmp.Chmod(fi.Mode())
+	}
+
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "; zone %s, serial %d, written after %s\n", z.origin, soa.Serial, what)
+	for _, rr := range records {
+		fmt.Fprintln(w, rr.String())
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+
+	z.reloadMu.Lock()
+	z.fileSerial = int64(soa.Serial)
+	z.reloadMu.Unlock()
+	return nil
+}
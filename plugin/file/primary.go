@@ -0,0 +1,96 @@
+package file
+
+import (
+	"sync"
+	"time"
+)
+
+// primaries tracks the health of the primaries of a secondary zone. A primary that fails isn't tried
+// again until its backoff expires, the backoff doubles with every consecutive failure. The zero
+// value is ready to use.
+type primaries struct {
+	sync.Mutex
+	health    map[string]*primary
+	refreshed time.Time // when the zone was last known to be up to date with a primary
+}
+
+type primary struct {
+	failures int
+	until    time.Time
+}
+
+const (
+	primaryBackoff    = 10 * time.Second
+	primaryBackoffMax = 1 * time.Hour
+)
+
+// order returns the addresses in addrs to try, in order of preference: the ones not in backoff as
+// configured. If all of them are in backoff, only the one whose backoff expires first is returned.
+func (p *primaries) order(addrs []string) []string {
+	p.Lock()
+	defer p.Unlock()
+
+	now := time.Now()
+	up := make([]string, 0, len(addrs))
+	next := ""
+	var until time.Time
+	for _, addr := range addrs {
+		h, ok := p.health[addr]
+		if !ok || !now.Before(h.until) {
+			up = append(up, addr)
+			continue
+		}
+		if next == "" || h.until.Before(until) {
+			next, until = addr, h.until
+		}
+	}
+	if len(up) == 0 && next != "" {
+		up = append(up, next)
+	}
+	return up
+}
+
+// up marks addr as healthy.
+func (p *primaries) up(addr string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.health, addr)
+}
+
+// down records a failure of addr, and returns how long it won't be tried.
+func (p *primaries) down(addr string) time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	if p.health == nil {
+		p.health = map[string]*primary{}
+	}
+	h, ok := p.health[addr]
+	if !ok {
+		h = &primary{}
+		p.health[addr] = h
+	}
+	h.failures++
+	backoff := primaryBackoffMax
+	if h.failures < 16 {
+		backoff = primaryBackoff << uint(h.failures-1)
+	}
+	if backoff > primaryBackoffMax {
+		backoff = primaryBackoffMax
+	}
+	h.until = time.Now().Add(backoff)
+	return backoff
+}
+
+// refresh marks the zone as up to date.
+func (p *primaries) refresh() {
+	p.Lock()
+	defer p.Unlock()
+	p.refreshed = time.Now()
+}
+
+// lastRefreshed returns when the zone was last known to be up to date, or the zero time.
+func (p *primaries) lastRefreshed() time.Time {
+	p.Lock()
+	defer p.Unlock()
+	return p.refreshed
+}
@@ -0,0 +1,47 @@
+package file
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrimariesOrder(t *testing.T) {
+	var p primaries
+	addrs := []string{"10.0.0.1:53", "10.0.0.2:53", "10.0.0.3:53"}
+
+	if order := p.order(addrs); len(order) != 3 {
+		t.Fatalf("Expected all primaries, got %v", order)
+	}
+
+	if d := p.down(addrs[0]); d != primaryBackoff {
+		t.Errorf("Expected backoff %s, got %s", primaryBackoff, d)
+	}
+	if d := p.down(addrs[0]); d != 2*primaryBackoff {
+		t.Errorf("Expected backoff %s, got %s", 2*primaryBackoff, d)
+	}
+	if order := p.order(addrs); len(order) != 2 || order[0] != addrs[1] || order[1] != addrs[2] {
+		t.Errorf("Expected %v, got %v", addrs[1:], order)
+	}
+
+	// With all primaries in backoff, only the one that comes out first is tried.
+	p.down(addrs[1])
+	p.down(addrs[2])
+	if order := p.order(addrs); len(order) != 1 || order[0] != addrs[1] {
+		t.Errorf("Expected [%s], got %v", addrs[1], order)
+	}
+
+	p.up(addrs[0])
+	if order := p.order(addrs); len(order) != 1 || order[0] != addrs[0] {
+		t.Errorf("Expected [%s], got %v", addrs[0], order)
+	}
+
+	for i := 0; i < 100; i++ {
+		p.down(addrs[0])
+	}
+	if d := p.down(addrs[0]); d != primaryBackoffMax {
+		t.Errorf("Expected backoff %s, got %s", primaryBackoffMax, d)
+	}
+	if h := p.health[addrs[0]]; h.until.After(time.Now().Add(primaryBackoffMax)) {
+		t.Errorf("Expected backoff to be capped")
+	}
+}
@@ -3,6 +3,8 @@ package file
 import (
 	"os"
 	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 )
 
 // TickTime is clock resolution. By default ticks every second. Handler checks if reloadInterval has been reached on every tick.
@@ -35,7 +37,8 @@ func (z *Zone) Reload() error {
 					continue
 				}
 
-				serial := z.SOASerialIfDefined()
+				// Compare with what we read from the file, dynamic updates may have changed the serial.
+				serial := z.fileSerialIfDefined()
 				zone, err := Parse(reader, z.origin, zFile, serial)
 				if err != nil {
 					if _, ok := err.(*serialErr); !ok {
@@ -43,12 +46,17 @@ func (z *Zone) Reload() error {
 					}
 					continue
 				}
+				// Without persist, dynamic updates only change the zone in memory. Replacing it with a
+				// file that has an older serial would make the serial go backwards.
+				if cur := z.SOASerialIfDefined(); cur >= 0 && !dnsutil.SerialNewer(zone.Apex.SOA.Serial, uint32(cur)) {
+					log.Warningf("Not reloading zone %q in %q: serial %d is not newer than %d, the serial after dynamic updates", z.origin, zFile, zone.Apex.SOA.Serial, cur)
+					z.reloadMu.Lock()
+					z.fileSerial = zone.fileSerial
+					z.reloadMu.Unlock()
+					continue
+				}
 
-				// copy elements we need
-				z.reloadMu.Lock()
-				z.Apex = zone.Apex
-				z.Tree = zone.Tree
-				z.reloadMu.Unlock()
+				z.replace(zone)
 
 				log.Infof("Successfully reloaded zone %q in %q with serial %d", z.origin, zFile, z.Apex.SOA.Serial)
 				z.Notify()
@@ -72,3 +80,46 @@ func (z *Zone) SOASerialIfDefined() int64 {
 	}
 	return -1
 }
+
+// fileSerialIfDefined returns the serial of the zone as last read from, or written to, its file.
+// If the zone wasn't read from a file, this is the same as SOASerialIfDefined.
+func (z *Zone) fileSerialIfDefined() int64 {
+	z.reloadMu.Lock()
+	defer z.reloadMu.Unlock()
+	if z.fileSerial >= 0 {
+		return z.fileSerial
+	}
+	if z.Apex.SOA != nil {
+		return int64(z.Apex.SOA.Serial)
+	}
+	return -1
+}
+
+// replace replaces the records of z with those of z1, and records the changes in the journal.
+func (z *Zone) replace(z1 *Zone) {
+	var (
+		c       *changes
+		records int
+	)
+	z.reloadMu.RLock()
+	old := z.Apex.SOA
+	if z.JournalSize > 0 && old != nil && z1.Apex.SOA != nil && dnsutil.SerialNewer(z1.Apex.SOA.Serial, old.Serial) {
+		// This may take a while for large zones, so don't block queries.
+		c, records = diff(z, z1)
+	}
+	z.reloadMu.RUnlock()
+
+	z.reloadMu.Lock()
+	// If the zone was updated in the meantime we can't tell what changed.
+	if c == nil || z.Apex.SOA != old {
+		z.journal.clear()
+	} else {
+		z.journal.records = records
+		z.journal.add(delta{from: old, to: z1.Apex.SOA, deleted: c.deleted, added: c.added}, z.JournalSize)
+	}
+	z.Apex = z1.Apex
+	z.Tree = z1.Tree
+	z.nsec3 = z1.nsec3
+	z.fileSerial = z1.fileSerial
+	z.reloadMu.Unlock()
+}
@@ -63,6 +63,41 @@ func TestZoneReload(t *testing.T) {
 	}
 }
 
+func TestZoneReloadOlderThanUpdates(t *testing.T) {
+	fileName, rm, err := test.TempFile(".", reloadZoneTest)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+	reader, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Failed to open zone: %s", err)
+	}
+	z, err := Parse(reader, "miek.nl", fileName, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	// A dynamic update, without persist, moved the serial past the one the file gets.
+	z.Apex.SOA.Serial = 1460175190
+
+	TickTime = 500 * time.Millisecond
+	z.ReloadInterval = 500 * time.Millisecond
+	z.Reload()
+	defer close(z.reloadShutdown)
+
+	if err := ioutil.WriteFile(fileName, []byte(reloadZone2Test), 0644); err != nil {
+		t.Fatalf("Failed to write new zone data: %s", err)
+	}
+	time.Sleep(1 * time.Second)
+
+	if len(z.All()) != 5 {
+		t.Fatalf("Expected 5 RRs, got %d", len(z.All()))
+	}
+	if serial := z.SOASerialIfDefined(); serial != 1460175190 {
+		t.Fatalf("Expected serial %d, got %d", 1460175190, serial)
+	}
+}
+
 func TestZoneReloadSOAChange(t *testing.T) {
 	_, err := Parse(strings.NewReader(reloadZoneTest), "miek.nl.", "stdin", 1460175181)
 	if err == nil {
@@ -1,98 +1,353 @@
 package file
 
 import (
+	"errors"
+	"fmt"
 	"math/rand"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
 	"github.com/miekg/dns"
 )
 
-// TransferIn retrieves the zone from the masters, parses it and sets it live.
+// TransferIn retrieves the zone from the primaries and sets it live. When we have the zone already
+// an incremental transfer (IXFR) is asked for first, falling back to a full one (AXFR). Primaries
+// that failed are skipped until their backoff expires.
 func (z *Zone) TransferIn() error {
-	if len(z.TransferFrom) == 0 {
-		return nil
+	var Err error
+	for _, tr := range z.primaries.order(z.TransferFrom) {
+		if Err = z.transferFrom(tr); Err == nil {
+			z.primaries.up(tr)
+			return nil
+		}
+		z.primaryDown(tr, Err)
 	}
-	m := new(dns.Msg)
-	m.SetAxfr(z.origin)
+	return Err
+}
 
-	z1 := z.CopyWithoutApex()
-	var (
-		Err error
-		tr  string
-	)
+// transferFrom retrieves the zone from the primary tr.
+func (z *Zone) transferFrom(tr string) error {
+	z.reloadMu.RLock()
+	soa := z.Apex.SOA
+	z.reloadMu.RUnlock()
 
-Transfer:
-	for _, tr = range z.TransferFrom {
-		t := new(dns.Transfer)
-		c, err := t.In(m, tr)
+	if soa != nil {
+		err := z.xfrIn(tr, soa)
+		if err == nil {
+			return nil
+		}
+		log.Warningf("Failed incremental transfer of `%s' from %q, trying a full transfer: %v", z.origin, tr, err)
+	}
+	return z.xfrIn(tr, nil)
+}
+
+// xfrIn transfers the zone from tr, incrementally from soa or, when soa is nil, in full.
+func (z *Zone) xfrIn(tr string, soa *dns.SOA) (err error) {
+	typ := "axfr"
+	if soa != nil {
+		typ = "ixfr"
+	}
+	start := time.Now()
+	defer func() {
+		result := "success"
 		if err != nil {
-			log.Errorf("Failed to setup transfer `%s' with `%q': %v", z.origin, tr, err)
-			Err = err
-			continue Transfer
+			result = "failure"
+		}
+		TransferCount.WithLabelValues(z.origin, typ, result).Inc()
+		TransferDuration.WithLabelValues(z.origin, typ).Observe(time.Since(start).Seconds())
+	}()
+
+	m := new(dns.Msg)
+	if soa == nil {
+		m.SetAxfr(z.origin)
+	} else {
+		m.SetIxfr(z.origin, soa.Serial, soa.Ns, soa.Mbox)
+	}
+	t := new(dns.Transfer)
+	if key, ok := z.TransferKeys[tr]; ok {
+		tsig.Sign(m, key)
+		t.TsigSecret = map[string]string{key.Name: key.Secret}
+	}
+	c, err := t.In(m, tr)
+	if err != nil {
+		return err
+	}
+	var records []dns.RR
+	for env := range c {
+		if env.Error != nil {
+			return env.Error
 		}
-		for env := range c {
-			if env.Error != nil {
-				log.Errorf("Failed to transfer `%s' from %q: %v", z.origin, tr, env.Error)
-				Err = env.Error
-				continue Transfer
+		records = append(records, env.RR...)
+	}
+	if len(records) == 0 {
+		return errNoSOA
+	}
+	first, ok := records[0].(*dns.SOA)
+	if !ok {
+		return errNoSOA
+	}
+
+	var z1 *Zone
+	switch {
+	case soa != nil && !dnsutil.SerialNewer(first.Serial, soa.Serial):
+		// Nothing changed.
+		z.transferred(tr, first, typ)
+		return nil
+	case soa != nil && len(records) > 1 && records[1].Header().Rrtype == dns.TypeSOA:
+		z1, err = z.applyIxfr(records)
+	default:
+		// A full zone, the reply to an IXFR may be one too.
+		typ = "axfr"
+		z1 = z.CopyWithoutApex()
+		for _, rr := range records {
+			if err = z1.Insert(rr); err != nil {
+				break
 			}
-			for _, rr := range env.RR {
-				if err := z1.Insert(rr); err != nil {
-					log.Errorf("Failed to parse transfer `%s' from: %q: %v", z.origin, tr, err)
-					Err = err
-					continue Transfer
-				}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	z.replace(z1)
+	if z.Persist {
+		if err := z.WriteFile("a zone transfer"); err != nil {
+			log.Errorf("Failed to write zone %q to %q: %s", z.origin, z.File(), err)
+		}
+	}
+	z.transferred(tr, first, typ)
+	return nil
+}
+
+// transferred logs and records the successful transfer of the zone with SOA soa from tr.
+func (z *Zone) transferred(tr string, soa *dns.SOA, typ string) {
+	z.refreshed()
+	TransferSerial.WithLabelValues(z.origin).Set(float64(soa.Serial))
+	log.Infof("Transferred: %s from %s with %s, serial %d", z.origin, tr, strings.ToUpper(typ), soa.Serial)
+}
+
+// applyIxfr applies the incremental transfer in records (RFC 1995, Section 4) to a copy of the zone,
+// and returns it. The transfer must start from the current serial of the zone, and every record
+// deleted must exist.
+func (z *Zone) applyIxfr(records []dns.RR) (*Zone, error) {
+	last, ok := records[len(records)-1].(*dns.SOA)
+	if !ok || last.Serial != records[0].(*dns.SOA).Serial {
+		return nil, errIxfr
+	}
+
+	z.reloadMu.RLock()
+	current := z.all()
+	z.reloadMu.RUnlock()
+
+	// The records of the zone keyed by their data, in order.
+	set := make(map[string]dns.RR, len(current))
+	keys := make([]string, 0, len(current))
+	for _, rr := range current[1:] {
+		k := rrKey(rr)
+		set[k] = rr
+		keys = append(keys, k)
+	}
+
+	serial := current[0].(*dns.SOA).Serial
+	deleting := false
+	for _, rr := range records[1 : len(records)-1] {
+		soa, isSOA := rr.(*dns.SOA)
+		switch {
+		case isSOA && !deleting: // start of a difference sequence
+			if soa.Serial != serial {
+				return nil, fmt.Errorf("IXFR difference from serial %d, expected %d", soa.Serial, serial)
+			}
+			deleting = true
+		case isSOA: // end of the deleted records
+			serial = soa.Serial
+			deleting = false
+		case deleting:
+			k := rrKey(rr)
+			if _, ok := set[k]; !ok {
+				return nil, fmt.Errorf("IXFR deletes a record not in the zone: %s", rr)
 			}
+			delete(set, k)
+		default:
+			k := rrKey(rr)
+			if _, ok := set[k]; !ok {
+				keys = append(keys, k)
+			}
+			set[k] = rr
 		}
-		Err = nil
-		break
 	}
-	if Err != nil {
-		return Err
+	if deleting || serial != last.Serial {
+		return nil, errIxfr
 	}
 
-	z.Tree = z1.Tree
-	z.Apex = z1.Apex
-	*z.Expired = false
-	log.Infof("Transferred: %s from %s", z.origin, tr)
+	z1 := z.CopyWithoutApex()
+	z1.Insert(last)
+	for _, k := range keys {
+		rr, ok := set[k]
+		if !ok {
+			continue
+		}
+		delete(set, k)
+		if err := z1.Insert(rr); err != nil {
+			return nil, err
+		}
+	}
+	return z1, nil
+}
+
+// rrKey returns a key for rr that ignores its TTL and the case of the names Insert lowercases.
+func rrKey(rr dns.RR) string {
+	rr = dns.Copy(rr)
+	rr.Header().Ttl = 0
+	rr.Header().Name = strings.ToLower(rr.Header().Name)
+	switch x := rr.(type) {
+	case *dns.NS:
+		x.Ns = strings.ToLower(x.Ns)
+	case *dns.CNAME:
+		x.Target = strings.ToLower(x.Target)
+	case *dns.MX:
+		x.Mx = strings.ToLower(x.Mx)
+	case *dns.SRV:
+		x.Target = strings.ToLower(x.Target)
+	}
+	return rr.String()
+}
+
+// refreshed records that the zone is up to date with its primaries. The file of a persisted zone is
+// touched, as its modification time is when the zone was last refreshed.
+func (z *Zone) refreshed() {
+	z.primaries.refresh()
+	if z.Expired != nil && *z.Expired {
+		*z.Expired = false
+	}
+	if z.Persist {
+		now := time.Now()
+		if err := os.Chtimes(z.File(), now, now); err != nil {
+			log.Warningf("Failed to touch %q of zone %s: %s", z.File(), z.origin, err)
+		}
+	}
+}
+
+// ReadFile loads a secondary zone from the file it was persisted to. The modification time of the file
+// is taken as the time the zone was last refreshed, the zone expires relative to it. A missing file is
+// not an error.
+func (z *Zone) ReadFile() error {
+	name := z.File()
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	z1, err := Parse(f, z.origin, name, 0)
+	if err != nil {
+		return err
+	}
+	z.replace(z1)
+
+	z.primaries.Lock()
+	z.primaries.refreshed = fi.ModTime()
+	z.primaries.Unlock()
+
+	soa := z1.Apex.SOA
+	TransferSerial.WithLabelValues(z.origin).Set(float64(soa.Serial))
+	age := time.Since(fi.ModTime())
+	if age >= time.Duration(soa.Expire)*time.Second {
+		*z.Expired = true
+		log.Warningf("Loaded zone %s with serial %d from %q, but it expired %s ago", z.origin, soa.Serial, name, age-time.Duration(soa.Expire)*time.Second)
+		return nil
+	}
+	log.Infof("Loaded zone %s with serial %d from %q, last refreshed %s ago", z.origin, soa.Serial, name, age.Round(time.Second))
 	return nil
 }
 
+// untilExpire returns how long until the zone expires, when it isn't refreshed in the meantime.
+func (z *Zone) untilExpire(expire time.Duration) time.Duration {
+	last := z.primaries.lastRefreshed()
+	if last.IsZero() {
+		return expire
+	}
+	return expire - time.Since(last)
+}
+
+// primaryDown records the failure of primary tr.
+func (z *Zone) primaryDown(tr string, err error) {
+	backoff := z.primaries.down(tr)
+	log.Warningf("Primary %q of `%s' failed, not trying it for %s: %v", tr, z.origin, backoff, err)
+}
+
 // shouldTransfer checks the primaries of zone, retrieves the SOA record, checks the current serial
 // and the remote serial and will return true if the remote one is higher than the locally configured one.
 func (z *Zone) shouldTransfer() (bool, error) {
-	c := new(dns.Client)
-	c.Net = "tcp" // do this query over TCP to minimize spoofing
-	m := new(dns.Msg)
-	m.SetQuestion(z.origin, dns.TypeSOA)
-
-	var Err error
+	var (
+		Err  error
+		from string
+	)
 	serial := -1
 
 Transfer:
-	for _, tr := range z.TransferFrom {
+	for _, tr := range z.primaries.order(z.TransferFrom) {
 		Err = nil
+		c := new(dns.Client)
+		c.Net = "tcp" // do this query over TCP to minimize spoofing
+		m := new(dns.Msg)
+		m.SetQuestion(z.origin, dns.TypeSOA)
+		if key, ok := z.TransferKeys[tr]; ok {
+			tsig.Sign(m, key)
+			c.TsigSecret = map[string]string{key.Name: key.Secret}
+		}
 		ret, _, err := c.Exchange(m, tr)
-		if err != nil || ret.Rcode != dns.RcodeSuccess {
+		if err == nil && ret.Rcode != dns.RcodeSuccess {
+			err = fmt.Errorf("SOA query answered with %s", dns.RcodeToString[ret.Rcode])
+		}
+		if err != nil {
 			Err = err
+			z.primaryDown(tr, err)
 			continue
 		}
 		for _, a := range ret.Answer {
 			if a.Header().Rrtype == dns.TypeSOA {
 				serial = int(a.(*dns.SOA).Serial)
+				from = tr
 				break Transfer
 			}
 		}
+		Err = errNoSOA
+		z.primaryDown(tr, Err)
 	}
 	if serial == -1 {
 		return false, Err
 	}
-	if z.Apex.SOA == nil {
+	z.primaries.up(from)
+
+	z.reloadMu.RLock()
+	soa := z.Apex.SOA
+	z.reloadMu.RUnlock()
+	if soa == nil {
 		return true, Err
 	}
-	return less(z.Apex.SOA.Serial, uint32(serial)), Err
+	if !less(soa.Serial, uint32(serial)) {
+		z.refreshed()
+		TransferSerial.WithLabelValues(z.origin).Set(float64(soa.Serial))
+		return false, Err
+	}
+	return true, Err
 }
 
+var (
+	errNoSOA = errors.New("no SOA record")
+	errIxfr  = errors.New("malformed IXFR")
+)
+
 // less return true of a is smaller than b when taking RFC 1982 serial arithmetic into account.
 func less(a, b uint32) bool {
 	if a < b {
@@ -103,14 +358,20 @@ func less(a, b uint32) bool {
 
 // Update updates the secondary zone according to its SOA. It will run for the life time of the server
 // and uses the SOA parameters. Every refresh it will check for a new SOA number. If that fails (for all
-// server) it will retry every retry interval. If the zone failed to transfer before the expire, the zone
-// will be marked expired.
+// server) it will retry every retry interval. If the zone wasn't refreshed within the expire interval,
+// the zone will be marked expired. Update returns when the zone is shut down.
 func (z *Zone) Update() error {
 	// If we don't have a SOA, we don't have a zone, wait for it to appear.
 	for z.Apex.SOA == nil {
-		time.Sleep(1 * time.Second)
+		select {
+		case <-time.After(1 * time.Second):
+		case <-z.updateShutdown:
+			return nil
+		}
 	}
-	retryActive := false
+	Staleness.add(z)
+	// A zone read from its file may be due for a refresh already.
+	retryActive := z.untilExpire(time.Second*time.Duration(z.Apex.SOA.Refresh)) <= 0
 
 Restart:
 	refresh := time.Second * time.Duration(z.Apex.SOA.Refresh)
@@ -119,14 +380,24 @@ Restart:
 
 	refreshTicker := time.NewTicker(refresh)
 	retryTicker := time.NewTicker(retry)
-	expireTicker := time.NewTicker(expire)
+	expireTimer := time.NewTimer(z.untilExpire(expire))
 
 	for {
 		select {
-		case <-expireTicker.C:
-			if !retryActive {
+		case <-z.updateShutdown:
+			refreshTicker.Stop()
+			retryTicker.Stop()
+			expireTimer.Stop()
+			return nil
+
+		case <-expireTimer.C:
+			if left := z.untilExpire(expire); left > 0 {
+				expireTimer.Reset(left)
 				break
 			}
+			if !*z.Expired {
+				log.Warningf("Zone %s expired, it wasn't refreshed for %s", z.origin, expire)
+			}
 			*z.Expired = true
 
 		case <-retryTicker.C:
@@ -153,7 +424,7 @@ Restart:
 			retryActive = false
 			refreshTicker.Stop()
 			retryTicker.Stop()
-			expireTicker.Stop()
+			expireTimer.Stop()
 			goto Restart
 
 		case <-refreshTicker.C:
@@ -179,7 +450,7 @@ Restart:
 			retryActive = false
 			refreshTicker.Stop()
 			retryTicker.Stop()
-			expireTicker.Stop()
+			expireTimer.Stop()
 			goto Restart
 
 		}
@@ -2,12 +2,18 @@ package file
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // TODO(miek): should test notifies as well, ie start test server (a real coredns one)...
@@ -156,9 +162,267 @@ func TestIsNotify(t *testing.T) {
 	}
 }
 
+func TestIsNotifyTsig(t *testing.T) {
+	z := new(Zone)
+	z.Expired = new(bool)
+	z.origin = testZone
+	state := newRequest(testZone, dns.TypeSOA)
+	state.Req.Opcode = dns.OpcodeNotify
+
+	key := tsig.Key{Name: "xfr.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+	z.TransferFrom = []string{"10.240.0.1:53"}
+	z.TransferKeys = map[string]tsig.Key{"10.240.0.1:53": key}
+	if z.isNotify(state) {
+		t.Fatal("Unsigned notify should have been invalid")
+	}
+	tsig.Sign(state.Req, key)
+	if !z.isNotify(state) {
+		t.Fatal("Signed notify should have been valid")
+	}
+}
+
+func TestTransferAllowedTsig(t *testing.T) {
+	z := NewZone(testZone, "stdin")
+	state := newRequest(testZone, dns.TypeAXFR)
+
+	key := tsig.Key{Name: "xfr.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+	z.TransferTo = []string{"*"}
+	z.TransferKeys = map[string]tsig.Key{"*": key}
+	if z.TransferAllowed(state) {
+		t.Fatal("Unsigned transfer should not have been allowed")
+	}
+	tsig.Sign(state.Req, tsig.Key{Name: "other.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"})
+	if z.TransferAllowed(state) {
+		t.Fatal("Transfer signed with another key should not have been allowed")
+	}
+	state.Req.Extra = nil
+	tsig.Sign(state.Req, key)
+	if !z.TransferAllowed(state) {
+		t.Fatal("Signed transfer should have been allowed")
+	}
+}
+
 func newRequest(zone string, qtype uint16) request.Request {
 	m := new(dns.Msg)
 	m.SetQuestion("example.com.", dns.TypeA)
 	m.SetEdns0(4097, true)
 	return request.Request{W: &test.ResponseWriter{}, Req: m}
 }
+
+// ixfr is a primary for testZone at serial 252 that has the changes from serial 250.
+type ixfr struct {
+	broken bool // send a difference sequence that doesn't apply
+}
+
+func (x ixfr) Handler(w dns.ResponseWriter, req *dns.Msg) {
+	soa := func(serial int) dns.RR {
+		return test.SOA(fmt.Sprintf("%s IN SOA bla. bla. %d 3600 600 7200 300", testZone, serial))
+	}
+	m := new(dns.Msg)
+	m.SetReply(req)
+	switch req.Question[0].Qtype {
+	case dns.TypeSOA:
+		m.Answer = []dns.RR{soa(252)}
+	case dns.TypeAXFR:
+		m.Answer = []dns.RR{soa(252), test.A("a." + testZone + " IN A 127.0.0.2"), test.A("b." + testZone + " IN A 127.0.0.3"), soa(252)}
+	case dns.TypeIXFR:
+		from := req.Ns[0].(*dns.SOA).Serial
+		if from != 250 {
+			m.Rcode = dns.RcodeNotImplemented
+			break
+		}
+		deleted := test.A("a." + testZone + " IN A 127.0.0.1")
+		if x.broken {
+			deleted = test.A("a." + testZone + " IN A 127.0.0.9")
+		}
+		m.Answer = []dns.RR{
+			soa(252),
+			soa(250), deleted, soa(251), test.A("a." + testZone + " IN A 127.0.0.2"),
+			soa(251), soa(252), test.A("b." + testZone + " IN A 127.0.0.3"),
+			soa(252),
+		}
+	}
+	w.WriteMsg(m)
+}
+
+func newSecondaryZone(t *testing.T, serial int, primaries ...string) *Zone {
+	z := NewZone(testZone, "stdin")
+	z.TransferFrom = primaries
+	if serial > 0 {
+		z.Insert(test.SOA(fmt.Sprintf("%s IN SOA bla. bla. %d 0 0 0 0", testZone, serial)))
+		z.Insert(test.NS(testZone + " IN NS ns.example.org."))
+		z.Insert(test.A("a." + testZone + " IN A 127.0.0.1"))
+	}
+	return z
+}
+
+func TestTransferInIxfr(t *testing.T) {
+	tests := []struct {
+		serial int
+		broken bool
+		typ    string // type of the successful transfer
+	}{
+		{250, false, "ixfr"},
+		{250, true, "axfr"}, // IXFR fails, fall back to AXFR
+		{249, false, "axfr"},
+		{0, false, "axfr"},
+	}
+
+	for i, tc := range tests {
+		dns.HandleFunc(testZone, ixfr{broken: tc.broken}.Handler)
+		s, addrstr, err := test.TCPServer("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Unable to run test server: %v", err)
+		}
+
+		z := newSecondaryZone(t, tc.serial, addrstr)
+		TransferCount.Reset()
+		err = z.TransferIn()
+		s.Shutdown()
+		dns.HandleRemove(testZone)
+		if err != nil {
+			t.Fatalf("Test %d: unable to run TransferIn: %v", i, err)
+		}
+
+		if z.Apex.SOA.Serial != 252 {
+			t.Errorf("Test %d: expected serial 252, got %d", i, z.Apex.SOA.Serial)
+		}
+		a := z.rrset("a."+testZone, dns.TypeA)
+		if len(a) != 1 || a[0].(*dns.A).A.String() != "127.0.0.2" {
+			t.Errorf("Test %d: expected a.%s to be 127.0.0.2, got %v", i, testZone, a)
+		}
+		if len(z.rrset("b."+testZone, dns.TypeA)) != 1 {
+			t.Errorf("Test %d: expected b.%s to exist", i, testZone)
+		}
+		if tc.typ == "ixfr" && len(z.Apex.NS) != 1 {
+			t.Errorf("Test %d: expected the NS record to be kept", i)
+		}
+		if c := TransferCount.WithLabelValues(testZone, tc.typ, "success"); testutil.ToFloat64(c) != 1 {
+			t.Errorf("Test %d: expected a successful %s transfer to be counted", i, tc.typ)
+		}
+		if z.primaries.lastRefreshed().IsZero() {
+			t.Errorf("Test %d: expected the zone to be refreshed", i)
+		}
+	}
+}
+
+func TestTransferInFailover(t *testing.T) {
+	dns.HandleFunc(testZone, ixfr{}.Handler)
+	defer dns.HandleRemove(testZone)
+
+	s, addrstr, err := test.TCPServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	// Grab a port nothing listens on.
+	dead, deadaddr, err := test.TCPServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	dead.Shutdown()
+
+	z := newSecondaryZone(t, 250, deadaddr, addrstr)
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Unable to run TransferIn: %v", err)
+	}
+	if z.Apex.SOA.Serial != 252 {
+		t.Errorf("Expected serial 252, got %d", z.Apex.SOA.Serial)
+	}
+
+	// The dead primary is in backoff now, and isn't tried first.
+	if order := z.primaries.order(z.TransferFrom); len(order) != 1 || order[0] != addrstr {
+		t.Errorf("Expected only %s to be tried, got %v", addrstr, order)
+	}
+	if should, err := z.shouldTransfer(); err != nil || should {
+		t.Errorf("Expected no transfer and no error, got %t and %v", should, err)
+	}
+}
+
+func TestTransferInPersist(t *testing.T) {
+	dns.HandleFunc(testZone, ixfr{}.Handler)
+	defer dns.HandleRemove(testZone)
+
+	s, addrstr, err := test.TCPServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	dir, err := ioutil.TempDir("", "secondary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	z := newSecondaryZone(t, 0, addrstr)
+	z.Persist = true
+	z.SetFile(filepath.Join(dir, "db."+testZone))
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Unable to run TransferIn: %v", err)
+	}
+
+	// After a restart the zone is loaded from its file.
+	z1 := newSecondaryZone(t, 0, addrstr)
+	z1.Persist = true
+	z1.SetFile(z.File())
+	if err := z1.ReadFile(); err != nil {
+		t.Fatalf("Unable to read zone: %v", err)
+	}
+	if z1.Apex.SOA == nil || z1.Apex.SOA.Serial != 252 {
+		t.Fatalf("Expected serial 252, got %v", z1.Apex.SOA)
+	}
+	if len(z1.All()) != len(z.All()) {
+		t.Errorf("Expected %d records, got %d", len(z.All()), len(z1.All()))
+	}
+	if *z1.Expired {
+		t.Errorf("Expected the zone not to be expired")
+	}
+}
+
+func TestReadFileExpired(t *testing.T) {
+	const db = `secondary.miek.nl. 3600 IN SOA bla. bla. 250 3600 600 7200 300
+secondary.miek.nl. 3600 IN NS ns.example.org.
+`
+	name, rm, err := test.TempFile(".", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		age     time.Duration
+		expired bool
+	}{
+		{time.Hour, false},
+		{3 * time.Hour, true},
+	}
+	for i, tc := range tests {
+		mtime := time.Now().Add(-tc.age)
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		z := newSecondaryZone(t, 0)
+		z.SetFile(name)
+		if err := z.ReadFile(); err != nil {
+			t.Fatalf("Test %d: unable to read zone: %v", i, err)
+		}
+		if *z.Expired != tc.expired {
+			t.Errorf("Test %d: expected expired %t, got %t", i, tc.expired, *z.Expired)
+		}
+		if !z.primaries.lastRefreshed().Equal(mtime) && z.primaries.lastRefreshed().Sub(mtime) > time.Second {
+			t.Errorf("Test %d: expected last refresh at %s, got %s", i, mtime, z.primaries.lastRefreshed())
+		}
+		if left := z.untilExpire(2 * time.Hour); (left <= 0) != tc.expired {
+			t.Errorf("Test %d: expected expired %t, got %s left", i, tc.expired, left)
+		}
+	}
+
+	// A missing file is not an error.
+	z := newSecondaryZone(t, 0)
+	z.SetFile(name + ".missing")
+	if err := z.ReadFile(); err != nil || z.Apex.SOA != nil {
+		t.Errorf("Expected no error and no zone, got %v", err)
+	}
+}
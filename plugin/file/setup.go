@@ -1,13 +1,16 @@
 package file
 
 import (
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 
 	"github.com/mholt/caddy"
@@ -95,15 +98,30 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 		reload := 1 * time.Minute
 		upstr := upstream.New()
 		t := []string{}
+		var upd []*net.IPNet
+		keys := map[string]tsig.Key{}
+		updKeys := map[string]tsig.Key{}
+		persist := false
+		journal := DefaultJournalSize
 		var e error
 
 		for c.NextBlock() {
 			switch c.Val() {
 			case "transfer":
-				t, _, e = parse.Transfer(c, false)
+				var name string
+				t, _, name, e = parse.Transfer(c, false)
 				if e != nil {
 					return Zones{}, e
 				}
+				if name != "" {
+					key, err := config.TsigKeys.Get(name)
+					if err != nil {
+						return Zones{}, c.Err(err.Error())
+					}
+					for _, to := range t {
+						keys[to] = key
+					}
+				}
 
 			case "reload":
 				d, err := time.ParseDuration(c.RemainingArgs()[0])
@@ -116,6 +134,46 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 				// ignore args, will be error later.
 				c.RemainingArgs() // clear buffer
 
+			case "update":
+				args, name, err := parse.Key(c.RemainingArgs())
+				if err != nil {
+					return Zones{}, c.Err(err.Error())
+				}
+				if len(args) == 0 {
+					return Zones{}, c.ArgErr()
+				}
+				nets, err := parse.Nets(args)
+				if err != nil {
+					return Zones{}, c.Err(err.Error())
+				}
+				if name != "" {
+					key, err := config.TsigKeys.Get(name)
+					if err != nil {
+						return Zones{}, c.Err(err.Error())
+					}
+					for _, n := range nets {
+						updKeys[n.String()] = key
+					}
+				}
+				upd = append(upd, nets...)
+
+			case "persist":
+				if len(c.RemainingArgs()) != 0 {
+					return Zones{}, c.ArgErr()
+				}
+				persist = true
+
+			case "journal":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return Zones{}, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 0 {
+					return Zones{}, c.Errf("invalid journal size '%s'", args[0])
+				}
+				journal = n
+
 			default:
 				return Zones{}, c.Errf("unknown property '%s'", c.Val())
 			}
@@ -126,6 +184,11 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 				}
 				z[origin].ReloadInterval = reload
 				z[origin].Upstream = upstr
+				z[origin].TransferKeys = keys
+				z[origin].UpdateFrom = upd
+				z[origin].UpdateKeys = updKeys
+				z[origin].Persist = persist
+				z[origin].JournalSize = journal
 			}
 		}
 	}
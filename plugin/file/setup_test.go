@@ -3,9 +3,12 @@ package file
 import (
 	"testing"
 
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/test"
 
 	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
 )
 
 func TestFileParse(t *testing.T) {
@@ -97,3 +100,164 @@ func TestFileParse(t *testing.T) {
 		}
 	}
 }
+
+func TestFileParseUpdate(t *testing.T) {
+	zoneFileName, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		nets      []string
+		persist   bool
+	}{
+		{`file ` + zoneFileName + ` miek.nl.`, false, nil, false},
+		{`file ` + zoneFileName + ` miek.nl. {
+			update 10.0.0.0/8 192.168.1.1
+			persist
+		}`, false, []string{"10.0.0.0/8", "192.168.1.1/32"}, true},
+		{`file ` + zoneFileName + ` miek.nl. {
+			update
+		}`, true, nil, false},
+		{`file ` + zoneFileName + ` miek.nl. {
+			update 10.0.0.0/33
+		}`, true, nil, false},
+		{`file ` + zoneFileName + ` miek.nl. {
+			persist yes
+		}`, true, nil, false},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		zones, err := fileParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+
+		z := zones.Z["miek.nl."]
+		if z.Persist != test.persist {
+			t.Errorf("Test %d: expected persist %t, got %t", i, test.persist, z.Persist)
+		}
+		if len(z.UpdateFrom) != len(test.nets) {
+			t.Errorf("Test %d: expected %d update networks, got %d", i, len(test.nets), len(z.UpdateFrom))
+			continue
+		}
+		for j, n := range z.UpdateFrom {
+			if n.String() != test.nets[j] {
+				t.Errorf("Test %d: expected update network %s, got %s", i, test.nets[j], n)
+			}
+		}
+	}
+}
+
+func TestFileParseTsig(t *testing.T) {
+	zoneFileName, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		transfer  string // address that must have the key
+		update    string // network that must have the key
+	}{
+		{`file ` + zoneFileName + ` miek.nl. {
+			transfer to 10.0.0.1 key xfr.miek.nl.
+			update 10.0.0.0/8 key xfr.miek.nl
+		}`, false, "10.0.0.1:53", "10.0.0.0/8"},
+		{`file ` + zoneFileName + ` miek.nl. {
+			transfer to * key xfr.miek.nl.
+		}`, false, "*", ""},
+		{`file ` + zoneFileName + ` miek.nl. {
+			transfer to 10.0.0.1 key unknown.miek.nl.
+		}`, true, "", ""},
+		{`file ` + zoneFileName + ` miek.nl. {
+			update 10.0.0.0/8 key
+		}`, true, "", ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		dnsserver.GetConfig(c).TsigKeys = tsig.Keys{"xfr.miek.nl.": {Name: "xfr.miek.nl.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}}
+		zones, err := fileParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+
+		z := zones.Z["miek.nl."]
+		if test.transfer != "" && z.TransferKeys[test.transfer].Name != "xfr.miek.nl." {
+			t.Errorf("Test %d: expected key for transfers to %s, got %v", i, test.transfer, z.TransferKeys)
+		}
+		if test.update != "" && z.UpdateKeys[test.update].Name != "xfr.miek.nl." {
+			t.Errorf("Test %d: expected key for updates from %s, got %v", i, test.update, z.UpdateKeys)
+		}
+	}
+}
+
+func TestFileParseJournal(t *testing.T) {
+	zoneFileName, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		size      int
+	}{
+		{`file ` + zoneFileName + ` miek.nl.`, false, DefaultJournalSize},
+		{`file ` + zoneFileName + ` miek.nl. {
+			journal 10
+		}`, false, 10},
+		{`file ` + zoneFileName + ` miek.nl. {
+			journal 0
+		}`, false, 0},
+		{`file ` + zoneFileName + ` miek.nl. {
+			journal
+		}`, true, 0},
+		{`file ` + zoneFileName + ` miek.nl. {
+			journal -1
+		}`, true, 0},
+		{`file ` + zoneFileName + ` miek.nl. {
+			journal many
+		}`, true, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		zones, err := fileParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if z := zones.Z["miek.nl."]; z.JournalSize != test.size {
+			t.Errorf("Test %d: expected journal size %d, got %d", i, test.size, z.JournalSize)
+		}
+	}
+}
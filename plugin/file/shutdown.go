@@ -5,5 +5,11 @@ func (z *Zone) OnShutdown() error {
 	if 0 < z.ReloadInterval {
 		z.reloadShutdown <- true
 	}
+	z.shutdownOnce.Do(func() {
+		if z.updateShutdown != nil {
+			close(z.updateShutdown)
+		}
+	})
+	Staleness.remove(z)
 	return nil
 }
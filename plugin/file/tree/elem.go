@@ -122,15 +122,18 @@ func equalRdata(a, b dns.RR) bool {
 		if x.Mx == b.(*dns.MX).Mx && x.Preference == b.(*dns.MX).Preference {
 			return true
 		}
+		return false
 	}
-	return false
+	return dns.IsDuplicate(a, b)
 }
 
-// removeFromSlice removes index i from the slice.
+// removeFromSlice removes index i from the slice. A new slice is returned, as the old one may still be
+// in use by a reader.
 func removeFromSlice(rrs []dns.RR, i int) []dns.RR {
 	if i >= len(rrs) {
 		return rrs
 	}
-	rrs = append(rrs[:i], rrs[i+1:]...)
-	return rrs
+	rrs1 := make([]dns.RR, 0, len(rrs)-1)
+	rrs1 = append(rrs1, rrs[:i]...)
+	return append(rrs1, rrs[i+1:]...)
 }
@@ -0,0 +1,430 @@
+package file
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// Update is the handler for dynamic updates (RFC 2136) of a zone.
+type Update struct {
+	*Zone
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (u Update) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Rcode = u.update(state)
+	w.WriteMsg(m)
+
+	if m.Rcode == dns.RcodeSuccess {
+		log.Infof("Update from %s for zone %q applied", state.IP(), u.origin)
+	} else {
+		log.Infof("Update from %s for zone %q not applied: %s", state.IP(), u.origin, dns.RcodeToString[m.Rcode])
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the plugin.Handler interface.
+func (u Update) Name() string { return "update" }
+
+// update checks the prerequisites of the update in state and applies it. It returns the rcode
+// for the reply.
+func (u Update) update(state request.Request) int {
+	r := state.Req
+	// The zone section is the question section and must name our apex.
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	if strings.ToLower(r.Question[0].Name) != u.origin {
+		return dns.RcodeNotAuth
+	}
+	if len(u.TransferFrom) > 0 || !u.updateAllowed(state) {
+		return dns.RcodeRefused
+	}
+	if rcode := u.prescan(r.Ns); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	u.reloadMu.Lock()
+	if u.Apex.SOA == nil {
+		u.reloadMu.Unlock()
+		return dns.RcodeServerFailure
+	}
+	if rcode := u.prerequisites(r.Answer); rcode != dns.RcodeSuccess {
+		u.reloadMu.Unlock()
+		return rcode
+	}
+	old := u.Apex.SOA
+	c := &changes{}
+	changed := u.apply(r.Ns, c)
+	serial := u.Apex.SOA.Serial
+	if changed && u.JournalSize > 0 {
+		u.journal.records += len(c.added) - len(c.deleted)
+		u.journal.add(delta{from: old, to: u.Apex.SOA, deleted: c.deleted, added: c.added}, u.JournalSize)
+	}
+	u.reloadMu.Unlock()
+
+	if !changed {
+		return dns.RcodeSuccess
+	}
+
+	log.Infof("Zone %q updated to serial %d", u.origin, serial)
+	if u.Persist {
+		if err := u.WriteFile("a dynamic update"); err != nil {
+			log.Errorf("Failed to write zone %q to %q: %s", u.origin, u.File(), err)
+		}
+	}
+	u.Notify()
+	return dns.RcodeSuccess
+}
+
+// updateAllowed returns true when the client in state may update the zone. If a TSIG key is
+// configured for the client's network, the update must be signed with it.
+func (z *Zone) updateAllowed(state request.Request) bool {
+	ip := net.ParseIP(state.IP())
+	for _, n := range z.UpdateFrom {
+		if !n.Contains(ip) {
+			continue
+		}
+		if key, ok := z.UpdateKeys[n.String()]; ok && !tsig.Verified(state.W, state.Req, key) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// prerequisites checks the prerequisite section of the update, RFC 2136 Section 3.2. The caller
+// must hold reloadMu.
+func (z *Zone) prerequisites(prereq []dns.RR) int {
+	// RRsets that must exist with exactly these records, keyed by name and type.
+	type key struct {
+		name  string
+		rtype uint16
+	}
+	exact := map[key][]dns.RR{}
+
+	for _, rr := range prereq {
+		h := rr.Header()
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		name := strings.ToLower(h.Name)
+		if !dns.IsSubDomain(z.origin, name) {
+			return dns.RcodeNotZone
+		}
+
+		switch h.Class {
+		case dns.ClassANY:
+			if !emptyRdata(rr) {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if !z.nameInUse(name) {
+					return dns.RcodeNameError
+				}
+			} else if len(z.rrset(name, h.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+
+		case dns.ClassNONE:
+			if !emptyRdata(rr) {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if z.nameInUse(name) {
+					return dns.RcodeYXDomain
+				}
+			} else if len(z.rrset(name, h.Rrtype)) != 0 {
+				return dns.RcodeYXRrset
+			}
+
+		case dns.ClassINET:
+			if emptyRdata(rr) {
+				return dns.RcodeFormatError
+			}
+			k := key{name, h.Rrtype}
+			exact[k] = append(exact[k], rr)
+
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	for k, rrs := range exact {
+		if !sameRRset(z.rrset(k.name, k.rtype), rrs) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// prescan checks the update section, RFC 2136 Section 3.4.1.
+func (z *Zone) prescan(updates []dns.RR) int {
+	for _, rr := range updates {
+		h := rr.Header()
+		if !dns.IsSubDomain(z.origin, strings.ToLower(h.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassINET:
+			if isMetaType(h.Rrtype) || h.Rrtype == dns.TypeANY || emptyRdata(rr) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if h.Ttl != 0 || !emptyRdata(rr) || isMetaType(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if h.Ttl != 0 || isMetaType(h.Rrtype) || h.Rrtype == dns.TypeANY || emptyRdata(rr) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// apply applies the update section, RFC 2136 Section 3.4.2. It returns true if the zone changed,
+// the records deleted and added are collected in c. Unless the update sets a newer SOA, the SOA
+// serial is incremented. The caller must hold reloadMu.
+func (z *Zone) apply(updates []dns.RR, c *changes) bool {
+	changed, soaSet := false, false
+	for _, rr := range updates {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+		apex := name == z.origin
+
+		switch h.Class {
+		case dns.ClassINET:
+			if apex && h.Rrtype == dns.TypeSOA {
+				if soa := rr.(*dns.SOA); dnsutil.SerialNewer(soa.Serial, z.Apex.SOA.Serial) {
+					z.Insert(dns.Copy(soa))
+					changed, soaSet = true, true
+				}
+				continue
+			}
+			if z.add(dns.Copy(rr), c) {
+				changed = true
+			}
+
+		case dns.ClassANY:
+			for _, del := range z.rrsetsAt(name, h.Rrtype) {
+				if apex && (del.Header().Rrtype == dns.TypeSOA || del.Header().Rrtype == dns.TypeNS) {
+					continue
+				}
+				z.Delete(del)
+				c.del(del)
+				changed = true
+			}
+
+		case dns.ClassNONE:
+			del := dns.Copy(rr)
+			del.Header().Class = dns.ClassINET
+			del.Header().Name = name
+			if z.remove(del, c) {
+				changed = true
+			}
+		}
+	}
+
+	if changed && !soaSet {
+		soa := dns.Copy(z.Apex.SOA).(*dns.SOA)
+		soa.Serial++
+		z.Apex.SOA = soa
+	}
+	return changed
+}
+
+// add adds rr to the zone, it returns false if nothing changed. A record with the same data replaces
+// the existing one, updating its TTL. A CNAME can't be added to a name with other data and vice versa.
+func (z *Zone) add(rr dns.RR, c *changes) bool {
+	h := rr.Header()
+	name := strings.ToLower(h.Name)
+
+	if name == z.origin && h.Rrtype == dns.TypeNS {
+		for i, ns := range z.Apex.NS {
+			if dns.IsDuplicate(ns, rr) {
+				if ns.Header().Ttl == h.Ttl {
+					return false
+				}
+				nss := make([]dns.RR, len(z.Apex.NS))
+				copy(nss, z.Apex.NS)
+				nss[i] = rr
+				z.Apex.NS = nss
+				c.del(ns)
+				c.add(rr)
+				return true
+			}
+		}
+		z.Insert(rr)
+		c.add(rr)
+		return true
+	}
+
+	if elem, ok := z.Tree.Search(name); ok {
+		cname := len(elem.Types(dns.TypeCNAME)) > 0
+		if h.Rrtype == dns.TypeCNAME {
+			for _, t := range elem.All() {
+				if rtype := t.Header().Rrtype; rtype != dns.TypeCNAME && !isDNSSECType(rtype) {
+					return false
+				}
+			}
+			// There can be only one CNAME, replace it.
+			for _, old := range elem.Types(dns.TypeCNAME) {
+				if !dns.IsDuplicate(old, rr) {
+					z.Delete(old)
+					c.del(old)
+				}
+			}
+		} else if cname && !isDNSSECType(h.Rrtype) {
+			return false
+		}
+
+		for _, old := range elem.Types(h.Rrtype) {
+			if dns.IsDuplicate(old, rr) {
+				if old.Header().Ttl == h.Ttl {
+					return false
+				}
+				z.Delete(old)
+				c.del(old)
+				break
+			}
+		}
+	}
+
+	z.Insert(rr)
+	c.add(rr)
+	return true
+}
+
+// remove removes rr from the zone, it returns false if rr wasn't found. The SOA and the last NS
+// record at the apex can't be removed.
+func (z *Zone) remove(rr dns.RR, c *changes) bool {
+	h := rr.Header()
+	if h.Name == z.origin {
+		switch h.Rrtype {
+		case dns.TypeSOA:
+			return false
+		case dns.TypeNS:
+			for i, ns := range z.Apex.NS {
+				if dns.IsDuplicate(ns, rr) {
+					if len(z.Apex.NS) == 1 {
+						return false
+					}
+					nss := make([]dns.RR, 0, len(z.Apex.NS)-1)
+					nss = append(nss, z.Apex.NS[:i]...)
+					z.Apex.NS = append(nss, z.Apex.NS[i+1:]...)
+					c.del(ns)
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	for _, old := range z.rrset(h.Name, h.Rrtype) {
+		if dns.IsDuplicate(old, rr) {
+			z.Delete(old)
+			c.del(old)
+			return true
+		}
+	}
+	return false
+}
+
+// rrset returns the records of type rtype for name, including the ones kept in the apex.
+func (z *Zone) rrset(name string, rtype uint16) []dns.RR {
+	if name == z.origin {
+		switch rtype {
+		case dns.TypeSOA:
+			if z.Apex.SOA == nil {
+				return nil
+			}
+			return []dns.RR{z.Apex.SOA}
+		case dns.TypeNS:
+			return z.Apex.NS
+		}
+	}
+	elem, ok := z.Tree.Search(name)
+	if !ok {
+		return nil
+	}
+	return elem.Types(rtype)
+}
+
+// rrsetsAt returns a copy of the records of type rtype for name, or of all records for name when
+// rtype is ANY.
+func (z *Zone) rrsetsAt(name string, rtype uint16) []dns.RR {
+	var rrs []dns.RR
+	if rtype != dns.TypeANY {
+		rrs = z.rrset(name, rtype)
+	} else if elem, ok := z.Tree.Search(name); ok {
+		rrs = elem.All()
+	}
+	return append([]dns.RR(nil), rrs...)
+}
+
+// nameInUse returns true if name owns any records.
+func (z *Zone) nameInUse(name string) bool {
+	if name == z.origin {
+		return true
+	}
+	elem, ok := z.Tree.Search(name)
+	return ok && !elem.Empty()
+}
+
+// sameRRset returns true if a and b hold the same records, ignoring TTLs.
+func sameRRset(a, b []dns.RR) bool {
+	contains := func(rrs []dns.RR, rr dns.RR) bool {
+		for _, x := range rrs {
+			if dns.IsDuplicate(x, rr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rr := range a {
+		if !contains(b, rr) {
+			return false
+		}
+	}
+	for _, rr := range b {
+		if !contains(a, rr) {
+			return false
+		}
+	}
+	return true
+}
+
+// emptyRdata returns true if rr has no rdata. The dns package unpacks such records as a bare header.
+func emptyRdata(rr dns.RR) bool {
+	switch rr.(type) {
+	case *dns.ANY, *dns.RR_Header:
+		return true
+	}
+	return false
+}
+
+func isMetaType(t uint16) bool {
+	switch t {
+	case dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG, dns.TypeTKEY:
+		return true
+	}
+	return false
+}
+
+func isDNSSECType(t uint16) bool {
+	return t == dns.TypeRRSIG || t == dns.TypeNSEC || t == dns.TypeNSEC3
+}
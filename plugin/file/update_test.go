@@ -0,0 +1,298 @@
+package file
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const dbUpdate = `$TTL 3600
+example.org.      IN SOA ns.example.org. admin.example.org. 2019010100 3600 600 86400 300
+example.org.      IN NS  ns.example.org.
+example.org.      IN NS  ns2.example.org.
+ns.example.org.   IN A   192.0.2.53
+www.example.org.  IN A   192.0.2.1
+www.example.org.  IN A   192.0.2.2
+alias.example.org. IN CNAME www.example.org.
+txt.example.org.  IN TXT "hello"
+`
+
+func newUpdateZone(t *testing.T) *Zone {
+	z, err := Parse(strings.NewReader(dbUpdate), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	_, n, _ := net.ParseCIDR("10.0.0.0/8")
+	z.UpdateFrom = []*net.IPNet{n}
+	return z
+}
+
+func rrs(s ...string) []dns.RR {
+	rrs := make([]dns.RR, len(s))
+	for i := range s {
+		rrs[i], _ = dns.NewRR(s[i])
+	}
+	return rrs
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		zone   string
+		prereq func(m *dns.Msg)
+		update func(m *dns.Msg)
+		rcode  int
+		serial uint32
+		// expected RRsets after the update, "name type" -> number of records
+		want map[string]int
+	}{
+		{ // add records
+			zone: "example.org.",
+			update: func(m *dns.Msg) {
+				m.Insert(rrs("host.example.org. 300 IN A 192.0.2.10", "www.example.org. 300 IN A 192.0.2.3"))
+			},
+			serial: 2019010101,
+			want:   map[string]int{"host.example.org. A": 1, "www.example.org. A": 3},
+		},
+		{ // adding an existing record with the same TTL changes nothing
+			zone:   "example.org.",
+			update: func(m *dns.Msg) { m.Insert(rrs("www.example.org. 3600 IN A 192.0.2.1")) },
+			serial: 2019010100,
+			want:   map[string]int{"www.example.org. A": 2},
+		},
+		{ // delete an RRset
+			zone:   "example.org.",
+			update: func(m *dns.Msg) { m.RemoveRRset(rrs("www.example.org. 0 IN A 0.0.0.0")) },
+			serial: 2019010101,
+			want:   map[string]int{"www.example.org. A": 0},
+		},
+		{ // delete a single record
+			zone:   "example.org.",
+			update: func(m *dns.Msg) { m.Remove(rrs("www.example.org. 0 IN A 192.0.2.2")) },
+			serial: 2019010101,
+			want:   map[string]int{"www.example.org. A": 1},
+		},
+		{ // delete a name, and a TXT record (only A, AAAA and MX used to be compared by rdata)
+			zone: "example.org.",
+			update: func(m *dns.Msg) {
+				m.RemoveName(rrs("www.example.org. 0 IN A 0.0.0.0"))
+				m.Remove(rrs(`txt.example.org. 0 IN TXT "hello"`))
+			},
+			serial: 2019010101,
+			want:   map[string]int{"www.example.org. A": 0, "txt.example.org. TXT": 0},
+		},
+		{ // the apex SOA and NS records can't be deleted as a whole
+			zone: "example.org.",
+			update: func(m *dns.Msg) {
+				m.RemoveName(rrs("example.org. 0 IN A 0.0.0.0"))
+				m.RemoveRRset(rrs("example.org. 0 IN NS ns.example.org."))
+			},
+			serial: 2019010100,
+			want:   map[string]int{"example.org. SOA": 1, "example.org. NS": 2},
+		},
+		{ // but a single NS can, except the last one
+			zone: "example.org.",
+			update: func(m *dns.Msg) {
+				m.Remove(rrs("example.org. 0 IN NS ns.example.org.", "example.org. 0 IN NS ns2.example.org."))
+			},
+			serial: 2019010101,
+			want:   map[string]int{"example.org. NS": 1},
+		},
+		{ // a newer SOA replaces the SOA, its serial is not incremented
+			zone: "example.org.",
+			update: func(m *dns.Msg) {
+				m.Insert(rrs("example.org. 3600 IN SOA ns.example.org. admin.example.org. 2019020100 3600 600 86400 300"))
+			},
+			serial: 2019020100,
+		},
+		{ // CNAME and other data can't coexist
+			zone: "example.org.",
+			update: func(m *dns.Msg) {
+				m.Insert(rrs("alias.example.org. 3600 IN A 192.0.2.1", "www.example.org. 3600 IN CNAME example.org."))
+			},
+			serial: 2019010100,
+			want:   map[string]int{"alias.example.org. A": 0, "www.example.org. CNAME": 0},
+		},
+		{ // prerequisite: name in use
+			zone:   "example.org.",
+			prereq: func(m *dns.Msg) { m.NameUsed(rrs("new.example.org. 0 IN A 0.0.0.0")) },
+			update: func(m *dns.Msg) { m.Insert(rrs("new.example.org. 300 IN A 192.0.2.10")) },
+			rcode:  dns.RcodeNameError,
+			serial: 2019010100,
+			want:   map[string]int{"new.example.org. A": 0},
+		},
+		{ // prerequisite: name not in use
+			zone:   "example.org.",
+			prereq: func(m *dns.Msg) { m.NameNotUsed(rrs("www.example.org. 0 IN A 0.0.0.0")) },
+			update: func(m *dns.Msg) { m.Insert(rrs("www.example.org. 300 IN A 192.0.2.10")) },
+			rcode:  dns.RcodeYXDomain,
+			serial: 2019010100,
+		},
+		{ // prerequisite: RRset exists
+			zone:   "example.org.",
+			prereq: func(m *dns.Msg) { m.RRsetUsed(rrs("www.example.org. 0 IN AAAA ::")) },
+			update: func(m *dns.Msg) { m.Insert(rrs("www.example.org. 300 IN A 192.0.2.10")) },
+			rcode:  dns.RcodeNXRrset,
+			serial: 2019010100,
+		},
+		{ // prerequisite: RRset does not exist
+			zone:   "example.org.",
+			prereq: func(m *dns.Msg) { m.RRsetNotUsed(rrs("www.example.org. 0 IN A 0.0.0.0")) },
+			update: func(m *dns.Msg) { m.Insert(rrs("www.example.org. 300 IN A 192.0.2.10")) },
+			rcode:  dns.RcodeYXRrset,
+			serial: 2019010100,
+		},
+		{ // prerequisite: RRset exists with these values
+			zone: "example.org.",
+			prereq: func(m *dns.Msg) {
+				m.Used(rrs("www.example.org. 0 IN A 192.0.2.1", "www.example.org. 0 IN A 192.0.2.2"))
+			},
+			update: func(m *dns.Msg) { m.Insert(rrs("www.example.org. 300 IN A 192.0.2.10")) },
+			serial: 2019010101,
+			want:   map[string]int{"www.example.org. A": 3},
+		},
+		{ // prerequisite: RRset exists with these values, but doesn't
+			zone:   "example.org.",
+			prereq: func(m *dns.Msg) { m.Used(rrs("www.example.org. 0 IN A 192.0.2.1")) },
+			update: func(m *dns.Msg) { m.Insert(rrs("www.example.org. 300 IN A 192.0.2.10")) },
+			rcode:  dns.RcodeNXRrset,
+			serial: 2019010100,
+		},
+		{ // not our apex
+			zone:   "www.example.org.",
+			update: func(m *dns.Msg) { m.Insert(rrs("www.example.org. 300 IN A 192.0.2.10")) },
+			rcode:  dns.RcodeNotAuth,
+			serial: 2019010100,
+		},
+		{ // out of zone
+			zone:   "example.org.",
+			update: func(m *dns.Msg) { m.Insert(rrs("www.example.net. 300 IN A 192.0.2.10")) },
+			rcode:  dns.RcodeNotZone,
+			serial: 2019010100,
+		},
+	}
+
+	for i, tc := range tests {
+		z := newUpdateZone(t)
+
+		m := new(dns.Msg)
+		m.SetUpdate(tc.zone)
+		if tc.prereq != nil {
+			tc.prereq(m)
+		}
+		tc.update(m)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		Update{z}.ServeDNS(context.TODO(), rec, m)
+
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if z.Apex.SOA.Serial != tc.serial {
+			t.Errorf("Test %d: expected serial %d, got %d", i, tc.serial, z.Apex.SOA.Serial)
+		}
+		for k, n := range tc.want {
+			f := strings.Fields(k)
+			if got := len(z.rrset(f[0], dns.StringToType[f[1]])); got != n {
+				t.Errorf("Test %d: expected %d records for %s, got %d", i, n, k, got)
+			}
+		}
+	}
+}
+
+func TestUpdateRefused(t *testing.T) {
+	z := newUpdateZone(t)
+	z.UpdateFrom = nil
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert(rrs("host.example.org. 300 IN A 192.0.2.10"))
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	Update{z}.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected rcode %s, got %s", dns.RcodeToString[dns.RcodeRefused], dns.RcodeToString[rec.Msg.Rcode])
+	}
+}
+
+func TestUpdateTsig(t *testing.T) {
+	z := newUpdateZone(t)
+	key := tsig.Key{Name: "update.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+	z.UpdateKeys = map[string]tsig.Key{z.UpdateFrom[0].String(): key}
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert(rrs("host.example.org. 300 IN A 192.0.2.10"))
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	Update{z}.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected unsigned update to be refused, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+
+	tsig.Sign(m, key)
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	Update{z}.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected signed update to succeed, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+}
+
+func TestUpdatePersist(t *testing.T) {
+	fileName, rm, err := test.TempFile(".", dbUpdate)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Failed to open zone: %s", err)
+	}
+	z, err := Parse(f, "example.org.", fileName, 0)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	_, n, _ := net.ParseCIDR("10.0.0.0/8")
+	z.UpdateFrom = []*net.IPNet{n}
+	z.Persist = true
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert(rrs("host.example.org. 300 IN A 192.0.2.10"))
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	Update{z}.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected update to succeed, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+
+	// The file now holds the update, and a reload of it is not needed.
+	if s := z.fileSerialIfDefined(); s != 2019010101 {
+		t.Errorf("Expected file serial 2019010101, got %d", s)
+	}
+	f, err = os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Failed to open zone: %s", err)
+	}
+	defer f.Close()
+	z1, err := Parse(f, "example.org.", fileName, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse written zone: %s", err)
+	}
+	if z1.Apex.SOA.Serial != 2019010101 {
+		t.Errorf("Expected serial 2019010101 in written zone, got %d", z1.Apex.SOA.Serial)
+	}
+	if len(z1.rrset("host.example.org.", dns.TypeA)) != 1 {
+		t.Errorf("Expected host.example.org. A record in written zone")
+	}
+	if len(z1.All()) != len(z.All()) {
+		t.Errorf("Expected %d records in written zone, got %d", len(z.All()), len(z1.All()))
+	}
+}
@@ -1,6 +1,14 @@
 package file
 
-import "github.com/miekg/dns"
+import (
+	"context"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
 
 // replaceWithWildcard replaces the left most label with '*'.
 func replaceWithAsteriskLabel(qname string) (wildcard string) {
@@ -11,3 +19,49 @@ func replaceWithAsteriskLabel(qname string) (wildcard string) {
 
 	return "*." + qname[i:]
 }
+
+// Metadata implements the metadata.Provider interface. It adds the label "file/wildcard" that holds
+// the owner name of the wildcard the answer is synthesized from, empty if there is none. The zone is
+// only searched when the label is actually used.
+func (f File) Metadata(ctx context.Context, state request.Request) context.Context {
+	zone := plugin.Zones(f.Zones.Names).Matches(state.Name())
+	z, ok := f.Zones.Z[zone]
+	if zone == "" || !ok || z == nil {
+		return ctx
+	}
+	qname := state.Name()
+	metadata.SetValueFunc(ctx, "file/wildcard", func() string { return z.wildcard(qname) })
+	return ctx
+}
+
+// wildcard returns the owner name of the wildcard Lookup expands for qname, or "" when qname exists,
+// is delegated or is redirected by a DNAME, or when there is no wildcard.
+func (z *Zone) wildcard(qname string) string {
+	if z.mustLock() {
+		z.reloadMu.RLock()
+		defer z.reloadMu.RUnlock()
+	}
+
+	wildcard := ""
+	for i := 0; ; i++ {
+		parts, shot := z.nameFromRight(qname, i)
+		if shot {
+			return wildcard
+		}
+		elem, found := z.Tree.Search(parts)
+		if !found {
+			if w := replaceWithAsteriskLabel(parts); w != "" {
+				if _, found := z.Tree.Search(w); found {
+					wildcard = w
+				}
+			}
+			continue
+		}
+		if parts == qname || elem.Types(dns.TypeDNAME) != nil {
+			return ""
+		}
+		if parts != z.origin && elem.Types(dns.TypeNS) != nil {
+			return ""
+		}
+	}
+}
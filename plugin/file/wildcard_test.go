@@ -5,8 +5,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
 )
@@ -164,6 +166,42 @@ func TestLookupDoubleWildcard(t *testing.T) {
 	}
 }
 
+func TestWildcardMetadata(t *testing.T) {
+	zone, err := Parse(strings.NewReader(exampleOrg), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expect no error when reading zone, got %q", err)
+	}
+	fm := File{Next: test.ErrorHandler(), Zones: Zones{Z: map[string]*Zone{"example.org.": zone}, Names: []string{"example.org."}}}
+
+	tests := []struct {
+		qname    string
+		wildcard string
+	}{
+		{"example.org.", ""},
+		{"alias.example.org.", ""},
+		{"x.w.example.org.", "*.w.example.org."},
+		{"a.b.x.w.example.org.", "*.w.example.org."},
+		{"x.d.example.org.", "*.d.example.org."},
+		{"a.b.c.w.example.org.", ""},
+		{"nothere.example.org.", ""},
+		{"example.com.", ""},
+	}
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeTXT)
+		ctx := metadata.ContextWithMetadata(context.TODO())
+		ctx = fm.Metadata(ctx, request.Request{Req: m, W: &test.ResponseWriter{}})
+
+		got := ""
+		if f := metadata.ValueFunc(ctx, "file/wildcard"); f != nil {
+			got = f()
+		}
+		if got != tc.wildcard {
+			t.Errorf("Expected wildcard %q for %s, got %q", tc.wildcard, tc.qname, got)
+		}
+	}
+}
+
 func TestReplaceWithAsteriskLabel(t *testing.T) {
 	tests := []struct {
 		in, out string
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -25,9 +26,35 @@ func (x Xfr) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (in
 		return 0, plugin.Error(x.Name(), fmt.Errorf("xfr called with non transfer type: %d", state.QType()))
 	}
 
-	records := x.All()
-	if len(records) == 0 {
-		return dns.RcodeServerFailure, nil
+	var records []dns.RR
+	if state.QType() == dns.TypeIXFR {
+		records = x.ixfr(r)
+	}
+	if records != nil {
+		log.Infof("Outgoing incremental transfer of %d records of zone %s to %s started", len(records), x.origin, state.IP())
+	} else {
+		// Full zone transfer, also the answer to an IXFR we can't serve incrementally.
+		records = x.All()
+		if len(records) == 0 {
+			return dns.RcodeServerFailure, nil
+		}
+		records = append(records, records[0]) // add closing SOA to the end
+		log.Infof("Outgoing transfer of %d records of zone %s to %s started", len(records), x.origin, state.IP())
+	}
+
+	// An IXFR over UDP must fit in a single message, otherwise we only send our SOA, so the
+	// client retries over TCP (RFC 1995, Section 2).
+	if state.QType() == dns.TypeIXFR && state.Proto() == "udp" {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		m.Compress = true
+		m.Answer = records
+		if m.Len() > state.Size() {
+			m.Answer = records[:1]
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
 	}
 
 	ch := make(chan *dns.Envelope)
@@ -36,8 +63,6 @@ func (x Xfr) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (in
 	go tr.Out(w, r, ch)
 
 	j, l := 0, 0
-	records = append(records, records[0]) // add closing SOA to the end
-	log.Infof("Outgoing transfer of %d records of zone %s to %s started", len(records), x.origin, state.IP())
 	for i, r := range records {
 		l += dns.Len(r)
 		if l > transferLength {
@@ -58,4 +83,42 @@ func (x Xfr) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (in
 // Name implements the plugin.Handler interface.
 func (x Xfr) Name() string { return "xfr" }
 
+// ixfr returns the records of an incremental transfer (RFC 1995) from the serial in the authority
+// section of the IXFR query r to the current one. It returns nil when the journal doesn't go back
+// that far, the full zone must be sent then.
+func (x Xfr) ixfr(r *dns.Msg) []dns.RR {
+	if len(r.Ns) == 0 {
+		return nil
+	}
+	soa, ok := r.Ns[0].(*dns.SOA)
+	if !ok {
+		return nil
+	}
+
+	x.reloadMu.RLock()
+	defer x.reloadMu.RUnlock()
+
+	current := x.Apex.SOA
+	if current == nil {
+		return nil
+	}
+	// The client is up to date, only our SOA is sent.
+	if !dnsutil.SerialNewer(current.Serial, soa.Serial) {
+		return []dns.RR{current}
+	}
+	deltas, ok := x.journal.since(soa.Serial)
+	if !ok || deltas[len(deltas)-1].to.Serial != current.Serial {
+		return nil
+	}
+
+	records := []dns.RR{current}
+	for _, d := range deltas {
+		records = append(records, d.from)
+		records = append(records, d.deleted...)
+		records = append(records, d.to)
+		records = append(records, d.added...)
+	}
+	return append(records, current)
+}
+
 const transferLength = 1000 // Start a new envelop after message reaches this size in bytes. Intentionally small to test multi envelope parsing.
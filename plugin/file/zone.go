@@ -1,7 +1,6 @@
 package file
 
 import (
-	"fmt"
 	"net"
 	"path/filepath"
 	"strings"
@@ -9,6 +8,7 @@ import (
 	"time"
 
 	"github.com/coredns/coredns/plugin/file/tree"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/request"
 
@@ -21,17 +21,31 @@ type Zone struct {
 	origLen int
 	file    string
 	*tree.Tree
-	Apex Apex
+	nsec3 *tree.Tree // NSEC3 records and their signatures, by hashed owner name
+	Apex  Apex
 
 	TransferTo   []string
 	StartupOnce  sync.Once
 	TransferFrom []string
 	Expired      *bool
+	TransferKeys map[string]tsig.Key // TSIG keys for the TransferTo and TransferFrom addresses
+	primaries    primaries           // health of the TransferFrom addresses
+
+	UpdateFrom []*net.IPNet        // networks allowed to send dynamic updates
+	UpdateKeys map[string]tsig.Key // TSIG keys required for updates, keyed by UpdateFrom network
+	Persist    bool                // write the zone back to its file after an update
+	fileSerial int64               // serial of the zone in its file, -1 if not read from a file
+	writeMu    sync.Mutex          // serializes writing the zone file
+
+	JournalSize int     // number of changes kept for IXFR, 0 to always send the full zone
+	journal     journal // recent changes, protected by reloadMu
 
 	ReloadInterval time.Duration
 	LastReloaded   time.Time
 	reloadMu       sync.RWMutex
 	reloadShutdown chan bool
+	updateShutdown chan struct{} // closed to stop Update
+	shutdownOnce   sync.Once
 	Upstream       *upstream.Upstream // Upstream for looking up external names during the resolution process
 }
 
@@ -50,9 +64,13 @@ func NewZone(name, file string) *Zone {
 		origLen:        dns.CountLabel(dns.Fqdn(name)),
 		file:           filepath.Clean(file),
 		Tree:           &tree.Tree{},
+		nsec3:          &tree.Tree{},
 		Expired:        new(bool),
 		reloadShutdown: make(chan bool),
+		updateShutdown: make(chan struct{}),
 		LastReloaded:   time.Now(),
+		fileSerial:     -1,
+		JournalSize:    DefaultJournalSize,
 	}
 	*z.Expired = false
 
@@ -65,6 +83,11 @@ func (z *Zone) Copy() *Zone {
 	z1.TransferTo = z.TransferTo
 	z1.TransferFrom = z.TransferFrom
 	z1.Expired = z.Expired
+	z1.TransferKeys = z.TransferKeys
+	z1.UpdateFrom = z.UpdateFrom
+	z1.UpdateKeys = z.UpdateKeys
+	z1.Persist = z.Persist
+	z1.JournalSize = z.JournalSize
 
 	z1.Apex = z.Apex
 	return z1
@@ -76,6 +99,11 @@ func (z *Zone) CopyWithoutApex() *Zone {
 	z1.TransferTo = z.TransferTo
 	z1.TransferFrom = z.TransferFrom
 	z1.Expired = z.Expired
+	z1.TransferKeys = z.TransferKeys
+	z1.UpdateFrom = z.UpdateFrom
+	z1.UpdateKeys = z.UpdateKeys
+	z1.Persist = z.Persist
+	z1.JournalSize = z.JournalSize
 
 	return z1
 }
@@ -84,6 +112,11 @@ func (z *Zone) CopyWithoutApex() *Zone {
 func (z *Zone) Insert(r dns.RR) error {
 	r.Header().Name = strings.ToLower(r.Header().Name)
 
+	if isNSEC3(r) {
+		z.nsec3.Insert(r)
+		return nil
+	}
+
 	switch h := r.Header().Rrtype; h {
 	case dns.TypeNS:
 		r.(*dns.NS).Ns = strings.ToLower(r.(*dns.NS).Ns)
@@ -98,8 +131,6 @@ func (z *Zone) Insert(r dns.RR) error {
 
 		z.Apex.SOA = r.(*dns.SOA)
 		return nil
-	case dns.TypeNSEC3, dns.TypeNSEC3PARAM:
-		return fmt.Errorf("NSEC3 zone is not supported, dropping RR: %s for zone: %s", r.Header().Name, z.origin)
 	case dns.TypeRRSIG:
 		x := r.(*dns.RRSIG)
 		switch x.TypeCovered {
@@ -125,7 +156,25 @@ func (z *Zone) Insert(r dns.RR) error {
 }
 
 // Delete deletes r from z.
-func (z *Zone) Delete(r dns.RR) { z.Tree.Delete(r) }
+func (z *Zone) Delete(r dns.RR) {
+	if isNSEC3(r) {
+		z.nsec3.Delete(r)
+		return
+	}
+	z.Tree.Delete(r)
+}
+
+// isNSEC3 returns true if r is an NSEC3 record or a signature over one. These are kept apart from the
+// other records, by their hashed owner name.
+func isNSEC3(r dns.RR) bool {
+	switch x := r.(type) {
+	case *dns.NSEC3:
+		return true
+	case *dns.RRSIG:
+		return x.TypeCovered == dns.TypeNSEC3
+	}
+	return false
+}
 
 // File retrieves the file path in a safe way
 func (z *Zone) File() string {
@@ -142,20 +191,20 @@ func (z *Zone) SetFile(path string) {
 }
 
 // TransferAllowed checks if incoming request for transferring the zone is allowed according to the ACLs.
+// If a TSIG key is configured for the address, the request must be signed with it.
 func (z *Zone) TransferAllowed(state request.Request) bool {
 	for _, t := range z.TransferTo {
-		if t == "*" {
-			return true
+		if t != "*" {
+			// If remote IP matches we accept.
+			to, _, err := net.SplitHostPort(t)
+			if err != nil || to != state.IP() {
+				continue
+			}
 		}
-		// If remote IP matches we accept.
-		remote := state.IP()
-		to, _, err := net.SplitHostPort(t)
-		if err != nil {
+		if key, ok := z.TransferKeys[t]; ok && !tsig.Verified(state.W, state.Req, key) {
 			continue
 		}
-		if to == remote {
-			return true
-		}
+		return true
 	}
 	// TODO(miek): future matching against IP/CIDR notations
 	return false
@@ -164,26 +213,32 @@ func (z *Zone) TransferAllowed(state request.Request) bool {
 // All returns all records from the zone, the first record will be the SOA record,
 // otionally followed by all RRSIG(SOA)s.
 func (z *Zone) All() []dns.RR {
-	if z.ReloadInterval > 0 {
+	if z.mustLock() {
 		z.reloadMu.RLock()
 		defer z.reloadMu.RUnlock()
 	}
+	return z.all()
+}
 
-	records := []dns.RR{}
-	allNodes := z.Tree.All()
-	for _, a := range allNodes {
+// all returns all records from the zone, the caller must hold reloadMu.
+func (z *Zone) all() []dns.RR {
+	// Build a new slice, appending to the apex slices would modify them.
+	records := []dns.RR{z.Apex.SOA}
+	records = append(records, z.Apex.SIGSOA...)
+	records = append(records, z.Apex.NS...)
+	records = append(records, z.Apex.SIGNS...)
+	for _, a := range z.Tree.All() {
 		records = append(records, a.All()...)
 	}
-
-	if len(z.Apex.SIGNS) > 0 {
-		records = append(z.Apex.SIGNS, records...)
+	for _, a := range z.nsec3.All() {
+		records = append(records, a.All()...)
 	}
-	records = append(z.Apex.NS, records...)
+	return records
+}
 
-	if len(z.Apex.SIGSOA) > 0 {
-		records = append(z.Apex.SIGSOA, records...)
-	}
-	return append([]dns.RR{z.Apex.SOA}, records...)
+// mustLock returns true if the zone can change while serving, in which case readers must hold reloadMu.
+func (z *Zone) mustLock() bool {
+	return z.ReloadInterval > 0 || len(z.UpdateFrom) > 0 || len(z.TransferFrom) > 0
 }
 
 // Print prints the zone's tree to stdout.
@@ -73,6 +73,10 @@ func (t *Transport) Dial(proto string) (*dns.Conn, bool, error) {
 func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options) (*dns.Msg, error) {
 	start := time.Now()
 
+	if p.quic != nil {
+		return p.connectQUIC(ctx, state, start)
+	}
+
 	proto := ""
 	switch {
 	case opts.forceTCP: // TCP flag has precedence over UDP flag
@@ -94,8 +98,13 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 		conn.UDPSize = 512
 	}
 
+	req, added := state.Req, false
+	if opts.cookie {
+		req, added = p.cookies.request(state.Req)
+	}
+
 	conn.SetWriteDeadline(time.Now().Add(maxTimeout))
-	if err := conn.WriteMsg(state.Req); err != nil {
+	if err := conn.WriteMsg(req); err != nil {
 		conn.Close() // not giving it back
 		if err == io.EOF && cached {
 			return nil, ErrCachedClosed
@@ -122,6 +131,31 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 
 	p.transport.Yield(conn)
 
+	if opts.cookie {
+		if err := p.cookies.response(ret, added); err != nil {
+			return nil, err
+		}
+		if ret.Rcode == dns.RcodeBadCookie {
+			return ret, ErrBadCookie
+		}
+	}
+
+	p.observe(ret, start)
+	return ret, nil
+}
+
+// connectQUIC sends the request to a DNS-over-QUIC upstream and waits for a response.
+func (p *Proxy) connectQUIC(ctx context.Context, state request.Request, start time.Time) (*dns.Msg, error) {
+	ret, err := p.quic.Exchange(ctx, state.Req)
+	if err != nil {
+		return nil, err
+	}
+	p.observe(ret, start)
+	return ret, nil
+}
+
+// observe updates the metrics for a response from this proxy.
+func (p *Proxy) observe(ret *dns.Msg, start time.Time) {
 	rc, ok := dns.RcodeToString[ret.Rcode]
 	if !ok {
 		rc = strconv.Itoa(ret.Rcode)
@@ -130,8 +164,6 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 	RequestCount.WithLabelValues(p.addr).Add(1)
 	RcodeCount.WithLabelValues(rc, p.addr).Add(1)
 	RequestDuration.WithLabelValues(p.addr).Observe(time.Since(start).Seconds())
-
-	return ret, nil
 }
 
 const cumulativeAvgWeight = 4
@@ -0,0 +1,107 @@
+package forward
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+
+	"github.com/miekg/dns"
+)
+
+// cookieJar holds the DNS Cookies (RFC 7873) we use with a single upstream: the client cookie we
+// send and the server cookie the upstream gave us.
+type cookieJar struct {
+	client string // hex encoded client cookie
+
+	sync.RWMutex
+	server string // hex encoded server cookie, empty if we don't have one (yet)
+}
+
+func newCookieJar() *cookieJar {
+	b := make([]byte, cookie.ClientLen)
+	rand.Read(b)
+	return &cookieJar{client: hex.EncodeToString(b)}
+}
+
+// request returns a copy of req with our cookie added, any cookie from the client is removed, as it
+// is meant for us and not for the upstream. The returned bool is true when an OPT record had to be
+// added to the copy.
+func (j *cookieJar) request(req *dns.Msg) (*dns.Msg, bool) {
+	m := req.Copy()
+
+	j.RLock()
+	co := &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: j.client + j.server}
+	j.RUnlock()
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(dns.MinMsgSize, false)
+		m.IsEdns0().Option = []dns.EDNS0{co}
+		return m, true
+	}
+
+	opt.Option = withoutCookie(opt.Option)
+	opt.Option = append(opt.Option, co)
+	return m, false
+}
+
+// response remembers the server cookie from ret and removes the cookie from it, because it is not
+// meant for our client. If added is true, the OPT record is removed entirely from ret.
+func (j *cookieJar) response(ret *dns.Msg, added bool) error {
+	opt := ret.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, o := range opt.Option {
+		co, ok := o.(*dns.EDNS0_COOKIE)
+		if !ok {
+			continue
+		}
+		client, server, err := cookie.Parse(co.Cookie)
+		if err != nil {
+			return err
+		}
+		if hex.EncodeToString(client) != j.client {
+			return errCookieMismatch
+		}
+		j.Lock()
+		j.server = hex.EncodeToString(server)
+		j.Unlock()
+		break
+	}
+
+	if added {
+		for i, rr := range ret.Extra {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				ret.Extra = append(ret.Extra[:i], ret.Extra[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+	opt.Option = withoutCookie(opt.Option)
+	return nil
+}
+
+func withoutCookie(opts []dns.EDNS0) []dns.EDNS0 {
+	ret := make([]dns.EDNS0, 0, len(opts))
+	for _, o := range opts {
+		if o.Option() != dns.EDNS0COOKIE {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
+
+var (
+	// errCookieMismatch is returned when the client cookie in a response is not the one we sent, the
+	// response is then likely spoofed.
+	errCookieMismatch = errors.New("client cookie mismatch")
+	// ErrBadCookie is returned when the upstream replied with BADCOOKIE, the query should be
+	// retried with the server cookie we got in that response.
+	ErrBadCookie = errors.New("bad cookie")
+)
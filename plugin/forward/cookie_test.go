@@ -0,0 +1,132 @@
+package forward
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+func TestProxyCookie(t *testing.T) {
+	secret, _ := cookie.NewSecret(nil, 0)
+	var queries int32
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&queries, 1)
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		opt := r.IsEdns0()
+		if opt == nil {
+			t.Errorf("Expected OPT record in query")
+			w.WriteMsg(ret)
+			return
+		}
+		var client, server []byte
+		for _, o := range opt.Option {
+			if co, ok := o.(*dns.EDNS0_COOKIE); ok {
+				if client != nil {
+					t.Errorf("Expected a single cookie in query")
+				}
+				client, server, _ = cookie.Parse(co.Cookie)
+			}
+		}
+		if client == nil {
+			t.Errorf("Expected client cookie in query")
+			w.WriteMsg(ret)
+			return
+		}
+		ip := net.ParseIP("127.0.0.1")
+		ret.SetEdns0(4096, false)
+		ret.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_COOKIE{
+			Code:   dns.EDNS0COOKIE,
+			Cookie: hex.EncodeToString(client) + hex.EncodeToString(secret.Generate(client, ip, time.Now())),
+		}}
+		if !secret.Valid(client, server, ip, time.Now()) {
+			ret.Rcode = dns.RcodeBadCookie
+			w.WriteMsg(ret)
+			return
+		}
+		ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\ncookie\n}\n")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	for i := 0; i < 2; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		m.SetEdns0(4096, false)
+		// Our client's cookie, this must not be forwarded.
+		m.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "2464c4abcf10c957"}}
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if len(rec.Msg.Answer) != 1 {
+			t.Fatalf("Test %d: expected 1 answer, got %d", i, len(rec.Msg.Answer))
+		}
+		for _, o := range rec.Msg.IsEdns0().Option {
+			if _, ok := o.(*dns.EDNS0_COOKIE); ok {
+				t.Errorf("Test %d: expected upstream cookie to be removed from the response", i)
+			}
+		}
+	}
+
+	// The first query is answered with BADCOOKIE and retried, the second query uses the server
+	// cookie we learned.
+	if q := atomic.LoadInt32(&queries); q != 3 {
+		t.Errorf("Expected 3 queries to the upstream, got %d", q)
+	}
+}
+
+func TestCookieJarNoEdns(t *testing.T) {
+	j := newCookieJar()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+
+	req, added := j.request(m)
+	if !added {
+		t.Fatal("Expected OPT record to be added")
+	}
+	if m.IsEdns0() != nil {
+		t.Error("Expected original request not to be modified")
+	}
+
+	ret := new(dns.Msg)
+	ret.SetReply(req)
+	ret.SetEdns0(4096, false)
+	ret.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: j.client + "010000005cf79f111f8130c3eee29480"}}
+
+	if err := j.response(ret, added); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if ret.IsEdns0() != nil {
+		t.Error("Expected OPT record to be removed from the response")
+	}
+	if j.server != "010000005cf79f111f8130c3eee29480" {
+		t.Errorf("Expected server cookie to be remembered, got %q", j.server)
+	}
+
+	ret.SetEdns0(4096, false)
+	ret.IsEdns0().Option = []dns.EDNS0{&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "2464c4abcf10c957"}}
+	if err := j.response(ret, added); err != errCookieMismatch {
+		t.Errorf("Expected error %s, got %v", errCookieMismatch, err)
+	}
+}
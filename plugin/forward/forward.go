@@ -13,6 +13,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/debug"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/validator"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -38,6 +39,10 @@ type Forward struct {
 
 	opts options // also here for testing
 
+	validator *validator.Validator // validates the answers, if not nil
+	anchors   []dns.RR             // trust anchors for the validator, the root's if empty
+	negative  []string             // negative trust anchors
+
 	Next plugin.Handler
 }
 
@@ -67,6 +72,12 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		return plugin.NextOrFailure(f.Name(), f.Next, ctx, w, r)
 	}
 
+	// Clients setting CD validate themselves.
+	validate := f.validator != nil && !r.CheckingDisabled
+	if validate {
+		state = request.Request{W: w, Req: validateRequest(r)}
+	}
+
 	fails := 0
 	var span, child ot.Span
 	var upstreamErr error
@@ -107,14 +118,25 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			err error
 		)
 		opts := f.opts
+		badCookie := false
 		for {
 			ret, err = proxy.Connect(ctx, state, opts)
 			if err == nil {
+				// A truncated answer misses the records to validate it, get all of it over TCP.
+				if validate && ret.Truncated && !opts.forceTCP {
+					opts.forceTCP = true
+					continue
+				}
 				break
 			}
 			if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
 				continue
 			}
+			// Retry once with the server cookie we just learned.
+			if err == ErrBadCookie && !badCookie {
+				badCookie = true
+				continue
+			}
 			// Retry with TCP if truncated and prefer_udp configured.
 			if ret != nil && ret.Truncated && !opts.forceTCP && f.opts.preferUDP {
 				opts.forceTCP = true
@@ -152,6 +174,10 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			return 0, taperr
 		}
 
+		if validate {
+			ret = f.validate(ctx, w, r, ret)
+		}
+
 		w.WriteMsg(ret)
 		return 0, taperr
 	}
@@ -215,6 +241,7 @@ const (
 type options struct {
 	forceTCP  bool
 	preferUDP bool
+	cookie    bool
 }
 
 const defaultTimeout = 5 * time.Second
@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/coredns/coredns/plugin/pkg/transport"
 	"github.com/coredns/coredns/plugin/pkg/up"
 )
 
@@ -18,10 +19,15 @@ type Proxy struct {
 	// Connection caching
 	expire    time.Duration
 	transport *Transport
+	// quic is used instead of transport for DNS-over-QUIC upstreams.
+	quic *quicTransport
 
 	// health checking
 	probe  *up.Probe
 	health HealthChecker
+
+	// DNS Cookies, only used when enabled in the options.
+	cookies *cookieJar
 }
 
 // NewProxy returns a new proxy.
@@ -31,6 +37,10 @@ func NewProxy(addr, trans string) *Proxy {
 		fails:     0,
 		probe:     up.New(),
 		transport: newTransport(addr),
+		cookies:   newCookieJar(),
+	}
+	if trans == transport.QUIC {
+		p.quic = newQUICTransport(addr)
 	}
 	p.health = NewHealthChecker(trans)
 	runtime.SetFinalizer(p, (*Proxy).finalizer)
@@ -39,12 +49,21 @@ func NewProxy(addr, trans string) *Proxy {
 
 // SetTLSConfig sets the TLS config in the lower p.transport and in the healthchecking client.
 func (p *Proxy) SetTLSConfig(cfg *tls.Config) {
+	if p.quic != nil {
+		p.quic.SetTLSConfig(cfg)
+		return
+	}
 	p.transport.SetTLSConfig(cfg)
 	p.health.SetTLSConfig(cfg)
 }
 
 // SetExpire sets the expire duration in the lower p.transport.
-func (p *Proxy) SetExpire(expire time.Duration) { p.transport.SetExpire(expire) }
+func (p *Proxy) SetExpire(expire time.Duration) {
+	if p.quic != nil {
+		p.quic.SetExpire(expire)
+	}
+	p.transport.SetExpire(expire)
+}
 
 // Healthcheck kicks of a round of health checks for this proxy.
 func (p *Proxy) Healthcheck() {
@@ -69,7 +88,13 @@ func (p *Proxy) Down(maxfails uint32) bool {
 }
 
 // close stops the health checking goroutine.
-func (p *Proxy) close()     { p.probe.Stop() }
+func (p *Proxy) close() {
+	p.probe.Stop()
+	if p.quic != nil {
+		p.quic.Stop()
+	}
+}
+
 func (p *Proxy) finalizer() { p.transport.Stop() }
 
 // start starts the proxy's healthchecking.
@@ -0,0 +1,156 @@
+package forward
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// quicTransport sends queries to a DNS-over-QUIC (RFC 9250) upstream. A single QUIC connection is
+// reused for all queries, each query is sent on its own stream.
+type quicTransport struct {
+	addr      string
+	tlsConfig *tls.Config
+	expire    time.Duration
+
+	sync.Mutex
+	conn quic.Connection
+}
+
+func newQUICTransport(addr string) *quicTransport {
+	return &quicTransport{addr: addr, tlsConfig: &tls.Config{NextProtos: []string{doqALPN}}, expire: defaultExpire}
+}
+
+// SetTLSConfig sets the TLS config used for the QUIC connection.
+func (t *quicTransport) SetTLSConfig(cfg *tls.Config) {
+	cfg = cfg.Clone()
+	cfg.NextProtos = []string{doqALPN}
+	t.tlsConfig = cfg
+}
+
+// SetExpire sets the time after which an idle connection is closed.
+func (t *quicTransport) SetExpire(expire time.Duration) { t.expire = expire }
+
+// Exchange sends m on a new stream and returns the reply. The message ID is zero on the wire as
+// required by DoQ, the reply gets the ID of m.
+func (t *quicTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	conn, cached, err := t.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := t.exchange(ctx, conn, m)
+	if err != nil && cached {
+		// The cached connection may have been closed by the upstream, retry once with a new one.
+		t.closeConn(conn)
+		if conn, _, err = t.dial(ctx); err != nil {
+			return nil, err
+		}
+		ret, err = t.exchange(ctx, conn, m)
+	}
+	if err != nil {
+		t.closeConn(conn)
+	}
+	return ret, err
+}
+
+func (t *quicTransport) exchange(ctx context.Context, conn quic.Connection, m *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	q := m.Copy()
+	q.Id = 0
+	buf, err := q.Pack()
+	if err != nil {
+		stream.CancelWrite(doqNoError)
+		return nil, err
+	}
+
+	msg := make([]byte, 2+len(buf))
+	binary.BigEndian.PutUint16(msg, uint16(len(buf)))
+	copy(msg[2:], buf)
+	if _, err := stream.Write(msg); err != nil {
+		return nil, err
+	}
+	// Closing the stream signals the upstream we have nothing more to send, RFC 9250, Section 4.2.
+	stream.Close()
+
+	var l [2]byte
+	if _, err := io.ReadFull(stream, l[:]); err != nil {
+		return nil, err
+	}
+	buf = make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		return nil, err
+	}
+
+	ret := new(dns.Msg)
+	if err := ret.Unpack(buf); err != nil {
+		return nil, err
+	}
+	ret.Id = m.Id
+	return ret, nil
+}
+
+// dial returns the cached connection or sets up a new one. The returned bool is true when the
+// connection was cached.
+func (t *quicTransport) dial(ctx context.Context) (quic.Connection, bool, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.conn != nil {
+		select {
+		case <-t.conn.Context().Done():
+			// closed, by us or the upstream
+		default:
+			return t.conn, true, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxTimeout)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, t.addr, t.tlsConfig, &quic.Config{MaxIdleTimeout: t.expire})
+	if err != nil {
+		return nil, false, err
+	}
+	t.conn = conn
+	return conn, false, nil
+}
+
+// closeConn closes conn and forgets it, if it is the cached connection.
+func (t *quicTransport) closeConn(conn quic.Connection) {
+	t.Lock()
+	if t.conn == conn {
+		t.conn = nil
+	}
+	t.Unlock()
+	conn.CloseWithError(doqNoError, "")
+}
+
+// Stop closes the cached connection.
+func (t *quicTransport) Stop() {
+	t.Lock()
+	defer t.Unlock()
+	if t.conn != nil {
+		t.conn.CloseWithError(doqNoError, "")
+		t.conn = nil
+	}
+}
+
+const (
+	doqALPN    = "doq"
+	doqNoError = 0x0
+)
@@ -0,0 +1,99 @@
+package forward
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+type answer struct{}
+
+func (answer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	ret := new(dns.Msg)
+	ret.SetReply(r)
+	ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+	w.WriteMsg(ret)
+	return 0, nil
+}
+
+func (answer) Name() string { return "answer" }
+
+func TestProxyQUIC(t *testing.T) {
+	serverTLS, clientTLS, err := test.TLSConfig()
+	if err != nil {
+		t.Fatalf("Could not create TLS config: %s", err)
+	}
+
+	c := &dnsserver.Config{Zone: ".", Transport: transport.QUIC, ListenHosts: []string{"127.0.0.1"}, Port: "0", TLSConfig: serverTLS}
+	c.AddPlugin(func(next plugin.Handler) plugin.Handler { return answer{} })
+	s, err := dnsserver.NewServerQUIC("quic://127.0.0.1:0", []*dnsserver.Config{c})
+	if err != nil {
+		t.Fatalf("Could not create QUIC server: %s", err)
+	}
+	pc, err := s.ListenPacket()
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	go s.ServePacket(pc)
+	defer s.Stop()
+
+	p := NewProxy(pc.LocalAddr().String(), transport.QUIC)
+	p.SetTLSConfig(clientTLS)
+	defer p.close()
+
+	for i := 0; i < 2; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("example.org.", dns.TypeA)
+		state := request.Request{W: &test.ResponseWriter{}, Req: req}
+
+		resp, err := p.Connect(context.TODO(), state, options{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+		if resp.Id != req.Id {
+			t.Errorf("Expected reply ID %d, got %d", req.Id, resp.Id)
+		}
+		if x := resp.Answer[0].Header().Name; x != "example.org." {
+			t.Errorf("Expected %s, got %s", "example.org.", x)
+		}
+	}
+
+	conn := p.quic.conn
+	if conn == nil {
+		t.Fatal("Expected a cached QUIC connection")
+	}
+	if err := p.health.Check(p); err != nil {
+		t.Errorf("Expected healthy upstream, got %s", err)
+	}
+	if p.quic.conn != conn {
+		t.Errorf("Expected the QUIC connection to be reused")
+	}
+}
+
+func TestSetupQUIC(t *testing.T) {
+	c := caddy.NewTestController("dns", "forward . quic://127.0.0.1 {\ntls_servername dns.example.org\n}\n")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if f.proxies[0].quic == nil {
+		t.Fatal("Expected a QUIC upstream")
+	}
+	if x := f.proxies[0].addr; x != "127.0.0.1:853" {
+		t.Errorf("Expected address %s, got %s", "127.0.0.1:853", x)
+	}
+	if x := f.proxies[0].quic.tlsConfig.ServerName; x != "dns.example.org" {
+		t.Errorf("Expected server name %s, got %s", "dns.example.org", x)
+	}
+	if x := f.proxies[0].quic.tlsConfig.NextProtos; len(x) != 1 || x[0] != "doq" {
+		t.Errorf("Expected ALPN %q, got %v", "doq", x)
+	}
+}
@@ -2,6 +2,7 @@ package forward
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"time"
 
@@ -11,9 +12,11 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/parse"
 	pkgtls "github.com/coredns/coredns/plugin/pkg/tls"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/pkg/validator"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyfile"
+	"github.com/miekg/dns"
 )
 
 func init() {
@@ -38,7 +41,7 @@ func setup(c *caddy.Controller) error {
 	})
 
 	c.OnStartup(func() error {
-		metrics.MustRegister(c, RequestCount, RcodeCount, RequestDuration, HealthcheckFailureCount, SocketGauge)
+		metrics.MustRegister(c, RequestCount, RcodeCount, RequestDuration, HealthcheckFailureCount, SocketGauge, ValidationCount)
 		return f.OnStartup()
 	})
 
@@ -114,18 +117,35 @@ func ParseForwardStanza(c *caddyfile.Dispenser) (*Forward, error) {
 		transports[i] = trans
 	}
 
+	validate := false
 	for c.NextBlock() {
+		if c.Val() == "validate" {
+			if c.NextArg() {
+				return f, c.ArgErr()
+			}
+			validate = true
+			continue
+		}
 		if err := parseBlock(c, f); err != nil {
 			return f, err
 		}
 	}
+	if validate {
+		anchors := f.anchors
+		if len(anchors) == 0 {
+			anchors = validator.RootAnchors()
+		}
+		f.validator = validator.New(f.exchange, anchors, f.negative)
+	} else if len(f.anchors) > 0 || len(f.negative) > 0 {
+		return f, fmt.Errorf("trust_anchor and negative_trust_anchor need validate")
+	}
 
 	if f.tlsServerName != "" {
 		f.tlsConfig.ServerName = f.tlsServerName
 	}
 	for i := range f.proxies {
 		// Only set this for proxies that need it.
-		if transports[i] == transport.TLS {
+		if transports[i] == transport.TLS || transports[i] == transport.QUIC {
 			f.proxies[i].SetTLSConfig(f.tlsConfig)
 		}
 		f.proxies[i].SetExpire(f.expire)
@@ -178,6 +198,11 @@ func parseBlock(c *caddyfile.Dispenser, f *Forward) error {
 			return c.ArgErr()
 		}
 		f.opts.preferUDP = true
+	case "cookie":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		f.opts.cookie = true
 	case "tls":
 		args := c.RemainingArgs()
 		if len(args) > 3 {
@@ -206,6 +231,26 @@ func parseBlock(c *caddyfile.Dispenser, f *Forward) error {
 			return fmt.Errorf("expire can't be negative: %s", dur)
 		}
 		f.expire = dur
+	case "trust_anchor":
+		files := c.RemainingArgs()
+		if len(files) == 0 {
+			return c.ArgErr()
+		}
+		for _, file := range files {
+			anchors, err := readAnchors(file)
+			if err != nil {
+				return err
+			}
+			f.anchors = append(f.anchors, anchors...)
+		}
+	case "negative_trust_anchor":
+		zones := c.RemainingArgs()
+		if len(zones) == 0 {
+			return c.ArgErr()
+		}
+		for _, z := range zones {
+			f.negative = append(f.negative, plugin.Host(z).Normalize())
+		}
 	case "policy":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -228,4 +273,18 @@ func parseBlock(c *caddyfile.Dispenser, f *Forward) error {
 	return nil
 }
 
+// readAnchors reads the trust anchors, DS or DNSKEY records, from file.
+func readAnchors(file string) ([]dns.RR, error) {
+	r, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	anchors, err := validator.ParseAnchors(r, file)
+	if err != nil {
+		return nil, fmt.Errorf("trust anchor file %q: %s", file, err)
+	}
+	return anchors, nil
+}
+
 const max = 15 // Maximum number of upstreams.
@@ -27,6 +27,7 @@ func TestSetup(t *testing.T) {
 		{"forward . 127.0.0.1 {\nforce_tcp\n}\n", false, ".", nil, 2, options{forceTCP: true}, ""},
 		{"forward . 127.0.0.1 {\nprefer_udp\n}\n", false, ".", nil, 2, options{preferUDP: true}, ""},
 		{"forward . 127.0.0.1 {\nforce_tcp\nprefer_udp\n}\n", false, ".", nil, 2, options{preferUDP: true, forceTCP: true}, ""},
+		{"forward . 127.0.0.1 {\ncookie\n}\n", false, ".", nil, 2, options{cookie: true}, ""},
 		{"forward . 127.0.0.1:53", false, ".", nil, 2, options{}, ""},
 		{"forward . 127.0.0.1:8080", false, ".", nil, 2, options{}, ""},
 		{"forward . [::1]:53", false, ".", nil, 2, options{}, ""},
@@ -172,3 +173,60 @@ nameserver 10.10.255.253`), 0666); err != nil {
 		}
 	}
 }
+
+func TestSetupValidate(t *testing.T) {
+	const anchor = "anchor.db"
+	if err := ioutil.WriteFile(anchor, []byte("example.org. IN DS 45330 13 2 D1B2C2B6A4E7F0A5B6C79E6A3D8A7F2B0E7D9A8C6B5A4F3E2D1C0B9A8F7E6D5C"), 0644); err != nil {
+		t.Fatalf("Failed to write anchor file: %s", err)
+	}
+	defer os.Remove(anchor)
+
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		expectedErr string
+		validate    bool
+		anchors     int
+		negative    []string
+	}{
+		{"forward . 127.0.0.1", false, "", false, 0, nil},
+		{"forward . 127.0.0.1 {\nvalidate\n}\n", false, "", true, 0, nil},
+		{"forward . 127.0.0.1 {\nvalidate\ntrust_anchor " + anchor + "\n}\n", false, "", true, 1, nil},
+		{"forward . 127.0.0.1 {\nvalidate\nnegative_trust_anchor example.org corp.example.\n}\n", false, "", true, 0, []string{"example.org.", "corp.example."}},
+		// fail
+		{"forward . 127.0.0.1 {\nvalidate yes\n}\n", true, "Wrong argument count", false, 0, nil},
+		{"forward . 127.0.0.1 {\nvalidate\ntrust_anchor\n}\n", true, "Wrong argument count", false, 0, nil},
+		{"forward . 127.0.0.1 {\nvalidate\ntrust_anchor /does/not/exist\n}\n", true, "no such file", false, 0, nil},
+		{"forward . 127.0.0.1 {\nvalidate\ntrust_anchor setup.go\n}\n", true, "trust anchor file", false, 0, nil},
+		{"forward . 127.0.0.1 {\ntrust_anchor " + anchor + "\n}\n", true, "need validate", false, 0, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		f, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			continue
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+			continue
+		}
+
+		if validate := f.validator != nil; validate != test.validate {
+			t.Errorf("Test %d: expected validate %t, got %t", i, test.validate, validate)
+		}
+		if len(f.anchors) != test.anchors {
+			t.Errorf("Test %d: expected %d trust anchors, got %d", i, test.anchors, len(f.anchors))
+		}
+		if !reflect.DeepEqual(f.negative, test.negative) {
+			t.Errorf("Test %d: expected negative trust anchors %v, got %v", i, test.negative, f.negative)
+		}
+	}
+}
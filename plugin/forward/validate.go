@@ -0,0 +1,124 @@
+package forward
+
+import (
+	"context"
+	"net"
+
+	"github.com/coredns/coredns/plugin/pkg/validator"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// validateRequest returns the request sent upstream when validating: with the DO bit set, to get the
+// signatures, and the CD bit, so a validating upstream returns bogus data for us to see.
+func validateRequest(r *dns.Msg) *dns.Msg {
+	req := r.Copy()
+	if o := req.IsEdns0(); o != nil {
+		o.SetDo()
+	} else {
+		req.SetEdns0(4096, true)
+	}
+	req.CheckingDisabled = true
+	return req
+}
+
+// validate validates ret, the response to the client's request r. Secure answers get the AD bit, bogus
+// ones are replaced by SERVFAIL. A truncated answer, that can't be validated, is passed on without the
+// AD bit, so the client retries over TCP. The DNSSEC records are removed if the client didn't ask for
+// them, and as ret was asked for with a larger buffer, it is truncated to what the client can take.
+func (f *Forward) validate(ctx context.Context, w dns.ResponseWriter, r, ret *dns.Msg) *dns.Msg {
+	var (
+		res validator.Result
+		err error
+	)
+	if !ret.Truncated {
+		res, err = f.validator.Validate(ctx, ret)
+		ValidationCount.WithLabelValues(res.String()).Add(1)
+	}
+	if res == validator.Bogus {
+		log.Warningf("Bogus answer for %s %s: %s", r.Question[0].Name, dns.TypeToString[r.Question[0].Qtype], err)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		return m
+	}
+
+	o := r.IsEdns0()
+	do := o != nil && o.Do()
+	// Only clients that understand it get the AD bit (RFC 6840, Section 5.8).
+	ret.AuthenticatedData = res == validator.Secure && (do || r.AuthenticatedData)
+	ret.CheckingDisabled = false
+	if !do {
+		qtype := r.Question[0].Qtype
+		ret.Answer = stripDNSSEC(ret.Answer, qtype)
+		ret.Ns = stripDNSSEC(ret.Ns, qtype)
+		ret.Extra = stripDNSSEC(ret.Extra, qtype)
+	}
+	if o == nil {
+		extra := ret.Extra[:0]
+		for _, rr := range ret.Extra {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				extra = append(extra, rr)
+			}
+		}
+		ret.Extra = extra
+	} else if ro := ret.IsEdns0(); ro != nil && !do {
+		ro.SetDo(false)
+	}
+	state := request.Request{W: w, Req: r}
+	ret.Truncate(state.Size())
+	return ret
+}
+
+// stripDNSSEC removes the RRSIG, NSEC and NSEC3 records from rrs, unless these were asked for.
+func stripDNSSEC(rrs []dns.RR, qtype uint16) []dns.RR {
+	keep := rrs[:0]
+	for _, rr := range rrs {
+		switch t := rr.Header().Rrtype; t {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			if t != qtype {
+				continue
+			}
+		}
+		keep = append(keep, rr)
+	}
+	return keep
+}
+
+// exchange sends m to the upstreams, in the order of the policy, until one answers. It is used by the
+// validator for the DNSKEY and DS records.
+func (f *Forward) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	state := request.Request{W: nopWriter{}, Req: m}
+	var err error
+	for _, proxy := range f.List() {
+		if proxy.Down(f.maxfails) {
+			continue
+		}
+		opts := f.opts
+		var ret *dns.Msg
+		for {
+			ret, err = proxy.Connect(ctx, state, opts)
+			if err == ErrCachedClosed {
+				continue
+			}
+			if err == nil && ret.Truncated && !opts.forceTCP {
+				opts.forceTCP = true
+				continue
+			}
+			break
+		}
+		if err == nil {
+			return ret, nil
+		}
+	}
+	if err == nil {
+		err = ErrNoHealthy
+	}
+	return nil, err
+}
+
+// nopWriter is the dns.ResponseWriter for the queries forward sends on its own behalf: these look like
+// they came in over UDP.
+type nopWriter struct{ dns.ResponseWriter }
+
+func (nopWriter) RemoteAddr() net.Addr { return &net.UDPAddr{} }
@@ -0,0 +1,117 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/validator"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+func TestValidateTruncate(t *testing.T) {
+	// example.org is below a negative trust anchor, so it's insecure without asking upstream.
+	f := New()
+	f.validator = validator.New(f.exchange, nil, []string{"example.org."})
+
+	// A client without EDNS0 can take 512 bytes.
+	r := new(dns.Msg)
+	r.SetQuestion("large.example.org.", dns.TypeTXT)
+
+	ret := new(dns.Msg)
+	ret.SetReply(validateRequest(r))
+	ret.SetEdns0(4096, true)
+	for i := 0; i < 20; i++ {
+		ret.Answer = append(ret.Answer, test.TXT(fmt.Sprintf("large.example.org. 3600 IN TXT \"%s %d\"", strings.Repeat("x", 40), i)))
+	}
+
+	ret = f.validate(context.TODO(), &test.ResponseWriter{}, r, ret)
+	if !ret.Truncated {
+		t.Errorf("Expected truncated reply, got %d records", len(ret.Answer))
+	}
+	if ret.Len() > dns.MinMsgSize {
+		t.Errorf("Expected reply of at most %d bytes, got %d", dns.MinMsgSize, ret.Len())
+	}
+	if ret.IsEdns0() != nil {
+		t.Errorf("Expected no OPT record in reply to a client without EDNS0")
+	}
+}
+
+func TestValidateTruncatedUpstream(t *testing.T) {
+	key := &dns.DNSKEY{Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600}, Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+	if _, err := key.Generate(256); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		tcpTC     bool     // the upstream truncates over TCP too
+		anchors   []dns.RR // unsigned answers are bogus below these
+		negative  []string
+		truncated bool
+		rcode     int
+	}{
+		// Retried over TCP: the full answer is validated, as insecure.
+		{"retry tcp", false, nil, []string{"example.org."}, false, dns.RcodeSuccess},
+		// Still truncated: passed on as is, an unsigned answer is not made bogus.
+		{"truncated", true, []dns.RR{key}, nil, true, dns.RcodeSuccess},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var tcp int32
+			s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+				ret := new(dns.Msg)
+				ret.SetReply(r)
+				_, overTCP := w.RemoteAddr().(*net.TCPAddr)
+				if overTCP {
+					atomic.AddInt32(&tcp, 1)
+				}
+				if overTCP && !tc.tcpTC {
+					ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+				} else {
+					ret.Truncated = true
+				}
+				w.WriteMsg(ret)
+			})
+			defer s.Close()
+
+			c := caddy.NewTestController("dns", "forward . "+s.Addr)
+			f, err := parseForward(c)
+			if err != nil {
+				t.Fatalf("Failed to create forwarder: %s", err)
+			}
+			f.validator = validator.New(f.exchange, tc.anchors, tc.negative)
+			f.OnStartup()
+			defer f.OnShutdown()
+
+			m := new(dns.Msg)
+			m.SetQuestion("example.org.", dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+				t.Fatalf("Expected to receive reply, but didn't: %s", err)
+			}
+			if atomic.LoadInt32(&tcp) == 0 {
+				t.Errorf("Expected the query to be retried over TCP")
+			}
+			if rec.Msg.Rcode != tc.rcode {
+				t.Errorf("Expected rcode %d, got %d", tc.rcode, rec.Msg.Rcode)
+			}
+			if rec.Msg.Truncated != tc.truncated {
+				t.Errorf("Expected truncated %t, got %t", tc.truncated, rec.Msg.Truncated)
+			}
+			if rec.Msg.AuthenticatedData {
+				t.Errorf("Expected no AD bit")
+			}
+			if !tc.truncated && len(rec.Msg.Answer) != 1 {
+				t.Errorf("Expected 1 answer, got %d", len(rec.Msg.Answer))
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 
 	"github.com/mholt/caddy"
@@ -265,13 +266,23 @@ func ParseStanza(c *caddy.Controller) (*Kubernetes, error) {
 			}
 			k8s.ttl = uint32(t)
 		case "transfer":
-			tos, froms, err := parse.Transfer(c, false)
+			tos, froms, name, err := parse.Transfer(c, false)
 			if err != nil {
 				return nil, err
 			}
 			if len(froms) != 0 {
 				return nil, c.Errf("transfer from is not supported with this plugin")
 			}
+			if name != "" {
+				key, err := dnsserver.GetConfig(c).TsigKeys.Get(name)
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				k8s.TransferKeys = make(map[string]tsig.Key)
+				for _, to := range tos {
+					k8s.TransferKeys[to] = key
+				}
+			}
 			k8s.TransferTo = tos
 		case "noendpoints":
 			if len(c.RemainingArgs()) != 0 {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/etcd/msg"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -76,21 +77,21 @@ func (k *Kubernetes) Transfer(ctx context.Context, state request.Request) (int,
 }
 
 // transferAllowed checks if incoming request for transferring the zone is allowed according to the ACLs.
+// If a TSIG key is configured for the address, the request must be signed with it.
 // Note: This is copied from zone.transferAllowed, but should eventually be factored into a common transfer pkg.
 func (k *Kubernetes) transferAllowed(state request.Request) bool {
 	for _, t := range k.TransferTo {
-		if t == "*" {
-			return true
+		if t != "*" {
+			// If remote IP matches we accept.
+			to, _, err := net.SplitHostPort(t)
+			if err != nil || to != state.IP() {
+				continue
+			}
 		}
-		// If remote IP matches we accept.
-		remote := state.IP()
-		to, _, err := net.SplitHostPort(t)
-		if err != nil {
+		if key, ok := k.TransferKeys[t]; ok && !tsig.Verified(state.W, state.Req, key) {
 			continue
 		}
-		if to == remote {
-			return true
-		}
+		return true
 	}
 	return false
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/coredns/coredns/plugin/kubernetes/object"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/test"
 
 	"github.com/miekg/dns"
@@ -127,6 +128,34 @@ func TestKubernetesXFRNotAllowed(t *testing.T) {
 	}
 }
 
+func TestKubernetesXFRTsig(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.APIConn = &APIConnServeTest{}
+	k.TransferTo = []string{"*"}
+	key := tsig.Key{Name: "xfr.cluster.local.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}
+	k.TransferKeys = map[string]tsig.Key{"*": key}
+	k.Namespaces = map[string]struct{}{"testns": {}}
+
+	dnsmsg := &dns.Msg{}
+	dnsmsg.SetAxfr(k.Zones[0])
+	w := dnstest.NewMultiRecorder(&test.ResponseWriter{})
+	if _, err := k.ServeDNS(context.TODO(), w, dnsmsg); err != nil {
+		t.Error(err)
+	}
+	if len(w.Msgs) == 0 || len(w.Msgs[0].Answer) != 0 {
+		t.Fatal("Got an answer to an unsigned transfer, should not have")
+	}
+
+	tsig.Sign(dnsmsg, key)
+	w = dnstest.NewMultiRecorder(&test.ResponseWriter{})
+	if _, err := k.ServeDNS(context.TODO(), w, dnsmsg); err != nil {
+		t.Error(err)
+	}
+	if len(w.Msgs) == 0 || len(w.Msgs[0].Answer) == 0 {
+		t.Fatal("Did not get back an answer to a signed transfer")
+	}
+}
+
 // difference shows what we're missing when comparing two RR slices
 func difference(testRRs []dns.RR, gotRRs []dns.RR) []dns.RR {
 	expectedRRs := map[string]struct{}{}
@@ -1,6 +1,9 @@
 // Package cache implements a cache. The cache hold 256 shards, each shard
-// holds a cache: a map with a mutex. There is no fancy expunge algorithm, it
-// just randomly evicts elements when it gets full.
+// holds a cache: a map with a mutex. When a shard gets full its eviction
+// Policy picks the element to evict, by default that is TinyLFU.
+//
+// The capacity is either a number of elements, or a number of bytes. For the
+// latter the elements must implement Sizer.
 package cache
 
 import (
@@ -15,21 +18,55 @@ func Hash(what []byte) uint64 {
 	return h.Sum64()
 }
 
+// Sizer is implemented by elements that know their (approximate) size in bytes.
+type Sizer interface {
+	Size() int
+}
+
 // Cache is cache.
 type Cache struct {
 	shards [shardSize]*shard
 }
 
-// shard is a cache with random eviction.
+// shard is a cache with an eviction policy.
 type shard struct {
-	items map[uint64]interface{}
-	size  int
+	items    map[uint64]element
+	policy   Policy
+	accesses chan access // lookups not yet recorded by the policy
+	bytes    bool        // the capacity is in bytes
+	size     int         // the total size of the elements that implement Sizer
 
 	sync.RWMutex
 }
 
-// New returns a new cache.
-func New(size int) *Cache {
+// access is a lookup of key, hit is true if it was found.
+type access struct {
+	key uint64
+	hit bool
+}
+
+type element struct {
+	el   interface{}
+	size int
+}
+
+// New returns a new cache, that holds up to size elements and evicts them with TinyLFU.
+func New(size int) *Cache { return NewWithPolicy(size, NewTinyLFU) }
+
+// NewWithPolicy returns a new cache, each shard evicts elements with the policy returned by
+// newPolicy for the size of the shard.
+func NewWithPolicy(size int, newPolicy func(size int) Policy) *Cache {
+	return newCache(size, false, newPolicy)
+}
+
+// NewBytes returns a new cache, that holds elements up to a total size of max bytes and evicts them
+// with TinyLFU. Elements that don't implement Sizer count as one byte. The TinyLFU sketch is sized
+// for elements of bytesPerItem, it adds about 3 to 6% to max.
+func NewBytes(max int) *Cache {
+	return newCache(max, true, func(size int) Policy { return newTinyLFU(size, size/bytesPerItem) })
+}
+
+func newCache(size int, bytes bool, newPolicy func(size int) Policy) *Cache {
 	ssize := size / shardSize
 	if ssize < 4 {
 		ssize = 4
@@ -39,7 +76,7 @@ func New(size int) *Cache {
 
 	// Initialize all the shards
 	for i := 0; i < shardSize; i++ {
-		c.shards[i] = newShard(ssize)
+		c.shards[i] = &shard{items: make(map[uint64]element), policy: newPolicy(ssize), accesses: make(chan access, accessBufferSize), bytes: bytes}
 	}
 	return c
 }
@@ -56,6 +93,14 @@ func (c *Cache) Get(key uint64) (interface{}, bool) {
 	return c.shards[shard].Get(key)
 }
 
+// GetOrAdd looks up the element indexed under key. If there is none, the element returned by newEl is
+// added, all under one lock of the shard, so concurrent callers get the same element. Found is true if
+// the element was already there.
+func (c *Cache) GetOrAdd(key uint64, newEl func() interface{}) (el interface{}, found bool) {
+	shard := key & (shardSize - 1)
+	return c.shards[shard].GetOrAdd(key, newEl)
+}
+
 // Remove removes the element indexed with key.
 func (c *Cache) Remove(key uint64) {
 	shard := key & (shardSize - 1)
@@ -71,56 +116,154 @@ func (c *Cache) Len() int {
 	return l
 }
 
-// newShard returns a new shard with size.
-func newShard(size int) *shard { return &shard{items: make(map[uint64]interface{}), size: size} }
+// Walk calls f for the elements in the cache, until it returns false. The shard of the element is
+// locked, so f must not use the cache.
+func (c *Cache) Walk(f func(key uint64, el interface{}) bool) {
+	for _, s := range c.shards {
+		if !s.Walk(f) {
+			return
+		}
+	}
+}
+
+// Size returns the total size in bytes of the elements in the cache that implement Sizer.
+func (c *Cache) Size() int {
+	l := 0
+	for _, s := range c.shards {
+		l += s.Size()
+	}
+	return l
+}
+
+// newShard returns a new shard with size, that evicts elements with TinyLFU.
+func newShard(size int) *shard {
+	return &shard{items: make(map[uint64]element), policy: NewTinyLFU(size), accesses: make(chan access, accessBufferSize)}
+}
 
 // Add adds element indexed by key into the cache. Any existing element is overwritten
 func (s *shard) Add(key uint64, el interface{}) {
-	l := s.Len()
-	if l+1 > s.size {
-		s.Evict()
+	s.Lock()
+	defer s.Unlock()
+
+	s.drain()
+	s.add(key, el)
+}
+
+// GetOrAdd looks up the element indexed under key, and adds the one returned by newEl if it's not there.
+func (s *shard) GetOrAdd(key uint64, newEl func() interface{}) (interface{}, bool) {
+	s.RLock()
+	e, found := s.items[key]
+	s.RUnlock()
+	if found {
+		s.record(access{key, true})
+		return e.el, true
 	}
 
 	s.Lock()
-	s.items[key] = el
-	s.Unlock()
+	defer s.Unlock()
+
+	s.drain()
+	// Another goroutine may have added it in the meantime.
+	if e, found := s.items[key]; found {
+		s.policy.Access(key, true)
+		return e.el, true
+	}
+	s.policy.Access(key, false)
+	el := newEl()
+	s.add(key, el)
+	return el, false
+}
+
+// add adds el indexed by key, overwriting any existing element. The write lock must be held.
+func (s *shard) add(key uint64, el interface{}) {
+	e := element{el: el}
+	if sz, ok := el.(Sizer); ok {
+		e.size = sz.Size()
+	}
+	cost := 1
+	if s.bytes && e.size > 0 {
+		cost = e.size
+	}
+
+	if old, ok := s.items[key]; ok {
+		s.items[key] = e
+		s.size += e.size - old.size
+		if old.size == e.size || !s.bytes {
+			s.policy.Access(key, true)
+			return
+		}
+		// The cost changed, add it again.
+		s.policy.Remove(key)
+	} else {
+		s.items[key] = e
+		s.size += e.size
+	}
+	for _, k := range s.policy.Add(key, cost) {
+		s.size -= s.items[k].size
+		delete(s.items, k)
+	}
 }
 
 // Remove removes the element indexed by key from the cache.
 func (s *shard) Remove(key uint64) {
 	s.Lock()
-	delete(s.items, key)
+	s.drain()
+	if e, ok := s.items[key]; ok {
+		s.size -= e.size
+		delete(s.items, key)
+		s.policy.Remove(key)
+	}
 	s.Unlock()
 }
 
-// Evict removes a random element from the cache.
-func (s *shard) Evict() {
-	hasKey := false
-	var key uint64
-
+// Get looks up the element indexed under key.
+func (s *shard) Get(key uint64) (interface{}, bool) {
 	s.RLock()
-	for k := range s.items {
-		key = k
-		hasKey = true
-		break
-	}
+	e, found := s.items[key]
 	s.RUnlock()
+	s.record(access{key, found})
+	return e.el, found
+}
 
-	if !hasKey {
-		// empty cache
+// record buffers a for the policy, which needs the write lock. When the buffer is full it is drained,
+// unless another goroutine holds the lock, then a is dropped: the policy only uses the accesses to
+// estimate what is popular, so losing a few under contention is fine.
+func (s *shard) record(a access) {
+	select {
+	case s.accesses <- a:
 		return
+	default:
 	}
+	if !s.TryLock() {
+		return
+	}
+	s.drain()
+	s.policy.Access(a.key, a.hit)
+	s.Unlock()
+}
 
-	// If this item is gone between the RUnlock and Lock race we don't care.
-	s.Remove(key)
+// drain passes the buffered accesses to the policy. The write lock must be held.
+func (s *shard) drain() {
+	for {
+		select {
+		case a := <-s.accesses:
+			s.policy.Access(a.key, a.hit)
+		default:
+			return
+		}
+	}
 }
 
-// Get looks up the element indexed under key.
-func (s *shard) Get(key uint64) (interface{}, bool) {
+// Walk calls f for the elements in the shard, until it returns false, which is returned.
+func (s *shard) Walk(f func(key uint64, el interface{}) bool) bool {
 	s.RLock()
-	el, found := s.items[key]
-	s.RUnlock()
-	return el, found
+	defer s.RUnlock()
+	for k, e := range s.items {
+		if !f(k, e.el) {
+			return false
+		}
+	}
+	return true
 }
 
 // Len returns the current length of the cache.
@@ -131,4 +274,16 @@ func (s *shard) Len() int {
 	return l
 }
 
-const shardSize = 256
+// Size returns the total size of the elements in the shard that implement Sizer.
+func (s *shard) Size() int {
+	s.RLock()
+	l := s.size
+	s.RUnlock()
+	return l
+}
+
+const (
+	shardSize        = 256
+	bytesPerItem     = 512 // the estimated size of an element, when the capacity is in bytes
+	accessBufferSize = 16  // the lookups a shard buffers before the policy records them
+)
@@ -30,6 +30,22 @@ func TestCacheLen(t *testing.T) {
 	}
 }
 
+func TestCacheGetOrAdd(t *testing.T) {
+	c := New(4)
+
+	el, found := c.GetOrAdd(1, func() interface{} { return 1 })
+	if found || el != 1 {
+		t.Fatalf("Expected 1 to be added, got %v, found %t", el, found)
+	}
+	el, found = c.GetOrAdd(1, func() interface{} { return 2 })
+	if !found || el != 1 {
+		t.Fatalf("Expected 1 to be found, got %v, found %t", el, found)
+	}
+	if l := c.Len(); l != 1 {
+		t.Fatalf("Cache size should %d, got %d", 1, l)
+	}
+}
+
 func BenchmarkCache(b *testing.B) {
 	b.ReportAllocs()
 
@@ -39,3 +55,79 @@ func BenchmarkCache(b *testing.B) {
 		c.Get(1)
 	}
 }
+
+type sized int
+
+func (s sized) Size() int { return int(s) }
+
+func TestCacheBytes(t *testing.T) {
+	c := NewBytes(shardSize * 100) // 100 bytes per shard
+
+	// All in the first shard.
+	for i := uint64(0); i < 10; i++ {
+		c.Add(i*shardSize, sized(30))
+		if s := c.Size(); s > 100 {
+			t.Fatalf("Cache size should be at most %d bytes, got %d", 100, s)
+		}
+	}
+	if l := c.Len(); l != 3 {
+		t.Errorf("Cache should hold %d elements, got %d", 3, l)
+	}
+
+	// Elements larger than the shard aren't kept.
+	c.Add(1, sized(200))
+	if _, found := c.Get(1); found {
+		t.Errorf("Found an element larger than the capacity")
+	}
+
+	c.Add(2, sized(10))
+	c.Add(2, sized(20))
+	if s := c.shards[2].Size(); s != 20 {
+		t.Errorf("Shard size should be %d bytes, got %d", 20, s)
+	}
+	c.Remove(2)
+	if s := c.shards[2].Size(); s != 0 {
+		t.Errorf("Shard size should be %d bytes, got %d", 0, s)
+	}
+}
+
+func TestCacheWalk(t *testing.T) {
+	c := New(1024)
+	for i := uint64(0); i < 10; i++ {
+		c.Add(i, i)
+	}
+	seen := map[uint64]bool{}
+	c.Walk(func(key uint64, el interface{}) bool {
+		if el.(uint64) != key {
+			t.Errorf("Expected element %d for key %d, got %d", key, key, el)
+		}
+		seen[key] = true
+		return true
+	})
+	if len(seen) != 10 {
+		t.Errorf("Expected to walk %d elements, got %d", 10, len(seen))
+	}
+
+	n := 0
+	c.Walk(func(key uint64, el interface{}) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("Expected to stop walking after %d elements, got %d", 3, n)
+	}
+}
+
+func TestCacheBytesSketch(t *testing.T) {
+	const max = 64 << 20
+	c := NewBytes(max)
+	sketch := 0
+	for _, s := range c.shards {
+		for _, row := range s.policy.(*tinyLFU).sketch.rows {
+			sketch += len(row)
+		}
+	}
+	if sketch > max*6/100 {
+		t.Errorf("Expected the sketches to use at most 6%% of %d bytes, got %d", max, sketch)
+	}
+}
@@ -0,0 +1,170 @@
+package cache
+
+import "container/list"
+
+// Policy is an eviction policy of a shard. It tracks the keys in the shard, with their cost, and
+// decides which ones to evict when the total cost is over the capacity of the shard. The shard's
+// lock is held when its methods are called.
+type Policy interface {
+	// Add records that key, which wasn't in the shard, is added. It returns the keys to evict to
+	// stay within the capacity, this can include key itself.
+	Add(key uint64, cost int) (evict []uint64)
+	// Access records a lookup of key, hit is true if it is in the shard.
+	Access(key uint64, hit bool)
+	// Remove records that key is removed from the shard.
+	Remove(key uint64)
+}
+
+// random evicts random keys.
+type random struct {
+	keys     map[uint64]int
+	cost     int
+	capacity int
+}
+
+// NewRandom returns a policy that evicts random keys.
+func NewRandom(capacity int) Policy { return &random{keys: make(map[uint64]int), capacity: capacity} }
+
+func (r *random) Add(key uint64, cost int) []uint64 {
+	r.keys[key] = cost
+	r.cost += cost
+
+	var evict []uint64
+	for k := range r.keys {
+		if r.cost <= r.capacity {
+			break
+		}
+		if k != key {
+			evict = append(evict, k)
+			r.Remove(k)
+		}
+	}
+	if r.cost > r.capacity {
+		evict = append(evict, key)
+		r.Remove(key)
+	}
+	return evict
+}
+
+func (r *random) Access(key uint64, hit bool) {}
+
+func (r *random) Remove(key uint64) {
+	if cost, ok := r.keys[key]; ok {
+		r.cost -= cost
+		delete(r.keys, key)
+	}
+}
+
+// slru is a segmented LRU: keys are added to the probationary segment and move to the protected
+// segment when they are accessed again. Keys that fall out of the protected segment go back to the
+// probationary segment, which is evicted first.
+type slru struct {
+	probation *lru
+	protected *lru
+	capacity  int
+	protect   int // the capacity of the protected segment
+}
+
+// NewSLRU returns a policy that evicts the least recently used keys of a segmented LRU, 80% of it is
+// protected.
+func NewSLRU(capacity int) Policy { return newSLRU(capacity) }
+
+func newSLRU(capacity int) *slru {
+	return &slru{probation: newLRU(), protected: newLRU(), capacity: capacity, protect: capacity * 8 / 10}
+}
+
+func (s *slru) Add(key uint64, cost int) []uint64 {
+	s.probation.push(key, cost)
+	var evict []uint64
+	for s.cost() > s.capacity {
+		k, _ := s.victim()
+		s.Remove(k)
+		evict = append(evict, k)
+	}
+	return evict
+}
+
+func (s *slru) Access(key uint64, hit bool) {
+	if !hit || s.protected.touch(key) {
+		return
+	}
+	cost, ok := s.probation.remove(key)
+	if !ok {
+		return
+	}
+	s.protected.push(key, cost)
+	for s.protected.cost > s.protect && s.protected.len() > 1 {
+		k, _ := s.protected.back()
+		cost, _ := s.protected.remove(k)
+		s.probation.push(k, cost)
+	}
+}
+
+func (s *slru) Remove(key uint64) {
+	if _, ok := s.probation.remove(key); !ok {
+		s.protected.remove(key)
+	}
+}
+
+// victim returns the key that is evicted next.
+func (s *slru) victim() (uint64, bool) {
+	if k, ok := s.probation.back(); ok {
+		return k, true
+	}
+	return s.protected.back()
+}
+
+func (s *slru) cost() int { return s.probation.cost + s.protected.cost }
+
+// lru is a list of keys, the most recently used first.
+type lru struct {
+	l    *list.List
+	keys map[uint64]*list.Element
+	cost int
+}
+
+type entry struct {
+	key  uint64
+	cost int
+}
+
+func newLRU() *lru { return &lru{l: list.New(), keys: make(map[uint64]*list.Element)} }
+
+// push adds key to the front.
+func (l *lru) push(key uint64, cost int) {
+	l.keys[key] = l.l.PushFront(entry{key, cost})
+	l.cost += cost
+}
+
+// touch moves key to the front, it returns false if key isn't in l.
+func (l *lru) touch(key uint64) bool {
+	e, ok := l.keys[key]
+	if ok {
+		l.l.MoveToFront(e)
+	}
+	return ok
+}
+
+// remove removes key and returns its cost, it returns false if key isn't in l.
+func (l *lru) remove(key uint64) (int, bool) {
+	e, ok := l.keys[key]
+	if !ok {
+		return 0, false
+	}
+	cost := e.Value.(entry).cost
+	l.l.Remove(e)
+	delete(l.keys, key)
+	l.cost -= cost
+	return cost, true
+}
+
+// back returns the least recently used key.
+func (l *lru) back() (uint64, bool) {
+	e := l.l.Back()
+	if e == nil {
+		return 0, false
+	}
+	return e.Value.(entry).key, true
+}
+
+func (l *lru) len() int { return len(l.keys) }
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSLRU(t *testing.T) {
+	s := newShardWithPolicy(NewSLRU(4))
+	for k := uint64(1); k <= 4; k++ {
+		s.Add(k, k)
+	}
+	// 1 is used again, it's protected, and 2 is the least recently used.
+	s.Get(1)
+	s.Add(5, 5)
+	if _, found := s.Get(2); found {
+		t.Error("Found 2, that should have been evicted")
+	}
+	if _, found := s.Get(1); !found {
+		t.Error("Failed to find 1, that should be protected")
+	}
+}
+
+func TestTinyLFU(t *testing.T) {
+	s := newShardWithPolicy(NewTinyLFU(10))
+	for k := uint64(1); k <= 10; k++ {
+		s.Add(k, k)
+		s.Get(k)
+		s.Get(k)
+	}
+	// Keys looked up once aren't admitted, the popular ones stay.
+	for k := uint64(100); k < 200; k++ {
+		s.Get(k)
+		s.Add(k, k)
+	}
+	if l := s.Len(); l != 10 {
+		t.Fatalf("Shard size should %d, got %d", 10, l)
+	}
+	for k := uint64(1); k <= 9; k++ {
+		if _, found := s.Get(k); !found {
+			t.Errorf("Failed to find popular key %d", k)
+		}
+	}
+}
+
+func TestPolicyRemove(t *testing.T) {
+	for name, p := range policies {
+		s := newShardWithPolicy(p(4))
+		for k := uint64(1); k <= 4; k++ {
+			s.Add(k, k)
+		}
+		s.Remove(3)
+		s.Add(5, 5)
+		if l := s.Len(); l != 4 {
+			t.Errorf("%s: shard size should %d, got %d", name, 4, l)
+		}
+		for k := uint64(6); k <= 20; k++ {
+			s.Get(k)
+			s.Add(k, k)
+			if l := s.Len(); l > 4 {
+				t.Errorf("%s: shard size should be at most %d, got %d", name, 4, l)
+			}
+		}
+	}
+}
+
+func TestHitRate(t *testing.T) {
+	random := hitRate(NewRandom, attack(rand.New(rand.NewSource(1))), 100000)
+	tinyLFU := hitRate(NewTinyLFU, attack(rand.New(rand.NewSource(1))), 100000)
+	if tinyLFU <= random {
+		t.Errorf("Expected a higher hit rate for TinyLFU (%.2f) than random eviction (%.2f) during an attack", tinyLFU, random)
+	}
+}
+
+var policies = map[string]func(int) Policy{
+	"random":  NewRandom,
+	"slru":    NewSLRU,
+	"tinylfu": NewTinyLFU,
+}
+
+const (
+	benchSize = 10000  // the cache size in the benchmarks
+	benchKeys = 100000 // the number of popular keys
+)
+
+// skewed returns keys with a Zipf distribution.
+func skewed(r *rand.Rand) func() uint64 {
+	z := rand.NewZipf(r, 1.1, 1, benchKeys)
+	return z.Uint64
+}
+
+// attack returns keys of which half are skewed, and half unique, as in a random subdomain attack.
+func attack(r *rand.Rand) func() uint64 {
+	z := skewed(r)
+	return func() uint64 {
+		if r.Intn(2) == 0 {
+			return benchKeys + uint64(r.Int63())
+		}
+		return z()
+	}
+}
+
+// hitRate returns the hit rate of a cache with policy for n lookups of the keys from next. Keys
+// that miss are added.
+func hitRate(policy func(int) Policy, next func() uint64, n int) float64 {
+	c := NewWithPolicy(benchSize, policy)
+	hits := 0
+	for i := 0; i < n; i++ {
+		k := next()
+		if _, found := c.Get(k); found {
+			hits++
+			continue
+		}
+		c.Add(k, k)
+	}
+	return float64(hits) / float64(n)
+}
+
+func BenchmarkHitRate(b *testing.B) {
+	workloads := map[string]func(*rand.Rand) func() uint64{
+		"skewed": skewed,
+		"attack": attack,
+	}
+	for wname, workload := range workloads {
+		for pname, policy := range policies {
+			b.Run(wname+"/"+pname, func(b *testing.B) {
+				b.ReportAllocs()
+				rate := hitRate(policy, workload(rand.New(rand.NewSource(1))), b.N)
+				b.ReportMetric(100*rate, "hit%")
+			})
+		}
+	}
+}
+
+func newShardWithPolicy(p Policy) *shard {
+	return &shard{items: make(map[uint64]element), policy: p}
+}
@@ -1,6 +1,9 @@
 package cache
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
 func TestShardAddAndGet(t *testing.T) {
 	s := newShard(4)
@@ -58,3 +61,30 @@ func TestShardLenEvict(t *testing.T) {
 		t.Fatalf("Shard size should %d, got %d", 4, l)
 	}
 }
+
+func TestShardGetConcurrent(t *testing.T) {
+	s := newShard(64)
+	for k := uint64(0); k < 64; k++ {
+		s.Add(k, 1)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := uint64(i % 128)
+				s.Get(k)
+				if i%100 == g {
+					s.Add(k, 1)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if l := s.Len(); l > 64 {
+		t.Fatalf("Shard size should be at most %d, got %d", 64, l)
+	}
+}
@@ -0,0 +1,147 @@
+package cache
+
+// tinyLFU is W-TinyLFU: new keys go into a small LRU window. The key that falls out of the window
+// is only admitted to the main segmented LRU if it is accessed more often than the keys it would
+// replace, otherwise it is evicted. The access frequencies are estimated with a count-min sketch,
+// that counts the lookups of all keys, also those not in the shard. This keeps keys that are
+// looked up once, like random subdomains, from pushing out the popular ones.
+type tinyLFU struct {
+	window *lru
+	main   *slru
+	sketch *sketch
+	wcap   int // the capacity of the window
+}
+
+// NewTinyLFU returns a policy that admits keys with W-TinyLFU, 1% of capacity is the window.
+func NewTinyLFU(capacity int) Policy { return newTinyLFU(capacity, capacity) }
+
+// newTinyLFU returns a W-TinyLFU policy for capacity, that holds about items keys. The sketch is
+// sized for the number of keys.
+func newTinyLFU(capacity, items int) *tinyLFU {
+	wcap := capacity / 100
+	if wcap < 1 {
+		wcap = 1
+	}
+	return &tinyLFU{window: newLRU(), main: newSLRU(capacity - wcap), sketch: newSketch(items), wcap: wcap}
+}
+
+func (t *tinyLFU) Add(key uint64, cost int) []uint64 {
+	t.window.push(key, cost)
+
+	var evict []uint64
+	for t.window.cost > t.wcap {
+		candidate, _ := t.window.back()
+		cost, _ := t.window.remove(candidate)
+		evict = append(evict, t.admit(candidate, cost)...)
+	}
+	return evict
+}
+
+// admit moves candidate, that fell out of the window, to the main segment if it's accessed more
+// often than the keys that need to be evicted to make room for it. It returns the evicted keys.
+func (t *tinyLFU) admit(candidate uint64, cost int) []uint64 {
+	if cost > t.main.capacity {
+		return []uint64{candidate}
+	}
+
+	var victims []uint64
+	free := t.main.capacity - t.main.cost()
+	freq := t.sketch.estimate(candidate)
+	for _, segment := range []*lru{t.main.probation, t.main.protected} {
+		for e := segment.l.Back(); e != nil && free < cost; e = e.Prev() {
+			victim := e.Value.(entry)
+			if freq <= t.sketch.estimate(victim.key) {
+				return []uint64{candidate}
+			}
+			victims = append(victims, victim.key)
+			free += victim.cost
+		}
+	}
+	for _, k := range victims {
+		t.main.Remove(k)
+	}
+	t.main.probation.push(candidate, cost)
+	return victims
+}
+
+func (t *tinyLFU) Access(key uint64, hit bool) {
+	t.sketch.increment(key)
+	if hit && !t.window.touch(key) {
+		t.main.Access(key, hit)
+	}
+}
+
+func (t *tinyLFU) Remove(key uint64) {
+	if _, ok := t.window.remove(key); !ok {
+		t.main.Remove(key)
+	}
+}
+
+// sketch is a count-min sketch with 4 rows of counters, that saturate at 15. The counters are
+// halved every 10 * items increments, so the frequencies adapt when the popular keys change.
+type sketch struct {
+	rows    [4][]uint8
+	mask    uint64
+	count   int
+	resetAt int
+}
+
+// newSketch returns a sketch for up to items keys. It uses 16 to 32 bytes per key.
+func newSketch(items int) *sketch {
+	if items > maxSketchItems {
+		items = maxSketchItems
+	}
+	if items < 1 {
+		items = 1
+	}
+	w := 16
+	for w < 4*items {
+		w *= 2
+	}
+	s := &sketch{mask: uint64(w - 1), resetAt: 10 * items}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+func (s *sketch) increment(key uint64) {
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(key, i)]; *c < 15 {
+			*c++
+		}
+	}
+	s.count++
+	if s.count >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *sketch) estimate(key uint64) uint8 {
+	min := uint8(15)
+	for i := range s.rows {
+		if c := s.rows[i][s.index(key, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] /= 2
+		}
+	}
+	s.count /= 2
+}
+
+// index returns the index of key in row i.
+func (s *sketch) index(key uint64, i int) uint64 {
+	h := (key + seeds[i]) * 0x9e3779b97f4a7c15
+	return (h ^ h>>32) & s.mask
+}
+
+var seeds = [4]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+const maxSketchItems = 4096 // the most keys a shard's sketch is sized for
@@ -0,0 +1,157 @@
+// Package cookie implements DNS Cookies as described in RFC 7873. Server cookies are generated
+// as specified in RFC 9018, which allows multiple servers that share a secret to verify each
+// other's cookies.
+package cookie
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	// ClientLen is the length of a client cookie.
+	ClientLen = 8
+	// ServerLen is the length of the server cookies we generate.
+	ServerLen = 16
+	// SecretLen is the length of a server secret.
+	SecretLen = 16
+
+	version = 1
+
+	// A cookie is valid for up to maxAge and may be up to maxSkew in the future, see RFC 9018 Section 4.3.
+	maxAge  = time.Hour
+	maxSkew = 5 * time.Minute
+)
+
+// ErrFormat is returned when a cookie option can not be parsed.
+var ErrFormat = errors.New("malformed cookie")
+
+// Parse parses the hex encoded cookie from a COOKIE option and returns the client and server
+// cookie. The server cookie is nil when only a client cookie is present.
+func Parse(s string) (client, server []byte, err error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, nil, ErrFormat
+	}
+	// A client cookie only is 8 bytes, a server cookie is between 8 and 32 bytes.
+	if len(b) != ClientLen && (len(b) < ClientLen+8 || len(b) > ClientLen+32) {
+		return nil, nil, ErrFormat
+	}
+	if len(b) == ClientLen {
+		return b, nil, nil
+	}
+	return b[:ClientLen], b[ClientLen:], nil
+}
+
+// Secret generates and verifies server cookies.
+type Secret struct {
+	// secrets are the configured secrets, the first one is used to generate new cookies, all of
+	// them are accepted when verifying one.
+	secrets [][SecretLen]byte
+	// rotate is the interval after which a new secret is derived from the configured ones. When
+	// zero the configured secrets are used as is.
+	rotate time.Duration
+}
+
+// NewSecret returns a new Secret using secrets. If rotate is non zero the secret used is derived
+// from the configured secret and the current time, and changes every rotate interval. When secrets
+// is empty a random secret is generated.
+func NewSecret(secrets [][SecretLen]byte, rotate time.Duration) (*Secret, error) {
+	if len(secrets) == 0 {
+		var s [SecretLen]byte
+		if _, err := rand.Read(s[:]); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, s)
+	}
+	return &Secret{secrets: secrets, rotate: rotate}, nil
+}
+
+// Generate returns a new server cookie for client and the client's ip.
+func (s *Secret) Generate(client []byte, ip net.IP, now time.Time) []byte {
+	return serverCookie(s.derive(0, now), client, ip, uint32(now.Unix()))
+}
+
+// Valid returns true if server is a valid server cookie for client and the client's ip.
+func (s *Secret) Valid(client, server []byte, ip net.IP, now time.Time) bool {
+	if len(server) != ServerLen || server[0] != version {
+		return false
+	}
+	ts := time.Unix(int64(binary.BigEndian.Uint32(server[4:8])), 0)
+	if ts.Before(now.Add(-maxAge)) || ts.After(now.Add(maxSkew)) {
+		return false
+	}
+
+	periods := 1
+	if s.rotate > 0 {
+		periods = 2 // also accept cookies generated with the previous secret
+	}
+	for i := range s.secrets {
+		for p := 0; p < periods; p++ {
+			key := s.derive(i, now.Add(-time.Duration(p)*s.rotate))
+			expect := serverCookie(key, client, ip, uint32(ts.Unix()))
+			if hmac.Equal(expect, server) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// derive returns the ith configured secret as in use at now.
+func (s *Secret) derive(i int, now time.Time) [SecretLen]byte {
+	if s.rotate == 0 {
+		return s.secrets[i]
+	}
+	var period [8]byte
+	binary.BigEndian.PutUint64(period[:], uint64(now.UnixNano()/int64(s.rotate)))
+
+	h := hmac.New(sha256.New, s.secrets[i][:])
+	h.Write(period[:])
+
+	var key [SecretLen]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// serverCookie returns the server cookie as specified in RFC 9018 Section 4:
+//
+//	Version (1) | Reserved (3) | Timestamp (4) | Hash (8)
+//
+// where Hash is SipHash-2-4(Client Cookie | Version | Reserved | Timestamp | Client-IP, Secret).
+func serverCookie(key [SecretLen]byte, client []byte, ip net.IP, ts uint32) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	msg := make([]byte, 0, ClientLen+8+net.IPv6len)
+	msg = append(msg, client...)
+	msg = append(msg, version, 0, 0, 0)
+	msg = append(msg, byte(ts>>24), byte(ts>>16), byte(ts>>8), byte(ts))
+	msg = append(msg, ip...)
+
+	cookie := make([]byte, ServerLen)
+	copy(cookie, msg[ClientLen:ClientLen+8])
+	binary.LittleEndian.PutUint64(cookie[8:], sipHash24(key, msg))
+	return cookie
+}
+
+type key struct{}
+
+// NewContext returns a context that records whether the request carried a valid server cookie.
+func NewContext(ctx context.Context, valid bool) context.Context {
+	return context.WithValue(ctx, key{}, valid)
+}
+
+// Valid returns true if the request handled with ctx carried a valid server cookie.
+func Valid(ctx context.Context) bool {
+	valid, _ := ctx.Value(key{}).(bool)
+	return valid
+}
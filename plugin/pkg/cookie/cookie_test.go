@@ -0,0 +1,141 @@
+package cookie
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+func mustSecret(t *testing.T, s string) [SecretLen]byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secret [SecretLen]byte
+	copy(secret[:], b)
+	return secret
+}
+
+// Test vector from RFC 9018, Appendix A.1.
+func TestGenerateRFC9018(t *testing.T) {
+	tests := []struct {
+		client   string
+		ip       string
+		secret   string
+		ts       int64
+		expected string
+	}{
+		{"2464c4abcf10c957", "198.51.100.100", "e5e973e5a6b2a43f48e7dc849e37bfcf", 1559731985, "010000005cf79f111f8130c3eee29480"},
+	}
+
+	for i, tc := range tests {
+		s, _ := NewSecret([][SecretLen]byte{mustSecret(t, tc.secret)}, 0)
+		client, _ := hex.DecodeString(tc.client)
+		now := time.Unix(tc.ts, 0)
+
+		server := s.Generate(client, net.ParseIP(tc.ip), now)
+		if x := hex.EncodeToString(server); x != tc.expected {
+			t.Errorf("Test %d: expected server cookie %s, got %s", i, tc.expected, x)
+		}
+		if !s.Valid(client, server, net.ParseIP(tc.ip), now) {
+			t.Errorf("Test %d: expected server cookie to be valid", i)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	secret := mustSecret(t, "e5e973e5a6b2a43f48e7dc849e37bfcf")
+	other := mustSecret(t, "0102030405060708090a0b0c0d0e0f10")
+	client, _ := hex.DecodeString("2464c4abcf10c957")
+	ip := net.ParseIP("2001:db8:220:1:59de:d0f4:8769:82b8")
+	now := time.Now()
+
+	s, _ := NewSecret([][SecretLen]byte{secret}, 0)
+	server := s.Generate(client, ip, now)
+
+	if s.Valid(client, server, net.ParseIP("2001:db8:220:1:59de:d0f4:8769:82b9"), now) {
+		t.Error("Expected server cookie to be invalid for another client ip")
+	}
+	if s.Valid(client, server, ip, now.Add(2*time.Hour)) {
+		t.Error("Expected server cookie to be invalid after an hour")
+	}
+	if s.Valid(client, server, ip, now.Add(-10*time.Minute)) {
+		t.Error("Expected server cookie from the future to be invalid")
+	}
+
+	// A secret that is rolled out to all servers, while the old one is still accepted.
+	s1, _ := NewSecret([][SecretLen]byte{other, secret}, 0)
+	if !s1.Valid(client, server, ip, now) {
+		t.Error("Expected server cookie to be valid with the secondary secret")
+	}
+	if s2, _ := NewSecret([][SecretLen]byte{other}, 0); s2.Valid(client, server, ip, now) {
+		t.Error("Expected server cookie to be invalid with another secret")
+	}
+}
+
+func TestValidRotate(t *testing.T) {
+	secret := mustSecret(t, "e5e973e5a6b2a43f48e7dc849e37bfcf")
+	client, _ := hex.DecodeString("2464c4abcf10c957")
+	ip := net.ParseIP("198.51.100.100")
+	now := time.Unix(1559731985, 0)
+
+	s, _ := NewSecret([][SecretLen]byte{secret}, 10*time.Minute)
+	s1, _ := NewSecret([][SecretLen]byte{secret}, 10*time.Minute) // another server sharing the secret.
+
+	server := s.Generate(client, ip, now)
+	if !s1.Valid(client, server, ip, now.Add(time.Minute)) {
+		t.Error("Expected server cookie to be valid on another server")
+	}
+	if !s.Valid(client, server, ip, now.Add(10*time.Minute)) {
+		t.Error("Expected server cookie to be valid in the next period")
+	}
+	if s.Valid(client, server, ip, now.Add(30*time.Minute)) {
+		t.Error("Expected server cookie to be invalid after the secret has been rotated twice")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		cookie    string
+		client    string
+		server    string
+		shouldErr bool
+	}{
+		{"2464c4abcf10c957", "2464c4abcf10c957", "", false},
+		{"2464c4abcf10c957010000005cf79f111f8130c3eee29480", "2464c4abcf10c957", "010000005cf79f111f8130c3eee29480", false},
+		{"2464c4abcf10c957", "2464c4abcf10c957", "", false},
+		{"2464c4abcf10c9", "", "", true},
+		{"2464c4abcf10c957010000", "", "", true},
+		{"zz64c4abcf10c957", "", "", true},
+	}
+	for i, tc := range tests {
+		client, server, err := Parse(tc.cookie)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if x := hex.EncodeToString(client); x != tc.client {
+			t.Errorf("Test %d: expected client cookie %s, got %s", i, tc.client, x)
+		}
+		if x := hex.EncodeToString(server); x != tc.server {
+			t.Errorf("Test %d: expected server cookie %s, got %s", i, tc.server, x)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if Valid(context.TODO()) {
+		t.Error("Expected no valid cookie in empty context")
+	}
+	if !Valid(NewContext(context.TODO(), true)) {
+		t.Error("Expected valid cookie in context")
+	}
+}
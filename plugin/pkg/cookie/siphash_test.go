@@ -0,0 +1,18 @@
+package cookie
+
+import "testing"
+
+func TestSipHash24(t *testing.T) {
+	// Test vector from the SipHash paper, Appendix A.
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	msg := make([]byte, 15)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	if h := sipHash24(key, msg); h != 0xa129ca6149be45e5 {
+		t.Errorf("Expected hash %x, got %x", uint64(0xa129ca6149be45e5), h)
+	}
+}
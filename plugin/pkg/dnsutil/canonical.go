@@ -0,0 +1,33 @@
+package dnsutil
+
+import (
+	"bytes"
+
+	"github.com/miekg/dns"
+)
+
+// CanonicalCompare compares a and b in canonical DNS name order (RFC 4034, Section 6.1). The result
+// is negative if a sorts before b, zero if they are equal and positive if a sorts after b.
+func CanonicalCompare(a, b string) int {
+	la, lb := wireLabels(a), wireLabels(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := bytes.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// wireLabels returns the lowercased labels of name, in wire format without the length octets.
+func wireLabels(name string) [][]byte {
+	buf := make([]byte, 256)
+	off, err := dns.PackDomainName(dns.Fqdn(name), buf, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+	labels := [][]byte{}
+	for i := 0; i < off && buf[i] != 0; i += int(buf[i]) + 1 {
+		labels = append(labels, bytes.ToLower(buf[i+1:i+1+int(buf[i])]))
+	}
+	return labels
+}
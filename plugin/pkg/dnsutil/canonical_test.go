@@ -0,0 +1,16 @@
+package dnsutil
+
+import "testing"
+
+func TestCanonicalCompare(t *testing.T) {
+	// RFC 4034, Section 6.1.
+	names := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "\\001.z.example.", "*.z.example.", "\\200.z.example."}
+	for i := 0; i < len(names)-1; i++ {
+		if CanonicalCompare(names[i], names[i+1]) >= 0 {
+			t.Errorf("Expected %s to sort before %s", names[i], names[i+1])
+		}
+	}
+	if CanonicalCompare("Z.a.example.", "z.a.example.") != 0 {
+		t.Errorf("Expected names to compare case insensitively")
+	}
+}
@@ -0,0 +1,4 @@
+package dnsutil
+
+// SerialNewer returns true if serial a is newer than b, using serial number arithmetic (RFC 1982).
+func SerialNewer(a, b uint32) bool { return a != b && a-b < 1<<31 }
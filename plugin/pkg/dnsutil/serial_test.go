@@ -0,0 +1,22 @@
+package dnsutil
+
+import "testing"
+
+func TestSerialNewer(t *testing.T) {
+	tests := []struct {
+		a, b     uint32
+		expected bool
+	}{
+		{2, 1, true},
+		{1, 2, false},
+		{1, 1, false},
+		{0, 4294967295, true},
+		{4294967295, 0, false},
+		{1 << 31, 0, false}, // undefined in RFC 1982, we treat it as not newer
+	}
+	for i, tc := range tests {
+		if got := SerialNewer(tc.a, tc.b); got != tc.expected {
+			t.Errorf("Test %d: expected SerialNewer(%d, %d) to be %t", i, tc.a, tc.b, tc.expected)
+		}
+	}
+}
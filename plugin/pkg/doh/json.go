@@ -0,0 +1,168 @@
+package doh
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// JSONMimeType is the mimetype of the JSON API as implemented by Google and Cloudflare.
+const JSONMimeType = "application/dns-json"
+
+// Response is the JSON representation of a DNS response.
+type Response struct {
+	Status           int        `json:"Status"`
+	TC               bool       `json:"TC"`
+	RD               bool       `json:"RD"`
+	RA               bool       `json:"RA"`
+	AD               bool       `json:"AD"`
+	CD               bool       `json:"CD"`
+	Question         []Question `json:"Question"`
+	Answer           []RR       `json:"Answer,omitempty"`
+	Authority        []RR       `json:"Authority,omitempty"`
+	Additional       []RR       `json:"Additional,omitempty"`
+	EDNSClientSubnet string     `json:"edns_client_subnet,omitempty"`
+	Comment          string     `json:"Comment,omitempty"`
+}
+
+// Question is the JSON representation of a question.
+type Question struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+// RR is the JSON representation of a resource record.
+type RR struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// IsJSONRequest returns true if req is a request for the JSON API: a GET request with a 'name'
+// query parameter.
+func IsJSONRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	values := req.URL.Query()
+	_, name := values["name"]
+	_, wire := values["dns"]
+	return name && !wire
+}
+
+// JSONRequestToMsg converts a JSON API request to a dns message. The parameters 'name' and 'type'
+// make up the question, 'do' and 'cd' set the respective bits and 'edns_client_subnet' adds an EDNS0
+// Client Subnet option.
+func JSONRequestToMsg(req *http.Request) (*dns.Msg, error) {
+	values := req.URL.Query()
+
+	name := values.Get("name")
+	if len(name) == 0 || len(name) > 253 {
+		return nil, fmt.Errorf("invalid 'name' query parameter: %q", name)
+	}
+	if _, ok := dns.IsDomainName(name); !ok {
+		return nil, fmt.Errorf("invalid 'name' query parameter: %q", name)
+	}
+
+	qtype := dns.TypeA
+	if t := values.Get("type"); t != "" {
+		if n, err := strconv.ParseUint(t, 10, 16); err == nil {
+			qtype = uint16(n)
+		} else if n, ok := dns.StringToType[strings.ToUpper(t)]; ok {
+			qtype = n
+		} else {
+			return nil, fmt.Errorf("invalid 'type' query parameter: %q", t)
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.CheckingDisabled = isTrue(values.Get("cd"))
+
+	do := isTrue(values.Get("do"))
+	ecs := values.Get("edns_client_subnet")
+	if !do && ecs == "" {
+		return m, nil
+	}
+
+	m.SetEdns0(dns.DefaultMsgSize, do)
+	if ecs != "" {
+		subnet, err := clientSubnet(ecs)
+		if err != nil {
+			return nil, err
+		}
+		o := m.IsEdns0()
+		o.Option = append(o.Option, subnet)
+	}
+	return m, nil
+}
+
+// clientSubnet parses s, an IP address with an optional prefix length, as an EDNS0 Client Subnet option.
+func clientSubnet(s string) (*dns.EDNS0_SUBNET, error) {
+	if !strings.Contains(s, "/") {
+		if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+			s += "/32"
+		} else {
+			s += "/128"
+		}
+	}
+	ip, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'edns_client_subnet' query parameter: %q", s)
+	}
+	ones, _ := ipnet.Mask.Size()
+
+	e := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, SourceNetmask: uint8(ones), Address: ipnet.IP}
+	e.Family = 1
+	if ip.To4() == nil {
+		e.Family = 2
+	}
+	return e, nil
+}
+
+// MsgToJSON converts the dns message m to its JSON representation.
+func MsgToJSON(m *dns.Msg) *Response {
+	r := &Response{
+		Status:   m.Rcode,
+		TC:       m.Truncated,
+		RD:       m.RecursionDesired,
+		RA:       m.RecursionAvailable,
+		AD:       m.AuthenticatedData,
+		CD:       m.CheckingDisabled,
+		Question: make([]Question, 0, len(m.Question)),
+	}
+	for _, q := range m.Question {
+		r.Question = append(r.Question, Question{Name: q.Name, Type: q.Qtype})
+	}
+	r.Answer = toRRs(m.Answer)
+	r.Authority = toRRs(m.Ns)
+	r.Additional = toRRs(m.Extra)
+
+	if o := m.IsEdns0(); o != nil {
+		for _, e := range o.Option {
+			if subnet, ok := e.(*dns.EDNS0_SUBNET); ok {
+				r.EDNSClientSubnet = subnet.Address.String() + "/" + strconv.Itoa(int(subnet.SourceScope))
+			}
+		}
+	}
+	return r
+}
+
+func toRRs(rrs []dns.RR) []RR {
+	var ret []RR
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeOPT {
+			continue
+		}
+		ret = append(ret, RR{Name: h.Name, Type: h.Rrtype, TTL: h.Ttl, Data: strings.TrimPrefix(rr.String(), h.String())})
+	}
+	return ret
+}
+
+func isTrue(s string) bool { return s == "1" || strings.ToLower(s) == "true" }
@@ -0,0 +1,125 @@
+package doh
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestIsJSONRequest(t *testing.T) {
+	tests := []struct {
+		method   string
+		url      string
+		expected bool
+	}{
+		{http.MethodGet, "https://example.org/dns-query?name=example.org", true},
+		{http.MethodGet, "https://example.org/dns-query?name=example.org&type=AAAA", true},
+		{http.MethodGet, "https://example.org/dns-query?dns=AAABAAABAAAAAAAAB2V4YW1wbGUDb3JnAAABAAE", false},
+		{http.MethodGet, "https://example.org/dns-query?type=A", false},
+		{http.MethodPost, "https://example.org/dns-query?name=example.org", false},
+	}
+	for i, tc := range tests {
+		req, _ := http.NewRequest(tc.method, tc.url, nil)
+		if got := IsJSONRequest(req); got != tc.expected {
+			t.Errorf("Test %d: expected %t, got %t", i, tc.expected, got)
+		}
+	}
+}
+
+func TestJSONRequestToMsg(t *testing.T) {
+	tests := []struct {
+		query     string
+		shouldErr bool
+		qname     string
+		qtype     uint16
+		do        bool
+		cd        bool
+		ecs       string
+	}{
+		{"name=example.org", false, "example.org.", dns.TypeA, false, false, ""},
+		{"name=example.org.&type=AAAA", false, "example.org.", dns.TypeAAAA, false, false, ""},
+		{"name=example.org&type=mx", false, "example.org.", dns.TypeMX, false, false, ""},
+		{"name=example.org&type=48", false, "example.org.", dns.TypeDNSKEY, false, false, ""},
+		{"name=example.org&do=1&cd=true", false, "example.org.", dns.TypeA, true, true, ""},
+		{"name=example.org&do=false&cd=0", false, "example.org.", dns.TypeA, false, false, ""},
+		{"name=example.org&edns_client_subnet=192.0.2.0/24", false, "example.org.", dns.TypeA, false, false, "192.0.2.0/24/0"},
+		{"name=example.org&edns_client_subnet=192.0.2.1", false, "example.org.", dns.TypeA, false, false, "192.0.2.1/32/0"},
+		{"name=example.org&edns_client_subnet=2001:db8::/56", false, "example.org.", dns.TypeA, false, false, "[2001:db8::]/56/0"},
+		{"name=", true, "", 0, false, false, ""},
+		{"name=example..org", true, "", 0, false, false, ""},
+		{"name=example.org&type=BLAH", true, "", 0, false, false, ""},
+		{"name=example.org&type=65536", true, "", 0, false, false, ""},
+		{"name=example.org&edns_client_subnet=blah", true, "", 0, false, false, ""},
+	}
+
+	for i, tc := range tests {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.org/dns-query?"+tc.query, nil)
+		m, err := JSONRequestToMsg(req)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if x := m.Question[0].Name; x != tc.qname {
+			t.Errorf("Test %d: expected qname %s, got %s", i, tc.qname, x)
+		}
+		if x := m.Question[0].Qtype; x != tc.qtype {
+			t.Errorf("Test %d: expected qtype %d, got %d", i, tc.qtype, x)
+		}
+		if !m.RecursionDesired {
+			t.Errorf("Test %d: expected RD to be set", i)
+		}
+		if m.CheckingDisabled != tc.cd {
+			t.Errorf("Test %d: expected CD %t, got %t", i, tc.cd, m.CheckingDisabled)
+		}
+		opt := m.IsEdns0()
+		if (opt != nil && opt.Do()) != tc.do {
+			t.Errorf("Test %d: expected DO %t", i, tc.do)
+		}
+		ecs := ""
+		if opt != nil {
+			for _, o := range opt.Option {
+				if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+					ecs = e.String()
+				}
+			}
+		}
+		if ecs != tc.ecs {
+			t.Errorf("Test %d: expected client subnet %q, got %q", i, tc.ecs, ecs)
+		}
+	}
+}
+
+func TestMsgToJSON(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.Response, m.RecursionAvailable, m.AuthenticatedData = true, true, true
+	m.Answer = []dns.RR{test.A("example.org. 300 IN A 192.0.2.1")}
+	m.Ns = []dns.RR{test.NS("example.org. 3600 IN NS ns.example.org.")}
+	m.SetEdns0(4096, false)
+
+	r := MsgToJSON(m)
+	if r.Status != dns.RcodeSuccess || !r.RD || !r.RA || !r.AD || r.TC || r.CD {
+		t.Errorf("Unexpected header in %+v", r)
+	}
+	if len(r.Question) != 1 || r.Question[0] != (Question{Name: "example.org.", Type: dns.TypeA}) {
+		t.Errorf("Unexpected question %+v", r.Question)
+	}
+	if len(r.Answer) != 1 || r.Answer[0] != (RR{Name: "example.org.", Type: dns.TypeA, TTL: 300, Data: "192.0.2.1"}) {
+		t.Errorf("Unexpected answer %+v", r.Answer)
+	}
+	if len(r.Authority) != 1 || r.Authority[0].Data != "ns.example.org." {
+		t.Errorf("Unexpected authority %+v", r.Authority)
+	}
+	if len(r.Additional) != 0 {
+		t.Errorf("Expected OPT record to be left out, got %+v", r.Additional)
+	}
+}
@@ -0,0 +1,47 @@
+package parse
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Nets parses addresses in CIDR notation (e.g. 10.0.0.0/8) or plain IP addresses into networks. The
+// special wildcard '*' means any address.
+func Nets(args []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, a := range args {
+		if a == "*" {
+			_, v4, _ := net.ParseCIDR("0.0.0.0/0")
+			_, v6, _ := net.ParseCIDR("::/0")
+			nets = append(nets, v4, v6)
+			continue
+		}
+		n, err := Net(a)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Net parses an address in CIDR notation (e.g. 10.0.0.0/8) or a plain IP address into a network.
+func Net(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("not an IP address or network: %q", s)
+		}
+		if ip.To4() != nil {
+			s += "/32"
+		} else {
+			s += "/128"
+		}
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("not an IP address or network: %q", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,60 @@
+package parse
+
+import "testing"
+
+func TestNets(t *testing.T) {
+	tests := []struct {
+		args      []string
+		shouldErr bool
+		expected  []string
+	}{
+		{[]string{"10.0.0.0/8"}, false, []string{"10.0.0.0/8"}},
+		{[]string{"10.0.0.1", "2001:db8::1"}, false, []string{"10.0.0.1/32", "2001:db8::1/128"}},
+		{[]string{"*"}, false, []string{"0.0.0.0/0", "::/0"}},
+		{[]string{"10.0.0.0/33"}, true, nil},
+		{[]string{"example.org"}, true, nil},
+	}
+
+	for i, test := range tests {
+		nets, err := Nets(test.args)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if len(nets) != len(test.expected) {
+			t.Errorf("Test %d: expected %d networks, got %d", i, len(test.expected), len(nets))
+			continue
+		}
+		for j, n := range nets {
+			if n.String() != test.expected[j] {
+				t.Errorf("Test %d: expected network %s, got %s", i, test.expected[j], n)
+			}
+		}
+	}
+}
+
+func TestNet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"2001:db8::1", "2001:db8::1/128"},
+	}
+	for i, test := range tests {
+		n, err := Net(test.input)
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if n.String() != test.expected {
+			t.Errorf("Test %d: expected %s, got %s", i, test.expected, n)
+		}
+	}
+}
@@ -3,26 +3,32 @@ package parse
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/coredns/coredns/plugin/pkg/transport"
 
 	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
 )
 
-// Transfer parses transfer statements: 'transfer [to|from] [address...]'.
-func Transfer(c *caddy.Controller, secondary bool) (tos, froms []string, err error) {
+// Transfer parses transfer statements: 'transfer [to|from] [address...] [key NAME]'. The name of
+// the TSIG key, if given, is returned in key.
+func Transfer(c *caddy.Controller, secondary bool) (tos, froms []string, key string, err error) {
 	if !c.NextArg() {
-		return nil, nil, c.ArgErr()
+		return nil, nil, "", c.ArgErr()
 	}
 	value := c.Val()
 	switch value {
 	case "to":
-		tos = c.RemainingArgs()
+		tos, key, err = Key(c.RemainingArgs())
+		if err != nil {
+			return nil, nil, "", err
+		}
 		for i := range tos {
 			if tos[i] != "*" {
 				normalized, err := HostPort(tos[i], transport.Port)
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, "", err
 				}
 				tos[i] = normalized
 			}
@@ -30,20 +36,41 @@ func Transfer(c *caddy.Controller, secondary bool) (tos, froms []string, err err
 
 	case "from":
 		if !secondary {
-			return nil, nil, fmt.Errorf("can't use `transfer from` when not being a secondary")
+			return nil, nil, "", fmt.Errorf("can't use `transfer from` when not being a secondary")
+		}
+		froms, key, err = Key(c.RemainingArgs())
+		if err != nil {
+			return nil, nil, "", err
 		}
-		froms = c.RemainingArgs()
 		for i := range froms {
 			if froms[i] != "*" {
 				normalized, err := HostPort(froms[i], transport.Port)
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, "", err
 				}
 				froms[i] = normalized
 			} else {
-				return nil, nil, fmt.Errorf("can't use '*' in transfer from")
+				return nil, nil, "", fmt.Errorf("can't use '*' in transfer from")
 			}
 		}
 	}
 	return
 }
+
+// Key splits off a trailing 'key NAME' from args. The key name is returned fully qualified and
+// lowercased, or empty if args don't end with a key.
+func Key(args []string) (rest []string, key string, err error) {
+	for i, a := range args {
+		if a != "key" {
+			continue
+		}
+		if i != len(args)-2 {
+			return nil, "", fmt.Errorf("'key' must be followed by exactly one key name")
+		}
+		if i == 0 {
+			return nil, "", fmt.Errorf("no addresses given before 'key'")
+		}
+		return args[:i], dns.Fqdn(strings.ToLower(args[i+1])), nil
+	}
+	return args, "", nil
+}
@@ -64,7 +64,7 @@ func TestTransfer(t *testing.T) {
 
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.inputFileRules)
-		tos, froms, err := Transfer(c, test.secondary)
+		tos, froms, _, err := Transfer(c, test.secondary)
 
 		if err == nil && test.shouldErr {
 			t.Fatalf("Test %d expected errors, but got no error %+v %+v", i, err, test)
@@ -90,3 +90,52 @@ func TestTransfer(t *testing.T) {
 	}
 
 }
+
+func TestTransferKey(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		secondary bool
+		addrs     []string
+		key       string
+	}{
+		{`to 127.0.0.1 key xfr.Example.org`, false, false, []string{"127.0.0.1:53"}, "xfr.example.org."},
+		{`to * key xfr.example.org.`, false, false, []string{"*"}, "xfr.example.org."},
+		{`from 127.0.0.1 127.0.0.2 key xfr.example.org.`, false, true, []string{"127.0.0.1:53", "127.0.0.2:53"}, "xfr.example.org."},
+		{`to 127.0.0.1`, false, false, []string{"127.0.0.1:53"}, ""},
+		{`to 127.0.0.1 key`, true, false, nil, ""},
+		{`to 127.0.0.1 key a. b.`, true, false, nil, ""},
+		{`to key xfr.example.org.`, true, false, nil, ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		tos, froms, key, err := Transfer(c, test.secondary)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		addrs := tos
+		if test.secondary {
+			addrs = froms
+		}
+		if len(addrs) != len(test.addrs) {
+			t.Errorf("Test %d: expected %v, got %v", i, test.addrs, addrs)
+			continue
+		}
+		for j := range addrs {
+			if addrs[j] != test.addrs[j] {
+				t.Errorf("Test %d: expected %v, got %v", i, test.addrs, addrs)
+			}
+		}
+		if key != test.key {
+			t.Errorf("Test %d: expected key %q, got %q", i, test.key, key)
+		}
+	}
+}
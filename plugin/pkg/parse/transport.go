@@ -27,6 +27,14 @@ func Transport(s string) (trans string, addr string) {
 		s = s[len(transport.HTTPS+"://"):]
 
 		return transport.HTTPS, s
+
+	case strings.HasPrefix(s, transport.HTTP+"://"):
+		s = s[len(transport.HTTP+"://"):]
+		return transport.HTTP, s
+
+	case strings.HasPrefix(s, transport.QUIC+"://"):
+		s = s[len(transport.QUIC+"://"):]
+		return transport.QUIC, s
 	}
 
 	return transport.DNS, s
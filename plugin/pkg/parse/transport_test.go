@@ -16,6 +16,8 @@ func TestTransport(t *testing.T) {
 		{"grpc://example.org:1443 ", transport.GRPC},
 		{"tls://example.org ", transport.TLS},
 		{"https://example.org ", transport.HTTPS},
+		{"quic://example.org ", transport.QUIC},
+		{"http://example.org ", transport.HTTP},
 	} {
 		actual, _ := Transport(test.input)
 		if actual != test.expected {
@@ -0,0 +1,99 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// Listener wraps a net.Listener. Connections from trusted sources may start with a PROXY protocol
+// header, the address in it is then returned as the connection's remote address.
+type Listener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+// NewListener returns a Listener that accepts PROXY protocol headers from the trusted networks.
+func NewListener(l net.Listener, trusted []*net.IPNet) *Listener {
+	return &Listener{Listener: l, trusted: trusted}
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !Trusted(c.RemoteAddr(), l.trusted) {
+		return c, nil
+	}
+	return &Conn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+// Conn is a net.Conn that reads the PROXY protocol header, if any, when it is first read from or
+// its remote address is asked for. Reading the header is done lazily, so a slow client doesn't
+// hold up the accept loop.
+type Conn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+// readHeader reads the header once. When called from Read, the read deadline set by the caller
+// applies, otherwise we set our own.
+func (c *Conn) readHeader(deadline bool) {
+	c.once.Do(func() {
+		if deadline {
+			c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.remote, c.err = Read(c.r)
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader(false)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr implements net.Conn. It returns the address from the PROXY protocol header, or the
+// address of the peer if there is none.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader(true)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// Trusted returns true if the IP address of addr is in one of the trusted networks.
+func Trusted(addr net.Addr, trusted []*net.IPNet) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+const headerTimeout = 5 * time.Second
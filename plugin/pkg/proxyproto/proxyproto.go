@@ -0,0 +1,171 @@
+// Package proxyproto implements the receiving side of the HAProxy PROXY protocol, version 1 and 2,
+// see https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	// v1 headers start with this.
+	v1Prefix = []byte("PROXY ")
+	// v2 headers start with this signature.
+	v2Signature = []byte("\x0D\x0A\x0D\x0A\x00\x0D\x0A\x51\x55\x49\x54\x0A")
+)
+
+const (
+	v1MaxLen     = 107
+	v2HeaderLen  = 16
+	v2CmdLocal   = 0x0
+	v2CmdProxy   = 0x1
+	v2Version    = 0x2
+	v2FamInet    = 0x1
+	v2FamInet6   = 0x2
+	v2ProtoDgram = 0x2
+)
+
+// ErrInvalid is returned when a PROXY protocol header can't be parsed.
+var ErrInvalid = errors.New("invalid PROXY protocol header")
+
+// Read reads a PROXY protocol header (v1 or v2) from r and returns the source address it carries.
+// If the data in r does not start with a header, nothing is consumed and nil is returned. The
+// address is also nil for headers that don't carry one, i.e. v1 UNKNOWN and v2 LOCAL.
+func Read(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(len(v1Prefix))
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if bytes.Equal(b, v1Prefix) {
+		return readV1(r)
+	}
+
+	b, err = r.Peek(len(v2Signature))
+	if err != nil || !bytes.Equal(b, v2Signature) {
+		// Not a header, including short reads that can't be one.
+		return nil, nil
+	}
+	h, err := r.Peek(v2HeaderLen)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	l := int(binary.BigEndian.Uint16(h[14:16]))
+	buf := make([]byte, v2HeaderLen+l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, ErrInvalid
+	}
+	return parseV2(buf)
+}
+
+// ReadPacket parses the PROXY protocol v2 header at the start of the datagram b. It returns the
+// source address and the payload. If b does not start with a header, it returns nil and b.
+func ReadPacket(b []byte) (net.Addr, []byte, error) {
+	if !bytes.HasPrefix(b, v2Signature) {
+		return nil, b, nil
+	}
+	if len(b) < v2HeaderLen {
+		return nil, nil, ErrInvalid
+	}
+	l := v2HeaderLen + int(binary.BigEndian.Uint16(b[14:16]))
+	if len(b) < l {
+		return nil, nil, ErrInvalid
+	}
+	addr, err := parseV2(b[:l])
+	if err != nil {
+		return nil, nil, err
+	}
+	return addr, b[l:], nil
+}
+
+// readV1 reads a header like "PROXY TCP4 192.0.2.1 192.0.2.2 56324 53\r\n".
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalid
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return nil, ErrInvalid
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, ErrInvalid
+	}
+	if len(fields) != 6 {
+		return nil, ErrInvalid
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, ErrInvalid
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// parseV2 parses the complete v2 header in b.
+func parseV2(b []byte) (net.Addr, error) {
+	if b[12]>>4 != v2Version {
+		return nil, ErrInvalid
+	}
+	switch b[12] & 0xF {
+	case v2CmdLocal:
+		return nil, nil
+	case v2CmdProxy:
+	default:
+		return nil, ErrInvalid
+	}
+
+	fam, proto := b[13]>>4, b[13]&0xF
+	addrs := b[v2HeaderLen:]
+
+	var ip net.IP
+	var port int
+	switch fam {
+	case v2FamInet:
+		if len(addrs) < 12 {
+			return nil, ErrInvalid
+		}
+		ip = net.IP(append([]byte(nil), addrs[:4]...))
+		port = int(binary.BigEndian.Uint16(addrs[8:10]))
+	case v2FamInet6:
+		if len(addrs) < 36 {
+			return nil, ErrInvalid
+		}
+		ip = net.IP(append([]byte(nil), addrs[:16]...))
+		port = int(binary.BigEndian.Uint16(addrs[32:34]))
+	default:
+		// AF_UNSPEC or AF_UNIX, nothing we can use.
+		return nil, nil
+	}
+
+	if proto == v2ProtoDgram {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
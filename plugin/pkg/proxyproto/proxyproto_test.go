@@ -0,0 +1,165 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// v2Header returns a v2 PROXY header for src and dst, proto is 0x1 (stream) or 0x2 (datagram).
+func v2Header(cmd byte, src, dst net.IP, sport, dport uint16, proto byte) []byte {
+	fam := byte(v2FamInet)
+	if src.To4() == nil {
+		fam = v2FamInet6
+	} else {
+		src, dst = src.To4(), dst.To4()
+	}
+	addrs := append(append([]byte{}, src...), dst...)
+	addrs = binary.BigEndian.AppendUint16(addrs, sport)
+	addrs = binary.BigEndian.AppendUint16(addrs, dport)
+
+	h := append([]byte{}, v2Signature...)
+	h = append(h, v2Version<<4|cmd, fam<<4|proto)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(addrs)))
+	return append(h, addrs...)
+}
+
+func TestRead(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	dst := net.ParseIP("192.0.2.2")
+
+	tests := []struct {
+		data      []byte
+		addr      string // "" for no address
+		shouldErr bool
+		rest      string
+	}{
+		{[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 53\r\nrest"), "192.0.2.1:56324", false, "rest"},
+		{[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 53\r\nrest"), "[2001:db8::1]:56324", false, "rest"},
+		{[]byte("PROXY UNKNOWN\r\nrest"), "", false, "rest"},
+		{append(v2Header(v2CmdProxy, v4, dst, 56324, 53, 0x1), "rest"...), "192.0.2.1:56324", false, "rest"},
+		{append(v2Header(v2CmdProxy, v6, net.ParseIP("2001:db8::2"), 56324, 53, 0x1), "rest"...), "[2001:db8::1]:56324", false, "rest"},
+		{append(v2Header(v2CmdLocal, v4, dst, 56324, 53, 0x1), "rest"...), "", false, "rest"},
+		// no header
+		{[]byte("\x00\x1d\x12\x34\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00"), "", false, "\x00\x1d\x12\x34\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00"},
+		{[]byte("abc"), "", false, "abc"},
+		// invalid
+		{[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324\r\n"), "", true, ""},
+		{[]byte("PROXY TCP4 2001:db8::1 192.0.2.2 56324 53\r\n"), "", true, ""},
+		{[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 99999 53\r\n"), "", true, ""},
+		{[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 53\n"), "", true, ""},
+		{[]byte("PROXY UDP4 192.0.2.1 192.0.2.2 56324 53\r\n"), "", true, ""},
+		{[]byte("PROXY " + strings.Repeat("A", 200)), "", true, ""},
+		{v2Header(v2CmdProxy, v4, dst, 56324, 53, 0x1)[:20], "", true, ""},
+	}
+
+	for i, tc := range tests {
+		r := bufio.NewReader(bytes.NewReader(tc.data))
+		addr, err := Read(r)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if got := addrString(addr); got != tc.addr {
+			t.Errorf("Test %d: expected address %q, got %q", i, tc.addr, got)
+		}
+		rest, _ := io.ReadAll(r)
+		if string(rest) != tc.rest {
+			t.Errorf("Test %d: expected remaining data %q, got %q", i, tc.rest, rest)
+		}
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	src, dst := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+
+	h := v2Header(v2CmdProxy, src, dst, 56324, 53, v2ProtoDgram)
+	addr, payload, err := ReadPacket(append(h, "query"...))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if _, ok := addr.(*net.UDPAddr); !ok {
+		t.Errorf("Expected *net.UDPAddr, got %T", addr)
+	}
+	if addrString(addr) != "192.0.2.1:56324" {
+		t.Errorf("Expected address 192.0.2.1:56324, got %s", addr)
+	}
+	if string(payload) != "query" {
+		t.Errorf("Expected payload %q, got %q", "query", payload)
+	}
+
+	addr, payload, err = ReadPacket([]byte("query"))
+	if err != nil || addr != nil || string(payload) != "query" {
+		t.Errorf("Expected datagram without header to be returned as is, got %v, %q, %v", addr, payload, err)
+	}
+
+	if _, _, err := ReadPacket(h[:len(h)-1]); err != ErrInvalid {
+		t.Errorf("Expected %s for truncated header, got %v", ErrInvalid, err)
+	}
+}
+
+func TestListener(t *testing.T) {
+	for _, trusted := range []bool{true, false} {
+		var nets []*net.IPNet
+		if trusted {
+			_, n, _ := net.ParseCIDR("127.0.0.0/8")
+			nets = append(nets, n)
+		}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %s", err)
+		}
+		pl := NewListener(l, nets)
+
+		go func() {
+			c, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			c.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 53\r\nhello"))
+		}()
+
+		c, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("Failed to accept: %s", err)
+		}
+		remote := c.RemoteAddr().String()
+		data, _ := io.ReadAll(c)
+		c.Close()
+		pl.Close()
+
+		if trusted {
+			if remote != "192.0.2.1:56324" {
+				t.Errorf("Expected remote address 192.0.2.1:56324, got %s", remote)
+			}
+			if string(data) != "hello" {
+				t.Errorf("Expected data %q, got %q", "hello", data)
+			}
+			continue
+		}
+		if strings.HasPrefix(remote, "192.0.2.1") {
+			t.Errorf("Expected header from untrusted source to be ignored, got remote address %s", remote)
+		}
+		if !strings.HasPrefix(string(data), "PROXY") {
+			t.Errorf("Expected header from untrusted source to be passed on, got %q", data)
+		}
+	}
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
@@ -6,6 +6,8 @@ const (
 	TLS   = "tls"
 	GRPC  = "grpc"
 	HTTPS = "https"
+	HTTP  = "http"
+	QUIC  = "quic"
 )
 
 // Port numbers for the various transports.
@@ -18,4 +20,8 @@ const (
 	GRPCPort = "443"
 	// HTTPSPort is the default port for DNS-over-HTTPS.
 	HTTPSPort = "443"
+	// HTTPPort is the default port for DNS-over-HTTPS served over cleartext HTTP.
+	HTTPPort = "80"
+	// QUICPort is the default port for DNS-over-QUIC.
+	QUICPort = "853"
 )
@@ -0,0 +1,87 @@
+// Package tsig holds the TSIG keys (RFC 8945) that are declared for a server block and the functions
+// plugins use to check and sign messages with them.
+package tsig
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Key is a named TSIG key.
+type Key struct {
+	Name      string // fully qualified and lowercase
+	Algorithm string // one of the dns.Hmac* algorithms
+	Secret    string // base64 encoded
+}
+
+// NewKey returns the key name, using algorithm and secret. An empty algorithm defaults to
+// hmac-sha256.
+func NewKey(name, algorithm, secret string) (Key, error) {
+	k := Key{Name: dns.Fqdn(strings.ToLower(name)), Algorithm: dns.HmacSHA256, Secret: secret}
+	if _, ok := dns.IsDomainName(k.Name); !ok {
+		return Key{}, fmt.Errorf("invalid TSIG key name: %q", name)
+	}
+	if algorithm != "" {
+		alg, ok := algorithms[dns.Fqdn(strings.ToLower(algorithm))]
+		if !ok {
+			return Key{}, fmt.Errorf("unsupported TSIG algorithm: %q", algorithm)
+		}
+		k.Algorithm = alg
+	}
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil || secret == "" {
+		return Key{}, fmt.Errorf("invalid secret for TSIG key %q: not base64", k.Name)
+	}
+	return k, nil
+}
+
+// Keys are TSIG keys keyed by their name.
+type Keys map[string]Key
+
+// Get returns the key name, which must have been declared.
+func (k Keys) Get(name string) (Key, error) {
+	key, ok := k[name]
+	if !ok {
+		return Key{}, fmt.Errorf("TSIG key %q is not declared in the tsig plugin", name)
+	}
+	return key, nil
+}
+
+// Secrets returns the secrets of the keys in the form the dns package uses, keyed by key name.
+func (k Keys) Secrets() map[string]string {
+	s := make(map[string]string, len(k))
+	for name, key := range k {
+		s[name] = key.Secret
+	}
+	return s
+}
+
+// Sign adds a TSIG record for key to m. The signature itself is calculated when m is written by
+// a dns.Client or dns.Transfer that has the secret of key.
+func Sign(m *dns.Msg, key Key) *dns.Msg {
+	return m.SetTsig(key.Name, key.Algorithm, Fudge, time.Now().Unix())
+}
+
+// Verified returns true if the request r, received on w, is signed with key and its signature is
+// valid.
+func Verified(w dns.ResponseWriter, r *dns.Msg, key Key) bool {
+	t := r.IsTsig()
+	if t == nil || !strings.EqualFold(t.Hdr.Name, key.Name) || !strings.EqualFold(t.Algorithm, key.Algorithm) {
+		return false
+	}
+	return w.TsigStatus() == nil
+}
+
+// Fudge is the number of seconds the time signed of a message may differ from our clock.
+const Fudge = 300
+
+var algorithms = map[string]string{
+	"hmac-md5.":    dns.HmacMD5,
+	dns.HmacMD5:    dns.HmacMD5,
+	dns.HmacSHA1:   dns.HmacSHA1,
+	dns.HmacSHA256: dns.HmacSHA256,
+	dns.HmacSHA512: dns.HmacSHA512,
+}
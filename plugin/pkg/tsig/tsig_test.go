@@ -0,0 +1,63 @@
+package tsig
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestNewKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		secret    string
+		expected  Key
+		shouldErr bool
+	}{
+		{"Key.Example.org", "", "c2VjcmV0", Key{"key.example.org.", dns.HmacSHA256, "c2VjcmV0"}, false},
+		{"key.", "hmac-sha512", "c2VjcmV0", Key{"key.", dns.HmacSHA512, "c2VjcmV0"}, false},
+		{"key.", "HMAC-MD5", "c2VjcmV0", Key{"key.", dns.HmacMD5, "c2VjcmV0"}, false},
+		{"key.", "hmac-sha3", "c2VjcmV0", Key{}, true},
+		{"key.", "", "not base64!", Key{}, true},
+		{"key.", "", "", Key{}, true},
+	}
+	for i, tc := range tests {
+		k, err := NewKey(tc.name, tc.algorithm, tc.secret)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if k != tc.expected {
+			t.Errorf("Test %d: expected %v, got %v", i, tc.expected, k)
+		}
+	}
+}
+
+func TestVerified(t *testing.T) {
+	key := Key{"key.", dns.HmacSHA256, "c2VjcmV0"}
+	w := &test.ResponseWriter{}
+
+	m := new(dns.Msg)
+	m.SetAxfr("example.org.")
+	if Verified(w, m, key) {
+		t.Errorf("Expected unsigned message not to be verified")
+	}
+	Sign(m, key)
+	if !Verified(w, m, key) {
+		t.Errorf("Expected signed message to be verified")
+	}
+	if Verified(w, m, Key{"other.", dns.HmacSHA256, "c2VjcmV0"}) {
+		t.Errorf("Expected message signed with another key not to be verified")
+	}
+	if Verified(w, m, Key{"key.", dns.HmacSHA512, "c2VjcmV0"}) {
+		t.Errorf("Expected message signed with another algorithm not to be verified")
+	}
+}
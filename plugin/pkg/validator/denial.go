@@ -0,0 +1,246 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+
+	"github.com/miekg/dns"
+)
+
+// denial checks that the NSEC or NSEC3 records in ns, which are validated, prove that name has no
+// RRset of type t, or doesn't exist at all for a name error.
+func denial(name string, t uint16, nxdomain bool, ns []dns.RR) (Result, error) {
+	nsecs, nsec3s := denialRecords(ns)
+	switch {
+	case len(nsecs) > 0:
+		return nsecDenial(name, t, nxdomain, nsecs)
+	case len(nsec3s) > 0:
+		return nsec3Denial(name, t, nxdomain, nsec3s)
+	}
+	return Bogus, fmt.Errorf("no NSEC or NSEC3 records for %s", name)
+}
+
+func nsecDenial(name string, t uint16, nxdomain bool, nsecs []*dns.NSEC) (Result, error) {
+	if !nxdomain {
+		for _, n := range nsecs {
+			if !strings.EqualFold(n.Hdr.Name, name) {
+				continue
+			}
+			if hasBit(n.TypeBitMap, t) || hasBit(n.TypeBitMap, dns.TypeCNAME) {
+				return Bogus, fmt.Errorf("NSEC at %s has type %s", name, dns.TypeToString[t])
+			}
+			// The NSEC of a delegation, from the parent side, only says something about DS.
+			if t != dns.TypeDS && hasBit(n.TypeBitMap, dns.TypeNS) && !hasBit(n.TypeBitMap, dns.TypeSOA) {
+				return Bogus, fmt.Errorf("NSEC at %s is from the parent zone", name)
+			}
+			return Secure, nil
+		}
+	}
+
+	// The name doesn't exist: an NSEC must cover it, and another the wildcard at the closest encloser.
+	cover := nsecCovering(nsecs, name)
+	if cover == nil {
+		return Bogus, fmt.Errorf("no NSEC covers %s", name)
+	}
+	ce := nsecClosestEncloser(name, cover)
+	wildcard := "*." + ce
+	if ce == "." {
+		wildcard = "*."
+	}
+	if nsecCovering(nsecs, wildcard) != nil {
+		return Secure, nil
+	}
+	if nxdomain {
+		return Bogus, fmt.Errorf("no NSEC covers %s", wildcard)
+	}
+	// No data for a name expanded from the wildcard.
+	for _, n := range nsecs {
+		if strings.EqualFold(n.Hdr.Name, wildcard) && !hasBit(n.TypeBitMap, t) && !hasBit(n.TypeBitMap, dns.TypeCNAME) {
+			return Secure, nil
+		}
+	}
+	return Bogus, fmt.Errorf("no NSEC proves %s %s doesn't exist", name, dns.TypeToString[t])
+}
+
+func nsec3Denial(name string, t uint16, nxdomain bool, nsec3s []*dns.NSEC3) (Result, error) {
+	for _, n := range nsec3s {
+		// Validators treat zones using more iterations as insecure (RFC 9276, Section 3.2).
+		if n.Iterations > maxIterations {
+			return Insecure, nil
+		}
+	}
+
+	if !nxdomain {
+		if n := nsec3Matching(nsec3s, name); n != nil {
+			if hasBit(n.TypeBitMap, t) || hasBit(n.TypeBitMap, dns.TypeCNAME) {
+				return Bogus, fmt.Errorf("NSEC3 for %s has type %s", name, dns.TypeToString[t])
+			}
+			if t != dns.TypeDS && hasBit(n.TypeBitMap, dns.TypeNS) && !hasBit(n.TypeBitMap, dns.TypeSOA) {
+				return Bogus, fmt.Errorf("NSEC3 for %s is from the parent zone", name)
+			}
+			return Secure, nil
+		}
+	}
+
+	ce, nc := nsec3ClosestEncloser(nsec3s, name)
+	if ce == "" {
+		return Bogus, fmt.Errorf("no closest encloser proof for %s", name)
+	}
+	cover := nsec3Covering(nsec3s, nc)
+	if cover == nil {
+		return Bogus, fmt.Errorf("no NSEC3 covers %s", nc)
+	}
+	// With opt-out, there could be an unsigned delegation for the name (RFC 5155, Section 9.2).
+	optOut := cover.Flags&1 == 1
+
+	wildcard := "*." + ce
+	if ce == "." {
+		wildcard = "*."
+	}
+	if nsec3Covering(nsec3s, wildcard) != nil {
+		if optOut {
+			return Insecure, nil
+		}
+		return Secure, nil
+	}
+	if !nxdomain {
+		if n := nsec3Matching(nsec3s, wildcard); n != nil && !hasBit(n.TypeBitMap, t) && !hasBit(n.TypeBitMap, dns.TypeCNAME) {
+			return Secure, nil
+		}
+		if t == dns.TypeDS && optOut {
+			return Insecure, nil
+		}
+	}
+	return Bogus, fmt.Errorf("no NSEC3 proves %s %s doesn't exist", name, dns.TypeToString[t])
+}
+
+// wildcardProof checks that the records in ns prove owner doesn't exist, when an answer for it was
+// expanded from a wildcard with the given number of labels.
+func wildcardProof(owner string, labels int, ns []dns.RR) error {
+	nsecs, nsec3s := denialRecords(ns)
+	if nsecCovering(nsecs, owner) != nil {
+		return nil
+	}
+	// The next closer name is the wildcard's closest encloser with one more label of owner.
+	idx := dns.Split(owner)
+	nc := owner[idx[len(idx)-labels-1]:]
+	if nsec3Covering(nsec3s, nc) != nil {
+		return nil
+	}
+	return fmt.Errorf("no proof that %s doesn't exist for the wildcard answer", owner)
+}
+
+// delegation returns true if the records in ns prove that name is a delegation, from the parent side.
+func delegation(name string, ns []dns.RR) bool {
+	nsecs, nsec3s := denialRecords(ns)
+	for _, n := range nsecs {
+		if strings.EqualFold(n.Hdr.Name, name) {
+			return hasBit(n.TypeBitMap, dns.TypeNS) && !hasBit(n.TypeBitMap, dns.TypeSOA)
+		}
+	}
+	if n := nsec3Matching(nsec3s, name); n != nil {
+		return hasBit(n.TypeBitMap, dns.TypeNS) && !hasBit(n.TypeBitMap, dns.TypeSOA)
+	}
+	return false
+}
+
+func denialRecords(ns []dns.RR) (nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) {
+	for _, rr := range ns {
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			nsecs = append(nsecs, x)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, x)
+		}
+	}
+	return nsecs, nsec3s
+}
+
+// nsecCovering returns the NSEC record that covers name, i.e. name sorts between its owner and next
+// name, or nil.
+func nsecCovering(nsecs []*dns.NSEC, name string) *dns.NSEC {
+	for _, n := range nsecs {
+		owner, next := n.Hdr.Name, n.NextDomain
+		if dnsutil.CanonicalCompare(owner, name) >= 0 {
+			continue
+		}
+		if dnsutil.CanonicalCompare(owner, next) < 0 {
+			if dnsutil.CanonicalCompare(name, next) < 0 {
+				return n
+			}
+			continue
+		}
+		// The last NSEC in the zone, its next name is the apex: it covers the rest of the zone.
+		if dns.IsSubDomain(next, name) {
+			return n
+		}
+	}
+	return nil
+}
+
+// nsecClosestEncloser returns the closest encloser of name, that doesn't exist, from the NSEC covering it:
+// the longest ancestor of name that is also an ancestor of the NSEC's owner or next name.
+func nsecClosestEncloser(name string, n *dns.NSEC) string {
+	ce := "."
+	for _, other := range []string{n.Hdr.Name, n.NextDomain} {
+		common := dns.CompareDomainName(name, other)
+		labels := dns.Split(name)
+		if common == 0 || common > len(labels) {
+			continue
+		}
+		anc := strings.ToLower(name[labels[len(labels)-common]:])
+		if dns.CountLabel(anc) > dns.CountLabel(ce) {
+			ce = anc
+		}
+	}
+	return ce
+}
+
+// nsec3ClosestEncloser returns the closest encloser of name, the longest ancestor of it with a matching
+// NSEC3 record, and the next closer name. It returns empty strings if there is no closest encloser.
+func nsec3ClosestEncloser(nsec3s []*dns.NSEC3, name string) (ce, nc string) {
+	idx := dns.Split(name)
+	for i := 1; i < len(idx); i++ {
+		if nsec3Matching(nsec3s, name[idx[i]:]) != nil {
+			return strings.ToLower(name[idx[i]:]), strings.ToLower(name[idx[i-1]:])
+		}
+	}
+	if nsec3Matching(nsec3s, ".") != nil && len(idx) > 0 {
+		return ".", strings.ToLower(name[idx[len(idx)-1]:])
+	}
+	return "", ""
+}
+
+func nsec3Matching(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, n := range nsec3s {
+		if n.Match(name) {
+			return n
+		}
+	}
+	return nil
+}
+
+// nsec3Covering returns the NSEC3 record that covers the hash of name, or nil. Cover also returns true
+// when the hash is the owner's.
+func nsec3Covering(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, n := range nsec3s {
+		if n.Cover(name) && !n.Match(name) {
+			return n
+		}
+	}
+	return nil
+}
+
+func hasBit(bitmap []uint16, t uint16) bool {
+	for _, x := range bitmap {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// maxIterations is the highest number of NSEC3 iterations a zone can use and still be secure.
+const maxIterations = 150
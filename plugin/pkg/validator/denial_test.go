@@ -0,0 +1,96 @@
+package validator
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestNSECCovering(t *testing.T) {
+	nsecs := []*dns.NSEC{
+		nsec("example.org.", "b.example.org.").(*dns.NSEC),
+		nsec("b.example.org.", "example.org.").(*dns.NSEC), // the last one
+	}
+	tests := []struct {
+		name  string
+		cover bool
+	}{
+		{"a.example.org.", true},
+		{"a.b.example.org.", true},
+		{"c.example.org.", true},
+		{"b.example.org.", false},
+		{"example.org.", false},
+		{"example.com.", false},
+	}
+	for i, tc := range tests {
+		if got := nsecCovering(nsecs, tc.name) != nil; got != tc.cover {
+			t.Errorf("Test %d: expected %s covered %t, got %t", i, tc.name, tc.cover, got)
+		}
+	}
+}
+
+func TestNSEC3Denial(t *testing.T) {
+	chain := nsec3Chain(map[string][]uint16{
+		"example.org.":     {dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM},
+		"a.example.org.":   {dns.TypeA, dns.TypeRRSIG},
+		"*.w.example.org.": {dns.TypeTXT, dns.TypeRRSIG},
+		"w.example.org.":   nil,
+		"d.example.org.":   {dns.TypeNS},
+	}, 0)
+
+	tests := []struct {
+		name     string
+		t        uint16
+		nxdomain bool
+		result   Result
+	}{
+		{"a.example.org.", dns.TypeMX, false, Secure},
+		{"a.example.org.", dns.TypeA, false, Bogus},
+		{"x.example.org.", dns.TypeA, true, Secure},
+		{"x.y.example.org.", dns.TypeA, true, Secure},
+		{"a.example.org.", dns.TypeA, true, Bogus}, // exists
+		{"x.w.example.org.", dns.TypeA, false, Secure},
+		{"x.w.example.org.", dns.TypeTXT, false, Bogus},
+		{"x.w.example.org.", dns.TypeA, true, Bogus}, // the wildcard exists
+		{"d.example.org.", dns.TypeDS, false, Secure},
+	}
+	for i, tc := range tests {
+		if r, err := nsec3Denial(tc.name, tc.t, tc.nxdomain, chain); r != tc.result {
+			t.Errorf("Test %d: expected %s for %s %s, got %s (%v)", i, tc.result, tc.name, dns.TypeToString[tc.t], r, err)
+		}
+	}
+
+	// With opt-out a missing DS proves nothing.
+	optOut := nsec3Chain(map[string][]uint16{"example.org.": {dns.TypeNS, dns.TypeSOA}}, 1)
+	if r, _ := nsec3Denial("d.example.org.", dns.TypeDS, false, optOut); r != Insecure {
+		t.Errorf("Expected %s for an opt-out NSEC3, got %s", Insecure, r)
+	}
+}
+
+// nsec3Chain returns the NSEC3 chain for names, in example.org.
+func nsec3Chain(names map[string][]uint16, flags uint8) []*dns.NSEC3 {
+	hashes := []string{}
+	types := map[string][]uint16{}
+	for name, t := range names {
+		h := dns.HashName(name, dns.SHA1, 1, "AB")
+		hashes = append(hashes, h)
+		types[h] = t
+	}
+	sort.Strings(hashes)
+	chain := []*dns.NSEC3{}
+	for i, h := range hashes {
+		chain = append(chain, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: h + ".example.org.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 3600},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			Iterations: 1,
+			SaltLength: 1,
+			Salt:       "AB",
+			HashLength: 20,
+			NextDomain: hashes[(i+1)%len(hashes)],
+			TypeBitMap: types[h],
+		})
+	}
+	return chain
+}
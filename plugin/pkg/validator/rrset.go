@@ -0,0 +1,162 @@
+package validator
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RootAnchors returns the DS records of the root zone's KSKs: KSK-2017 and KSK-2024.
+func RootAnchors() []dns.RR {
+	anchors := []dns.RR{}
+	for _, s := range rootAnchors {
+		rr, _ := dns.NewRR(s)
+		anchors = append(anchors, rr)
+	}
+	return anchors
+}
+
+var rootAnchors = []string{
+	". 172800 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". 172800 IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// ParseAnchors reads the DS and DNSKEY records in r, which is in zone file format. Other records are
+// ignored, file is used in errors.
+func ParseAnchors(r io.Reader, file string) ([]dns.RR, error) {
+	anchors := []dns.RR{}
+	zp := dns.NewZoneParser(r, ".", file)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr.Header().Rrtype {
+		case dns.TypeDS, dns.TypeDNSKEY:
+			anchors = append(anchors, rr)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if len(anchors) == 0 {
+		return nil, ErrNoAnchors
+	}
+	return anchors, nil
+}
+
+// supported returns true if one of the DS records, or DNSKEY trust anchors, uses an algorithm and
+// digest type we can validate.
+func supported(anchors []dns.RR) bool {
+	for _, a := range anchors {
+		var alg uint8
+		switch x := a.(type) {
+		case *dns.DS:
+			if _, ok := dns.HashToString[x.DigestType]; !ok || x.DigestType == dns.GOST94 {
+				continue
+			}
+			alg = x.Algorithm
+		case *dns.DNSKEY:
+			alg = x.Algorithm
+		}
+		switch alg {
+		case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512, dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519:
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if k matches one of the DS records, or is one of the DNSKEY trust anchors.
+func matches(k *dns.DNSKEY, anchors []dns.RR) bool {
+	for _, a := range anchors {
+		switch x := a.(type) {
+		case *dns.DS:
+			if x.KeyTag != k.KeyTag() || x.Algorithm != k.Algorithm {
+				continue
+			}
+			if ds := k.ToDS(x.DigestType); ds != nil && strings.EqualFold(ds.Digest, x.Digest) {
+				return true
+			}
+		case *dns.DNSKEY:
+			if x.Flags == k.Flags && x.Protocol == k.Protocol && x.Algorithm == k.Algorithm && x.PublicKey == k.PublicKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// signatures returns the RRSIG records in rrs.
+func signatures(rrs []dns.RR) []*dns.RRSIG {
+	sigs := []*dns.RRSIG{}
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// rrSets returns the RRsets in rrs, without the signatures and the OPT record.
+func rrSets(rrs []dns.RR) [][]dns.RR {
+	type key struct {
+		name string
+		t    uint16
+	}
+	sets := map[key][]dns.RR{}
+	order := []key{}
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeRRSIG || h.Rrtype == dns.TypeOPT {
+			continue
+		}
+		k := key{strings.ToLower(h.Name), h.Rrtype}
+		if _, ok := sets[k]; !ok {
+			order = append(order, k)
+		}
+		sets[k] = append(sets[k], rr)
+	}
+	rrsets := make([][]dns.RR, len(order))
+	for i, k := range order {
+		rrsets[i] = sets[k]
+	}
+	return rrsets
+}
+
+// chainEnd follows the CNAMEs for name in rrs and returns the name at the end of the chain.
+func chainEnd(name string, rrs []dns.RR) string {
+	for i := 0; i < len(rrs); i++ { // a chain can't be longer than the answer
+		next := ""
+		for _, rr := range rrs {
+			if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, name) {
+				next = strings.ToLower(c.Target)
+			}
+		}
+		if next == "" {
+			break
+		}
+		name = next
+	}
+	return name
+}
+
+// hasType returns true if rrs has an RRset of type t for name. For ANY queries any type will do.
+func hasType(rrs []dns.RR, name string, t uint16) bool {
+	for _, rr := range rrs {
+		h := rr.Header()
+		if strings.EqualFold(h.Name, name) && h.Rrtype != dns.TypeRRSIG && (h.Rrtype == t || t == dns.TypeANY) {
+			return true
+		}
+	}
+	return false
+}
+
+// ttl returns the lowest TTL in rrs, as a duration no longer than maxTTL.
+func ttl(rrs []dns.RR) time.Duration {
+	d := maxTTL
+	for _, rr := range rrs {
+		if t := time.Duration(rr.Header().Ttl) * time.Second; t < d {
+			d = t
+		}
+	}
+	return d
+}
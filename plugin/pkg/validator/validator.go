@@ -0,0 +1,422 @@
+// Package validator implements DNSSEC validation (RFC 4033, 4034 and 4035) of responses, for plugins
+// that get their answers from elsewhere. The DNSKEY and DS records needed to build the chain of trust,
+// from a trust anchor down to the zone that signed the answer, are fetched with the same exchange
+// function the answers came from, validated and cached.
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/singleflight"
+
+	"github.com/miekg/dns"
+)
+
+// Exchanger sends the query m and returns the response.
+type Exchanger func(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+
+// Result is the outcome of validating a response.
+type Result int
+
+const (
+	// Insecure means there is no chain of trust to the answer: it isn't signed, and provably so, or
+	// it is below a negative trust anchor.
+	Insecure Result = iota
+	// Secure means the answer is validated.
+	Secure
+	// Bogus means the answer should have validated, but didn't.
+	Bogus
+)
+
+func (r Result) String() string {
+	switch r {
+	case Secure:
+		return "secure"
+	case Bogus:
+		return "bogus"
+	}
+	return "insecure"
+}
+
+// Validator validates responses.
+type Validator struct {
+	exchange Exchanger
+	anchors  map[string][]dns.RR // trust anchors, DS or DNSKEY records, by zone
+	negative []string            // negative trust anchors (RFC 7646)
+
+	cache    *cache.Cache // validated keys, by zone
+	inflight *singleflight.Group
+
+	now func() time.Time
+}
+
+// New returns a Validator that gets the DNSKEY and DS records with exchange. The anchors are DS or
+// DNSKEY records; validation starts at the closest one above the signer of an answer. Names at or
+// below the negative trust anchors are never validated.
+func New(exchange Exchanger, anchors []dns.RR, negative []string) *Validator {
+	v := &Validator{
+		exchange: exchange,
+		anchors:  map[string][]dns.RR{},
+		cache:    cache.New(defaultCap),
+		inflight: new(singleflight.Group),
+		now:      time.Now,
+	}
+	for _, a := range anchors {
+		zone := strings.ToLower(dns.Fqdn(a.Header().Name))
+		v.anchors[zone] = append(v.anchors[zone], a)
+	}
+	for _, n := range negative {
+		v.negative = append(v.negative, strings.ToLower(dns.Fqdn(n)))
+	}
+	return v
+}
+
+// Validate validates m, the response to a query that was sent with the DO and CD bits set. For a
+// Bogus result the error tells why.
+func (v *Validator) Validate(ctx context.Context, m *dns.Msg) (Result, error) {
+	return v.validate(ctx, m, "")
+}
+
+// validate validates m. Only the keys of zones above limit may be used, if it isn't empty: these are
+// the DS records of limit being validated.
+func (v *Validator) validate(ctx context.Context, m *dns.Msg, limit string) (Result, error) {
+	if len(m.Question) == 0 {
+		return Insecure, nil
+	}
+	q := m.Question[0]
+	qname := strings.ToLower(q.Name)
+	if v.isNegative(qname) || v.anchor(qname) == "" {
+		return Insecure, nil
+	}
+	if m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError {
+		return Insecure, nil // nothing to validate, the client gets the error
+	}
+
+	result := Secure
+	sigs := signatures(m.Answer)
+	for _, set := range rrSets(m.Answer) {
+		r, sig, err := v.verify(ctx, set, sigs, limit)
+		if r == Bogus {
+			return Bogus, err
+		}
+		if r == Insecure {
+			result = Insecure
+			continue
+		}
+		// A wildcard expansion needs proof that the name itself doesn't exist.
+		if owner := set[0].Header().Name; int(sig.Labels) < dns.CountLabel(owner) {
+			r, err := v.verifyAll(ctx, m.Ns, limit)
+			if r != Secure {
+				return r, err
+			}
+			if err := wildcardProof(owner, int(sig.Labels), m.Ns); err != nil {
+				return Bogus, err
+			}
+		}
+	}
+
+	name := chainEnd(qname, m.Answer)
+	if m.Rcode == dns.RcodeSuccess && hasType(m.Answer, name, q.Qtype) {
+		return result, nil
+	}
+	if result == Insecure {
+		return Insecure, nil // the chain of CNAMEs goes into an insecure zone
+	}
+
+	// Name error or no data: the authority section must prove it.
+	r, err := v.verifyAll(ctx, m.Ns, limit)
+	if r != Secure {
+		return r, err
+	}
+	if len(m.Ns) == 0 {
+		// Nothing at all, this is only fine if the zone isn't signed.
+		z := v.keysFor(ctx, name, q.Qtype, limit)
+		if z.result == Secure {
+			return Bogus, fmt.Errorf("no proof of non-existence for %s", name)
+		}
+		return z.result, z.err
+	}
+	return denial(name, q.Qtype, m.Rcode == dns.RcodeNameError, m.Ns)
+}
+
+// verifyAll verifies all RRsets in rrs, these must all be secure for the result to be secure.
+func (v *Validator) verifyAll(ctx context.Context, rrs []dns.RR, limit string) (Result, error) {
+	result := Secure
+	sigs := signatures(rrs)
+	for _, set := range rrSets(rrs) {
+		if set[0].Header().Rrtype == dns.TypeNS {
+			continue // a referral, or the zone's NS records added by an authoritative server
+		}
+		r, _, err := v.verify(ctx, set, sigs, limit)
+		if r == Bogus {
+			return Bogus, err
+		}
+		if r == Insecure {
+			result = Insecure
+		}
+	}
+	return result, nil
+}
+
+// verify verifies the RRset rrs with one of its signatures in sigs. For a secure RRset the signature
+// that validated is returned.
+func (v *Validator) verify(ctx context.Context, rrs []dns.RR, sigs []*dns.RRSIG, limit string) (Result, *dns.RRSIG, error) {
+	h := rrs[0].Header()
+	owner := strings.ToLower(h.Name)
+
+	var err error
+	signed := false
+	for _, sig := range sigs {
+		if sig.TypeCovered != h.Rrtype || !strings.EqualFold(sig.Hdr.Name, owner) {
+			continue
+		}
+		signed = true
+		signer := strings.ToLower(sig.SignerName)
+		// The signer is the zone of the RRset; DS records are signed by the parent.
+		if !dns.IsSubDomain(signer, owner) || (h.Rrtype == dns.TypeDS && signer == owner) {
+			err = fmt.Errorf("%s %s signed by %s", owner, dns.TypeToString[h.Rrtype], signer)
+			continue
+		}
+		z := v.keys(ctx, signer, limit)
+		if z.result != Secure {
+			return z.result, nil, z.err
+		}
+		if !sig.ValidityPeriod(v.now()) {
+			err = fmt.Errorf("signature of %s %s by key %d is expired or not yet valid", owner, dns.TypeToString[h.Rrtype], sig.KeyTag)
+			continue
+		}
+		for _, k := range z.keys {
+			if k.KeyTag() != sig.KeyTag || k.Algorithm != sig.Algorithm {
+				continue
+			}
+			if e := sig.Verify(k, rrs); e != nil {
+				err = fmt.Errorf("signature of %s %s by key %d: %s", owner, dns.TypeToString[h.Rrtype], sig.KeyTag, e)
+				continue
+			}
+			return Secure, sig, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("no key %d in %s for %s %s", sig.KeyTag, signer, owner, dns.TypeToString[h.Rrtype])
+		}
+	}
+	if signed {
+		return Bogus, nil, err
+	}
+
+	// Not signed: fine only if the zone it is in isn't.
+	z := v.keysFor(ctx, owner, h.Rrtype, limit)
+	if z.result == Secure {
+		return Bogus, nil, fmt.Errorf("%s %s is not signed", owner, dns.TypeToString[h.Rrtype])
+	}
+	return z.result, nil, z.err
+}
+
+// keysFor returns the keys of the zone name, an RRset of type t, is in.
+func (v *Validator) keysFor(ctx context.Context, name string, t uint16, limit string) *zoneKeys {
+	var zone string
+	switch {
+	case t == dns.TypeSOA:
+		zone = name
+	case t == dns.TypeDS && name != ".":
+		// The DS records are in the parent zone.
+		i, _ := dns.NextLabel(name, 0)
+		z, err := v.zone(ctx, name[i:])
+		if err != nil {
+			return &zoneKeys{result: Bogus, err: err}
+		}
+		zone = z
+	default:
+		z, err := v.zone(ctx, name)
+		if err != nil {
+			return &zoneKeys{result: Bogus, err: err}
+		}
+		zone = z
+	}
+	return v.keys(ctx, zone, limit)
+}
+
+// zone returns the zone name is in, from the owner name of the SOA record in the response to a SOA query.
+func (v *Validator) zone(ctx context.Context, name string) (string, error) {
+	m, err := v.query(ctx, name, dns.TypeSOA)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range append(m.Answer, m.Ns...) {
+		if rr.Header().Rrtype == dns.TypeSOA && dns.IsSubDomain(rr.Header().Name, name) {
+			return strings.ToLower(rr.Header().Name), nil
+		}
+	}
+	return "", fmt.Errorf("no zone found for %s", name)
+}
+
+// zoneKeys are the validated keys of a zone.
+type zoneKeys struct {
+	result Result
+	keys   []*dns.DNSKEY // the zone's keys, if secure
+	err    error         // why the zone is bogus
+	expire time.Time
+}
+
+// keys returns the validated keys of zone, from the cache if possible. The zone must be above limit,
+// unless that is empty.
+func (v *Validator) keys(ctx context.Context, zone, limit string) *zoneKeys {
+	zone = strings.ToLower(zone)
+	if limit != "" && (zone == limit || !dns.IsSubDomain(zone, limit)) {
+		return &zoneKeys{result: Bogus, err: fmt.Errorf("the DS records of %s need the keys of %s", limit, zone)}
+	}
+	if v.isNegative(zone) || v.anchor(zone) == "" {
+		return &zoneKeys{result: Insecure}
+	}
+
+	key := cache.Hash([]byte(zone))
+	if x, ok := v.cache.Get(key); ok {
+		z := x.(*zoneKeys)
+		if v.now().Before(z.expire) {
+			return z
+		}
+		v.cache.Remove(key)
+	}
+
+	x, _ := v.inflight.Do(key, func() (interface{}, error) {
+		z, cacheable := v.fetchKeys(ctx, zone)
+		if cacheable {
+			v.cache.Add(key, z)
+		}
+		return z, nil
+	})
+	return x.(*zoneKeys)
+}
+
+// fetchKeys fetches and validates the keys of zone. Failures to reach the upstream aren't cacheable.
+func (v *Validator) fetchKeys(ctx context.Context, zone string) (*zoneKeys, bool) {
+	now := v.now()
+	bogus := func(err error) (*zoneKeys, bool) {
+		return &zoneKeys{result: Bogus, err: err, expire: now.Add(bogusTTL)}, true
+	}
+
+	// The DS records, or the trust anchor, the keys must match.
+	anchors, ok := v.anchors[zone]
+	if !ok {
+		m, err := v.query(ctx, zone, dns.TypeDS)
+		if err != nil {
+			return &zoneKeys{result: Bogus, err: err}, false
+		}
+		r, err := v.validate(ctx, m, zone)
+		switch r {
+		case Bogus:
+			return bogus(fmt.Errorf("DS of %s: %s", zone, err))
+		case Insecure:
+			return &zoneKeys{result: Insecure, expire: now.Add(ttl(append(m.Answer, m.Ns...)))}, true
+		}
+		for _, rr := range m.Answer {
+			if ds, ok := rr.(*dns.DS); ok && strings.EqualFold(ds.Hdr.Name, zone) {
+				anchors = append(anchors, ds)
+			}
+		}
+		if len(anchors) == 0 {
+			// A secure delegation without DS records is insecure, anything else isn't a zone.
+			if !delegation(zone, m.Ns) {
+				return bogus(fmt.Errorf("%s is not a delegation", zone))
+			}
+			return &zoneKeys{result: Insecure, expire: now.Add(ttl(m.Ns))}, true
+		}
+	}
+	if !supported(anchors) {
+		// Algorithms or digests we can't validate make the zone insecure (RFC 4035, Section 5.2).
+		return &zoneKeys{result: Insecure, expire: now.Add(ttl(anchors))}, true
+	}
+
+	m, err := v.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return &zoneKeys{result: Bogus, err: err}, false
+	}
+	keys := []*dns.DNSKEY{}
+	rrs := []dns.RR{}
+	for _, rr := range m.Answer {
+		if k, ok := rr.(*dns.DNSKEY); ok && strings.EqualFold(k.Hdr.Name, zone) {
+			keys = append(keys, k)
+			rrs = append(rrs, k)
+		}
+	}
+	if len(keys) == 0 {
+		return bogus(fmt.Errorf("no DNSKEY records for %s", zone))
+	}
+
+	// The DNSKEY RRset must be signed by a key that matches a DS record or trust anchor.
+	err = fmt.Errorf("no DNSKEY for %s matches its DS records", zone)
+	for _, sig := range signatures(m.Answer) {
+		if sig.TypeCovered != dns.TypeDNSKEY || !strings.EqualFold(sig.SignerName, zone) {
+			continue
+		}
+		if !sig.ValidityPeriod(now) {
+			err = fmt.Errorf("signature of %s DNSKEY by key %d is expired or not yet valid", zone, sig.KeyTag)
+			continue
+		}
+		for _, k := range keys {
+			if k.KeyTag() != sig.KeyTag || k.Algorithm != sig.Algorithm || !matches(k, anchors) {
+				continue
+			}
+			if e := sig.Verify(k, rrs); e != nil {
+				err = fmt.Errorf("signature of %s DNSKEY by key %d: %s", zone, sig.KeyTag, e)
+				continue
+			}
+			zk := []*dns.DNSKEY{}
+			for _, k := range keys {
+				if k.Flags&dns.ZONE != 0 && k.Flags&dns.REVOKE == 0 {
+					zk = append(zk, k)
+				}
+			}
+			expire := now.Add(ttl(rrs))
+			if e := time.Unix(int64(sig.Expiration), 0); e.Before(expire) {
+				expire = e
+			}
+			return &zoneKeys{result: Secure, keys: zk, expire: expire}, true
+		}
+	}
+	return bogus(err)
+}
+
+// query sends a query for name and t, with the DO and CD bits set.
+func (v *Validator) query(ctx context.Context, name string, t uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, t)
+	m.SetEdns0(4096, true)
+	m.CheckingDisabled = true
+	ret, err := v.exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Rcode != dns.RcodeSuccess && ret.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("%s for %s %s", dns.RcodeToString[ret.Rcode], name, dns.TypeToString[t])
+	}
+	return ret, nil
+}
+
+// anchor returns the closest trust anchor at or above name, or the empty string if there is none.
+func (v *Validator) anchor(name string) string {
+	zones := make([]string, 0, len(v.anchors))
+	for z := range v.anchors {
+		zones = append(zones, z)
+	}
+	return plugin.Zones(zones).Matches(name)
+}
+
+// isNegative returns true if name is at or below a negative trust anchor.
+func (v *Validator) isNegative(name string) bool {
+	return plugin.Zones(v.negative).Matches(name) != ""
+}
+
+// ErrNoAnchors is returned when a trust anchor file has no DS or DNSKEY records.
+var ErrNoAnchors = errors.New("no DS or DNSKEY records")
+
+const (
+	defaultCap = 10000
+	bogusTTL   = time.Minute    // bogus keys are tried again after this
+	maxTTL     = 24 * time.Hour // validated keys are cached at most this long
+)
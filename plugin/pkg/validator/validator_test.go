@@ -0,0 +1,211 @@
+package validator
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// world is a tiny DNS tree: org. is the trust anchor, example.org. is a secure delegation and
+// insecure.org. one without DS records.
+type world struct {
+	keys    map[string]*dns.DNSKEY
+	privs   map[string]crypto.Signer
+	answers map[string]*dns.Msg // by "qname qtype"
+	queries int
+}
+
+func newWorld(t *testing.T) *world {
+	w := &world{keys: map[string]*dns.DNSKEY{}, privs: map[string]crypto.Signer{}, answers: map[string]*dns.Msg{}}
+	for _, zone := range []string{"org.", "example.org."} {
+		k := &dns.DNSKEY{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600}, Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+		priv, err := k.Generate(256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.keys[zone], w.privs[zone] = k, priv.(crypto.Signer)
+		w.add(zone, dns.TypeDNSKEY, []dns.RR{k}, nil)
+	}
+
+	// org.
+	w.add("example.org.", dns.TypeDS, []dns.RR{w.keys["example.org."].ToDS(dns.SHA256)}, nil)
+	w.add("insecure.org.", dns.TypeDS, nil, []dns.RR{soa("org."), nsec("insecure.org.", "org.", dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC)})
+	w.add("www.insecure.org.", dns.TypeA, []dns.RR{a("www.insecure.org.")}, nil)
+	w.add("www.insecure.org.", dns.TypeSOA, nil, []dns.RR{soa("insecure.org.")})
+
+	// example.org.
+	w.add("www.example.org.", dns.TypeA, []dns.RR{a("www.example.org.")}, nil)
+	w.add("www.example.org.", dns.TypeMX, nil, []dns.RR{soa("example.org."), nsec("www.example.org.", "example.org.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC)})
+	w.add("www.example.org.", dns.TypeSOA, nil, []dns.RR{soa("example.org.")})
+	w.add("nx.example.org.", dns.TypeA, nil, []dns.RR{soa("example.org."), nsec("example.org.", "www.example.org.", dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY)})
+	w.answers["nx.example.org. A"].Rcode = dns.RcodeNameError
+	return w
+}
+
+// add adds the response for name and t, with the answer and authority sections signed by the zone
+// the records are in, unless they're in insecure.org. The NSEC record of the delegation is in org.
+func (w *world) add(name string, t uint16, answer, ns []dns.RR) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, t)
+	m.Response = true
+	m.Answer = w.sign(answer)
+	m.Ns = w.sign(ns)
+	w.answers[fmt.Sprintf("%s %s", name, dns.TypeToString[t])] = m
+}
+
+func (w *world) sign(rrs []dns.RR) []dns.RR {
+	signed := []dns.RR{}
+	for _, set := range rrSets(rrs) {
+		signed = append(signed, set...)
+		h := set[0].Header()
+		zone := "org."
+		switch {
+		case dns.IsSubDomain("insecure.org.", h.Name) && !(h.Rrtype == dns.TypeNSEC && h.Name == "insecure.org."):
+			continue
+		case dns.IsSubDomain("example.org.", h.Name) && !(h.Rrtype == dns.TypeDS && h.Name == "example.org."):
+			zone = "example.org."
+		}
+		sig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Name: h.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: h.Ttl},
+			Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+			Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+			KeyTag:     w.keys[zone].KeyTag(),
+			SignerName: zone,
+			Algorithm:  dns.ECDSAP256SHA256,
+		}
+		if err := sig.Sign(w.privs[zone], set); err != nil {
+			panic(err)
+		}
+		signed = append(signed, sig)
+	}
+	return signed
+}
+
+func (w *world) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	w.queries++
+	q := m.Question[0]
+	if ret, ok := w.answers[fmt.Sprintf("%s %s", q.Name, dns.TypeToString[q.Qtype])]; ok {
+		return ret.Copy(), nil
+	}
+	return nil, fmt.Errorf("no answer for %s %s", q.Name, dns.TypeToString[q.Qtype])
+}
+
+func (w *world) validator(negative ...string) *Validator {
+	return New(w.exchange, []dns.RR{w.keys["org."].ToDS(dns.SHA256)}, negative)
+}
+
+func TestValidate(t *testing.T) {
+	w := newWorld(t)
+
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		change func(*dns.Msg)
+		result Result
+	}{
+		{"www.example.org.", dns.TypeA, nil, Secure},
+		// no data and name error
+		{"www.example.org.", dns.TypeMX, nil, Secure},
+		{"nx.example.org.", dns.TypeA, nil, Secure},
+		// insecure delegation
+		{"www.insecure.org.", dns.TypeA, nil, Insecure},
+		// tampered
+		{"www.example.org.", dns.TypeA, func(m *dns.Msg) { m.Answer[0].(*dns.A).A[3] = 2 }, Bogus},
+		// signature stripped
+		{"www.example.org.", dns.TypeA, func(m *dns.Msg) { m.Answer = m.Answer[:1] }, Bogus},
+		// NSEC records stripped
+		{"nx.example.org.", dns.TypeA, func(m *dns.Msg) { m.Ns = m.Ns[:2] }, Bogus},
+		// no data claimed for a type that exists
+		{"www.example.org.", dns.TypeA, func(m *dns.Msg) { m.Answer, m.Ns = nil, w.answers["www.example.org. MX"].Ns }, Bogus},
+	}
+
+	for i, tc := range tests {
+		v := w.validator()
+		m, _ := w.exchange(context.TODO(), &dns.Msg{Question: []dns.Question{{Name: tc.qname, Qtype: tc.qtype, Qclass: dns.ClassINET}}})
+		if tc.change != nil {
+			tc.change(m)
+		}
+		r, err := v.Validate(context.TODO(), m)
+		if r != tc.result {
+			t.Errorf("Test %d: expected %s, got %s (%v)", i, tc.result, r, err)
+		}
+		if r == Bogus && err == nil {
+			t.Errorf("Test %d: expected an error for a bogus result", i)
+		}
+	}
+}
+
+func TestValidateNegativeAnchor(t *testing.T) {
+	w := newWorld(t)
+	v := w.validator("example.org")
+
+	m, _ := w.exchange(context.TODO(), &dns.Msg{Question: []dns.Question{{Name: "www.example.org.", Qtype: dns.TypeA, Qclass: dns.ClassINET}}})
+	m.Answer[0].(*dns.A).A[3] = 2
+	if r, _ := v.Validate(context.TODO(), m); r != Insecure {
+		t.Errorf("Expected %s below a negative trust anchor, got %s", Insecure, r)
+	}
+}
+
+func TestValidateBadAnchor(t *testing.T) {
+	w := newWorld(t)
+	k := dns.Copy(w.keys["org."]).(*dns.DNSKEY)
+	k.PublicKey = w.keys["example.org."].PublicKey // not the key of org.
+	v := New(w.exchange, []dns.RR{k}, nil)
+
+	m, _ := w.exchange(context.TODO(), &dns.Msg{Question: []dns.Question{{Name: "www.example.org.", Qtype: dns.TypeA, Qclass: dns.ClassINET}}})
+	if r, _ := v.Validate(context.TODO(), m); r != Bogus {
+		t.Errorf("Expected %s, got %s", Bogus, r)
+	}
+}
+
+func TestValidateCache(t *testing.T) {
+	w := newWorld(t)
+	v := w.validator()
+
+	for i := 0; i < 2; i++ {
+		m, _ := w.exchange(context.TODO(), &dns.Msg{Question: []dns.Question{{Name: "www.example.org.", Qtype: dns.TypeA, Qclass: dns.ClassINET}}})
+		w.queries = 0
+		if r, err := v.Validate(context.TODO(), m); r != Secure {
+			t.Fatalf("Expected %s, got %s (%v)", Secure, r, err)
+		}
+		// The DNSKEY of org., the DS and DNSKEY of example.org.
+		if want := []int{3, 0}[i]; w.queries != want {
+			t.Errorf("Validation %d: expected %d queries, got %d", i, want, w.queries)
+		}
+	}
+}
+
+func TestParseAnchors(t *testing.T) {
+	anchors, err := ParseAnchors(strings.NewReader(rootAnchors[0]+"\n. IN NS a.root-servers.net.\n"), "stdin")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(anchors) != 1 || anchors[0].(*dns.DS).KeyTag != 20326 {
+		t.Errorf("Expected the DS record of KSK-2017, got %v", anchors)
+	}
+	if _, err := ParseAnchors(strings.NewReader(". IN NS a.root-servers.net.\n"), "stdin"); err != ErrNoAnchors {
+		t.Errorf("Expected %s, got %v", ErrNoAnchors, err)
+	}
+	if len(RootAnchors()) != 2 {
+		t.Errorf("Expected 2 root anchors")
+	}
+}
+
+func soa(zone string) dns.RR {
+	rr, _ := dns.NewRR(zone + " 3600 IN SOA ns." + zone + " hostmaster." + zone + " 1 7200 3600 1209600 3600")
+	return rr
+}
+
+func a(name string) dns.RR {
+	rr, _ := dns.NewRR(name + " 3600 IN A 127.0.0.1")
+	return rr
+}
+
+func nsec(name, next string, types ...uint16) dns.RR {
+	return &dns.NSEC{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600}, NextDomain: next, TypeBitMap: types}
+}
@@ -0,0 +1,63 @@
+// Package proxyproto configures the server block to accept PROXY protocol headers.
+package proxyproto
+
+import (
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("proxyproto", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	if err := parse(c); err != nil {
+		return plugin.Error("proxyproto", err)
+	}
+	return nil
+}
+
+func parse(c *caddy.Controller) error {
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return plugin.ErrOnce
+		}
+		i++
+		if len(c.RemainingArgs()) != 0 {
+			return c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return c.ArgErr()
+				}
+				for _, a := range args {
+					n, err := pkgparse.Net(a)
+					if err != nil {
+						return c.Errf("illegal CIDR notation %q", a)
+					}
+					config.ProxyProtocolTrusted = append(config.ProxyProtocolTrusted, n)
+				}
+
+			default:
+				return c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+	if len(config.ProxyProtocolTrusted) == 0 {
+		return c.Err("at least one 'allow' network is required")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package proxyproto
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		trusted   []string
+	}{
+		// positive
+		{`proxyproto {
+			allow 10.0.0.0/8 192.168.1.1
+			allow 2001:db8::/32
+		}`, false, []string{"10.0.0.0/8", "192.168.1.1/32", "2001:db8::/32"}},
+		// negative
+		{`proxyproto`, true, nil},
+		{`proxyproto 10.0.0.0/8`, true, nil},
+		{`proxyproto {
+			allow
+		}`, true, nil},
+		{`proxyproto {
+			allow 10.0.0.0/33
+		}`, true, nil},
+		{`proxyproto {
+			allow example.org
+		}`, true, nil},
+		{`proxyproto {
+			blah
+		}`, true, nil},
+		{"proxyproto {\nallow 10.0.0.1\n}\nproxyproto {\nallow 10.0.0.2\n}", true, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found one for input %s: %v", i, test.input, err)
+			continue
+		}
+
+		cfg := dnsserver.GetConfig(c)
+		if len(cfg.ProxyProtocolTrusted) != len(test.trusted) {
+			t.Errorf("Test %d: Expected %d trusted networks, got %d", i, len(test.trusted), len(cfg.ProxyProtocolTrusted))
+			continue
+		}
+		for j, n := range cfg.ProxyProtocolTrusted {
+			if n.String() != test.trusted[j] {
+				t.Errorf("Test %d: Expected trusted network %s, got %s", i, test.trusted[j], n)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package recursive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// delegation is a zone cut: the zone and the names and addresses of its name servers.
+type delegation struct {
+	zone  string
+	ns    []string
+	addrs map[string][]string // by name server name
+}
+
+// newDelegation returns the delegation of zone from m, which has the NS records of zone in its answer
+// section and the addresses of the name servers in the additional section. It returns nil if there are
+// no NS records.
+func newDelegation(zone string, m *dns.Msg) *delegation {
+	d := &delegation{zone: strings.ToLower(zone), addrs: map[string][]string{}}
+	for _, rr := range m.Answer {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, zone) {
+			d.ns = append(d.ns, strings.ToLower(ns.Ns))
+		}
+	}
+	if len(d.ns) == 0 {
+		return nil
+	}
+	for _, rr := range m.Extra {
+		name := strings.ToLower(rr.Header().Name)
+		switch x := rr.(type) {
+		case *dns.A:
+			d.addrs[name] = append(d.addrs[name], x.A.String())
+		case *dns.AAAA:
+			d.addrs[name] = append(d.addrs[name], x.AAAA.String())
+		}
+	}
+	return d
+}
+
+// referral returns the delegation in m, the response to qname from the name servers of zone, as a
+// message that can be cached. It returns nil if m isn't a referral to a zone below zone. Only glue
+// that zone's name servers are authoritative for is kept.
+func referral(m *dns.Msg, zone, qname string) *dns.Msg {
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) > 0 {
+		return nil
+	}
+	cut := ""
+	ref := new(dns.Msg)
+	for _, rr := range m.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		owner := strings.ToLower(ns.Hdr.Name)
+		if cut == "" && dns.CountLabel(owner) > dns.CountLabel(zone) && dns.IsSubDomain(zone, owner) && dns.IsSubDomain(owner, qname) {
+			cut = owner
+		}
+		if owner == cut {
+			ref.Answer = append(ref.Answer, ns)
+		}
+	}
+	if cut == "" {
+		return nil
+	}
+	ref.SetQuestion(cut, dns.TypeNS)
+	ref.Response = true
+
+	for _, rr := range m.Extra {
+		h := rr.Header()
+		if h.Rrtype != dns.TypeA && h.Rrtype != dns.TypeAAAA {
+			continue
+		}
+		if !dns.IsSubDomain(zone, h.Name) {
+			continue
+		}
+		for _, ns := range ref.Answer {
+			if strings.EqualFold(ns.(*dns.NS).Ns, h.Name) {
+				ref.Extra = append(ref.Extra, rr)
+				break
+			}
+		}
+	}
+	return ref
+}
+
+// parseHints reads the root hints in r, in zone file format: the NS records of the root zone and the
+// addresses of its name servers. File is used in errors.
+func parseHints(r io.Reader, file string) (*delegation, error) {
+	m := new(dns.Msg)
+	zp := dns.NewZoneParser(r, ".", file)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr.Header().Rrtype {
+		case dns.TypeNS:
+			m.Answer = append(m.Answer, rr)
+		case dns.TypeA, dns.TypeAAAA:
+			m.Extra = append(m.Extra, rr)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	d := newDelegation(".", m)
+	if d == nil {
+		return nil, fmt.Errorf("no NS records for the root zone in %s", file)
+	}
+	if len(d.addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for the root name servers in %s", file)
+	}
+	return d, nil
+}
+
+// rootHints are the root name servers, from https://www.internic.net/domain/named.root.
+const rootHints = `
+.                        3600000      NS    A.ROOT-SERVERS.NET.
+A.ROOT-SERVERS.NET.      3600000      A     198.41.0.4
+A.ROOT-SERVERS.NET.      3600000      AAAA  2001:503:ba3e::2:30
+.                        3600000      NS    B.ROOT-SERVERS.NET.
+B.ROOT-SERVERS.NET.      3600000      A     170.247.170.2
+B.ROOT-SERVERS.NET.      3600000      AAAA  2801:1b8:10::b
+.                        3600000      NS    C.ROOT-SERVERS.NET.
+C.ROOT-SERVERS.NET.      3600000      A     192.33.4.12
+C.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:2::c
+.                        3600000      NS    D.ROOT-SERVERS.NET.
+D.ROOT-SERVERS.NET.      3600000      A     199.7.91.13
+D.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:2d::d
+.                        3600000      NS    E.ROOT-SERVERS.NET.
+E.ROOT-SERVERS.NET.      3600000      A     192.203.230.10
+E.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:a8::e
+.                        3600000      NS    F.ROOT-SERVERS.NET.
+F.ROOT-SERVERS.NET.      3600000      A     192.5.5.241
+F.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:2f::f
+.                        3600000      NS    G.ROOT-SERVERS.NET.
+G.ROOT-SERVERS.NET.      3600000      A     192.112.36.4
+G.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:12::d0d
+.                        3600000      NS    H.ROOT-SERVERS.NET.
+H.ROOT-SERVERS.NET.      3600000      A     198.97.190.53
+H.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:1::53
+.                        3600000      NS    I.ROOT-SERVERS.NET.
+I.ROOT-SERVERS.NET.      3600000      A     192.36.148.17
+I.ROOT-SERVERS.NET.      3600000      AAAA  2001:7fe::53
+.                        3600000      NS    J.ROOT-SERVERS.NET.
+J.ROOT-SERVERS.NET.      3600000      A     192.58.128.30
+J.ROOT-SERVERS.NET.      3600000      AAAA  2001:503:c27::2:30
+.                        3600000      NS    K.ROOT-SERVERS.NET.
+K.ROOT-SERVERS.NET.      3600000      A     193.0.14.129
+K.ROOT-SERVERS.NET.      3600000      AAAA  2001:7fd::1
+.                        3600000      NS    L.ROOT-SERVERS.NET.
+L.ROOT-SERVERS.NET.      3600000      A     199.7.83.42
+L.ROOT-SERVERS.NET.      3600000      AAAA  2001:500:9f::42
+.                        3600000      NS    M.ROOT-SERVERS.NET.
+M.ROOT-SERVERS.NET.      3600000      A     202.12.27.33
+M.ROOT-SERVERS.NET.      3600000      AAAA  2001:dc3::35
+`
@@ -0,0 +1,23 @@
+package recursive
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Variables declared for monitoring.
+var (
+	UpstreamCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "recursive",
+		Name:      "upstream_request_count_total",
+		Help:      "Counter of queries sent to authoritative name servers.",
+	})
+	ExhaustedCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "recursive",
+		Name:      "exhausted_count_total",
+		Help:      "Counter of queries that needed more queries to resolve than allowed.",
+	})
+)
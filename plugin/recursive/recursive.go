@@ -0,0 +1,98 @@
+// Package recursive implements a recursive resolver, that resolves names iteratively from the root.
+package recursive
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/cache"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// Recursive is a recursive resolver.
+type Recursive struct {
+	Next  plugin.Handler
+	Zones []string
+
+	hints      *delegation // the root name servers
+	minimise   bool        // use QNAME minimisation (RFC 9156)
+	maxQueries int         // the most queries sent for a client's query
+	maxDepth   int         // the most nested lookups of name server addresses
+	port       string      // the port the name servers are asked on
+
+	// cache holds the delegations, it's the cache plugin's if it is used in the same server block.
+	cache *cache.Cache
+	rtts  *rtts
+
+	// exchange sends m to addr, it is replaced for testing.
+	exchange func(ctx context.Context, m *dns.Msg, addr, proto string) (*dns.Msg, time.Duration, error)
+}
+
+// New returns a new Recursive, using the root hints of the internet.
+func New() *Recursive {
+	hints, _ := parseHints(strings.NewReader(rootHints), "root hints")
+	r := &Recursive{
+		Zones:      []string{"."},
+		hints:      hints,
+		minimise:   true,
+		maxQueries: defaultMaxQueries,
+		maxDepth:   defaultMaxDepth,
+		port:       defaultPort,
+		cache:      cache.New(),
+		rtts:       newRTTs(defaultCap),
+	}
+	r.exchange = r.dial
+	return r
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (r *Recursive) ServeDNS(ctx context.Context, w dns.ResponseWriter, req *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: req}
+	if !req.RecursionDesired || plugin.Zones(r.Zones).Matches(state.Name()) == "" {
+		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+
+	ret, err := r.resolve(ctx, state.Name(), state.QType(), state.Do(), &work{}, 0)
+	if err != nil {
+		if err == errExhausted {
+			ExhaustedCount.Inc()
+		}
+		return dns.RcodeServerFailure, err
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+	m.Rcode = ret.Rcode
+	m.Answer, m.Ns = ret.Answer, ret.Ns
+	state.SizeAndDo(m)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the Handler interface.
+func (r *Recursive) Name() string { return "recursive" }
+
+// dial sends m to the name server at addr, on r's port.
+func (r *Recursive) dial(ctx context.Context, m *dns.Msg, addr, proto string) (*dns.Msg, time.Duration, error) {
+	c := &dns.Client{Net: proto, Timeout: timeout}
+	return c.ExchangeContext(ctx, m, net.JoinHostPort(addr, r.port))
+}
+
+const (
+	defaultMaxQueries = 100
+	defaultMaxDepth   = 7
+	defaultPort       = "53"
+	defaultCap        = 10000 // the number of round trip times tracked.
+
+	timeout        = 2 * time.Second  // for a single query to a name server.
+	resolveTimeout = 10 * time.Second // for resolving a client's query.
+)
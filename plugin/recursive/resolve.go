@@ -0,0 +1,337 @@
+package recursive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// work is the work done for a client's query, it is bounded by maxQueries.
+type work struct {
+	queries int
+}
+
+var (
+	errExhausted = errors.New("too many queries needed")
+	errNoServers = errors.New("no name servers reachable")
+)
+
+// resolve resolves name and type qtype, following CNAMEs. The answer section of the returned message
+// starts with the CNAME chain. Depth is the nesting of lookups of name server addresses.
+func (r *Recursive) resolve(ctx context.Context, name string, qtype uint16, do bool, w *work, depth int) (*dns.Msg, error) {
+	ret := new(dns.Msg)
+	ret.SetQuestion(name, qtype)
+	ret.Response = true
+
+	for i := 0; i <= maxCNAME; i++ {
+		m, err := r.lookup(ctx, name, qtype, do, w, depth)
+		if err != nil {
+			return nil, err
+		}
+		ret.Answer = append(ret.Answer, m.Answer...)
+		ret.Ns, ret.Rcode = m.Ns, m.Rcode
+
+		if qtype == dns.TypeCNAME || qtype == dns.TypeANY || m.Rcode != dns.RcodeSuccess {
+			return ret, nil
+		}
+		end := chainEnd(name, m.Answer)
+		if end == name || hasType(m.Answer, end, qtype) {
+			return ret, nil
+		}
+		name = end
+	}
+	return nil, fmt.Errorf("CNAME chain longer than %d", maxCNAME)
+}
+
+// lookup resolves name and type qtype iteratively, from the closest delegation we know.
+func (r *Recursive) lookup(ctx context.Context, name string, qtype uint16, do bool, w *work, depth int) (*dns.Msg, error) {
+	// DS records are in the parent zone.
+	start := name
+	if qtype == dns.TypeDS && name != "." {
+		i, _ := dns.NextLabel(name, 0)
+		start = name[i:]
+	}
+	d, err := r.closest(ctx, start, w)
+	if err != nil {
+		return nil, err
+	}
+
+	known := d.zone // the longest ancestor of name that we know exists
+	minimise := r.minimise
+	for {
+		qname, qt := name, qtype
+		if minimise {
+			// Ask for A records of the minimised name, as recommended by RFC 9156, Section 3.
+			if q := minimised(name, known); q != name {
+				qname, qt = q, dns.TypeA
+			}
+		}
+
+		m, err := r.ask(ctx, d, qname, qt, do, w, depth)
+		if err != nil {
+			return nil, err
+		}
+		if ref := referral(m, d.zone, qname); ref != nil && !(qt == dns.TypeDS && ref.Question[0].Name == qname) {
+			r.cache.Set(ref)
+			d = newDelegation(ref.Question[0].Name, ref)
+			known = d.zone
+			continue
+		}
+		if qname == name {
+			return inZone(m, d.zone), nil
+		}
+		if m.Rcode == dns.RcodeNameError {
+			// An empty non-terminal that the name server doesn't know about: fall back to the full name.
+			minimise = false
+			continue
+		}
+		known = qname
+	}
+}
+
+// closest returns the delegation closest to name that is cached, or the root's.
+func (r *Recursive) closest(ctx context.Context, name string, w *work) (*delegation, error) {
+	for z := name; z != "."; {
+		if m, ok := r.cache.Get(z, dns.TypeNS); ok {
+			if d := newDelegation(z, m); d != nil {
+				return d, nil
+			}
+		}
+		i, end := dns.NextLabel(z, 0)
+		if end {
+			break
+		}
+		z = z[i:]
+	}
+	return r.root(ctx, w)
+}
+
+// root returns the delegation for the root zone. If it's not cached the root name servers in the
+// hints are asked for it, priming the cache (RFC 8109).
+func (r *Recursive) root(ctx context.Context, w *work) (*delegation, error) {
+	if m, ok := r.cache.Get(".", dns.TypeNS); ok {
+		if d := newDelegation(".", m); d != nil && len(d.addrs) > 0 {
+			return d, nil
+		}
+	}
+	m, err := r.ask(ctx, r.hints, ".", dns.TypeNS, false, w, r.maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	m.Extra = glue(m.Answer, m.Extra)
+	d := newDelegation(".", m)
+	if d == nil || len(d.addrs) == 0 {
+		return r.hints, nil
+	}
+	r.cache.Set(m)
+	return d, nil
+}
+
+// ask sends the query for qname and qt to the name servers of d, until one answers. Name servers
+// without glue have their addresses looked up, when the others don't answer.
+func (r *Recursive) ask(ctx context.Context, d *delegation, qname string, qt uint16, do bool, w *work, depth int) (*dns.Msg, error) {
+	tried := map[string]bool{}
+	try := func(addrs []string) (*dns.Msg, error) {
+		err := errNoServers
+		for _, addr := range r.rtts.sort(addrs) {
+			if tried[addr] {
+				continue
+			}
+			tried[addr] = true
+			var m *dns.Msg
+			if m, err = r.query(ctx, addr, d.zone, qname, qt, do, w); err == nil {
+				return m, nil
+			}
+			if err == errExhausted || ctx.Err() != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	addrs := []string{}
+	glueless := []string{}
+	for _, ns := range d.ns {
+		a := d.addrs[ns]
+		if len(a) == 0 {
+			a = r.cached(ns)
+		}
+		if len(a) == 0 {
+			glueless = append(glueless, ns)
+		}
+		addrs = append(addrs, a...)
+	}
+	m, err := try(addrs)
+	if m != nil || err == errExhausted || ctx.Err() != nil {
+		return m, err
+	}
+
+	for _, ns := range glueless {
+		// Without glue, name servers in the zone itself can't be found.
+		if depth >= r.maxDepth || dns.IsSubDomain(d.zone, ns) {
+			continue
+		}
+		res, err1 := r.resolve(ctx, ns, dns.TypeA, false, w, depth+1)
+		if err1 == errExhausted {
+			return nil, err1
+		}
+		if err1 != nil {
+			continue
+		}
+		r.cache.Set(res)
+		if m, err = try(addresses(res)); m != nil || err == errExhausted || ctx.Err() != nil {
+			return m, err
+		}
+	}
+	return nil, fmt.Errorf("%s %s in %s: %s", qname, dns.TypeToString[qt], d.zone, err)
+}
+
+// query sends a query for qname and qt to the name server at addr, which is authoritative for zone.
+// It returns an error for failures and replies that are no answer nor a referral.
+func (r *Recursive) query(ctx context.Context, addr, zone, qname string, qt uint16, do bool, w *work) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qt)
+	m.RecursionDesired = false
+	m.SetEdns0(bufSize, do)
+
+	for _, proto := range []string{"udp", "tcp"} {
+		if w.queries >= r.maxQueries {
+			return nil, errExhausted
+		}
+		w.queries++
+		UpstreamCount.Inc()
+
+		ret, rtt, err := r.exchange(ctx, m, addr, proto)
+		if err != nil {
+			r.rtts.fail(addr)
+			return nil, err
+		}
+		if ret.Truncated && proto == "udp" {
+			continue
+		}
+		if len(ret.Question) != 1 || !strings.EqualFold(ret.Question[0].Name, qname) || ret.Question[0].Qtype != qt {
+			r.rtts.fail(addr)
+			return nil, fmt.Errorf("reply from %s doesn't match the question", addr)
+		}
+		if ret.Rcode != dns.RcodeSuccess && ret.Rcode != dns.RcodeNameError {
+			r.rtts.fail(addr)
+			return nil, fmt.Errorf("%s from %s", dns.RcodeToString[ret.Rcode], addr)
+		}
+		if !ret.Authoritative && referral(ret, zone, qname) == nil {
+			r.rtts.fail(addr)
+			return nil, fmt.Errorf("lame reply from %s for %s", addr, zone)
+		}
+		r.rtts.update(addr, rtt)
+		return ret, nil
+	}
+	return nil, fmt.Errorf("truncated reply from %s", addr)
+}
+
+// cached returns the cached addresses of the name server ns.
+func (r *Recursive) cached(ns string) []string {
+	addrs := []string{}
+	for _, t := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		if m, ok := r.cache.Get(ns, t); ok {
+			addrs = append(addrs, addresses(m)...)
+		}
+	}
+	return addrs
+}
+
+// addresses returns the addresses in the answer section of m.
+func addresses(m *dns.Msg) []string {
+	addrs := []string{}
+	for _, rr := range m.Answer {
+		switch x := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, x.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, x.AAAA.String())
+		}
+	}
+	return addrs
+}
+
+// glue returns the address records in extra of the name servers in the NS records in ns.
+func glue(ns, extra []dns.RR) []dns.RR {
+	names := map[string]bool{}
+	for _, rr := range ns {
+		if x, ok := rr.(*dns.NS); ok {
+			names[strings.ToLower(x.Ns)] = true
+		}
+	}
+	g := []dns.RR{}
+	for _, rr := range extra {
+		h := rr.Header()
+		if (h.Rrtype == dns.TypeA || h.Rrtype == dns.TypeAAAA) && names[strings.ToLower(h.Name)] {
+			g = append(g, rr)
+		}
+	}
+	return g
+}
+
+// inZone returns a copy of m with only the records from the answer and authority sections that are
+// in zone, the zone of the name server that sent m. Others could be spoofed.
+func inZone(m *dns.Msg, zone string) *dns.Msg {
+	ret := new(dns.Msg)
+	ret.SetQuestion(m.Question[0].Name, m.Question[0].Qtype)
+	ret.Response = true
+	ret.Rcode = m.Rcode
+	for _, rr := range m.Answer {
+		if dns.IsSubDomain(zone, rr.Header().Name) {
+			ret.Answer = append(ret.Answer, rr)
+		}
+	}
+	for _, rr := range m.Ns {
+		if dns.IsSubDomain(zone, rr.Header().Name) {
+			ret.Ns = append(ret.Ns, rr)
+		}
+	}
+	return ret
+}
+
+// minimised returns the name to ask for with QNAME minimisation: the ancestor of name that has one
+// label more than known.
+func minimised(name, known string) string {
+	idx := dns.Split(name)
+	n := dns.CountLabel(known) + 1
+	if n >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-n]:]
+}
+
+// chainEnd follows the CNAMEs for name in rrs and returns the name at the end of the chain.
+func chainEnd(name string, rrs []dns.RR) string {
+	for i := 0; i < len(rrs); i++ { // a chain can't be longer than the answer
+		next := ""
+		for _, rr := range rrs {
+			if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, name) {
+				next = strings.ToLower(c.Target)
+			}
+		}
+		if next == "" {
+			break
+		}
+		name = next
+	}
+	return name
+}
+
+// hasType returns true if rrs has an RRset of type t for name.
+func hasType(rrs []dns.RR, name string, t uint16) bool {
+	for _, rr := range rrs {
+		if h := rr.Header(); h.Rrtype == t && strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	maxCNAME = 8    // the longest CNAME chain followed
+	bufSize  = 1232 // EDNS0 buffer size, see https://www.dnsflagday.net/2020/
+)
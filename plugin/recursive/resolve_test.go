@@ -0,0 +1,270 @@
+package recursive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// world are the name servers, serving zones with the file plugin, by address. Ns2.org. at 10.0.0.9
+// is down.
+type world struct {
+	servers map[string]plugin.Handler
+	queries []string // "addr qname qtype"
+}
+
+func newWorld(t *testing.T) *world {
+	w := &world{servers: map[string]plugin.Handler{}}
+	for addr, z := range map[string]struct{ origin, zone string }{
+		"10.0.0.1": {".", rootZone},
+		"10.0.0.2": {"org.", orgZone},
+		"10.0.0.4": {"net.", netZone},
+		"10.0.0.3": {"example.org.", exampleOrgZone},
+	} {
+		zone, err := file.Parse(strings.NewReader(z.zone), z.origin, "stdin", 0)
+		if err != nil {
+			t.Fatalf("Failed to parse zone %s: %s", z.origin, err)
+		}
+		w.servers[addr] = file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{z.origin: zone}, Names: []string{z.origin}}}
+	}
+	return w
+}
+
+func (w *world) exchange(ctx context.Context, m *dns.Msg, addr, proto string) (*dns.Msg, time.Duration, error) {
+	w.queries = append(w.queries, fmt.Sprintf("%s %s %s", addr, m.Question[0].Name, dns.TypeToString[m.Question[0].Qtype]))
+	h, ok := w.servers[addr]
+	if !ok {
+		return nil, 0, errors.New("i/o timeout")
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	h.ServeDNS(ctx, rec, m)
+	if addr == "10.0.0.4" {
+		return rec.Msg, 20 * time.Millisecond, nil
+	}
+	return rec.Msg, 10 * time.Millisecond, nil
+}
+
+// asked returns the queries sent to addr.
+func (w *world) asked(addr string) []string {
+	q := []string{}
+	for _, s := range w.queries {
+		if strings.HasPrefix(s, addr+" ") {
+			q = append(q, strings.TrimPrefix(s, addr+" "))
+		}
+	}
+	return q
+}
+
+func (w *world) recursive(t *testing.T) *Recursive {
+	r := New()
+	hints, err := parseHints(strings.NewReader(". 3600 NS a.root.test.\na.root.test. 3600 A 10.0.0.1\n"), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.hints = hints
+	r.exchange = w.exchange
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	w := newWorld(t)
+	r := w.recursive(t)
+
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		rcode  int
+		answer []string
+	}{
+		{"www.example.org.", dns.TypeA, dns.RcodeSuccess, []string{"www.example.org. A"}},
+		{"alias.example.org.", dns.TypeA, dns.RcodeSuccess, []string{"alias.example.org. CNAME", "www.example.net. A"}},
+		{"alias.example.org.", dns.TypeCNAME, dns.RcodeSuccess, []string{"alias.example.org. CNAME"}},
+		{"www.example.org.", dns.TypeMX, dns.RcodeSuccess, nil},
+		{"nx.example.org.", dns.TypeA, dns.RcodeNameError, nil},
+		{"deep.a.b.example.org.", dns.TypeA, dns.RcodeSuccess, []string{"deep.a.b.example.org. A"}},
+		{"example.org.", dns.TypeDS, dns.RcodeSuccess, nil},
+	}
+	for i, tc := range tests {
+		m, err := r.resolve(context.TODO(), tc.qname, tc.qtype, false, &work{}, 0)
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if m.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, m.Rcode)
+		}
+		answer := []string{}
+		for _, rr := range m.Answer {
+			answer = append(answer, rr.Header().Name+" "+dns.TypeToString[rr.Header().Rrtype])
+		}
+		if strings.Join(answer, ",") != strings.Join(tc.answer, ",") {
+			t.Errorf("Test %d: expected answer %v, got %v", i, tc.answer, answer)
+		}
+		if tc.rcode == dns.RcodeNameError && (len(m.Ns) == 0 || m.Ns[0].Header().Rrtype != dns.TypeSOA) {
+			t.Errorf("Test %d: expected the SOA record in the authority section", i)
+		}
+	}
+}
+
+func TestResolveMinimisation(t *testing.T) {
+	w := newWorld(t)
+	r := w.recursive(t)
+
+	if _, err := r.resolve(context.TODO(), "deep.a.b.example.org.", dns.TypeA, false, &work{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// The name server of ns.example.net. is asked about it, while looking up the name server of example.org.
+	expected := map[string][]string{
+		"10.0.0.1": {". NS", "org. A", "net. A"},
+		"10.0.0.2": {"example.org. A"},
+		"10.0.0.4": {"example.net. A", "ns.example.net. A"},
+		"10.0.0.3": {"b.example.org. A", "a.b.example.org. A", "deep.a.b.example.org. A"},
+	}
+	for addr, q := range expected {
+		if got := w.asked(addr); strings.Join(got, ",") != strings.Join(q, ",") {
+			t.Errorf("Expected %s to be asked %v, got %v", addr, q, got)
+		}
+	}
+
+	w.queries = nil
+	r = w.recursive(t)
+	r.minimise = false
+	if _, err := r.resolve(context.TODO(), "deep.a.b.example.org.", dns.TypeA, false, &work{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.asked("10.0.0.1"); strings.Join(got, ",") != ". NS,deep.a.b.example.org. A,ns.example.net. A" {
+		t.Errorf("Expected the root to be asked for the full names, got %v", got)
+	}
+}
+
+func TestResolveCached(t *testing.T) {
+	w := newWorld(t)
+	r := w.recursive(t)
+
+	if _, err := r.resolve(context.TODO(), "www.example.org.", dns.TypeA, false, &work{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	w.queries = nil
+	if _, err := r.resolve(context.TODO(), "nx.example.org.", dns.TypeA, false, &work{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// The delegation of example.org. and the address of its name server are cached.
+	if strings.Join(w.queries, ",") != "10.0.0.3 nx.example.org. A" {
+		t.Errorf("Expected only the name server of example.org. to be asked, got %v", w.queries)
+	}
+	if m, ok := r.cache.Get("example.org.", dns.TypeNS); !ok || len(m.Answer) != 1 {
+		t.Errorf("Expected the delegation of example.org. in the cache")
+	}
+}
+
+func TestResolveRetry(t *testing.T) {
+	w := newWorld(t)
+	r := w.recursive(t)
+	r.rtts.update("10.0.0.9", time.Millisecond) // it was fast
+
+	for i := 0; i < 5; i++ {
+		if _, err := r.resolve(context.TODO(), fmt.Sprintf("x%d.example.org.", i), dns.TypeNS, false, &work{}, 0); err != nil {
+			t.Fatal(err)
+		}
+		// Don't cache the delegation, so the name servers of org. are asked each time.
+		r.cache = New().cache
+		r.cache.Set(rootNS())
+	}
+	if len(w.asked("10.0.0.9")) != 1 {
+		t.Errorf("Expected the name server that is down to be asked once, got %v", w.asked("10.0.0.9"))
+	}
+	if r.rtts.get("10.0.0.9") <= r.rtts.get("10.0.0.2") {
+		t.Errorf("Expected the name server that is down to be slower")
+	}
+}
+
+func TestResolveExhausted(t *testing.T) {
+	w := newWorld(t)
+	r := w.recursive(t)
+	r.maxQueries = 4
+
+	if _, err := r.resolve(context.TODO(), "www.example.org.", dns.TypeA, false, &work{}, 0); err != errExhausted {
+		t.Errorf("Expected %s, got %v", errExhausted, err)
+	}
+	if len(w.queries) != 4 {
+		t.Errorf("Expected 4 queries, got %d", len(w.queries))
+	}
+}
+
+func TestServeDNS(t *testing.T) {
+	w := newWorld(t)
+	r := w.recursive(t)
+	r.Next = test.NextHandler(dns.RcodeRefused, nil)
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := r.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Msg.RecursionAvailable || rec.Msg.Authoritative || len(rec.Msg.Answer) != 1 {
+		t.Errorf("Expected a recursive answer, got %v", rec.Msg)
+	}
+
+	// Without RD we don't recurse.
+	m.RecursionDesired = false
+	if rcode, _ := r.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m); rcode != dns.RcodeRefused {
+		t.Errorf("Expected the next plugin to be called, got rcode %d", rcode)
+	}
+}
+
+// rootNS returns the primed NS records of the root zone.
+func rootNS() *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(".", dns.TypeNS)
+	m.Response, m.Authoritative = true, true
+	m.Answer = []dns.RR{test.NS(". 3600 IN NS a.root.test.")}
+	m.Extra = []dns.RR{test.A("a.root.test. 3600 IN A 10.0.0.1")}
+	return m
+}
+
+const rootZone = `$TTL 3600
+.		IN SOA a.root.test. hostmaster.root.test. 1 7200 3600 1209600 3600
+.		IN NS a.root.test.
+a.root.test.	IN A 10.0.0.1
+org.		IN NS ns1.org.
+org.		IN NS ns2.org.
+ns1.org.	IN A 10.0.0.2
+ns2.org.	IN A 10.0.0.9
+net.		IN NS ns.net.
+ns.net.		IN A 10.0.0.4
+`
+
+const orgZone = `$TTL 3600
+org.		IN SOA ns1.org. hostmaster.org. 1 7200 3600 1209600 3600
+org.		IN NS ns1.org.
+org.		IN NS ns2.org.
+ns1.org.	IN A 10.0.0.2
+ns2.org.	IN A 10.0.0.9
+example.org.	IN NS ns.example.net.
+`
+
+const netZone = `$TTL 3600
+net.		IN SOA ns.net. hostmaster.net. 1 7200 3600 1209600 3600
+net.		IN NS ns.net.
+ns.net.		IN A 10.0.0.4
+ns.example.net.	IN A 10.0.0.3
+www.example.net. IN A 127.0.0.2
+`
+
+const exampleOrgZone = `$TTL 3600
+example.org.		IN SOA ns.example.net. hostmaster.example.org. 1 7200 3600 1209600 3600
+example.org.		IN NS ns.example.net.
+www.example.org.	IN A 127.0.0.1
+alias.example.org.	IN CNAME www.example.net.
+deep.a.b.example.org.	IN A 127.0.0.3
+`
@@ -0,0 +1,67 @@
+package recursive
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+)
+
+// rtts tracks the smoothed round trip time to the name servers, by address. Entries are forgotten
+// after rttTTL, so servers that were down get another chance; lost entries are no problem either.
+type rtts struct {
+	c   *cache.Cache
+	now func() time.Time
+}
+
+type rtt struct {
+	d       time.Duration
+	updated time.Time
+}
+
+func newRTTs(size int) *rtts { return &rtts{c: cache.New(size), now: time.Now} }
+
+// get returns the smoothed round trip time to addr, unknownRTT for servers we don't know.
+func (r *rtts) get(addr string) time.Duration {
+	if x, ok := r.c.Get(cache.Hash([]byte(addr))); ok && r.now().Sub(x.(rtt).updated) < rttTTL {
+		return x.(rtt).d
+	}
+	return unknownRTT
+}
+
+// update adds the round trip time d of a reply from addr.
+func (r *rtts) update(addr string, d time.Duration) {
+	if old := r.get(addr); old != unknownRTT {
+		d = (7*old + 3*d) / 10
+	}
+	r.c.Add(cache.Hash([]byte(addr)), rtt{d, r.now()})
+}
+
+// fail records that addr didn't reply, or replied with an error: it is backed off.
+func (r *rtts) fail(addr string) {
+	d := 2*r.get(addr) + failRTT
+	if d > maxRTT {
+		d = maxRTT
+	}
+	r.c.Add(cache.Hash([]byte(addr)), rtt{d, r.now()})
+}
+
+// sort sorts addrs, fastest first. Servers with the same round trip time, the unknown ones, are
+// shuffled so the load is spread.
+func (r *rtts) sort(addrs []string) []string {
+	rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	d := make(map[string]time.Duration, len(addrs))
+	for _, a := range addrs {
+		d[a] = r.get(a)
+	}
+	sort.SliceStable(addrs, func(i, j int) bool { return d[addrs[i]] < d[addrs[j]] })
+	return addrs
+}
+
+const (
+	unknownRTT = 300 * time.Millisecond
+	failRTT    = 500 * time.Millisecond
+	maxRTT     = 30 * time.Second
+	rttTTL     = 15 * time.Minute
+)
@@ -0,0 +1,148 @@
+package recursive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/cache"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+
+	"github.com/mholt/caddy"
+)
+
+var log = clog.NewWithPlugin("recursive")
+
+func init() {
+	caddy.RegisterPlugin("recursive", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	r, err := recursiveParse(c)
+	if err != nil {
+		return plugin.Error("recursive", err)
+	}
+
+	// Do this in OnStartup, so all plugins have been initialized.
+	c.OnStartup(func() error {
+		m := dnsserver.GetConfig(c).Handler("cache")
+		if x, ok := m.(*cache.Cache); ok {
+			r.cache = x
+		}
+		return nil
+	})
+
+	c.OnStartup(func() error {
+		metrics.MustRegister(c, UpstreamCount, ExhaustedCount)
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		r.Next = next
+		return r
+	})
+
+	return nil
+}
+
+func recursiveParse(c *caddy.Controller) (*Recursive, error) {
+	r := New()
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		origins := make([]string, len(c.ServerBlockKeys))
+		copy(origins, c.ServerBlockKeys)
+		if args := c.RemainingArgs(); len(args) > 0 {
+			origins = args
+		}
+		for i := range origins {
+			origins[i] = plugin.Host(origins[i]).Normalize()
+		}
+		r.Zones = origins
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "root_hints":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				file := c.Val()
+				if !filepath.IsAbs(file) && config.Root != "" {
+					file = filepath.Join(config.Root, file)
+				}
+				hints, err := readHints(file)
+				if err != nil {
+					return nil, err
+				}
+				r.hints = hints
+			case "no_qname_minimisation":
+				r.minimise = false
+			case "max_queries":
+				n, err := positive(c)
+				if err != nil {
+					return nil, err
+				}
+				r.maxQueries = n
+			case "max_depth":
+				n, err := positive(c)
+				if err != nil {
+					return nil, err
+				}
+				r.maxDepth = n
+			case "port":
+				n, err := positive(c)
+				if err != nil {
+					return nil, err
+				}
+				if n > 65535 {
+					return nil, fmt.Errorf("port must be at most 65535: %d", n)
+				}
+				r.port = strconv.Itoa(n)
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+	}
+	return r, nil
+}
+
+func readHints(file string) (*delegation, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseHints(f, file)
+}
+
+// positive parses the next argument as a number larger than zero.
+func positive(c *caddy.Controller) (int, error) {
+	name := c.Val()
+	if !c.NextArg() {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(c.Val())
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%s must be positive: %d", name, n)
+	}
+	return n, nil
+}
@@ -0,0 +1,81 @@
+package recursive
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	const hints = "root.hints"
+	if err := ioutil.WriteFile(hints, []byte(". 3600 NS a.root.test.\na.root.test. 3600 A 10.0.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write root hints: %s", err)
+	}
+	defer os.Remove(hints)
+
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		expectedErr string
+		zones       []string
+		minimise    bool
+		maxQueries  int
+		maxDepth    int
+		roots       int
+		port        string
+	}{
+		{"recursive", false, "", []string{"."}, true, defaultMaxQueries, defaultMaxDepth, 13, "53"},
+		{"recursive example.org", false, "", []string{"example.org."}, true, defaultMaxQueries, defaultMaxDepth, 13, "53"},
+		{"recursive {\nroot_hints " + hints + "\n}", false, "", []string{"."}, true, defaultMaxQueries, defaultMaxDepth, 1, "53"},
+		{"recursive {\nno_qname_minimisation\nmax_queries 10\nmax_depth 2\n}", false, "", []string{"."}, false, 10, 2, 13, "53"},
+		{"recursive {\nport 1053\n}", false, "", []string{"."}, true, defaultMaxQueries, defaultMaxDepth, 13, "1053"},
+		// fail
+		{"recursive {\nroot_hints\n}", true, "Wrong argument count", nil, false, 0, 0, 0, ""},
+		{"recursive {\nroot_hints /does/not/exist\n}", true, "no such file", nil, false, 0, 0, 0, ""},
+		{"recursive {\nroot_hints setup.go\n}", true, "setup.go", nil, false, 0, 0, 0, ""},
+		{"recursive {\nmax_queries 0\n}", true, "must be positive", nil, false, 0, 0, 0, ""},
+		{"recursive {\nmax_depth x\n}", true, "invalid syntax", nil, false, 0, 0, 0, ""},
+		{"recursive {\nport 65536\n}", true, "at most 65535", nil, false, 0, 0, 0, ""},
+		{"recursive {\nno_qname_minimisation yes\n}", true, "Wrong argument count", nil, false, 0, 0, 0, ""},
+		{"recursive {\nblah\n}", true, "unknown property", nil, false, 0, 0, 0, ""},
+		{"recursive\nrecursive", true, "plugin", nil, false, 0, 0, 0, ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		c.ServerBlockKeys = []string{"."}
+		r, err := recursiveParse(c)
+
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			} else if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			continue
+		}
+
+		if strings.Join(r.Zones, ",") != strings.Join(test.zones, ",") {
+			t.Errorf("Test %d: expected zones %v, got %v", i, test.zones, r.Zones)
+		}
+		if r.minimise != test.minimise {
+			t.Errorf("Test %d: expected minimise %t, got %t", i, test.minimise, r.minimise)
+		}
+		if r.maxQueries != test.maxQueries || r.maxDepth != test.maxDepth {
+			t.Errorf("Test %d: expected limits %d and %d, got %d and %d", i, test.maxQueries, test.maxDepth, r.maxQueries, r.maxDepth)
+		}
+		if r.port != test.port {
+			t.Errorf("Test %d: expected port %s, got %s", i, test.port, r.port)
+		}
+		if len(r.hints.ns) != test.roots {
+			t.Errorf("Test %d: expected %d root name servers, got %d", i, test.roots, len(r.hints.ns))
+		}
+	}
+}
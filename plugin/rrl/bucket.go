@@ -0,0 +1,49 @@
+package rrl
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket that accounts the responses sent for a single key.
+type bucket struct {
+	sync.Mutex
+
+	// balance is the number of responses that may still be sent. It is credited with rate every
+	// second, up to rate, and debited for every response. A negative balance means the responses
+	// are being limited; it can go down to -rate*window, which means a client needs to stay below
+	// the rate for up to window before it is no longer limited.
+	balance float64
+	last    time.Time
+
+	// limited counts the responses that were limited, it is used to decide when to slip.
+	limited int
+}
+
+// debit credits the bucket for the time passed since the last response and debits it for the
+// current response. It returns the new balance and the number of limited responses so far.
+func (b *bucket) debit(now time.Time, rate float64, window time.Duration) (float64, int) {
+	b.Lock()
+	defer b.Unlock()
+
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.balance += elapsed * rate
+		b.last = now
+	}
+	if b.balance > rate {
+		b.balance = rate
+	}
+
+	b.balance--
+	if min := -rate * window.Seconds(); b.balance < min {
+		b.balance = min
+	}
+
+	if b.balance >= 0 {
+		b.limited = 0
+		return b.balance, 0
+	}
+	b.limited++
+	return b.balance, b.limited
+}
@@ -0,0 +1,24 @@
+package rrl
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ResponsesDropped is the number of responses that were dropped because they exceeded the rate.
+	ResponsesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "rrl",
+		Name:      "responses_dropped_total",
+		Help:      "Counter of responses dropped due to exceeding the rate limit.",
+	}, []string{"server", "zone"})
+	// ResponsesSlipped is the number of responses that were replaced with a truncated reply.
+	ResponsesSlipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "rrl",
+		Name:      "responses_slipped_total",
+		Help:      "Counter of truncated responses sent instead of responses that exceeded the rate limit.",
+	}, []string{"server", "zone"})
+)
@@ -0,0 +1,58 @@
+package rrl
+
+import (
+	"strconv"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// ResponseWriter accounts every response in the RRL table and drops or truncates the
+// responses that exceed the configured rate.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	rrl    *RRL
+	state  request.Request
+	server string
+	zone   string
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
+	cl, name, ok := classify(res, w.rrl.now())
+	if !ok {
+		return w.ResponseWriter.WriteMsg(res)
+	}
+
+	key := w.rrl.netblock(w.state.IP()) + "/" + strconv.Itoa(int(cl)) + "/" + name
+	switch w.rrl.debit(key, cl) {
+	case actionDrop:
+		ResponsesDropped.WithLabelValues(w.server, w.zone).Inc()
+		if w.rrl.reportOnly {
+			break
+		}
+		return nil
+
+	case actionSlip:
+		ResponsesSlipped.WithLabelValues(w.server, w.zone).Inc()
+		if w.rrl.reportOnly {
+			break
+		}
+		// Send an empty truncated reply, this makes a legitimate client retry over TCP.
+		m := new(dns.Msg)
+		m.SetReply(w.state.Req)
+		m.Truncated = true
+		w.state.SizeAndDo(m)
+		return w.ResponseWriter.WriteMsg(m)
+	}
+
+	return w.ResponseWriter.WriteMsg(res)
+}
+
+// Write implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) Write(buf []byte) (int, error) {
+	log.Warning("RRL called with Write: not rate limiting reply")
+	n, err := w.ResponseWriter.Write(buf)
+	return n, err
+}
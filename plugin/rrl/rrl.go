@@ -0,0 +1,181 @@
+// Package rrl implements Response Rate Limiting (RRL) for UDP responses.
+package rrl
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// RRL limits the rate of responses sent to a client netblock. Responses are accounted in token
+// buckets keyed by the client's netblock, the response class and the name the response is about.
+type RRL struct {
+	Next  plugin.Handler
+	Zones []string
+
+	window           time.Duration
+	ipv4PrefixLength int
+	ipv6PrefixLength int
+
+	// rates holds the allowed responses per second for each response class. A zero rate disables
+	// limiting for that class.
+	rates [classes]float64
+
+	slipRatio  int
+	reportOnly bool
+
+	table *cache.Cache
+	now   func() time.Time
+}
+
+// New returns an initialized RRL with the default settings.
+func New() *RRL {
+	return &RRL{
+		window:           defaultWindow,
+		ipv4PrefixLength: defaultIPv4PrefixLength,
+		ipv6PrefixLength: defaultIPv6PrefixLength,
+		slipRatio:        defaultSlipRatio,
+		table:            newTable(defaultMaxTableSize),
+		now:              time.Now,
+	}
+}
+
+// newTable returns a table for size buckets. It evicts the least recently used buckets: TinyLFU would
+// refuse new buckets when the table is full, so their rate would start over on every query.
+func newTable(size int) *cache.Cache { return cache.NewWithPolicy(size, cache.NewSLRU) }
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *RRL) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if state.Proto() != "udp" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	zone := plugin.Zones(rl.Zones).Matches(state.Name())
+	if zone == "" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	// Clients that sent a valid server cookie are not spoofed, don't limit those.
+	if cookie.Valid(ctx) {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	rw := &ResponseWriter{ResponseWriter: w, rrl: rl, state: state, server: metrics.WithServer(ctx), zone: zone}
+	return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, rw, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (rl *RRL) Name() string { return "rrl" }
+
+// class is the response class a response is accounted under.
+type class int
+
+const (
+	classResponse class = iota
+	classNodata
+	classNXDomain
+	classReferral
+	classError
+	classes
+)
+
+// classify returns the response class of m and the name the response should be accounted for.
+// Responses that should not be rate limited return false.
+func classify(m *dns.Msg, now time.Time) (class, string, bool) {
+	typ, _ := response.Typify(m, now)
+	switch typ {
+	case response.NoError:
+		return classResponse, qnameType(m), true
+	case response.NoData:
+		return classNodata, qnameType(m), true
+	case response.NameError:
+		// All NXDOMAINs for one zone share a bucket, otherwise random subdomains would never be limited.
+		return classNXDomain, authOwner(m, dns.TypeSOA), true
+	case response.Delegation:
+		return classReferral, authOwner(m, dns.TypeNS), true
+	case response.ServerError, response.OtherError:
+		return classError, "", true
+	}
+	return classResponse, "", false
+}
+
+func qnameType(m *dns.Msg) string {
+	if len(m.Question) == 0 {
+		return ""
+	}
+	return m.Question[0].Name + "/" + strconv.Itoa(int(m.Question[0].Qtype))
+}
+
+// authOwner returns the owner name of the first record of type typ in the authority section.
+func authOwner(m *dns.Msg, typ uint16) string {
+	for _, r := range m.Ns {
+		if r.Header().Rrtype == typ {
+			return r.Header().Name
+		}
+	}
+	return ""
+}
+
+// netblock returns the netblock of ip according to the configured prefix lengths.
+func (rl *RRL) netblock(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(rl.ipv4PrefixLength, 32)).String()
+	}
+	return addr.Mask(net.CIDRMask(rl.ipv6PrefixLength, 128)).String()
+}
+
+// action is the verdict of the rate limiter for a single response.
+type action int
+
+const (
+	actionSend action = iota
+	actionDrop
+	actionSlip
+)
+
+// debit accounts one response for key and returns what to do with it.
+func (rl *RRL) debit(key string, cl class) action {
+	rate := rl.rates[cl]
+	if rate == 0 {
+		return actionSend
+	}
+
+	b := rl.bucket(cache.Hash([]byte(key)), rate)
+	balance, limited := b.debit(rl.now(), rate, rl.window)
+	if balance >= 0 {
+		return actionSend
+	}
+	if rl.slipRatio > 0 && limited%rl.slipRatio == 0 {
+		return actionSlip
+	}
+	return actionDrop
+}
+
+// bucket returns the bucket for k, it is added to the table with a balance of rate if there is none.
+func (rl *RRL) bucket(k uint64, rate float64) *bucket {
+	v, _ := rl.table.GetOrAdd(k, func() interface{} { return &bucket{balance: rate, last: rl.now()} })
+	return v.(*bucket)
+}
+
+const (
+	defaultWindow           = 15 * time.Second
+	defaultIPv4PrefixLength = 24
+	defaultIPv6PrefixLength = 56
+	defaultSlipRatio        = 2
+	defaultMaxTableSize     = 100000
+)
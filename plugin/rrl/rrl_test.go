@@ -0,0 +1,195 @@
+package rrl
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// next replies with an A record for every query, or with NXDOMAIN for names starting with "nx".
+var next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	if strings.HasPrefix(r.Question[0].Name, "nx") {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{test.SOA("example.org. 300 IN SOA ns.example.org. admin.example.org. 1 3600 600 86400 300")}
+	} else {
+		m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 127.0.0.1")}
+	}
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+})
+
+func newTestRRL(now *time.Time) *RRL {
+	rl := New()
+	rl.Zones = []string{"example.org."}
+	rl.rates = [classes]float64{2, 2, 2, 2, 2}
+	rl.window = 2 * time.Second
+	rl.slipRatio = 2
+	rl.now = func() time.Time { return *now }
+	rl.Next = next
+	return rl
+}
+
+func query(rl *RRL, w dns.ResponseWriter, qname string) *dns.Msg {
+	return queryContext(context.TODO(), rl, w, qname)
+}
+
+func queryContext(ctx context.Context, rl *RRL, w dns.ResponseWriter, qname string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	rec := dnstest.NewRecorder(w)
+	rl.ServeDNS(ctx, rec, m)
+	return rec.Msg
+}
+
+func TestRRLLimit(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(&now)
+
+	// The first two responses are within the rate.
+	for i := 0; i < 2; i++ {
+		if m := query(rl, &test.ResponseWriter{}, "a.example.org."); m == nil || m.Truncated || len(m.Answer) != 1 {
+			t.Fatalf("Expected response %d to be sent, got %v", i, m)
+		}
+	}
+	// The next ones alternate between dropped and slipped.
+	if m := query(rl, &test.ResponseWriter{}, "a.example.org."); m != nil {
+		t.Errorf("Expected response to be dropped, got %v", m)
+	}
+	if m := query(rl, &test.ResponseWriter{}, "a.example.org."); m == nil || !m.Truncated || len(m.Answer) != 0 {
+		t.Errorf("Expected response to be slipped, got %v", m)
+	}
+
+	// Another name is accounted in a different bucket.
+	if m := query(rl, &test.ResponseWriter{}, "b.example.org."); m == nil || len(m.Answer) != 1 {
+		t.Errorf("Expected response to be sent, got %v", m)
+	}
+	// Names outside of the zones are not limited.
+	for i := 0; i < 5; i++ {
+		if m := query(rl, &test.ResponseWriter{}, "a.example.net."); m == nil || len(m.Answer) != 1 {
+			t.Errorf("Expected response for name outside zone to be sent, got %v", m)
+		}
+	}
+	// TCP is never limited.
+	if m := query(rl, &test.ResponseWriter{TCP: true}, "a.example.org."); m == nil || len(m.Answer) != 1 {
+		t.Errorf("Expected TCP response to be sent, got %v", m)
+	}
+
+	// After the window has passed the client is allowed again.
+	now = now.Add(3 * time.Second)
+	if m := query(rl, &test.ResponseWriter{}, "a.example.org."); m == nil || len(m.Answer) != 1 {
+		t.Errorf("Expected response to be sent after window, got %v", m)
+	}
+}
+
+func TestRRLSlipEDNS0(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(&now)
+	rl.slipRatio = 1
+
+	m := new(dns.Msg)
+	m.SetQuestion("a.example.org.", dns.TypeA)
+	m.SetEdns0(1232, false)
+	var rec *dnstest.Recorder
+	for i := 0; i < 3; i++ {
+		rec = dnstest.NewRecorder(&test.ResponseWriter{})
+		rl.ServeDNS(context.TODO(), rec, m)
+	}
+	if rec.Msg == nil || !rec.Msg.Truncated {
+		t.Fatalf("Expected response to be slipped, got %v", rec.Msg)
+	}
+	if opt := rec.Msg.IsEdns0(); opt == nil || opt.UDPSize() != 1232 {
+		t.Errorf("Expected slipped response to an EDNS0 query to have an OPT record of 1232, got %v", opt)
+	}
+}
+
+func TestRRLConcurrent(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(&now)
+	rl.slipRatio = 0
+
+	// All responses for a new key are accounted in one bucket, so only the rate is sent.
+	var sent int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if m := query(rl, &test.ResponseWriter{}, "a.example.org."); m != nil {
+				atomic.AddInt32(&sent, 1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if sent != 2 {
+		t.Errorf("Expected 2 responses to be sent, got %d", sent)
+	}
+}
+
+func TestRRLNXDomain(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(&now)
+	rl.slipRatio = 0
+
+	// Random subdomains share the bucket of the zone.
+	query(rl, &test.ResponseWriter{}, "nx1.example.org.")
+	query(rl, &test.ResponseWriter{}, "nx2.example.org.")
+	if m := query(rl, &test.ResponseWriter{}, "nx3.example.org."); m != nil {
+		t.Errorf("Expected NXDOMAIN response to be dropped, got %v", m)
+	}
+}
+
+func TestRRLReportOnly(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(&now)
+	rl.reportOnly = true
+
+	for i := 0; i < 5; i++ {
+		if m := query(rl, &test.ResponseWriter{}, "a.example.org."); m == nil || len(m.Answer) != 1 {
+			t.Errorf("Expected response %d to be sent in report-only mode, got %v", i, m)
+		}
+	}
+}
+
+func TestRRLValidCookie(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(&now)
+
+	ctx := cookie.NewContext(context.TODO(), true)
+	for i := 0; i < 5; i++ {
+		if m := queryContext(ctx, rl, &test.ResponseWriter{}, "a.example.org."); m == nil || len(m.Answer) != 1 {
+			t.Errorf("Expected response %d to a client with a valid cookie to be sent, got %v", i, m)
+		}
+	}
+}
+
+func TestNetblock(t *testing.T) {
+	rl := New()
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"10.240.0.1", "10.240.0.0"},
+		{"fe80::42:ff:feca:4c65", "fe80::"},
+		{"2001:db8:1:ff00::1", "2001:db8:1:ff00::"},
+	}
+	for i, tc := range tests {
+		if got := rl.netblock(tc.ip); got != tc.expected {
+			t.Errorf("Test %d: expected netblock %s, got %s", i, tc.expected, got)
+		}
+	}
+}
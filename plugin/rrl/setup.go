@@ -0,0 +1,159 @@
+package rrl
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+
+	"github.com/mholt/caddy"
+)
+
+var log = clog.NewWithPlugin("rrl")
+
+func init() {
+	caddy.RegisterPlugin("rrl", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	rl, err := rrlParse(c)
+	if err != nil {
+		return plugin.Error("rrl", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	c.OnStartup(func() error {
+		metrics.MustRegister(c, ResponsesDropped, ResponsesSlipped)
+		return nil
+	})
+
+	return nil
+}
+
+func rrlParse(c *caddy.Controller) (*RRL, error) {
+	rl := New()
+
+	// Rates of the other classes default to responses-per-second, unless set explicitly.
+	rates := [classes]float64{-1, -1, -1, -1, -1}
+	size := defaultMaxTableSize
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.Zones = c.RemainingArgs()
+		if len(rl.Zones) == 0 {
+			rl.Zones = make([]string, len(c.ServerBlockKeys))
+			copy(rl.Zones, c.ServerBlockKeys)
+		}
+		for i := range rl.Zones {
+			rl.Zones[i] = plugin.Host(rl.Zones[i]).Normalize()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "window":
+				n, err := intArg(c, 1, 3600)
+				if err != nil {
+					return nil, err
+				}
+				rl.window = time.Duration(n) * time.Second
+			case "ipv4-prefix-length":
+				n, err := intArg(c, 1, 32)
+				if err != nil {
+					return nil, err
+				}
+				rl.ipv4PrefixLength = n
+			case "ipv6-prefix-length":
+				n, err := intArg(c, 1, 128)
+				if err != nil {
+					return nil, err
+				}
+				rl.ipv6PrefixLength = n
+			case "slip-ratio":
+				n, err := intArg(c, 0, 10)
+				if err != nil {
+					return nil, err
+				}
+				rl.slipRatio = n
+			case "max-table-size":
+				n, err := intArg(c, 1, 1<<30)
+				if err != nil {
+					return nil, err
+				}
+				size = n
+			case "report-only":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				rl.reportOnly = true
+			default:
+				cl, ok := rateProperties[c.Val()]
+				if !ok {
+					return nil, c.Errf("unknown property '%s'", c.Val())
+				}
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				f, err := strconv.ParseFloat(args[0], 64)
+				if err != nil || f < 0 {
+					return nil, c.Errf("%s needs a positive number, got %q", c.Val(), args[0])
+				}
+				rates[cl] = f
+			}
+		}
+	}
+
+	if rates[classResponse] < 0 {
+		rates[classResponse] = 0
+	}
+	for cl := range rates {
+		if rates[cl] < 0 {
+			rates[cl] = rates[classResponse]
+		}
+	}
+	rl.rates = rates
+	rl.table = newTable(size)
+
+	return rl, nil
+}
+
+// rateProperties maps the properties that set a rate to the response class they apply to.
+var rateProperties = map[string]class{
+	"responses-per-second": classResponse,
+	"nodata-per-second":    classNodata,
+	"nxdomains-per-second": classNXDomain,
+	"referrals-per-second": classReferral,
+	"errors-per-second":    classError,
+}
+
+// intArg parses the single argument of the current property as an integer in [min, max].
+func intArg(c *caddy.Controller, min, max int) (int, error) {
+	name := c.Val()
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, c.Errf("%s needs a number, got %q", name, args[0])
+	}
+	if n < min || n > max {
+		return 0, c.Errf("%s must be between %d and %d, got %d", name, min, max, n)
+	}
+	return n, nil
+}
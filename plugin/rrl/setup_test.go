@@ -0,0 +1,81 @@
+package rrl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetupRRL(t *testing.T) {
+	tests := []struct {
+		input          string
+		shouldErr      bool
+		expectedWindow time.Duration
+		expectedRates  [classes]float64
+		expectedSlip   int
+	}{
+		{`rrl`, false, defaultWindow, [classes]float64{0, 0, 0, 0, 0}, defaultSlipRatio},
+		{`rrl {
+			responses-per-second 10
+		}`, false, defaultWindow, [classes]float64{10, 10, 10, 10, 10}, defaultSlipRatio},
+		{`rrl example.org {
+			window 5
+			responses-per-second 10
+			nxdomains-per-second 2.5
+			errors-per-second 0
+			slip-ratio 0
+		}`, false, 5 * time.Second, [classes]float64{10, 10, 2.5, 10, 0}, 0},
+		{`rrl {
+			ipv4-prefix-length 32
+			ipv6-prefix-length 64
+			max-table-size 1000
+			report-only
+		}`, false, defaultWindow, [classes]float64{0, 0, 0, 0, 0}, defaultSlipRatio},
+		// fails
+		{`rrl {
+			window 0
+		}`, true, 0, [classes]float64{}, 0},
+		{`rrl {
+			ipv4-prefix-length 33
+		}`, true, 0, [classes]float64{}, 0},
+		{`rrl {
+			responses-per-second -1
+		}`, true, 0, [classes]float64{}, 0},
+		{`rrl {
+			responses-per-second
+		}`, true, 0, [classes]float64{}, 0},
+		{`rrl {
+			slip-ratio 11
+		}`, true, 0, [classes]float64{}, 0},
+		{`rrl {
+			blah
+		}`, true, 0, [classes]float64{}, 0},
+		{`rrl
+		  rrl`, true, 0, [classes]float64{}, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		rl, err := rrlParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			continue
+		}
+		if rl.window != test.expectedWindow {
+			t.Errorf("Test %d: expected window %s, got %s", i, test.expectedWindow, rl.window)
+		}
+		if rl.rates != test.expectedRates {
+			t.Errorf("Test %d: expected rates %v, got %v", i, test.expectedRates, rl.rates)
+		}
+		if rl.slipRatio != test.expectedSlip {
+			t.Errorf("Test %d: expected slip ratio %d, got %d", i, test.expectedSlip, rl.slipRatio)
+		}
+	}
+}
@@ -1,15 +1,23 @@
 package secondary
 
 import (
+	"path/filepath"
+	"strings"
+
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 
 	"github.com/mholt/caddy"
 )
 
+var log = clog.NewWithPlugin("secondary")
+
 func init() {
 	caddy.RegisterPlugin("secondary", caddy.Plugin{
 		ServerType: "dns",
@@ -29,6 +37,11 @@ func setup(c *caddy.Controller) error {
 		if len(z.TransferFrom) > 0 {
 			c.OnStartup(func() error {
 				z.StartupOnce.Do(func() {
+					if z.Persist {
+						if err := z.ReadFile(); err != nil {
+							log.Warningf("Failed to load zone from %q: %s", z.File(), err)
+						}
+					}
 					z.TransferIn()
 					go func() {
 						z.Update()
@@ -36,9 +49,15 @@ func setup(c *caddy.Controller) error {
 				})
 				return nil
 			})
+			c.OnShutdown(z.OnShutdown)
 		}
 	}
 
+	c.OnStartup(func() error {
+		metrics.MustRegister(c, file.TransferCount, file.TransferDuration, file.TransferSerial, file.Staleness)
+		return nil
+	})
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		return Secondary{file.File{Next: next, Zones: zones}}
 	})
@@ -50,6 +69,7 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 	z := make(map[string]*file.Zone)
 	names := []string{}
 	upstr := upstream.New()
+	config := dnsserver.GetConfig(c)
 	for c.Next() {
 
 		if c.Val() == "secondary" {
@@ -69,16 +89,39 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 			for c.NextBlock() {
 
 				t, f := []string{}, []string{}
-				var e error
+				var (
+					key     tsig.Key
+					name    string
+					e       error
+					persist bool
+					dir     string
+				)
 
 				switch c.Val() {
 				case "transfer":
-					t, f, e = parse.Transfer(c, true)
+					t, f, name, e = parse.Transfer(c, true)
 					if e != nil {
 						return file.Zones{}, e
 					}
+					if name != "" {
+						if key, e = config.TsigKeys.Get(name); e != nil {
+							return file.Zones{}, c.Err(e.Error())
+						}
+					}
 				case "upstream":
 					c.RemainingArgs() // eat args
+				case "persist":
+					args := c.RemainingArgs()
+					if len(args) > 1 {
+						return file.Zones{}, c.ArgErr()
+					}
+					persist, dir = true, config.Root
+					if len(args) == 1 {
+						dir = args[0]
+						if !filepath.IsAbs(dir) && config.Root != "" {
+							dir = filepath.Join(config.Root, dir)
+						}
+					}
 				default:
 					return file.Zones{}, c.Errf("unknown property '%s'", c.Val())
 				}
@@ -90,6 +133,20 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 					if f != nil {
 						z[origin].TransferFrom = append(z[origin].TransferFrom, f...)
 					}
+					if name != "" {
+						if z[origin].TransferKeys == nil {
+							z[origin].TransferKeys = map[string]tsig.Key{}
+						}
+						for _, addrs := range [][]string{t, f} {
+							for _, addr := range addrs {
+								z[origin].TransferKeys[addr] = key
+							}
+						}
+					}
+					if persist {
+						z[origin].Persist = true
+						z[origin].SetFile(filepath.Join(dir, fileName(origin)))
+					}
 					z[origin].Upstream = upstr
 				}
 			}
@@ -97,3 +154,12 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 	}
 	return file.Zones{Z: z, Names: names}, nil
 }
+
+// fileName returns the name of the file the zone origin is persisted to: "db." followed by the origin
+// without the trailing dot, as the *auto* plugin expects by default.
+func fileName(origin string) string {
+	if origin == "." {
+		return "db.root"
+	}
+	return "db." + strings.TrimSuffix(origin, ".")
+}
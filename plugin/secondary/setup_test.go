@@ -3,7 +3,11 @@ package secondary
 import (
 	"testing"
 
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
 	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
 )
 
 func TestSecondaryParse(t *testing.T) {
@@ -63,3 +67,88 @@ func TestSecondaryParse(t *testing.T) {
 		}
 	}
 }
+
+func TestSecondaryParseTsig(t *testing.T) {
+	c := caddy.NewTestController("dns", `secondary example.org {
+		transfer from 127.0.0.1 key xfr.example.org.
+		transfer to 127.0.0.2
+	}`)
+	dnsserver.GetConfig(c).TsigKeys = tsig.Keys{"xfr.example.org.": {Name: "xfr.example.org.", Algorithm: dns.HmacSHA256, Secret: "c2VjcmV0"}}
+	s, err := secondaryParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	z := s.Z["example.org."]
+	if z.TransferKeys["127.0.0.1:53"].Name != "xfr.example.org." {
+		t.Errorf("Expected key for transfers from 127.0.0.1:53, got %v", z.TransferKeys)
+	}
+	if _, ok := z.TransferKeys["127.0.0.2:53"]; ok {
+		t.Errorf("Expected no key for transfers to 127.0.0.2:53")
+	}
+
+	c = caddy.NewTestController("dns", `secondary example.org {
+		transfer from 127.0.0.1 key unknown.example.org.
+	}`)
+	if _, err := secondaryParse(c); err == nil {
+		t.Errorf("Expected error for undeclared key")
+	}
+}
+
+func TestSecondaryParsePersist(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		file      string
+	}{
+		{`secondary example.org {
+			transfer from 127.0.0.1
+		}`, false, ""},
+		{`secondary example.org {
+			transfer from 127.0.0.1
+			persist
+		}`, false, "/var/lib/coredns/db.example.org"},
+		{`secondary example.org {
+			transfer from 127.0.0.1
+			persist zones
+		}`, false, "/var/lib/coredns/zones/db.example.org"},
+		{`secondary example.org {
+			transfer from 127.0.0.1
+			persist /tmp
+		}`, false, "/tmp/db.example.org"},
+		{`secondary example.org {
+			transfer from 127.0.0.1
+			persist /tmp zones
+		}`, true, ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		dnsserver.GetConfig(c).Root = "/var/lib/coredns"
+		zones, err := secondaryParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		z := zones.Z["example.org."]
+		if z.Persist != (test.file != "") {
+			t.Errorf("Test %d: expected persist %t, got %t", i, test.file != "", z.Persist)
+		}
+		if test.file != "" && z.File() != test.file {
+			t.Errorf("Test %d: expected file %q, got %q", i, test.file, z.File())
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	for origin, want := range map[string]string{"example.org.": "db.example.org", ".": "db.root"} {
+		if got := fileName(origin); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, origin, got)
+		}
+	}
+}
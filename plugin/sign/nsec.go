@@ -0,0 +1,84 @@
+package sign
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// nsecChain returns the NSEC records linking the authoritative names, in canonical order, of the zone
+// origin (RFC 4034, Section 4).
+func nsecChain(origin string, names []owner, ttl uint32) []dns.RR {
+	nsecs := make([]dns.RR, len(names))
+	for i, n := range names {
+		nsecs[i] = &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: n.name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: ttl},
+			NextDomain: names[(i+1)%len(names)].name,
+			TypeBitMap: bitmap(n.types, dns.TypeRRSIG, dns.TypeNSEC),
+		}
+	}
+	return nsecs
+}
+
+// nsec3Chain returns the NSEC3 records, with the parameters of param, linking the hashes of the
+// authoritative names and empty non-terminals of the zone origin (RFC 5155, Section 7.1). Opt-out is
+// not used.
+func nsec3Chain(origin string, names []owner, param *dns.NSEC3PARAM, ttl uint32) []dns.RR {
+	types := map[string][]uint16{}
+	for _, n := range names {
+		t := n.types
+		if !n.cut || hasType(n.types, dns.TypeDS) {
+			t = bitmap(t, dns.TypeRRSIG)
+		}
+		types[n.name] = t
+
+		// Empty non-terminals get an NSEC3 record too.
+		for name := n.name; name != origin; {
+			i, end := dns.NextLabel(name, 0)
+			if end {
+				break
+			}
+			name = name[i:]
+			if _, ok := types[name]; !ok {
+				types[name] = nil
+			}
+		}
+	}
+
+	hashes := make([]string, 0, len(types))
+	bitmaps := make(map[string][]uint16, len(types))
+	for name, t := range types {
+		h := dns.HashName(name, param.Hash, param.Iterations, param.Salt)
+		hashes = append(hashes, h)
+		bitmaps[h] = bitmap(t)
+	}
+	sort.Strings(hashes)
+
+	nsec3s := make([]dns.RR, len(hashes))
+	for i, h := range hashes {
+		nsec3s[i] = &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(h) + "." + origin, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: ttl},
+			Hash:       param.Hash,
+			Iterations: param.Iterations,
+			SaltLength: param.SaltLength,
+			Salt:       param.Salt,
+			HashLength: 20, // SHA1
+			NextDomain: hashes[(i+1)%len(hashes)],
+			TypeBitMap: bitmaps[h],
+		}
+	}
+	return nsec3s
+}
+
+// bitmap returns the sorted type bitmap of types, with extra added.
+func bitmap(types []uint16, extra ...uint16) []uint16 {
+	b := make([]uint16, 0, len(types)+len(extra))
+	for _, t := range append(types, extra...) {
+		if !hasType(b, t) {
+			b = append(b, t)
+		}
+	}
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return b
+}
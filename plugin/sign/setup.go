@@ -0,0 +1,148 @@
+package sign
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/dnssec"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("sign")
+
+func init() {
+	caddy.RegisterPlugin("sign", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	s, err := signParse(c)
+	if err != nil {
+		return plugin.Error("sign", err)
+	}
+
+	config := dnsserver.GetConfig(c)
+	c.OnStartup(func() error {
+		// Do this in OnStartup, so all plugins have been initialized.
+		s.sources = config.Handlers
+		s.check(time.Now().UTC())
+		go s.run()
+		return nil
+	})
+	c.OnShutdown(s.OnShutdown)
+
+	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		s.Next = next
+		return s
+	})
+
+	return nil
+}
+
+func signParse(c *caddy.Controller) (*Sign, error) {
+	var s *Sign
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		origins := make([]string, len(c.ServerBlockKeys))
+		copy(origins, c.ServerBlockKeys)
+		args := c.RemainingArgs()
+		if len(args) > 0 {
+			origins = args
+		}
+		for i := range origins {
+			origins[i] = plugin.Host(origins[i]).Normalize()
+		}
+		s = New(origins, nil)
+		s.directory = config.Root
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "key":
+				if !c.NextArg() || c.Val() != "file" {
+					return nil, c.ArgErr()
+				}
+				ks := c.RemainingArgs()
+				if len(ks) == 0 {
+					return nil, c.ArgErr()
+				}
+				keys, err := dnssec.ParseKeyFiles(config.Root, ks)
+				if err != nil {
+					return nil, err
+				}
+				s.keys = append(s.keys, keys...)
+
+			case "directory":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				s.directory = args[0]
+				if !filepath.IsAbs(s.directory) && config.Root != "" {
+					s.directory = filepath.Join(config.Root, s.directory)
+				}
+
+			case "nsec3":
+				param, err := nsec3Parse(c)
+				if err != nil {
+					return nil, err
+				}
+				s.nsec3 = param
+
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	if len(s.keys) == 0 {
+		return nil, c.Err("no keys to sign with")
+	}
+	return s, nil
+}
+
+// nsec3Parse parses the arguments of nsec3: [ITERATIONS [SALT]]. There are no iterations and no salt by
+// default, as RFC 9276 recommends.
+func nsec3Parse(c *caddy.Controller) (*dns.NSEC3PARAM, error) {
+	param := &dns.NSEC3PARAM{Hash: dns.SHA1}
+	args := c.RemainingArgs()
+	if len(args) > 2 {
+		return nil, c.ArgErr()
+	}
+	if len(args) > 0 {
+		n, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil || n > maxIterations {
+			return nil, c.Errf("invalid NSEC3 iterations '%s'", args[0])
+		}
+		param.Iterations = uint16(n)
+	}
+	if len(args) > 1 && args[1] != "-" {
+		salt, err := hex.DecodeString(args[1])
+		if err != nil || len(salt) > 255 {
+			return nil, c.Errf("invalid NSEC3 salt '%s'", args[1])
+		}
+		param.Salt = strings.ToUpper(hex.EncodeToString(salt))
+		param.SaltLength = uint8(len(salt))
+	}
+	return param, nil
+}
+
+// maxIterations is the highest number of NSEC3 iterations allowed. Validators commonly treat zones using
+// more as insecure (RFC 9276, Section 3.2).
+const maxIterations = 150
@@ -0,0 +1,153 @@
+package sign
+
+import (
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+// newKey generates a key for example.org with flags in dir, and returns its basename.
+func newKey(t *testing.T, dir string, flags uint16) string {
+	k := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := k.Generate(256)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	base := fmt.Sprintf("Kexample.org.+%03d+%05d", k.Algorithm, k.KeyTag())
+	if err := ioutil.WriteFile(filepath.Join(dir, base+".key"), []byte(k.String()+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write key: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, base+".private"), []byte(k.PrivateKeyString(priv.(crypto.PrivateKey))), 0600); err != nil {
+		t.Fatalf("Failed to write key: %s", err)
+	}
+	return base
+}
+
+func TestSignParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	zsk, ksk := newKey(t, dir, 256), newKey(t, dir, 257)
+
+	tests := []struct {
+		input      string
+		shouldErr  bool
+		origins    []string
+		keys       int
+		directory  string
+		iterations int // -1 for NSEC
+		salt       string
+	}{
+		{`sign {
+			key file ` + zsk + `
+		}`, false, []string{"example.org."}, 1, dir, -1, ""},
+		{`sign example.org example.net {
+			key file ` + zsk + ` ` + ksk + `.key
+			directory signed
+		}`, false, []string{"example.org.", "example.net."}, 2, filepath.Join(dir, "signed"), -1, ""},
+		{`sign {
+			key file ` + ksk + `.private
+			directory /var/lib/coredns
+			nsec3
+		}`, false, []string{"example.org."}, 1, "/var/lib/coredns", 0, ""},
+		{`sign {
+			key file ` + zsk + `
+			nsec3 10 aabbccdd
+		}`, false, []string{"example.org."}, 1, dir, 10, "AABBCCDD"},
+		{`sign {
+			key file ` + zsk + `
+			nsec3 0 -
+		}`, false, []string{"example.org."}, 1, dir, 0, ""},
+		// negative
+		{`sign`, true, nil, 0, "", 0, ""},
+		{`sign {
+			key file
+		}`, true, nil, 0, "", 0, ""},
+		{`sign {
+			key ` + zsk + `
+		}`, true, nil, 0, "", 0, ""},
+		{`sign {
+			key file Kexample.org.+013+00000
+		}`, true, nil, 0, "", 0, ""},
+		{`sign {
+			key file ` + zsk + `
+			nsec3 151
+		}`, true, nil, 0, "", 0, ""},
+		{`sign {
+			key file ` + zsk + `
+			nsec3 1 xyz
+		}`, true, nil, 0, "", 0, ""},
+		{`sign {
+			key file ` + zsk + `
+			directory
+		}`, true, nil, 0, "", 0, ""},
+		{`sign {
+			key file ` + zsk + `
+			nsec
+		}`, true, nil, 0, "", 0, ""},
+		{`sign {
+			key file ` + zsk + `
+		}
+		sign {
+			key file ` + zsk + `
+		}`, true, nil, 0, "", 0, ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		c.ServerBlockKeys = []string{"example.org"}
+		dnsserver.GetConfig(c).Root = dir
+		s, err := signParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if len(s.origins) != len(test.origins) {
+			t.Fatalf("Test %d: expected origins %v, got %v", i, test.origins, s.origins)
+		}
+		for j := range test.origins {
+			if s.origins[j] != test.origins[j] {
+				t.Errorf("Test %d: expected origin %s, got %s", i, test.origins[j], s.origins[j])
+			}
+		}
+		if len(s.keys) != test.keys {
+			t.Errorf("Test %d: expected %d keys, got %d", i, test.keys, len(s.keys))
+		}
+		if s.directory != test.directory {
+			t.Errorf("Test %d: expected directory %q, got %q", i, test.directory, s.directory)
+		}
+		if test.iterations < 0 {
+			if s.nsec3 != nil {
+				t.Errorf("Test %d: expected NSEC, got NSEC3", i)
+			}
+			continue
+		}
+		if s.nsec3 == nil {
+			t.Fatalf("Test %d: expected NSEC3, got NSEC", i)
+		}
+		if int(s.nsec3.Iterations) != test.iterations || s.nsec3.Salt != test.salt {
+			t.Errorf("Test %d: expected %d iterations and salt %q, got %d and %q", i, test.iterations, test.salt, s.nsec3.Iterations, s.nsec3.Salt)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package sign implements a plugin that DNSSEC signs the zones served by the file and auto plugins. The
+// signed zones are written to disk and served, and transferred, instead of the unsigned ones.
+package sign
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/auto"
+	"github.com/coredns/coredns/plugin/dnssec"
+	"github.com/coredns/coredns/plugin/file"
+
+	"github.com/miekg/dns"
+)
+
+// Sign signs zones and serves the signed versions.
+type Sign struct {
+	Next plugin.Handler
+
+	origins   []string         // the zones served by file and auto in these zones are signed
+	keys      []*dnssec.DNSKEY // the keys to sign with
+	directory string           // where the signed zones are written
+	nsec3     *dns.NSEC3PARAM  // parameters of the NSEC3 chain, nil for NSEC
+
+	sources func() []plugin.Handler // the handlers of the server block
+
+	mu     sync.RWMutex
+	signed map[string]*signed // signed zones, by name
+	zones  file.Zones         // the signed zones served, replaced on every change
+	names  []string           // the names of all zones served by the sources, signed or not
+
+	stop chan struct{}
+}
+
+// signed is a signed zone.
+type signed struct {
+	zone   *file.Zone
+	serial uint32    // the serial of the unsigned zone
+	resign time.Time // when the zone must be signed again
+}
+
+// New returns a new Sign signing the zones in origins with keys.
+func New(origins []string, keys []*dnssec.DNSKEY) *Sign {
+	return &Sign{
+		origins: origins,
+		keys:    keys,
+		signed:  map[string]*signed{},
+		stop:    make(chan struct{}),
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (s *Sign) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	// Updates and notifies are for the unsigned zones.
+	if r.Opcode == dns.OpcodeUpdate || r.Opcode == dns.OpcodeNotify || len(r.Question) == 0 {
+		return plugin.NextOrFailure(s.Name(), s.Next, ctx, w, r)
+	}
+
+	s.mu.RLock()
+	f := file.File{Next: s.Next, Zones: s.zones}
+	zone := plugin.Zones(s.names).Matches(r.Question[0].Name)
+	s.mu.RUnlock()
+
+	// A more specific zone may not be signed.
+	if _, ok := f.Zones.Z[zone]; !ok {
+		return plugin.NextOrFailure(s.Name(), s.Next, ctx, w, r)
+	}
+	return f.ServeDNS(ctx, w, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (s *Sign) Name() string { return "sign" }
+
+// OnShutdown stops signing the zones.
+func (s *Sign) OnShutdown() error {
+	close(s.stop)
+	return nil
+}
+
+// run signs the zones when they change, or their signatures need refreshing, until s is shut down.
+func (s *Sign) run() {
+	tick := time.NewTicker(checkInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			s.check(time.Now().UTC())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// check signs the zones served by the sources that weren't signed yet, whose serial changed, or whose
+// signatures are due to be refreshed. Signed zones that are no longer served are dropped.
+func (s *Sign) check(now time.Time) {
+	unsigned := s.unsigned()
+
+	for origin, z := range unsigned {
+		serial := z.SOASerialIfDefined()
+		if serial < 0 {
+			continue // A secondary zone that wasn't transferred yet.
+		}
+
+		s.mu.RLock()
+		prev := s.signed[origin]
+		s.mu.RUnlock()
+		if prev != nil && prev.serial == uint32(serial) && now.Before(prev.resign) {
+			continue
+		}
+
+		sz, err := s.sign(z, prev, now)
+		if err != nil {
+			log.Errorf("Failed to sign zone %s: %s", origin, err)
+			continue
+		}
+
+		s.mu.Lock()
+		s.signed[origin] = sz
+		s.mu.Unlock()
+
+		log.Infof("Signed zone %s with serial %d, signatures valid until %s", origin, sz.zone.Apex.SOA.Serial, now.Add(validity).Format(time.RFC3339))
+		if err := sz.zone.WriteFile("signing"); err != nil {
+			log.Errorf("Failed to write signed zone %s to %q: %s", origin, sz.zone.File(), err)
+		}
+		if prev != nil {
+			sz.zone.Notify()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(unsigned))
+	for origin := range unsigned {
+		names = append(names, origin)
+	}
+	s.names = names
+	z := make(map[string]*file.Zone, len(s.signed))
+	signedNames := make([]string, 0, len(s.signed))
+	for origin, sz := range s.signed {
+		if _, ok := unsigned[origin]; !ok {
+			delete(s.signed, origin)
+			continue
+		}
+		z[origin] = sz.zone
+		signedNames = append(signedNames, origin)
+	}
+	s.zones = file.Zones{Z: z, Names: signedNames}
+}
+
+// unsigned returns the zones served by the file and auto plugins, that are to be signed.
+func (s *Sign) unsigned() map[string]*file.Zone {
+	zones := map[string]*file.Zone{}
+	add := func(name string, z *file.Zone) {
+		if z != nil && plugin.Zones(s.origins).Matches(name) != "" {
+			zones[name] = z
+		}
+	}
+	for _, h := range s.sources() {
+		switch x := h.(type) {
+		case file.File:
+			for _, name := range x.Zones.Names {
+				add(name, x.Zones.Z[name])
+			}
+		case auto.Auto:
+			for _, name := range x.Zones.Names() {
+				add(name, x.Zones.Zones(name))
+			}
+		}
+	}
+	return zones
+}
+
+const (
+	checkInterval = time.Minute
+	validity      = 4 * 7 * 24 * time.Hour // signatures are valid for 4 weeks
+	resignAfter   = 7 * 24 * time.Hour     // and refreshed after a week
+)
@@ -0,0 +1,255 @@
+package sign
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/dnssec"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const unsignedZone = `$ORIGIN example.org.
+@	3600	IN	SOA	ns.example.org. hostmaster.example.org. 10 7200 3600 1209600 300
+	3600	IN	NS	ns
+	3600	IN	MX	10 mail
+ns	3600	IN	A	127.0.0.1
+mail	3600	IN	A	127.0.0.2
+a.b	3600	IN	TXT	"empty non-terminal above"
+*.w	3600	IN	TXT	"wildcard"
+sub	3600	IN	NS	ns.sub
+	3600	IN	DS	12345 13 2 0F7EED52FC1CE9B1F6E68ADCCDB6B6A6C63C93B6B6D2B1A0E4E4CAF5E1B8E6A2
+ns.sub	3600	IN	A	127.0.0.3
+insecure	3600	IN	NS	ns.insecure
+ns.insecure	3600	IN	A	127.0.0.4
+`
+
+// newSign returns a Sign for a file plugin serving unsignedZone, signing with a KSK and a ZSK.
+func newSign(t *testing.T, dir string) (*Sign, *file.Zone) {
+	z, err := file.Parse(strings.NewReader(unsignedZone), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	keys, err := dnssec.ParseKeyFiles(dir, []string{newKey(t, dir, 257), newKey(t, dir, 256)})
+	if err != nil {
+		t.Fatalf("Failed to read keys: %s", err)
+	}
+	f := file.File{Zones: file.Zones{Z: map[string]*file.Zone{"example.org.": z}, Names: []string{"example.org."}}}
+	s := New([]string{"example.org."}, keys)
+	s.directory = dir
+	s.sources = func() []plugin.Handler { return []plugin.Handler{f} }
+	s.Next = f
+	return s, z
+}
+
+func TestSign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, _ := newSign(t, dir)
+
+	now := time.Now().UTC()
+	s.check(now)
+	sz, ok := s.signed["example.org."]
+	if !ok {
+		t.Fatal("Expected example.org. to be signed")
+	}
+	rrs := sz.zone.All()
+
+	keys := map[uint16]*dns.DNSKEY{}
+	sets := map[string][]dns.RR{}
+	sigs := []*dns.RRSIG{}
+	nsecs := map[string]*dns.NSEC{}
+	for _, rr := range rrs {
+		switch x := rr.(type) {
+		case *dns.RRSIG:
+			sigs = append(sigs, x)
+			continue
+		case *dns.DNSKEY:
+			keys[x.KeyTag()] = x
+		case *dns.NSEC:
+			nsecs[x.Hdr.Name] = x
+		}
+		k := rr.Header().Name + "/" + dns.TypeToString[rr.Header().Rrtype]
+		sets[k] = append(sets[k], rr)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 DNSKEYs, got %d", len(keys))
+	}
+
+	signed := map[string]bool{}
+	for _, sig := range sigs {
+		k := sig.Hdr.Name + "/" + dns.TypeToString[sig.TypeCovered]
+		if err := sig.Verify(keys[sig.KeyTag], sets[k]); err != nil {
+			t.Errorf("Expected signature over %s to verify: %s", k, err)
+		}
+		if !sig.ValidityPeriod(now) {
+			t.Errorf("Expected signature over %s to be valid now", k)
+		}
+		if sig.TypeCovered == dns.TypeDNSKEY && keys[sig.KeyTag].Flags != 257 {
+			t.Errorf("Expected the DNSKEY RRset to be signed by the KSK")
+		}
+		if sig.TypeCovered != dns.TypeDNSKEY && keys[sig.KeyTag].Flags != 256 {
+			t.Errorf("Expected %s to be signed by the ZSK", k)
+		}
+		signed[k] = true
+	}
+
+	for _, k := range []string{"example.org./SOA", "example.org./NS", "example.org./MX", "example.org./DNSKEY", "example.org./NSEC",
+		"ns.example.org./A", "a.b.example.org./TXT", "*.w.example.org./TXT", "sub.example.org./DS", "sub.example.org./NSEC", "insecure.example.org./NSEC"} {
+		if !signed[k] {
+			t.Errorf("Expected %s to be signed", k)
+		}
+	}
+	// Delegations and glue are not signed.
+	for _, k := range []string{"sub.example.org./NS", "ns.sub.example.org./A", "insecure.example.org./NS", "ns.insecure.example.org./A"} {
+		if signed[k] {
+			t.Errorf("Expected %s not to be signed", k)
+		}
+	}
+
+	// The NSEC chain links all authoritative names and wraps around.
+	chain := []string{"example.org.", "a.b.example.org.", "insecure.example.org.", "mail.example.org.", "ns.example.org.", "sub.example.org.", "*.w.example.org."}
+	if len(nsecs) != len(chain) {
+		t.Errorf("Expected %d NSEC records, got %d", len(chain), len(nsecs))
+	}
+	for i, name := range chain {
+		nsec, ok := nsecs[name]
+		if !ok {
+			t.Errorf("Expected an NSEC record for %s", name)
+			continue
+		}
+		if next := chain[(i+1)%len(chain)]; nsec.NextDomain != next {
+			t.Errorf("Expected the NSEC record of %s to point to %s, got %s", name, next, nsec.NextDomain)
+		}
+		if nsec.Hdr.Ttl != 300 {
+			t.Errorf("Expected the NSEC TTL to be the SOA minimum, got %d", nsec.Hdr.Ttl)
+		}
+	}
+
+	// The signed zone is written to disk.
+	if _, err := os.Stat(filepath.Join(dir, "db.example.org.signed")); err != nil {
+		t.Errorf("Expected the signed zone to be written: %s", err)
+	}
+}
+
+func TestSignResign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, z := newSign(t, dir)
+
+	now := time.Now().UTC()
+	s.check(now)
+	first := s.signed["example.org."].zone
+	if serial := first.Apex.SOA.Serial; serial != 10 {
+		t.Errorf("Expected the serial of the unsigned zone, got %d", serial)
+	}
+
+	// Nothing changed.
+	s.check(now.Add(time.Hour))
+	if s.signed["example.org."].zone != first {
+		t.Errorf("Expected the zone not to be signed again")
+	}
+
+	// The signatures are refreshed, the serial must increase.
+	s.check(now.Add(resignAfter + time.Hour))
+	second := s.signed["example.org."].zone
+	if second == first {
+		t.Fatalf("Expected the zone to be signed again")
+	}
+	if serial := second.Apex.SOA.Serial; serial != 11 {
+		t.Errorf("Expected serial 11, got %d", serial)
+	}
+
+	// The unsigned zone changed.
+	z.Apex.SOA.Serial = 20
+	s.check(now.Add(resignAfter + 2*time.Hour))
+	if serial := s.signed["example.org."].zone.Apex.SOA.Serial; serial != 20 {
+		t.Errorf("Expected serial 20, got %d", serial)
+	}
+
+	// After a restart, the serial continues from the one on disk.
+	z.Apex.SOA.Serial = 10
+	s1 := New(s.origins, s.keys)
+	s1.directory, s1.sources = dir, s.sources
+	s1.check(now)
+	if serial := s1.signed["example.org."].zone.Apex.SOA.Serial; serial != 21 {
+		t.Errorf("Expected serial 21, got %d", serial)
+	}
+
+	// The zone is no longer served.
+	s1.sources = func() []plugin.Handler { return nil }
+	s1.check(now)
+	if len(s1.signed) != 0 || len(s1.zones.Names) != 0 {
+		t.Errorf("Expected no signed zones, got %v", s1.zones.Names)
+	}
+}
+
+func TestSignServeNSEC3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, _ := newSign(t, dir)
+	s.nsec3 = &dns.NSEC3PARAM{Hash: dns.SHA1, Iterations: 1, Salt: "AABB", SaltLength: 2}
+	s.check(time.Now().UTC())
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int
+		match string // the name an NSEC3 record must match
+	}{
+		{"x.example.org.", dns.TypeA, dns.RcodeNameError, "example.org."},
+		{"b.example.org.", dns.TypeA, dns.RcodeSuccess, "b.example.org."},
+		{"insecure.example.org.", dns.TypeDS, dns.RcodeSuccess, "insecure.example.org."},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := s.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, rec.Msg.Rcode)
+		}
+		found := false
+		for _, rr := range rec.Msg.Ns {
+			if x, ok := rr.(*dns.NSEC3); ok && x.Match(tc.match) {
+				found = true
+				if !hasType(x.TypeBitMap, dns.TypeRRSIG) && tc.qtype != dns.TypeDS && tc.match != "b.example.org." {
+					t.Errorf("Test %d: expected RRSIG in the type bitmap", i)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Test %d: expected an NSEC3 record matching %s", i, tc.match)
+		}
+	}
+
+	// Updates go to the unsigned zone.
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	s.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg == nil || rec.Msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected the update to be refused by the unsigned zone")
+	}
+}
@@ -0,0 +1,234 @@
+package sign
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/dnssec"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/file/tree"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+
+	"github.com/miekg/dns"
+)
+
+// sign returns the signed version of the unsigned zone z. The serial of the signed zone is that of z,
+// unless a previous version, prev or the one on disk, had a serial that isn't older: then that one is
+// incremented, so secondaries see the new signatures.
+func (s *Sign) sign(z *file.Zone, prev *signed, now time.Time) (*signed, error) {
+	rrs := []dns.RR{}
+	for _, rr := range z.All() {
+		if !dnssecType(rr.Header().Rrtype) {
+			rrs = append(rrs, dns.Copy(rr))
+		}
+	}
+	soa := rrs[0].(*dns.SOA)
+	unsignedSerial := soa.Serial
+	origin := soa.Hdr.Name
+	name := filepath.Join(s.directory, fileName(origin))
+
+	last, ok := int64(-1), false
+	if prev != nil {
+		last, ok = int64(prev.zone.Apex.SOA.Serial), true
+	} else if serial, err := fileSerial(name, origin); err == nil {
+		last, ok = serial, true
+	}
+	if ok && !dnsutil.SerialNewer(soa.Serial, uint32(last)) {
+		soa.Serial = uint32(last) + 1
+	}
+
+	for _, k := range s.keys {
+		key := dns.Copy(k.K).(*dns.DNSKEY)
+		key.Hdr.Name = origin
+		rrs = append(rrs, key)
+	}
+	if s.nsec3 != nil {
+		param := dns.Copy(s.nsec3).(*dns.NSEC3PARAM)
+		param.Hdr = dns.RR_Header{Name: origin, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: 0}
+		rrs = append(rrs, param)
+	}
+
+	// The tree sorts the names in canonical order.
+	t := &tree.Tree{}
+	for _, rr := range rrs {
+		t.Insert(rr)
+	}
+	names := authoritative(origin, t.All())
+
+	ttl := soa.Hdr.Ttl
+	if soa.Minttl < ttl {
+		ttl = soa.Minttl
+	}
+	if s.nsec3 != nil {
+		rrs = append(rrs, nsec3Chain(origin, names, s.nsec3, ttl)...)
+	} else {
+		rrs = append(rrs, nsecChain(origin, names, ttl)...)
+	}
+
+	incep, expir := uint32(now.Add(-3*time.Hour).Unix()), uint32(now.Add(validity).Unix())
+	sigs := []dns.RR{}
+	for _, set := range rrSets(rrs, names) {
+		for _, k := range s.signers(set[0].Header().Rrtype) {
+			sig, err := k.Sign(set, origin, incep, expir)
+			if err != nil {
+				return nil, err
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+
+	sz := file.NewZone(origin, name)
+	sz.TransferTo = z.TransferTo
+	sz.TransferKeys = z.TransferKeys
+	for _, rr := range append(rrs, sigs...) {
+		if err := sz.Insert(rr); err != nil {
+			return nil, err
+		}
+	}
+	return &signed{zone: sz, serial: unsignedSerial, resign: now.Add(resignAfter)}, nil
+}
+
+// signers returns the keys that sign RRsets of type t. When there are both KSKs and ZSKs, the KSKs sign
+// the DNSKEY RRset and the ZSKs everything else, otherwise all keys sign everything.
+func (s *Sign) signers(t uint16) []*dnssec.DNSKEY {
+	ksks, zsks := []*dnssec.DNSKEY{}, []*dnssec.DNSKEY{}
+	for _, k := range s.keys {
+		if k.IsKSK() {
+			ksks = append(ksks, k)
+		} else if k.IsZSK() {
+			zsks = append(zsks, k)
+		}
+	}
+	if len(ksks) == 0 || len(zsks) == 0 {
+		return s.keys
+	}
+	if t == dns.TypeDNSKEY {
+		return ksks
+	}
+	return zsks
+}
+
+// owner is an authoritative name in a zone, with the types that exist there.
+type owner struct {
+	name  string
+	types []uint16
+	cut   bool // a delegation: only the DS RRset is signed
+}
+
+// authoritative returns the authoritative names in elems, the ones at or above zone cuts. Names below a
+// zone cut, i.e. glue, are not signed and not part of the NSEC(3) chain. The apex comes first.
+func authoritative(origin string, elems []*tree.Elem) []owner {
+	names := []owner{}
+	cut := ""
+	for _, e := range elems {
+		n := e.Name()
+		if cut != "" && dns.IsSubDomain(cut, n) {
+			continue
+		}
+		types := []uint16{}
+		isCut := false
+		for _, rr := range e.All() {
+			t := rr.Header().Rrtype
+			if !hasType(types, t) {
+				types = append(types, t)
+			}
+			if t == dns.TypeNS && n != origin {
+				isCut = true
+			}
+		}
+		if isCut {
+			cut = n
+		}
+		names = append(names, owner{name: n, types: types, cut: isCut})
+	}
+	return names
+}
+
+// rrSets returns the RRsets in rrs that are signed: those at authoritative names, except the NS RRset at
+// a delegation.
+func rrSets(rrs []dns.RR, names []owner) [][]dns.RR {
+	auth := map[string]bool{}
+	for _, n := range names {
+		auth[n.name] = !n.cut
+	}
+
+	type key struct {
+		name string
+		t    uint16
+	}
+	sets := map[key][]dns.RR{}
+	order := []key{}
+	for _, rr := range rrs {
+		h := rr.Header()
+		k := key{strings.ToLower(h.Name), h.Rrtype}
+		// NSEC3 records live at hashed names, all of them are signed.
+		if h.Rrtype != dns.TypeNSEC3 {
+			full, ok := auth[k.name]
+			if !ok {
+				continue
+			}
+			if !full && h.Rrtype != dns.TypeDS && h.Rrtype != dns.TypeNSEC {
+				continue
+			}
+		}
+		if _, ok := sets[k]; !ok {
+			order = append(order, k)
+		}
+		sets[k] = append(sets[k], rr)
+	}
+
+	rrsets := make([][]dns.RR, len(order))
+	for i, k := range order {
+		rrsets[i] = sets[k]
+	}
+	return rrsets
+}
+
+// dnssecType returns true for the types the signer adds. These are removed from the unsigned zone.
+func dnssecType(t uint16) bool {
+	switch t {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM, dns.TypeDNSKEY:
+		return true
+	}
+	return false
+}
+
+func hasType(types []uint16, t uint16) bool {
+	for _, x := range types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// fileSerial returns the SOA serial of the zone origin written to the file name.
+func fileSerial(name, origin string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+	zp := dns.NewZoneParser(f, origin, name)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return int64(soa.Serial), nil
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return -1, err
+	}
+	return -1, fmt.Errorf("file %q has no SOA record", name)
+}
+
+// fileName returns the name of the file the signed zone origin is written to: "db." followed by the
+// origin without the trailing dot, and ".signed".
+func fileName(origin string) string {
+	if origin == "." {
+		return "db.root.signed"
+	}
+	return "db." + strings.TrimSuffix(origin, ".") + ".signed"
+}
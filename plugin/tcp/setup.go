@@ -0,0 +1,96 @@
+// Package tcp configures the TCP and TLS connections of a server block.
+package tcp
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("tcp", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	if err := parse(c); err != nil {
+		return plugin.Error("tcp", err)
+	}
+	return nil
+}
+
+func parse(c *caddy.Controller) error {
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return plugin.ErrOnce
+		}
+		i++
+		if len(c.RemainingArgs()) != 0 {
+			return c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "idle_timeout":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return c.Errf("invalid duration %q: %v", args[0], err)
+				}
+				if d < 100*time.Millisecond {
+					return c.Errf("idle_timeout must be at least 100ms: %s", d)
+				}
+				config.TCPIdleTimeout = d
+
+			case "max_queries":
+				n, err := parseNumber(c)
+				if err != nil {
+					return err
+				}
+				if n == 0 {
+					n = -1 // no limit
+				}
+				config.TCPMaxQueries = n
+
+			case "max_pipeline":
+				n, err := parseNumber(c)
+				if err != nil {
+					return err
+				}
+				if n == 0 {
+					return c.Err("max_pipeline must be at least 1")
+				}
+				config.TCPMaxPipeline = n
+
+			default:
+				return c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// parseNumber parses the single, non-negative, number argument of the current property.
+func parseNumber(c *caddy.Controller) (int, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, c.Errf("invalid number %q", args[0])
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package tcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		idle        time.Duration
+		maxQueries  int
+		maxPipeline int
+	}{
+		// positive
+		{`tcp`, false, 0, 0, 0},
+		{`tcp {
+			idle_timeout 30s
+			max_queries 1000
+			max_pipeline 16
+		}`, false, 30 * time.Second, 1000, 16},
+		{`tcp {
+			max_queries 0
+		}`, false, 0, -1, 0},
+		// negative
+		{`tcp 30s`, true, 0, 0, 0},
+		{`tcp {
+			idle_timeout
+		}`, true, 0, 0, 0},
+		{`tcp {
+			idle_timeout 10
+		}`, true, 0, 0, 0},
+		{`tcp {
+			idle_timeout 10ms
+		}`, true, 0, 0, 0},
+		{`tcp {
+			max_queries -1
+		}`, true, 0, 0, 0},
+		{`tcp {
+			max_queries 1 2
+		}`, true, 0, 0, 0},
+		{`tcp {
+			max_pipeline 0
+		}`, true, 0, 0, 0},
+		{`tcp {
+			max_pipeline many
+		}`, true, 0, 0, 0},
+		{`tcp {
+			blah
+		}`, true, 0, 0, 0},
+		{"tcp\ntcp", true, 0, 0, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found one for input %s: %v", i, test.input, err)
+			continue
+		}
+
+		cfg := dnsserver.GetConfig(c)
+		if cfg.TCPIdleTimeout != test.idle {
+			t.Errorf("Test %d: Expected idle timeout %s, got %s", i, test.idle, cfg.TCPIdleTimeout)
+		}
+		if cfg.TCPMaxQueries != test.maxQueries {
+			t.Errorf("Test %d: Expected max queries %d, got %d", i, test.maxQueries, cfg.TCPMaxQueries)
+		}
+		if cfg.TCPMaxPipeline != test.maxPipeline {
+			t.Errorf("Test %d: Expected max pipeline %d, got %d", i, test.maxPipeline, cfg.TCPMaxPipeline)
+		}
+	}
+}
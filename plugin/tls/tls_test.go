@@ -1,27 +1,48 @@
 package tls
 
 import (
+	"crypto/tls"
 	"strings"
 	"testing"
 
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/test"
+
 	"github.com/mholt/caddy"
 )
 
 func TestTLS(t *testing.T) {
+	tmpdir, rmFunc, err := test.WritePEMFiles("")
+	if err != nil {
+		t.Fatalf("Could not write PEM files: %s", err)
+	}
+	defer rmFunc()
+
 	tests := []struct {
 		input              string
 		shouldErr          bool
-		expectedRoot       string // expected root, set to the controller. Empty for negative cases.
+		expectedClientAuth tls.ClientAuthType
 		expectedErrContent string // substring from the expected error. Empty for positive cases.
 	}{
 		// positive
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem", false, tls.NoClientCert, ""},
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem {\n client_auth nocert\n}", false, tls.NoClientCert, ""},
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem {\n client_auth request\n}", false, tls.RequestClientCert, ""},
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem {\n client_auth require\n}", false, tls.RequireAnyClientCert, ""},
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem {\n client_auth verify_if_given\n}", false, tls.VerifyClientCertIfGiven, ""},
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem {\n client_auth require_and_verify\n}", false, tls.RequireAndVerifyClientCert, ""},
 		// negative
+		{"tls", true, tls.NoClientCert, "Wrong argument count"},
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem {\n client_auth\n}", true, tls.NoClientCert, "Wrong argument count"},
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem {\n client_auth none\n}", true, tls.NoClientCert, "unknown authentication type"},
+		{"tls " + tmpdir + "/cert.pem " + tmpdir + "/key.pem " + tmpdir + "/ca.pem {\n blah\n}", true, tls.NoClientCert, "unknown option"},
+		{"tls " + tmpdir + "/nonexistent.pem " + tmpdir + "/key.pem", true, tls.NoClientCert, "could not load TLS cert"},
 	}
 
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.input)
 		err := setup(c)
-		//cfg := dnsserver.GetConfig(c)
+		cfg := dnsserver.GetConfig(c)
 
 		if test.shouldErr && err == nil {
 			t.Errorf("Test %d: Expected error but found %s for input %s", i, err, test.input)
@@ -35,6 +56,14 @@ func TestTLS(t *testing.T) {
 			if !strings.Contains(err.Error(), test.expectedErrContent) {
 				t.Errorf("Test %d: Expected error to contain: %v, found error: %v, input: %s", i, test.expectedErrContent, err, test.input)
 			}
+			continue
+		}
+
+		if cfg.TLSConfig.ClientAuth != test.expectedClientAuth {
+			t.Errorf("Test %d: Expected client auth %v, got %v", i, test.expectedClientAuth, cfg.TLSConfig.ClientAuth)
+		}
+		if cfg.TLSConfig.ClientCAs == nil {
+			t.Errorf("Test %d: Expected ClientCAs to be set", i)
 		}
 	}
 }
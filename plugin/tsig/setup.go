@@ -0,0 +1,70 @@
+// Package tsig declares the TSIG keys of a server block.
+package tsig
+
+import (
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("tsig", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	if err := parse(c); err != nil {
+		return plugin.Error("tsig", err)
+	}
+	return nil
+}
+
+func parse(c *caddy.Controller) error {
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return plugin.ErrOnce
+		}
+		i++
+		if len(c.RemainingArgs()) != 0 {
+			return c.ArgErr()
+		}
+
+		keys := tsig.Keys{}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "key":
+				args := c.RemainingArgs()
+				if len(args) != 2 && len(args) != 3 {
+					return c.ArgErr()
+				}
+				alg := ""
+				if len(args) == 3 {
+					alg = args[2]
+				}
+				k, err := tsig.NewKey(args[0], alg, args[1])
+				if err != nil {
+					return c.Err(err.Error())
+				}
+				if _, ok := keys[k.Name]; ok {
+					return c.Errf("TSIG key %q is declared twice", k.Name)
+				}
+				keys[k.Name] = k
+
+			default:
+				return c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+		if len(keys) == 0 {
+			return c.Err("no TSIG keys declared")
+		}
+		config.TsigKeys = keys
+	}
+	return nil
+}
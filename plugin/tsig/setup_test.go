@@ -0,0 +1,78 @@
+package tsig
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/mholt/caddy"
+	"github.com/miekg/dns"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		keys      map[string]string // key name to algorithm
+	}{
+		// positive
+		{`tsig {
+			key xfr.example.org c2VjcmV0
+		}`, false, map[string]string{"xfr.example.org.": dns.HmacSHA256}},
+		{`tsig {
+			key xfr.example.org. c2VjcmV0 hmac-sha512
+			key update.example.org. c2VjcmV0 hmac-sha1
+		}`, false, map[string]string{"xfr.example.org.": dns.HmacSHA512, "update.example.org.": dns.HmacSHA1}},
+		// negative
+		{`tsig`, true, nil},
+		{`tsig key {
+			key xfr.example.org c2VjcmV0
+		}`, true, nil},
+		{`tsig {
+			key xfr.example.org
+		}`, true, nil},
+		{`tsig {
+			key xfr.example.org c2VjcmV0 hmac-sha3
+		}`, true, nil},
+		{`tsig {
+			key xfr.example.org secret!
+		}`, true, nil},
+		{`tsig {
+			key xfr.example.org c2VjcmV0
+			key XFR.example.org. c2VjcmV0
+		}`, true, nil},
+		{`tsig {
+			secret xfr.example.org c2VjcmV0
+		}`, true, nil},
+		{`tsig {
+			key xfr.example.org c2VjcmV0
+		}
+		tsig {
+			key update.example.org c2VjcmV0
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		keys := dnsserver.GetConfig(c).TsigKeys
+		if len(keys) != len(test.keys) {
+			t.Errorf("Test %d: expected %d keys, got %d", i, len(test.keys), len(keys))
+		}
+		for name, alg := range test.keys {
+			if keys[name].Algorithm != alg {
+				t.Errorf("Test %d: expected key %q with algorithm %q, got %q", i, name, alg, keys[name].Algorithm)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package view
+
+import (
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("view", caddy.Plugin{
+		ServerType: "dns",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	cfg := dnsserver.GetConfig(c)
+	if cfg.ViewName != "" {
+		return plugin.Error("view", c.Errf("view already defined for this server block: %s", cfg.ViewName))
+	}
+
+	v, err := parse(c)
+	if err != nil {
+		return plugin.Error("view", err)
+	}
+
+	cfg.ViewName = v.viewName
+	cfg.FilterFuncs = append(cfg.FilterFuncs, v.Filter)
+
+	cfg.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		v.Next = next
+		return v
+	})
+
+	if v.usesMetadata {
+		c.OnStartup(func() error {
+			for _, h := range cfg.Handlers() {
+				// Skip ourselves, we only provide the view name.
+				if p, ok := h.(metadata.Provider); ok && h != plugin.Handler(v) {
+					v.providers = append(v.providers, p)
+				}
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+func parse(c *caddy.Controller) (*View, error) {
+	v := &View{}
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		v.viewName = args[0]
+
+		for c.NextBlock() {
+			switch strings.ToLower(c.Val()) {
+			case "net", "ecs":
+				typ := strings.ToLower(c.Val())
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				nets := make([]*net.IPNet, 0, len(args))
+				for _, a := range args {
+					n, err := pkgparse.Net(a)
+					if err != nil {
+						return nil, c.Errf("illegal CIDR notation %q", a)
+					}
+					nets = append(nets, n)
+				}
+				if typ == "net" {
+					v.conditions = append(v.conditions, matchNet(nets))
+				} else {
+					v.conditions = append(v.conditions, matchECS(nets))
+				}
+
+			case "tls":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				v.conditions = append(v.conditions, matchTLS(args))
+
+			case "metadata":
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return nil, c.ArgErr()
+				}
+				if !metadata.IsLabel(args[0]) {
+					return nil, c.Errf("invalid metadata label %q", args[0])
+				}
+				v.conditions = append(v.conditions, matchMetadata(args[0], args[1:]))
+				v.usesMetadata = true
+
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return v, nil
+}
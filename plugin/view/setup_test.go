@@ -0,0 +1,91 @@
+package view
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input      string
+		shouldErr  bool
+		name       string
+		conditions int
+	}{
+		// positive
+		{`view internal`, false, "internal", 0},
+		{`view internal {
+			net 10.0.0.0/8 192.168.1.1 2001:db8::/32
+		}`, false, "internal", 1},
+		{`view internal {
+			net 10.0.0.0/8
+			ecs 10.0.0.0/8
+			tls client.example.org
+			metadata acl/action allow
+		}`, false, "internal", 4},
+		// negative
+		{`view`, true, "", 0},
+		{`view a b`, true, "", 0},
+		{`view internal {
+			net
+		}`, true, "", 0},
+		{`view internal {
+			net 10.0.0.0/33
+		}`, true, "", 0},
+		{`view internal {
+			ecs blah
+		}`, true, "", 0},
+		{`view internal {
+			tls
+		}`, true, "", 0},
+		{`view internal {
+			metadata acl/action
+		}`, true, "", 0},
+		{`view internal {
+			metadata nolabel allow
+		}`, true, "", 0},
+		{`view internal {
+			blah 10.0.0.0/8
+		}`, true, "", 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		err := setup(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			continue
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: Expected no error but found one for input %s: %v", i, test.input, err)
+			}
+			continue
+		}
+
+		cfg := dnsserver.GetConfig(c)
+		if cfg.ViewName != test.name {
+			t.Errorf("Test %d: Expected view name %q, got %q", i, test.name, cfg.ViewName)
+		}
+		if len(cfg.FilterFuncs) != 1 {
+			t.Errorf("Test %d: Expected 1 filter func, got %d", i, len(cfg.FilterFuncs))
+		}
+		v := cfg.Plugin[0](nil).(*View)
+		if len(v.conditions) != test.conditions {
+			t.Errorf("Test %d: Expected %d conditions, got %d", i, test.conditions, len(v.conditions))
+		}
+	}
+}
+
+func TestSetupTwice(t *testing.T) {
+	c := caddy.NewTestController("dns", "view internal")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := setup(c); err == nil {
+		t.Errorf("Expected error when defining a second view in the same server block")
+	}
+}
@@ -0,0 +1,157 @@
+// Package view implements split-horizon DNS: multiple server blocks for the same zone and port
+// that are selected by properties of the client.
+package view
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// View is a plugin that enables configuring expressions that determine whether the server block
+// is used for a query. It is a passthrough plugin in the chain, but provides the view/name metadata.
+type View struct {
+	viewName string
+	// conditions must all match for the view to be selected. Within a condition any value may match.
+	conditions []condition
+	// providers are the metadata providers of the server block, used to evaluate metadata
+	// conditions before the plugin chain is called.
+	providers    []metadata.Provider
+	usesMetadata bool
+
+	Next plugin.Handler
+}
+
+// condition matches a single property of a request.
+type condition func(ctx context.Context, state *request.Request) bool
+
+// Filter implements dnsserver.FilterFunc. It returns true if all conditions of the view match.
+func (v *View) Filter(ctx context.Context, state *request.Request) bool {
+	if len(v.conditions) == 0 {
+		return true
+	}
+	if len(v.providers) > 0 {
+		ctx = metadata.ContextWithMetadata(ctx)
+		for _, p := range v.providers {
+			ctx = p.Metadata(ctx, *state)
+		}
+	}
+	for _, c := range v.conditions {
+		if !c(ctx, state) {
+			return false
+		}
+	}
+	return true
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (v *View) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (v *View) Name() string { return "view" }
+
+// Metadata implements the metadata.Provider interface.
+func (v *View) Metadata(ctx context.Context, state request.Request) context.Context {
+	metadata.SetValueFunc(ctx, "view/name", func() string { return v.viewName })
+	return ctx
+}
+
+// matchNet returns a condition that matches if the client's address is in one of nets.
+func matchNet(nets []*net.IPNet) condition {
+	return func(_ context.Context, state *request.Request) bool {
+		return contains(nets, net.ParseIP(state.IP()))
+	}
+}
+
+// matchECS returns a condition that matches if the request carries an EDNS Client Subnet option
+// whose address is in one of nets.
+func matchECS(nets []*net.IPNet) condition {
+	return func(_ context.Context, state *request.Request) bool {
+		opt := state.Req.IsEdns0()
+		if opt == nil {
+			return false
+		}
+		for _, o := range opt.Option {
+			if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+				return contains(nets, e.Address)
+			}
+		}
+		return false
+	}
+}
+
+// matchTLS returns a condition that matches if the client presented a verified certificate whose
+// common name or one of its DNS names is in names. A certificate that wasn't verified against the
+// client CAs could claim any name, so it never matches.
+func matchTLS(names []string) condition {
+	return func(_ context.Context, state *request.Request) bool {
+		cs := connectionState(state.W)
+		if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+			return false
+		}
+		cert := cs.VerifiedChains[0][0]
+		for _, n := range names {
+			if n == cert.Subject.CommonName {
+				return true
+			}
+			for _, d := range cert.DNSNames {
+				if n == d {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// matchMetadata returns a condition that matches if the value of the metadata label is one of values.
+func matchMetadata(label string, values []string) condition {
+	return func(ctx context.Context, _ *request.Request) bool {
+		f := metadata.ValueFunc(ctx, label)
+		if f == nil {
+			return false
+		}
+		val := f()
+		for _, v := range values {
+			if v == val {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// connectionState returns the TLS connection state of w, looking through the writers the server
+// wraps the original one in. It returns nil for connections that don't use TLS.
+func connectionState(w dns.ResponseWriter) *tls.ConnectionState {
+	for {
+		switch x := w.(type) {
+		case dns.ConnectionStater:
+			return x.ConnectionState()
+		case *request.ScrubWriter:
+			w = x.ResponseWriter
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package view
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestFilter(t *testing.T) {
+	_, internal, _ := net.ParseCIDR("10.240.0.0/16")
+	_, other, _ := net.ParseCIDR("192.0.2.0/24")
+
+	tests := []struct {
+		conditions []condition
+		ecs        net.IP
+		cn         string
+		expected   bool
+	}{
+		{nil, nil, "", true},
+		{[]condition{matchNet([]*net.IPNet{internal})}, nil, "", true},
+		{[]condition{matchNet([]*net.IPNet{other})}, nil, "", false},
+		{[]condition{matchNet([]*net.IPNet{other, internal})}, nil, "", true},
+		{[]condition{matchECS([]*net.IPNet{other})}, nil, "", false},
+		{[]condition{matchECS([]*net.IPNet{other})}, net.ParseIP("192.0.2.53"), "", true},
+		{[]condition{matchECS([]*net.IPNet{internal})}, net.ParseIP("192.0.2.53"), "", false},
+		{[]condition{matchTLS([]string{"client.example.org"})}, nil, "", false},
+		{[]condition{matchTLS([]string{"client.example.org"})}, nil, "client.example.org", true},
+		{[]condition{matchTLS([]string{"client.example.org"})}, nil, "other.example.org", false},
+		// All conditions must match.
+		{[]condition{matchNet([]*net.IPNet{internal}), matchECS([]*net.IPNet{other})}, nil, "", false},
+		{[]condition{matchNet([]*net.IPNet{internal}), matchECS([]*net.IPNet{other})}, net.ParseIP("192.0.2.53"), "", true},
+	}
+
+	for i, tc := range tests {
+		v := &View{viewName: "test", conditions: tc.conditions}
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		if tc.ecs != nil {
+			m.SetEdns0(4096, false)
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: tc.ecs})
+		}
+		var w dns.ResponseWriter = &test.ResponseWriter{}
+		if tc.cn != "" {
+			w = &tlsWriter{ResponseWriter: w, cn: tc.cn}
+		}
+		w = request.NewScrubWriter(m, w)
+
+		if got := v.Filter(context.TODO(), &request.Request{Req: m, W: w}); got != tc.expected {
+			t.Errorf("Test %d: expected %t, got %t", i, tc.expected, got)
+		}
+	}
+}
+
+func TestFilterUnverifiedTLS(t *testing.T) {
+	v := &View{viewName: "test", conditions: []condition{matchTLS([]string{"client.example.org"})}}
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	w := request.NewScrubWriter(m, &tlsWriter{ResponseWriter: &test.ResponseWriter{}, cn: "client.example.org", unverified: true})
+
+	if v.Filter(context.TODO(), &request.Request{Req: m, W: w}) {
+		t.Errorf("Expected an unverified certificate not to match")
+	}
+}
+
+func TestFilterMetadata(t *testing.T) {
+	v := &View{
+		viewName:   "test",
+		conditions: []condition{matchMetadata("test/label", []string{"a", "b"})},
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	state := &request.Request{Req: m, W: &test.ResponseWriter{}}
+
+	// Without providers the label doesn't exist and the condition can not match.
+	if v.Filter(context.TODO(), state) {
+		t.Errorf("Expected no match without metadata providers")
+	}
+
+	v.providers = []metadata.Provider{provider("b")}
+	if !v.Filter(context.TODO(), state) {
+		t.Errorf("Expected match for metadata value %q", "b")
+	}
+	v.providers = []metadata.Provider{provider("c")}
+	if v.Filter(context.TODO(), state) {
+		t.Errorf("Expected no match for metadata value %q", "c")
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	v := &View{viewName: "internal"}
+	ctx := metadata.ContextWithMetadata(context.TODO())
+	ctx = v.Metadata(ctx, request.Request{})
+	f := metadata.ValueFunc(ctx, "view/name")
+	if f == nil {
+		t.Fatal("Expected view/name metadata to be set")
+	}
+	if f() != "internal" {
+		t.Errorf("Expected view/name %q, got %q", "internal", f())
+	}
+}
+
+type provider string
+
+func (p provider) Metadata(ctx context.Context, state request.Request) context.Context {
+	metadata.SetValueFunc(ctx, "test/label", func() string { return string(p) })
+	return ctx
+}
+
+type tlsWriter struct {
+	dns.ResponseWriter
+	cn         string
+	unverified bool // the certificate wasn't verified against the client CAs
+}
+
+func (w *tlsWriter) ConnectionState() *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: w.cn}}
+	cs := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if !w.unverified {
+		cs.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return cs
+}
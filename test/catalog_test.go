@@ -0,0 +1,66 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestCatalogZone(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `.:0 {
+		file ` + name + ` example.org {
+			transfer to *
+		}
+		catalog catalog.example {
+			transfer to *
+		}
+	}
+`
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	corefile = `.:0 {
+		catalog catalog.example {
+			transfer from ` + tcp + `
+		}
+	}
+`
+	i1, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i1.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+
+	var r *dns.Msg
+	for j := 0; j < 50; j++ {
+		r, err = dns.Exchange(m, udp)
+		if err == nil && len(r.Answer) > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if len(r.Answer) == 0 {
+		t.Fatalf("Expected answer section")
+	}
+	if r.Answer[0].(*dns.SOA).Serial != 2015082541 {
+		t.Fatalf("Expected serial 2015082541, got %d", r.Answer[0].(*dns.SOA).Serial)
+	}
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestZoneUpdate(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `example.org:0 {
+	file ` + name + ` {
+		update 127.0.0.1 ::1
+	}
+}
+`
+	i, udp, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	for _, proto := range []string{"udp", "tcp"} {
+		addr := udp
+		if proto == "tcp" {
+			addr = tcp
+		}
+		c := &dns.Client{Net: proto}
+
+		host := proto + ".example.org."
+		rr, _ := dns.NewRR(host + " 300 IN A 192.0.2.10")
+		m := new(dns.Msg)
+		m.SetUpdate("example.org.")
+		m.NameNotUsed([]dns.RR{rr})
+		m.Insert([]dns.RR{rr})
+
+		resp, _, err := c.Exchange(m, addr)
+		if err != nil {
+			t.Fatalf("Expected to receive reply over %s, but didn't: %s", proto, err)
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			t.Fatalf("Expected update over %s to succeed, got %s", proto, dns.RcodeToString[resp.Rcode])
+		}
+
+		// Again, the name is now in use.
+		resp, _, err = c.Exchange(m, addr)
+		if err != nil {
+			t.Fatalf("Expected to receive reply over %s, but didn't: %s", proto, err)
+		}
+		if resp.Rcode != dns.RcodeYXDomain {
+			t.Errorf("Expected YXDOMAIN over %s, got %s", proto, dns.RcodeToString[resp.Rcode])
+		}
+
+		q := new(dns.Msg)
+		q.SetQuestion(host, dns.TypeA)
+		resp, _, err = c.Exchange(q, addr)
+		if err != nil {
+			t.Fatalf("Expected to receive reply over %s, but didn't: %s", proto, err)
+		}
+		if len(resp.Answer) != 1 {
+			t.Errorf("Expected the added record over %s, got %d answers", proto, len(resp.Answer))
+		}
+	}
+}
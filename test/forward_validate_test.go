@@ -0,0 +1,160 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// signedExampleOrg starts a server for example.org, signed with the test key, and returns its address
+// and the directory with the key.
+func signedExampleOrg(t *testing.T) (addr, dir string, stop func()) {
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _, err := test.TempFile(dir, exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	key := filepath.Join(dir, "Kexample.org.+013+45330")
+	if err := ioutil.WriteFile(key+".key", []byte(examplePub), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(key+".private", []byte(examplePriv), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	corefile := `example.org:0 {
+		file ` + name + `
+		sign {
+			key file ` + key + `
+			directory ` + dir + `
+		}
+	}
+`
+	i, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	return udp, dir, func() { i.Stop(); os.RemoveAll(dir) }
+}
+
+func TestForwardValidate(t *testing.T) {
+	upstream, dir, stop := signedExampleOrg(t)
+	defer stop()
+
+	anchor := filepath.Join(dir, "anchor")
+	if err := ioutil.WriteFile(anchor, []byte(examplePub), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	corefile := `example.org:0 {
+		forward . ` + upstream + ` {
+			validate
+			trust_anchor ` + anchor + `
+		}
+	}
+`
+	i, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	tests := []struct {
+		qname string
+		do    bool
+		rcode int
+	}{
+		{"example.org.", true, dns.RcodeSuccess},
+		{"example.org.", false, dns.RcodeSuccess},
+		{"nxdomain.example.org.", true, dns.RcodeNameError},
+	}
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		if tc.do {
+			m.SetEdns0(4096, true)
+		}
+		r, err := dns.Exchange(m, udp)
+		if err != nil {
+			t.Fatalf("Expected to receive reply, but didn't: %s", err)
+		}
+		if r.Rcode != tc.rcode {
+			t.Errorf("Expected rcode %d for %s, got %d", tc.rcode, tc.qname, r.Rcode)
+		}
+		if r.AuthenticatedData != tc.do {
+			t.Errorf("Expected AD %t for %s with DO %t", tc.do, tc.qname, tc.do)
+		}
+		sigs := len(signatures(r.Answer)) + len(signatures(r.Ns))
+		if tc.do && sigs == 0 {
+			t.Errorf("Expected signatures for %s with DO", tc.qname)
+		}
+		if !tc.do && sigs > 0 {
+			t.Errorf("Expected no signatures for %s without DO, got %d", tc.qname, sigs)
+		}
+	}
+}
+
+func TestForwardValidateBogus(t *testing.T) {
+	upstream, dir, stop := signedExampleOrg(t)
+	defer stop()
+
+	// A trust anchor with another key: everything in example.org is bogus.
+	anchor := filepath.Join(dir, "anchor")
+	other := strings.Replace(examplePub, "eNMYFZYb6e0oJOV47IPo5f", "AAAAAAAAAAAAAAAAAAAAAA", 1)
+	if err := ioutil.WriteFile(anchor, []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	corefile := `example.org:0 {
+		forward . ` + upstream + ` {
+			validate
+			trust_anchor ` + anchor + `
+		}
+	}
+`
+	i, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	r, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if r.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL for a bogus answer, got %d", r.Rcode)
+	}
+
+	// With CD set the client validates itself and gets the answer.
+	m.CheckingDisabled = true
+	r, err = dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) == 0 {
+		t.Errorf("Expected an answer with CD set, got rcode %d", r.Rcode)
+	}
+}
+
+func signatures(rrs []dns.RR) []dns.RR {
+	sigs := []dns.RR{}
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			sigs = append(sigs, rr)
+		}
+	}
+	return sigs
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const recursiveRoot = `; root zone
+.                 3600 IN SOA a.root.test. hostmaster.root.test. 1 7200 3600 1209600 3600
+.                 3600 IN NS  a.root.test.
+a.root.test.      3600 IN A   127.0.0.1
+example.org.      3600 IN NS  ns.example.org.
+ns.example.org.   3600 IN A   127.0.0.2
+`
+
+const recursiveExampleOrg = `; example.org zone
+example.org.      3600 IN SOA ns.example.org. hostmaster.example.org. 1 7200 3600 1209600 3600
+example.org.      3600 IN NS  ns.example.org.
+ns.example.org.   3600 IN A   127.0.0.2
+www.example.org.  3600 IN A   192.0.2.1
+`
+
+func TestRecursive(t *testing.T) {
+	// The name servers of the root and of example.org listen on the same port, on other addresses.
+	child, cleanup, err := test.TempFile(".", recursiveExampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer cleanup()
+	i, udp, _, err := CoreDNSServerAndPorts(`example.org:0 {
+		bind 127.0.0.2
+		file ` + child + `
+	}`)
+	if err != nil {
+		t.Skipf("Could not get CoreDNS serving instance on 127.0.0.2: %s", err)
+	}
+	defer i.Stop()
+	_, port, _ := net.SplitHostPort(udp)
+
+	root, cleanup, err := test.TempFile(".", recursiveRoot)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer cleanup()
+	r, err := CoreDNSServer(`.:` + port + ` {
+		bind 127.0.0.1
+		file ` + root + `
+	}`)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer r.Stop()
+
+	hints, cleanup, err := test.TempFile(".", ". 3600 IN NS a.root.test.\na.root.test. 3600 IN A 127.0.0.1\n")
+	if err != nil {
+		t.Fatalf("Failed to create root hints: %s", err)
+	}
+	defer cleanup()
+	rec, udp, _, err := CoreDNSServerAndPorts(`.:0 {
+		recursive {
+			root_hints ` + hints + `
+			port ` + port + `
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer rec.Stop()
+
+	tests := []struct {
+		qname  string
+		rcode  int
+		answer string
+	}{
+		{"www.example.org.", dns.RcodeSuccess, "www.example.org.\t3600\tIN\tA\t192.0.2.1"},
+		{"nxdomain.example.org.", dns.RcodeNameError, ""},
+	}
+	for _, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		resp, err := dns.Exchange(m, udp)
+		if err != nil {
+			t.Fatalf("Expected to receive reply, but didn't: %s", err)
+		}
+		if resp.Rcode != tc.rcode {
+			t.Errorf("Expected rcode %d for %s, got %d", tc.rcode, tc.qname, resp.Rcode)
+		}
+		if tc.answer == "" {
+			continue
+		}
+		if len(resp.Answer) != 1 || resp.Answer[0].String() != tc.answer {
+			t.Errorf("Expected answer %q for %s, got %v", tc.answer, tc.qname, resp.Answer)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/coredns/coredns/plugin/test"
 
@@ -78,3 +83,160 @@ func TestSecondaryZoneTransfer(t *testing.T) {
 		t.Fatalf("Expected answer section")
 	}
 }
+
+func TestSecondaryZoneTransferTsig(t *testing.T) {
+	// Enough records to need several messages, so the chaining of the signatures is tested.
+	zone := exampleOrg
+	for i := 0; i < 100; i++ {
+		zone += fmt.Sprintf("host%d IN A 192.0.2.%d\n", i, i)
+	}
+	name, rm, err := test.TempFile(".", zone)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	const (
+		keyName = "xfr.example.org."
+		secret  = "c2VjcmV0c2VjcmV0c2VjcmV0"
+	)
+	corefile := `example.org:0 {
+		tsig {
+			key ` + keyName + ` ` + secret + `
+		}
+		file ` + name + ` {
+			transfer to * key ` + keyName + `
+		}
+}
+`
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	// Unsigned and wrongly signed transfers are not allowed.
+	m := new(dns.Msg)
+	m.SetAxfr("example.org.")
+	if _, err := transfer(m, tcp, nil); err == nil {
+		t.Errorf("Expected unsigned transfer to fail")
+	}
+	m = new(dns.Msg)
+	m.SetAxfr("example.org.")
+	m.SetTsig(keyName, dns.HmacSHA256, 300, time.Now().Unix())
+	if _, err := transfer(m, tcp, map[string]string{keyName: "d3JvbmdzZWNyZXQ="}); err == nil {
+		t.Errorf("Expected transfer with wrong secret to fail")
+	}
+	m = new(dns.Msg)
+	m.SetAxfr("example.org.")
+	m.SetTsig(keyName, dns.HmacSHA256, 300, time.Now().Unix())
+	n, err := transfer(m, tcp, map[string]string{keyName: secret})
+	if err != nil {
+		t.Fatalf("Expected signed transfer to succeed, got: %s", err)
+	}
+	if n < 100 {
+		t.Errorf("Expected at least 100 records to be transferred, got %d", n)
+	}
+
+	corefile = `example.org:0 {
+		tsig {
+			key ` + keyName + ` ` + secret + `
+		}
+		secondary {
+			transfer from ` + tcp + ` key ` + keyName + `
+		}
+}
+`
+	i1, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i1.Stop()
+
+	m = new(dns.Msg)
+	m.SetQuestion("host99.example.org.", dns.TypeA)
+	r, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if len(r.Answer) == 0 {
+		t.Fatalf("Expected answer section")
+	}
+}
+
+// transfer does an AXFR of m from addr and returns the number of records transferred.
+func transfer(m *dns.Msg, addr string, secrets map[string]string) (int, error) {
+	tr := &dns.Transfer{TsigSecret: secrets}
+	c, err := tr.In(m, addr)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for env := range c {
+		if env.Error != nil {
+			return n, env.Error
+		}
+		n += len(env.RR)
+	}
+	return n, nil
+}
+
+func TestSecondaryZonePersist(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+	dir, err := ioutil.TempDir("", "secondary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	corefile := `example.org:0 {
+		file ` + name + ` {
+			transfer to *
+		}
+}
+`
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+
+	corefile = `example.org:0 {
+		root ` + dir + `
+		secondary {
+			transfer from ` + tcp + `
+			persist
+		}
+}
+`
+	i1, _, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	i1.Stop()
+	// The primary is gone when the secondary restarts.
+	i.Stop()
+
+	if _, err := os.Stat(filepath.Join(dir, "db.example.org")); err != nil {
+		t.Fatalf("Expected the zone to be written: %s", err)
+	}
+
+	i1, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i1.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+	r, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) == 0 {
+		t.Fatalf("Expected an answer from the persisted zone, got %s with %d records", dns.RcodeToString[r.Rcode], len(r.Answer))
+	}
+}
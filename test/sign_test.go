@@ -0,0 +1,87 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestSignZone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name, rm, err := test.TempFile(dir, exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	key := filepath.Join(dir, "Kexample.org.+013+45330")
+	if err := ioutil.WriteFile(key+".key", []byte(examplePub), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(key+".private", []byte(examplePriv), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	corefile := `example.org:0 {
+		file ` + name + `
+		sign {
+			key file ` + key + `
+			directory ` + dir + `
+		}
+	}
+`
+	i, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	r, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	sigs := 0
+	for _, rr := range r.Answer {
+		if _, ok := rr.(*dns.RRSIG); ok {
+			sigs++
+		}
+	}
+	if sigs != 1 {
+		t.Errorf("Expected 1 RRSIG in the answer, got %d", sigs)
+	}
+
+	m.SetQuestion("nxdomain.example.org.", dns.TypeA)
+	r, err = dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if r.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN, got %d", r.Rcode)
+	}
+	nsecs := 0
+	for _, rr := range r.Ns {
+		if _, ok := rr.(*dns.NSEC); ok {
+			nsecs++
+		}
+	}
+	if nsecs == 0 {
+		t.Errorf("Expected NSEC records in the authority section")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "db.example.org.signed")); err != nil {
+		t.Errorf("Expected the signed zone to be written: %s", err)
+	}
+}
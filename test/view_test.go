@@ -0,0 +1,50 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestView(t *testing.T) {
+	corefile := `example.org:0 {
+		view internal {
+			net 127.0.0.0/8 ::1
+		}
+		template IN A example.org {
+			answer "{{ .Name }} 60 IN A 10.0.0.1"
+		}
+	}
+	example.org:0 {
+		view other {
+			net 192.0.2.0/24
+		}
+		template IN A example.org {
+			answer "{{ .Name }} 60 IN A 192.0.2.2"
+		}
+	}
+	example.org:0 {
+		template IN A example.org {
+			answer "{{ .Name }} 60 IN A 192.0.2.1"
+		}
+	}
+`
+	i, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	r, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if len(r.Answer) != 1 {
+		t.Fatalf("Expected 1 answer, got %d", len(r.Answer))
+	}
+	if a := r.Answer[0].(*dns.A).A.String(); a != "10.0.0.1" {
+		t.Errorf("Expected answer from the internal view 10.0.0.1, got %s", a)
+	}
+}